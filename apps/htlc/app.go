@@ -0,0 +1,183 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package htlc implements the hash time-locked contract (HTLC) app and a
+// router that forwards conditional payments over multiple channels.
+package htlc // import "perun.network/go-perun/apps/htlc"
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
+)
+
+// numParts is the number of participants of an HTLC channel.
+const numParts = 2
+
+var _ channel.StateApp = (*App)(nil)
+
+// App is the HTLC app. An HTLC channel locks a payment from the sender to the
+// receiver. The payment is released to the receiver if the receiver reveals
+// the preimage of the hash lock before the timeout. Otherwise, the receiver
+// can refund the payment at any time, and the sender after the timeout, which
+// it can enforce on-chain by disputing the HTLC channel.
+type App struct {
+	Addr wallet.Address
+}
+
+// Def returns the address of this HTLC app.
+func (a *App) Def() wallet.Address {
+	return a.Addr
+}
+
+// NewData returns a new instance of data specific to the HTLC app,
+// intialized to its zero value.
+//
+// This should be used for unmarshalling the data from its binary
+// representation.
+func (a *App) NewData() channel.Data {
+	return new(Data)
+}
+
+// ValidInit checks that the payment is pending and that all funds are held by
+// the sender.
+func (a *App) ValidInit(_ *channel.Params, s *channel.State) error {
+	data, err := asData(s)
+	if err != nil {
+		return err
+	}
+	switch {
+	case s.NumParts() != numParts:
+		return channel.NewStateTransitionError(s.ID, fmt.Sprintf("expected %d participants, got %d", numParts, s.NumParts()))
+	case int(data.Receiver) >= numParts:
+		return channel.NewStateTransitionError(s.ID, "invalid receiver index")
+	case data.IsResolved():
+		return channel.NewStateTransitionError(s.ID, "preimage must not be revealed initially")
+	}
+	for i, asset := range s.Balances {
+		if asset[data.Receiver].Sign() != 0 {
+			return channel.NewStateTransitionError(s.ID, fmt.Sprintf("receiver must not hold funds of asset %d", i))
+		}
+	}
+	return nil
+}
+
+// ValidTransition checks that the pending payment is either claimed by
+// revealing the preimage before the timeout, or refunded by the receiver or,
+// after the timeout, by the sender. Both transitions finalize the channel.
+//
+// The timeout is checked against the local clock.
+func (a *App) ValidTransition(_ *channel.Params, from, to *channel.State, actor channel.Index) error {
+	fromData, err := asData(from)
+	if err != nil {
+		return err
+	}
+	toData, err := asData(to)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case fromData.IsResolved():
+		return channel.NewStateTransitionError(to.ID, "payment already resolved")
+	case fromData.Receiver != toData.Receiver, fromData.Hash != toData.Hash, fromData.Timeout != toData.Timeout:
+		return channel.NewStateTransitionError(to.ID, "payment terms must not change")
+	case !equalRoutes(fromData, toData):
+		return channel.NewStateTransitionError(to.ID, "route must not change")
+	case !to.IsFinal:
+		return channel.NewStateTransitionError(to.ID, "resolved payment must be final")
+	}
+
+	expired := fromData.expired(time.Now())
+	if toData.IsResolved() {
+		// Claim: the preimage is revealed and the funds go to the receiver.
+		if expired {
+			return channel.NewStateTransitionError(to.ID, "payment timed out")
+		}
+		if toData.Preimage.Hash() != fromData.Hash {
+			return channel.NewStateTransitionError(to.ID, "invalid preimage")
+		}
+		if err := to.Balances.AssertEqual(claimedBalances(from.Balances, toData)); err != nil {
+			return channel.NewStateTransitionError(to.ID, fmt.Sprintf("invalid claim balances: %v", err))
+		}
+		return nil
+	}
+
+	// Refund: the receiver can release the payment back to the sender at any
+	// time, the sender only after the timeout.
+	if actor != fromData.Receiver && !expired {
+		return channel.NewStateTransitionError(to.ID, "sender can only refund the payment after the timeout")
+	}
+	if err := to.Balances.AssertEqual(from.Balances); err != nil {
+		return channel.NewStateTransitionError(to.ID, fmt.Sprintf("invalid refund balances: %v", err))
+	}
+	return nil
+}
+
+// Claim reveals the preimage in the given state and moves the locked funds to
+// the receiver. It does not check the preimage.
+func Claim(s *channel.State, preimage Preimage) error {
+	data, err := asData(s)
+	if err != nil {
+		return err
+	}
+	data.Preimage = &preimage
+	s.Balances = claimedBalances(s.Balances, data)
+	s.IsFinal = true
+	return nil
+}
+
+// Refund releases the locked funds of the given state back to the sender.
+func Refund(s *channel.State) error {
+	if _, err := asData(s); err != nil {
+		return err
+	}
+	s.IsFinal = true
+	return nil
+}
+
+// claimedBalances returns the balances after all funds of the sender have
+// been moved to the receiver.
+func claimedBalances(bals channel.Balances, data *Data) channel.Balances {
+	claimed := bals.Clone()
+	for _, asset := range claimed {
+		asset[data.Receiver].Add(asset[data.Receiver], asset[data.sender()])
+		asset[data.sender()].SetInt64(0)
+	}
+	return claimed
+}
+
+func equalRoutes(a, b *Data) bool {
+	if len(a.Route) != len(b.Route) {
+		return false
+	}
+	for i := range a.Route {
+		if !a.Route[i].Equal(b.Route[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func asData(s *channel.State) (*Data, error) {
+	data, ok := s.Data.(*Data)
+	if !ok {
+		return nil, errors.Errorf("htlc app data must be *Data, is %T", s.Data)
+	}
+	return data, nil
+}
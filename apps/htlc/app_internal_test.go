@@ -0,0 +1,168 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htlc
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "perun.network/go-perun/backend/sim" // backend init
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/test"
+	wiretest "perun.network/go-perun/wire/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestData_Serialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for _, resolved := range []bool{false, true} {
+		data := newRandomData(rng, channel.Index(rng.Intn(numParts)))
+		if resolved {
+			data.Preimage = new(Preimage)
+			rng.Read(data.Preimage[:])
+		}
+
+		b, err := data.MarshalBinary()
+		require.NoError(t, err)
+		decoded := new(App).NewData()
+		require.NoError(t, decoded.UnmarshalBinary(b))
+		assert.Equal(t, data, decoded)
+
+		clone := data.Clone()
+		assert.Equal(t, data, clone)
+		if resolved {
+			assert.NotSame(t, data.Preimage, clone.(*Data).Preimage)
+		}
+	}
+}
+
+func TestApp_ValidInit(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	app := new(App)
+
+	s := newRandomState(rng, 1)
+	assert.NoError(t, app.ValidInit(nil, s))
+
+	wrongData := s.Clone()
+	wrongData.Data = channel.NoData()
+	assert.Error(t, app.ValidInit(nil, wrongData))
+
+	receiverFunded := s.Clone()
+	receiverFunded.Balances[0][1] = big.NewInt(1)
+	assert.Error(t, app.ValidInit(nil, receiverFunded))
+
+	resolved := s.Clone()
+	resolved.Data.(*Data).Preimage = new(Preimage)
+	assert.Error(t, app.ValidInit(nil, resolved))
+}
+
+func TestApp_ValidTransition(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	app := new(App)
+	const receiver, sender = channel.Index(1), channel.Index(0)
+
+	var preimage Preimage
+	rng.Read(preimage[:])
+	from := newRandomState(rng, receiver)
+	from.Data.(*Data).Hash = preimage.Hash()
+	from.Data.(*Data).Timeout = uint64(time.Now().Add(time.Hour).Unix())
+	expired := from.Clone()
+	expired.Data.(*Data).Timeout = uint64(time.Now().Unix())
+
+	claim := from.Clone()
+	require.NoError(t, Claim(claim, preimage))
+	refund := from.Clone()
+	require.NoError(t, Refund(refund))
+
+	t.Run("claim", func(t *testing.T) {
+		assert.NoError(t, app.ValidTransition(nil, from, claim, receiver))
+		assert.NoError(t, app.ValidTransition(nil, from, claim, sender))
+		assert.Zero(t, claim.Balances[0][sender].Sign())
+
+		wrongPreimage := from.Clone()
+		require.NoError(t, Claim(wrongPreimage, Preimage{}))
+		assert.Error(t, app.ValidTransition(nil, from, wrongPreimage, receiver))
+
+		notFinal := claim.Clone()
+		notFinal.IsFinal = false
+		assert.Error(t, app.ValidTransition(nil, from, notFinal, receiver))
+
+		wrongBals := claim.Clone()
+		wrongBals.Balances = from.Balances.Clone()
+		assert.Error(t, app.ValidTransition(nil, from, wrongBals, receiver))
+
+		changedTimeout := claim.Clone()
+		changedTimeout.Data.(*Data).Timeout++
+		assert.Error(t, app.ValidTransition(nil, from, changedTimeout, receiver))
+
+		changedRoute := claim.Clone()
+		changedRoute.Data.(*Data).Route = nil
+		assert.Error(t, app.ValidTransition(nil, from, changedRoute, receiver))
+
+		lateClaim := expired.Clone()
+		require.NoError(t, Claim(lateClaim, preimage))
+		assert.Error(t, app.ValidTransition(nil, expired, lateClaim, receiver), "claim after timeout")
+	})
+
+	t.Run("refund", func(t *testing.T) {
+		assert.NoError(t, app.ValidTransition(nil, from, refund, receiver))
+		assert.Error(t, app.ValidTransition(nil, from, refund, sender), "sender refund before timeout")
+
+		lateRefund := expired.Clone()
+		require.NoError(t, Refund(lateRefund))
+		assert.NoError(t, app.ValidTransition(nil, expired, lateRefund, sender), "sender refund after timeout")
+		assert.NoError(t, app.ValidTransition(nil, expired, lateRefund, receiver))
+
+		wrongBals := refund.Clone()
+		wrongBals.Balances = claim.Balances.Clone()
+		assert.Error(t, app.ValidTransition(nil, from, wrongBals, receiver))
+	})
+
+	t.Run("resolved", func(t *testing.T) {
+		assert.Error(t, app.ValidTransition(nil, claim, claim, receiver))
+	})
+}
+
+func newRandomData(rng *rand.Rand, receiver channel.Index) *Data {
+	data := &Data{
+		Receiver: receiver,
+		Timeout:  rng.Uint64(),
+		Route:    wiretest.NewRandomAddresses(rng, 1+rng.Intn(3)),
+	}
+	rng.Read(data.Hash[:])
+	return data
+}
+
+// newRandomState creates a random pending HTLC state with a single asset.
+func newRandomState(rng *rand.Rand, receiver channel.Index) *channel.State {
+	bals := make([]channel.Bal, numParts)
+	bals[receiver] = big.NewInt(0)
+	bals[1-receiver] = big.NewInt(1 + rng.Int63n(100))
+	s := test.NewRandomState(rng,
+		test.WithNumParts(numParts),
+		test.WithNumAssets(1),
+		test.WithBalances(bals),
+		test.WithNumLocked(0),
+		test.WithIsFinal(false),
+		test.WithVersion(0),
+	)
+	s.Data = newRandomData(rng, receiver)
+	return s
+}
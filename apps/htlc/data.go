@@ -0,0 +1,127 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htlc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"time"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+// HashSize is the size of a hash lock and of its preimage.
+const HashSize = sha256.Size
+
+type (
+	// Hash is the hash lock of a conditional payment.
+	Hash [HashSize]byte
+
+	// Preimage unlocks a conditional payment with hash lock Hash().
+	Preimage [HashSize]byte
+
+	// Data is the app data of an HTLC channel. The channel has two
+	// participants, the sender and the receiver of the payment. The funds of
+	// the channel are released to the receiver if the preimage of Hash is
+	// revealed, otherwise they are refunded to the sender.
+	Data struct {
+		Receiver channel.Index  // Index of the receiver, the other participant is the sender.
+		Hash     Hash           // Hash lock of the payment.
+		Timeout  uint64         // Unix time in seconds from which on the payment can only be refunded.
+		Route    []wire.Address // Remaining hops after the receiver, empty if the receiver is the payee.
+		Preimage *Preimage      // Revealed preimage, nil while the payment is pending.
+	}
+)
+
+var _ channel.Data = (*Data)(nil)
+
+// Hash returns the hash lock that is unlocked by the preimage.
+func (p Preimage) Hash() Hash {
+	return sha256.Sum256(p[:])
+}
+
+// IsResolved returns whether the preimage has been revealed.
+func (d *Data) IsResolved() bool {
+	return d.Preimage != nil
+}
+
+// MarshalBinary encodes the data into its binary representation.
+func (d *Data) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := perunio.Encode(&buf,
+		uint16(d.Receiver),
+		[HashSize]byte(d.Hash),
+		d.Timeout,
+		wire.AddressesWithLen(d.Route),
+		d.IsResolved(),
+	)
+	if err != nil || !d.IsResolved() {
+		return buf.Bytes(), err
+	}
+	err = perunio.Encode(&buf, [HashSize]byte(*d.Preimage))
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary decodes the data from its binary representation.
+func (d *Data) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	var (
+		receiver uint16
+		resolved bool
+	)
+	err := perunio.Decode(buf,
+		&receiver,
+		(*[HashSize]byte)(&d.Hash),
+		&d.Timeout,
+		(*wire.AddressesWithLen)(&d.Route),
+		&resolved,
+	)
+	if err != nil {
+		return err
+	}
+	d.Receiver = channel.Index(receiver)
+	d.Preimage = nil
+	if !resolved {
+		return nil
+	}
+	d.Preimage = new(Preimage)
+	return perunio.Decode(buf, (*[HashSize]byte)(d.Preimage))
+}
+
+// Clone returns a deep copy of the data.
+func (d *Data) Clone() channel.Data {
+	if d == nil {
+		return nil
+	}
+	clone := *d
+	clone.Route = append([]wire.Address(nil), d.Route...)
+	if d.Preimage != nil {
+		p := *d.Preimage
+		clone.Preimage = &p
+	}
+	return &clone
+}
+
+// expired returns whether the timeout of the payment has passed at time now.
+func (d *Data) expired(now time.Time) bool {
+	return uint64(now.Unix()) >= d.Timeout
+}
+
+// sender returns the index of the sender of the payment.
+func (d *Data) sender() channel.Index {
+	return 1 - d.Receiver
+}
@@ -0,0 +1,28 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htlc
+
+import (
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
+)
+
+// Resolver is the HTLC app resolver.
+type Resolver struct{}
+
+// Resolve returns an HTLC app with the given definition.
+func (b *Resolver) Resolve(def wallet.Address) (channel.App, error) {
+	return &App{def}, nil
+}
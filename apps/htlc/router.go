@@ -0,0 +1,618 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htlc
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/routing"
+	"perun.network/go-perun/wire"
+)
+
+// opTimeout is the timeout for the channel operations of the router.
+const opTimeout = 10 * time.Second
+
+var (
+	// ErrNoRoute is returned if there is no route to the payee or no channel
+	// to the next hop with sufficient funds.
+	ErrNoRoute = errors.New("no route with sufficient funds")
+	// ErrRefunded is returned if a payment was refunded.
+	ErrRefunded = errors.New("payment refunded")
+	// ErrTimedOut is returned if a payment was refunded on-chain because it
+	// was not resolved before its timeout.
+	ErrTimedOut = errors.New("payment timed out")
+)
+
+type (
+	// Router sends, forwards and receives conditional payments over the ledger
+	// channels of a client. The route of a payment is found in the router's
+	// channel graph, which contains the added ledger channels and the remote
+	// channels known from the network. A payment is locked in an HTLC
+	// sub-channel of a ledger channel with the next hop. Forwarding routers lock the payment in
+	// a sub-channel with their next hop and resolve the incoming payment once
+	// the outgoing payment is resolved. The timeout decreases by the timeout
+	// delta on each hop, so that a forwarding router can always resolve the
+	// incoming payment after the outgoing payment timed out.
+	//
+	// Outgoing HTLC channels are watched for disputes, so that a forwarding
+	// router learns a preimage that the receiver reveals on-chain. If an
+	// outgoing payment is not resolved before its timeout, the router refunds
+	// it by disputing the HTLC channel. As disputes take up to the challenge
+	// duration, the timeout delta must be longer than the challenge duration
+	// of all channels.
+	//
+	// The router handles HTLC channel proposals and updates with HandleProposal
+	// and HandleUpdate, which must be called by the client's proposal and
+	// update handlers.
+	Router struct {
+		log.Embedding
+
+		client       *client.Client
+		addr         wire.Address
+		app          *App
+		graph        *routing.Graph
+		timeoutDelta time.Duration
+
+		mu       sync.Mutex
+		channels []*client.Channel
+		invoices map[Hash]Preimage
+		outgoing map[paymentKey]*payment
+	}
+
+	// paymentKey identifies an outgoing payment by its parent channel and hash.
+	paymentKey struct {
+		parent channel.ID
+		hash   Hash
+	}
+
+	// payment is a pending outgoing payment.
+	payment struct {
+		incoming *client.Channel // The forwarded HTLC channel, or nil if we are the payer.
+		resolved chan struct{}   // Closed when the receiver resolves the payment.
+		result   chan result
+	}
+
+	result struct {
+		preimage Preimage
+		err      error
+	}
+)
+
+// NewRouter creates a new router for the given client, which is reachable
+// under the wire address addr. The router uses the given app for HTLC
+// channels, which must be registered at the app registry. timeoutDelta is
+// subtracted from the timeout of forwarded payments and must be longer than
+// the challenge duration of the routed channels.
+func NewRouter(c *client.Client, addr wire.Address, app *App, timeoutDelta time.Duration) *Router {
+	return &Router{
+		Embedding:    log.MakeEmbedding(log.WithField("role", "htlc-router")),
+		client:       c,
+		addr:         addr,
+		app:          app,
+		graph:        routing.NewGraph(),
+		timeoutDelta: timeoutDelta,
+		invoices:     make(map[Hash]Preimage),
+		outgoing:     make(map[paymentKey]*payment),
+	}
+}
+
+// AddChannel adds a ledger channel over which payments can be routed. The
+// channel is also added to the channel graph. The channel must be watched, see
+// client.Channel.Watch, so that its HTLC sub-channels can be watched, and its
+// challenge duration must be shorter than the timeout delta.
+func (r *Router) AddChannel(ch *client.Channel) error {
+	if !ch.IsLedgerChannel() || len(ch.Peers()) != numParts {
+		return errors.New("only two-party ledger channels can be used for routing")
+	}
+	if !r.validChallengeDuration(ch.Params().ChallengeDuration) {
+		return errors.New("challenge duration must be shorter than the timeout delta")
+	}
+	if err := r.graph.AddLocalChannel(ch); err != nil {
+		return errors.WithMessage(err, "adding channel to graph")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.channels = append(r.channels, ch)
+	return nil
+}
+
+// AddInvoice registers the preimage of a payment that we receive and returns
+// the hash lock that the payer must use.
+func (r *Router) AddInvoice(preimage Preimage) Hash {
+	hash := preimage.Hash()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invoices[hash] = preimage
+	return hash
+}
+
+// Graph returns the channel graph of the router. Remote channels have to be
+// added to the graph to route payments over them, e.g., by a
+// routing.Gossiper.
+func (r *Router) Graph() *routing.Graph {
+	return r.graph
+}
+
+// Pay sends a conditional payment of the given amount to the payee over the
+// shortest route of the channel graph on which every hop has sufficient
+// funds. The payment is locked with the given hash and can be refunded after
+// the timeout. Pay blocks until the payment is resolved and returns the
+// revealed preimage. It returns ErrNoRoute if there is no route to the payee
+// and ErrRefunded if the payment was refunded.
+func (r *Router) Pay(
+	ctx context.Context,
+	payee wire.Address,
+	asset channel.Asset,
+	amount channel.Bal,
+	hash Hash,
+	timeout time.Time,
+) (Preimage, error) {
+	route, err := r.findRoute(payee, asset, amount)
+	if err != nil {
+		return Preimage{}, err
+	}
+	p, err := r.lock(ctx, route, asset, amount, hash, timeout, nil)
+	if err != nil {
+		return Preimage{}, err
+	}
+
+	select {
+	case res := <-p.result:
+		return res.preimage, res.err
+	case <-ctx.Done():
+		return Preimage{}, ctx.Err()
+	}
+}
+
+// HandleProposal handles HTLC channel proposals. It returns false if the
+// proposal is not an HTLC channel proposal, in which case the caller has to
+// handle it. Accepted payments are claimed or forwarded in the background.
+func (r *Router) HandleProposal(p client.ChannelProposal, responder *client.ProposalResponder) bool {
+	prop, ok := p.(*client.SubChannelProposal)
+	if !ok || prop.App == nil || channel.IsNoApp(prop.App) || !prop.App.Def().Equal(r.app.Def()) {
+		return false
+	}
+
+	data, err := r.validProposal(prop)
+	// The proposal is answered asynchronously because the parent channel is
+	// locked while the proposal handler runs, but it has to be updated for
+	// funding the HTLC channel.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+		defer cancel()
+		if err != nil {
+			if err := responder.Reject(ctx, err.Error()); err != nil {
+				r.Log().Warnf("rejecting HTLC channel proposal: %v", err)
+			}
+			return
+		}
+
+		in, err := responder.Accept(ctx, prop.Accept(client.WithRandomNonce()))
+		if err != nil {
+			r.Log().Warnf("accepting HTLC channel proposal: %v", err)
+			return
+		}
+		r.resolveIncoming(in, data)
+	}()
+	return true
+}
+
+// HandleUpdate handles the resolution of our outgoing payments. It returns
+// false if the update does not belong to an outgoing payment, in which case
+// the caller has to handle it.
+func (r *Router) HandleUpdate(_ *channel.State, u client.ChannelUpdate, responder *client.UpdateResponder) bool {
+	data, ok := u.State.Data.(*Data)
+	if !ok {
+		return false
+	}
+	ch, err := r.client.Channel(u.State.ID)
+	if err != nil || ch.Parent() == nil {
+		return false
+	}
+
+	p, ok := r.take(paymentKey{parent: ch.Parent().ID(), hash: data.Hash})
+	if !ok {
+		return false
+	}
+
+	// The update has already been validated against the app rules, so it
+	// either claims or refunds the payment.
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := responder.Accept(ctx); err != nil {
+		go r.finish(p, result{err: errors.WithMessage(err, "accepting payment resolution")})
+		return true
+	}
+
+	res := result{err: ErrRefunded}
+	if data.IsResolved() {
+		res = result{preimage: *data.Preimage}
+	}
+	go func() {
+		if err := settle(ch); err != nil {
+			r.Log().Warnf("settling HTLC channel: %v", err)
+		}
+		r.finish(p, res)
+	}()
+	return true
+}
+
+// lock locks a payment in a new HTLC channel with the first hop of the route.
+func (r *Router) lock(
+	ctx context.Context,
+	route []wire.Address,
+	asset channel.Asset,
+	amount channel.Bal,
+	hash Hash,
+	timeout time.Time,
+	incoming *client.Channel,
+) (*payment, error) {
+	if len(route) == 0 {
+		return nil, errors.New("empty route")
+	}
+	parent, assetIdx, err := r.findChannel(route[0], asset, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	state := parent.State()
+	alloc := channel.NewAllocation(numParts, state.Assets...)
+	for _, bals := range alloc.Balances {
+		for i := range bals {
+			bals[i] = big.NewInt(0)
+		}
+	}
+	alloc.Balances[assetIdx][parent.Idx()].Set(amount)
+	data := &Data{
+		Receiver: 1 - parent.Idx(),
+		Hash:     hash,
+		Timeout:  uint64(timeout.Unix()),
+		Route:    route[1:],
+	}
+	prop, err := client.NewSubChannelProposal(
+		parent.ID(),
+		parent.Params().ChallengeDuration,
+		alloc,
+		client.WithApp(r.app, data),
+	)
+	if err != nil {
+		return nil, errors.WithMessage(err, "creating HTLC channel proposal")
+	}
+
+	// Register the payment before proposing, as the receiver may resolve it
+	// right after the channel is opened.
+	key := paymentKey{parent: parent.ID(), hash: hash}
+	p := &payment{
+		incoming: incoming,
+		resolved: make(chan struct{}),
+		result:   make(chan result, 1),
+	}
+	r.mu.Lock()
+	if _, ok := r.outgoing[key]; ok {
+		r.mu.Unlock()
+		return nil, errors.New("payment with same hash already pending in channel")
+	}
+	r.outgoing[key] = p
+	r.mu.Unlock()
+
+	out, err := r.client.ProposeChannel(ctx, prop)
+	if err != nil {
+		r.mu.Lock()
+		delete(r.outgoing, key)
+		r.mu.Unlock()
+		return nil, errors.WithMessage(err, "opening HTLC channel")
+	}
+
+	go r.watch(key, out)
+	go r.enforceTimeout(key, p, out, timeout)
+	return p, nil
+}
+
+// take removes the pending outgoing payment with the given key and marks it
+// as resolved. It returns false if the payment is not pending.
+func (r *Router) take(key paymentKey) (*payment, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.outgoing[key]
+	if !ok {
+		return nil, false
+	}
+	delete(r.outgoing, key)
+	close(p.resolved)
+	return p, true
+}
+
+// findRoute returns the wire addresses of all hops to the payee, including
+// the payee, of the shortest route in the channel graph.
+func (r *Router) findRoute(payee wire.Address, asset channel.Asset, amount channel.Bal) ([]wire.Address, error) {
+	routes, err := r.graph.FindRoute(r.addr, payee, asset, amount)
+	if errors.Is(err, routing.ErrNoRoute) {
+		return nil, ErrNoRoute
+	} else if err != nil {
+		return nil, errors.WithMessage(err, "finding route")
+	}
+	route := make([]wire.Address, len(routes[0]))
+	for i, hop := range routes[0] {
+		route[i] = hop.To
+	}
+	return route, nil
+}
+
+// findChannel returns the channel to the given peer that has the most funds
+// of the given asset, if they are sufficient for the given amount.
+func (r *Router) findChannel(peer wire.Address, asset channel.Asset, amount channel.Bal) (*client.Channel, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		best     *client.Channel
+		bestIdx  int
+		bestFund channel.Bal
+	)
+	for _, ch := range r.channels {
+		if ch.IsClosed() || !ch.Peers()[1-ch.Idx()].Equal(peer) {
+			continue
+		}
+		state := ch.State()
+		if state.IsFinal {
+			continue
+		}
+		for a, chAsset := range state.Assets {
+			if !chAsset.Equal(asset) {
+				continue
+			}
+			bal := state.Balances[a][ch.Idx()]
+			if bal.Cmp(amount) >= 0 && (best == nil || bal.Cmp(bestFund) > 0) {
+				best, bestIdx, bestFund = ch, a, bal
+			}
+		}
+	}
+	if best == nil {
+		return nil, 0, ErrNoRoute
+	}
+	return best, bestIdx, nil
+}
+
+// validProposal checks that we are the receiver of the proposed payment and
+// that we can either claim or forward it.
+func (r *Router) validProposal(prop *client.SubChannelProposal) (*Data, error) {
+	data, ok := prop.InitData.(*Data)
+	if !ok {
+		return nil, errors.Errorf("invalid HTLC app data: %T", prop.InitData)
+	}
+	parent, err := r.client.Channel(prop.Parent)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unknown parent channel")
+	}
+	if data.Receiver != parent.Idx() {
+		return nil, errors.New("we are not the receiver")
+	}
+	if _, _, err := lockedAmount(prop.InitBals.Balances, data); err != nil {
+		return nil, err
+	}
+
+	if len(data.Route) == 0 {
+		r.mu.Lock()
+		_, ok := r.invoices[data.Hash]
+		r.mu.Unlock()
+		if !ok {
+			return nil, errors.New("unknown payment hash")
+		}
+		return data, nil
+	}
+
+	if !r.forwardTimeout(data).After(time.Now()) {
+		return nil, errors.New("timeout too short for forwarding")
+	}
+	if !r.validChallengeDuration(prop.ChallengeDuration) {
+		return nil, errors.New("challenge duration too long for forwarding")
+	}
+	return data, nil
+}
+
+// resolveIncoming claims the incoming payment if we are the payee and
+// forwards it otherwise.
+func (r *Router) resolveIncoming(in *client.Channel, data *Data) {
+	if len(data.Route) == 0 {
+		r.mu.Lock()
+		preimage, ok := r.invoices[data.Hash]
+		delete(r.invoices, data.Hash)
+		r.mu.Unlock()
+		if !ok {
+			r.refund(in)
+			return
+		}
+		r.claim(in, preimage)
+		return
+	}
+
+	assetIdx, amount, err := lockedAmount(in.State().Balances, data)
+	if err != nil {
+		r.Log().Warnf("forwarding payment: %v", err)
+		r.refund(in)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	asset := in.State().Assets[assetIdx]
+	if _, err := r.lock(ctx, data.Route, asset, amount, data.Hash, r.forwardTimeout(data), in); err != nil {
+		r.Log().Warnf("forwarding payment: %v", err)
+		r.refund(in)
+	}
+}
+
+// finish resolves the forwarded incoming payment or returns the result to the
+// payer.
+func (r *Router) finish(p *payment, res result) {
+	if p.incoming == nil {
+		p.result <- res
+		return
+	}
+
+	switch {
+	case res.err == nil:
+		r.claim(p.incoming, res.preimage)
+	case errors.Is(res.err, ErrTimedOut):
+		// The outgoing payment was enforced on-chain. The incoming payment is
+		// enforced by its sender.
+		r.Log().Warnf("forwarded payment timed out: %v", res.err)
+	default:
+		r.refund(p.incoming)
+	}
+}
+
+// watch watches the outgoing HTLC channel for disputes and resolves the
+// payment if the receiver reveals the preimage on-chain. It returns when the
+// channel is closed.
+func (r *Router) watch(key paymentKey, out *client.Channel) {
+	h := eventHandlerFunc(func(e channel.AdjudicatorEvent) {
+		r.handleOutgoingEvent(key, e)
+	})
+	if err := out.Watch(h); err != nil && !out.IsClosed() {
+		r.Log().Warnf("watching HTLC channel: %v", err)
+	}
+}
+
+// handleOutgoingEvent resolves the outgoing payment if the disputed state of
+// the HTLC channel reveals the preimage.
+func (r *Router) handleOutgoingEvent(key paymentKey, e channel.AdjudicatorEvent) {
+	var state *channel.State
+	switch e := e.(type) {
+	case *channel.RegisteredEvent:
+		state = e.State
+	case *channel.ProgressedEvent:
+		state = e.State
+	default:
+		return
+	}
+	data, ok := state.Data.(*Data)
+	if !ok || !data.IsResolved() || data.Preimage.Hash() != key.hash {
+		return
+	}
+
+	p, ok := r.take(key)
+	if !ok {
+		return
+	}
+	r.Log().Infof("Preimage of payment in channel %x revealed on-chain", e.ID())
+	r.finish(p, result{preimage: *data.Preimage})
+}
+
+// enforceTimeout disputes the outgoing HTLC channel of a payment that is not
+// resolved before its timeout and refunds the payment on-chain. The parent
+// channel is not settled.
+func (r *Router) enforceTimeout(key paymentKey, p *payment, out *client.Channel, timeout time.Time) {
+	timer := time.NewTimer(time.Until(timeout))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-p.resolved:
+		return
+	case <-out.Ctx().Done():
+		return
+	}
+
+	r.Log().Infof("Payment in channel %x timed out, refunding on-chain", out.ID())
+	if err := out.ForceUpdate(out.Ctx(), Refund); err != nil {
+		// The payment stays pending, as the receiver may have revealed the
+		// preimage on-chain.
+		r.Log().Warnf("refunding payment on-chain: %v", err)
+		return
+	}
+	if p, ok := r.take(key); ok {
+		r.finish(p, result{err: ErrTimedOut})
+	}
+}
+
+func (r *Router) claim(in *client.Channel, preimage Preimage) {
+	r.resolve(in, func(s *channel.State) error { return Claim(s, preimage) })
+}
+
+func (r *Router) refund(in *client.Channel) {
+	r.resolve(in, Refund)
+}
+
+// resolve finalizes the incoming HTLC channel with the given update and
+// settles it into the parent channel. If the sender does not accept the
+// update, it is enforced on-chain.
+func (r *Router) resolve(in *client.Channel, update func(*channel.State) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := in.Update(ctx, update); err != nil {
+		r.Log().Warnf("resolving HTLC channel off-chain, enforcing on-chain: %v", err)
+		if err := in.ForceUpdate(in.Ctx(), update); err != nil {
+			r.Log().Warnf("resolving HTLC channel on-chain: %v", err)
+		}
+		return
+	}
+	if err := settle(in); err != nil {
+		r.Log().Warnf("settling HTLC channel: %v", err)
+	}
+}
+
+// validChallengeDuration returns whether a dispute with the given challenge
+// duration, in seconds, ends within the timeout delta.
+func (r *Router) validChallengeDuration(challengeDuration uint64) bool {
+	return challengeDuration < uint64(r.timeoutDelta/time.Second)
+}
+
+// forwardTimeout returns the timeout of the forwarded payment.
+func (r *Router) forwardTimeout(data *Data) time.Time {
+	return time.Unix(int64(data.Timeout), 0).Add(-r.timeoutDelta)
+}
+
+// settle settles the final HTLC channel into its parent channel.
+func settle(ch *client.Channel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	return ch.Settle(ctx, false)
+}
+
+// lockedAmount returns the asset index and the amount of the payment. A
+// payment locks exactly one asset.
+func lockedAmount(bals channel.Balances, data *Data) (assetIdx int, amount channel.Bal, err error) {
+	assetIdx = -1
+	for a, asset := range bals {
+		if asset[data.sender()].Sign() == 0 {
+			continue
+		}
+		if assetIdx >= 0 {
+			return 0, nil, errors.New("payment must lock exactly one asset")
+		}
+		assetIdx, amount = a, asset[data.sender()]
+	}
+	if assetIdx < 0 {
+		return 0, nil, errors.New("payment must lock exactly one asset")
+	}
+	return assetIdx, new(big.Int).Set(amount), nil
+}
+
+// eventHandlerFunc is an adapter to use a function as a
+// client.AdjudicatorEventHandler.
+type eventHandlerFunc func(channel.AdjudicatorEvent)
+
+// HandleAdjudicatorEvent calls f(e).
+func (f eventHandlerFunc) HandleAdjudicatorEvent(e channel.AdjudicatorEvent) {
+	f(e)
+}
@@ -0,0 +1,357 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htlc_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/apps/htlc"
+	_ "perun.network/go-perun/backend/sim" // backend init
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	ctest "perun.network/go-perun/client/test"
+	wtest "perun.network/go-perun/wallet/test"
+	"perun.network/go-perun/watcher/local"
+	"perun.network/go-perun/wire"
+	wiretest "perun.network/go-perun/wire/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+const (
+	testTimeout       = 10 * time.Second
+	challengeDuration = 60
+	timeoutDelta      = 2 * time.Minute
+	// watcherWait is the time to wait until the watchers of the ledger
+	// channels are active.
+	watcherWait = 100 * time.Millisecond
+)
+
+var initBals = []int64{100, 100} // Initial balances of all ledger channels.
+
+func TestRouter_Pay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rt := setupRouterTest(t, ctx, 4)
+	alice, ingrid1, ingrid2, bob := rt.nodes[0], rt.nodes[1], rt.nodes[2], rt.nodes[3]
+
+	var preimage htlc.Preimage
+	rt.rng.Read(preimage[:])
+	hash := bob.router.AddInvoice(preimage)
+
+	amount := big.NewInt(10)
+	got, err := alice.router.Pay(ctx, bob.addr, rt.asset, amount, hash, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, preimage, got)
+
+	// The payment is settled into the ledger channels of all hops.
+	require.Eventually(t, func() bool {
+		return rt.settled(amount, alice, ingrid1, ingrid2, bob)
+	}, testTimeout, 10*time.Millisecond)
+}
+
+func TestRouter_Refund(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rt := setupRouterTest(t, ctx, 4)
+	alice, ingrid1, ingrid2, bob := rt.nodes[0], rt.nodes[1], rt.nodes[2], rt.nodes[3]
+
+	// Bob does not know the preimage and rejects the payment.
+	var hash htlc.Hash
+	rt.rng.Read(hash[:])
+
+	_, err := alice.router.Pay(ctx, bob.addr, rt.asset, big.NewInt(10), hash, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, htlc.ErrRefunded)
+
+	// All funds are back with their owners.
+	require.Eventually(t, func() bool {
+		return rt.settled(big.NewInt(0), alice, ingrid1, ingrid2, bob)
+	}, testTimeout, 10*time.Millisecond)
+}
+
+func TestRouter_NoRoute(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rt := setupRouterTest(t, ctx, 3)
+	alice, bob := rt.nodes[0], rt.nodes[2]
+
+	var hash htlc.Hash
+	// Insufficient funds.
+	_, err := alice.router.Pay(ctx, bob.addr, rt.asset, big.NewInt(initBals[0]+1), hash, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, htlc.ErrNoRoute)
+	// Unknown payee.
+	_, err = alice.router.Pay(ctx, wiretest.NewRandomAddress(rt.rng), rt.asset, big.NewInt(1), hash, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, htlc.ErrNoRoute)
+	// Unknown asset.
+	_, err = alice.router.Pay(ctx, bob.addr, chtest.NewRandomAsset(rt.rng), big.NewInt(1), hash, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, htlc.ErrNoRoute)
+}
+
+func TestRouter_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rt := setupRouterTest(t, ctx, 2)
+	alice, bob := rt.nodes[0], rt.nodes[1]
+	ledger := alice.channels[0]
+
+	// Bob accepts the payment but never resolves it.
+	bob.hold = true
+
+	var hash htlc.Hash
+	rt.rng.Read(hash[:])
+	_, err := alice.router.Pay(ctx, bob.addr, rt.asset, big.NewInt(10), hash, time.Now().Add(100*time.Millisecond))
+	assert.ErrorIs(t, err, htlc.ErrTimedOut)
+
+	// Only the HTLC channel is progressed to the refund, the ledger channel
+	// is not settled.
+	require.Len(t, ledger.State().Locked, 1)
+	out, err := alice.Channel(ledger.State().Locked[0].ID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return out.Phase() == channel.Progressed
+	}, testTimeout, 10*time.Millisecond)
+	assert.True(t, out.State().IsFinal)
+	assert.Zero(t, out.State().Balances[0][1].Sign(), "payment not refunded")
+	assert.False(t, ledger.IsClosed())
+	assert.Zero(t, rt.balanceReader.Balance(alice.acc, rt.asset).Sign(), "ledger channel settled")
+
+	// Settling the ledger channel pays out the refund.
+	require.NoError(t, ledger.Settle(ctx, false))
+	got := rt.balanceReader.Balance(alice.acc, rt.asset)
+	assert.Zerof(t, got.Cmp(big.NewInt(initBals[0])), "alice: wrong on-chain balance: %v", got)
+}
+
+func TestRouter_ClaimOnChain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rt := setupRouterTest(t, ctx, 3)
+	alice, ingrid, bob := rt.nodes[0], rt.nodes[1], rt.nodes[2]
+
+	// Bob accepts the payment without resolving it off-chain.
+	bob.hold = true
+
+	var preimage htlc.Preimage
+	rt.rng.Read(preimage[:])
+	paid := make(chan error, 1)
+	go func() {
+		got, err := alice.router.Pay(ctx, bob.addr, rt.asset, big.NewInt(10), preimage.Hash(), time.Now().Add(time.Hour))
+		if err == nil && got != preimage {
+			err = errors.New("wrong preimage")
+		}
+		paid <- err
+	}()
+
+	// Bob claims the payment on-chain. Ingrid learns the preimage from the
+	// dispute and claims her incoming payment from Alice.
+	var in *client.Channel
+	select {
+	case in = <-bob.held:
+	case <-ctx.Done():
+		t.Fatal("bob did not accept HTLC channel")
+	}
+	require.NoError(t, in.ForceUpdate(ctx, func(s *channel.State) error {
+		return htlc.Claim(s, preimage)
+	}))
+
+	select {
+	case err := <-paid:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("payment not resolved")
+	}
+	require.Eventually(t, func() bool {
+		return rt.settled(big.NewInt(10), alice, ingrid)
+	}, testTimeout, 10*time.Millisecond)
+}
+
+func TestRouter_ChallengeDuration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rt := setupRouterTest(t, ctx, 2)
+	alice := rt.nodes[0]
+
+	// The timeout delta must be longer than the challenge duration.
+	router := htlc.NewRouter(alice.Client, alice.addr, &htlc.App{}, challengeDuration*time.Second)
+	assert.Error(t, router.AddChannel(alice.channels[0]))
+}
+
+type (
+	routerTest struct {
+		t             *testing.T
+		rng           *rand.Rand
+		asset         channel.Asset
+		balanceReader ctest.BalanceReader
+		nodes         []*node
+	}
+
+	node struct {
+		*client.Client
+		router   *htlc.Router
+		addr     wire.Address
+		acc      wire.Address
+		hold     bool                 // Whether to accept HTLC proposals without resolving them.
+		channels []*client.Channel    // Ledger channels to the previous and next node.
+		accepted chan *client.Channel // Accepted ledger channels.
+		held     chan *client.Channel // Accepted HTLC channels if hold is set.
+	}
+)
+
+// setupRouterTest creates a line of n nodes, where each node has a ledger
+// channel with the next node. Each node knows and watches all its channels.
+func setupRouterTest(t *testing.T, ctx context.Context, n int) *routerTest {
+	t.Helper()
+	rng := pkgtest.Prng(t)
+	backend := ctest.NewMockBackend(rng)
+	bus := wiretest.NewSerializingLocalBus()
+	app := &htlc.App{Addr: wtest.NewRandomAddress(rng)}
+	channel.RegisterApp(app)
+
+	rt := &routerTest{
+		t:             t,
+		rng:           rng,
+		asset:         chtest.NewRandomAsset(rng),
+		balanceReader: backend,
+	}
+	for i := 0; i < n; i++ {
+		w := wtest.NewWallet()
+		acc := w.NewRandomAccount(rng)
+		watcher, err := local.NewWatcher(backend)
+		require.NoError(t, err)
+		c, err := client.New(acc.Address(), bus, backend, backend, w, watcher)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() }) //nolint:errcheck
+
+		nd := &node{
+			Client:   c,
+			router:   htlc.NewRouter(c, acc.Address(), app, timeoutDelta),
+			addr:     acc.Address(),
+			acc:      acc.Address(),
+			accepted: make(chan *client.Channel, 1),
+			held:     make(chan *client.Channel, 1),
+		}
+		go c.Handle(nd.proposalHandler(ctx), nd.updateHandler(ctx))
+		rt.nodes = append(rt.nodes, nd)
+	}
+
+	for i := 0; i+1 < n; i++ {
+		rt.openLedgerChannel(ctx, rt.nodes[i], rt.nodes[i+1])
+	}
+	for _, nd := range rt.nodes {
+		for _, info := range nd.router.Graph().LocalChannels() {
+			for _, other := range rt.nodes {
+				_, err := other.router.Graph().UpdateChannel(info)
+				require.NoError(t, err)
+			}
+		}
+	}
+	time.Sleep(watcherWait)
+	return rt
+}
+
+func (rt *routerTest) openLedgerChannel(ctx context.Context, proposer, responder *node) {
+	rt.t.Helper()
+	peers := []wire.Address{proposer.addr, responder.addr}
+	alloc := channel.NewAllocation(len(peers), rt.asset)
+	alloc.SetAssetBalances(rt.asset, []channel.Bal{big.NewInt(initBals[0]), big.NewInt(initBals[1])})
+	prop, err := client.NewLedgerChannelProposal(challengeDuration, proposer.acc, alloc, peers)
+	require.NoError(rt.t, err)
+
+	ch, err := proposer.ProposeChannel(ctx, prop)
+	require.NoError(rt.t, err)
+	var resp *client.Channel
+	select {
+	case resp = <-responder.accepted:
+	case <-ctx.Done():
+		rt.t.Fatal("responder did not accept ledger channel")
+	}
+
+	for _, c := range []struct {
+		n  *node
+		ch *client.Channel
+	}{{proposer, ch}, {responder, resp}} {
+		require.NoError(rt.t, c.n.router.AddChannel(c.ch))
+		c.n.channels = append(c.n.channels, c.ch)
+		go c.ch.Watch(noopHandler{}) //nolint:errcheck
+	}
+}
+
+// settled returns whether amount has been moved from the first to the last
+// node along the line and no funds are locked, as seen by both peers of each
+// channel.
+func (rt *routerTest) settled(amount channel.Bal, nodes ...*node) bool {
+	expected := channel.Balances{{
+		new(big.Int).Sub(big.NewInt(initBals[0]), amount),
+		new(big.Int).Add(big.NewInt(initBals[1]), amount),
+	}}
+	for i := 0; i+1 < len(nodes); i++ {
+		for _, ch := range []*client.Channel{
+			nodes[i].channels[len(nodes[i].channels)-1], // Channel to the next node.
+			nodes[i+1].channels[0],                      // Channel to the previous node.
+		} {
+			state := ch.State()
+			if len(state.Locked) != 0 || state.Balances.AssertEqual(expected) != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (nd *node) proposalHandler(ctx context.Context) client.ProposalHandlerFunc {
+	return func(p client.ChannelProposal, r *client.ProposalResponder) {
+		if !nd.hold && nd.router.HandleProposal(p, r) {
+			return
+		}
+		switch p := p.(type) {
+		case *client.LedgerChannelProposal:
+			ch, err := r.Accept(ctx, p.Accept(nd.acc, client.WithRandomNonce()))
+			if err != nil {
+				r.Reject(ctx, err.Error()) //nolint:errcheck
+				return
+			}
+			nd.accepted <- ch
+		case *client.SubChannelProposal:
+			go func() {
+				ch, err := r.Accept(ctx, p.Accept(client.WithRandomNonce()))
+				if err == nil {
+					nd.held <- ch
+				}
+			}()
+		default:
+			r.Reject(ctx, "unexpected proposal") //nolint:errcheck
+		}
+	}
+}
+
+func (nd *node) updateHandler(ctx context.Context) client.UpdateHandlerFunc {
+	return func(s *channel.State, u client.ChannelUpdate, r *client.UpdateResponder) {
+		if nd.router.HandleUpdate(s, u, r) {
+			return
+		}
+		r.Reject(ctx, "unexpected update") //nolint:errcheck
+	}
+}
+
+type noopHandler struct{}
+
+func (noopHandler) HandleAdjudicatorEvent(channel.AdjudicatorEvent) {}
@@ -194,11 +194,14 @@ func (f *Funder) fundAssets(ctx context.Context, channelID channel.ID, req chann
 		contract := bindAssetHolder(f.ContractBackend, asset, channel.Index(index))
 		// Wait for the funding event.
 		errg.Go(func() error {
+			if req.TopUp {
+				return f.waitForHoldings(ctx, req, contract, fundingIDs)
+			}
 			return f.waitForFundingConfirmation(ctx, req, contract, fundingIDs)
 		})
 
 		// Send the funding TX.
-		tx, err := f.sendFundingTx(ctx, req, contract, fundingIDs[req.Idx])
+		tx, err := f.sendFundingTx(ctx, req, contract, fundingIDs)
 		if err != nil {
 			f.log.WithField("asset", asset).WithError(err).Error("Could not fund asset")
 			errg.Add(errors.WithMessage(err, "funding asset"))
@@ -211,14 +214,21 @@ func (f *Funder) fundAssets(ctx context.Context, channelID channel.ID, req chann
 
 // sendFundingTx sends and returns the TXs that are needed to fulfill the
 // funding request. It is idempotent.
-func (f *Funder) sendFundingTx(ctx context.Context, request channel.FundingReq, contract assetHolder, fundingID [32]byte) (txs []*types.Transaction, fatal error) {
+func (f *Funder) sendFundingTx(ctx context.Context, request channel.FundingReq, contract assetHolder, fundingIDs [][32]byte) (txs []*types.Transaction, fatal error) {
 	bal := request.Agreement[contract.assetIndex][request.Idx]
 	if bal == nil || bal.Sign() <= 0 {
 		f.log.WithFields(log.Fields{"channel": request.Params.ID(), "idx": request.Idx}).Debug("Skipped zero funding.")
 		return nil, nil
 	}
 
-	alreadyFunded, err := f.checkFunded(ctx, bal, contract, fundingID)
+	fundingID := fundingIDs[request.Idx]
+	var alreadyFunded bool
+	var err error
+	if request.TopUp {
+		alreadyFunded, err = f.checkToppedUp(ctx, request, contract, fundingIDs)
+	} else {
+		alreadyFunded, err = f.checkFunded(ctx, bal, contract, fundingID)
+	}
 	if err != nil {
 		return nil, errors.WithMessage(err, "checking funded")
 	} else if alreadyFunded {
@@ -271,6 +281,48 @@ func (f *Funder) checkFunded(ctx context.Context, amount *big.Int, asset assetHo
 	return left.Sign() != 1, errors.WithMessagef(<-subErr, "filtering old Funding events for asset %d", asset.assetIndex)
 }
 
+// checkToppedUp returns whether our top-up of the specified asset was already
+// deposited. Top-ups add to the previous deposits, so unlike for the initial
+// funding, the deposit events of our funding ID do not suffice:
+//   - If the asset was not funded before, our holdings must cover our top-up.
+//   - If only we top up the asset, the channel's holdings must cover the
+//     previous holdings plus our top-up, which is the sum of the new state.
+//
+// Other top-ups can not be checked, so an error is returned for them.
+func (f *Funder) checkToppedUp(ctx context.Context, request channel.FundingReq, asset assetHolder, fundingIDs [][32]byte) (bool, error) {
+	deposits := request.Agreement[asset.assetIndex]
+	required := request.State.Allocation.Sum()[asset.assetIndex]
+	previous := new(big.Int).Sub(required, request.Agreement.Sum()[asset.assetIndex])
+	if previous.Sign() == 0 {
+		return f.checkFunded(ctx, deposits[request.Idx], asset, fundingIDs[request.Idx])
+	}
+
+	for i, bal := range deposits {
+		if channel.Index(i) != request.Idx && bal.Sign() != 0 {
+			return false, errors.Errorf("asset %d is topped up by several participants", asset.assetIndex)
+		}
+	}
+	holdings, err := f.holdings(ctx, asset, fundingIDs)
+	if err != nil {
+		return false, err
+	}
+	return holdings.Cmp(required) >= 0, nil
+}
+
+// holdings returns the sum of the holdings of all `fundingIDs` for the
+// specified asset.
+func (f *Funder) holdings(ctx context.Context, asset assetHolder, fundingIDs [][32]byte) (*big.Int, error) {
+	holdings := new(big.Int)
+	for _, id := range fundingIDs {
+		h, err := asset.Holdings(&bind.CallOpts{Context: ctx}, id)
+		if err != nil {
+			return nil, errors.WithMessage(err, "reading holdings")
+		}
+		holdings.Add(holdings, h)
+	}
+	return holdings, nil
+}
+
 func (f *Funder) depositedSub(ctx context.Context, contract *bind.BoundContract, fundingIDs ...[32]byte) (*subscription.ResistantEventSub, error) {
 	filter := make([]interface{}, len(fundingIDs))
 	for i, fundingID := range fundingIDs {
@@ -353,6 +405,51 @@ func (f *Funder) waitForFundingConfirmation(ctx context.Context, request channel
 	return nil
 }
 
+// waitForHoldings waits until the holdings of all participants for the
+// specified asset cover the balances of the requested state. It is used for
+// top-ups, for which the deposit events can not be attributed to the request.
+func (f *Funder) waitForHoldings(ctx context.Context, request channel.FundingReq, asset assetHolder, fundingIDs [][32]byte) error {
+	deposited := make(chan *subscription.Event)
+	subErr := make(chan error, 1)
+	// Subscribe to events.
+	sub, err := f.depositedSub(ctx, asset.contract, fundingIDs...)
+	if err != nil {
+		return errors.WithMessage(err, "subscribing to deposited event")
+	}
+	defer sub.Close()
+	// Read from the sub.
+	go func() {
+		subErr <- sub.Read(ctx, deposited)
+	}()
+
+	required := request.State.Allocation.Sum()[asset.assetIndex]
+	// Check the holdings initially and after every deposit.
+	for {
+		holdings, err := f.holdings(ctx, asset, fundingIDs)
+		if err != nil {
+			return err
+		}
+		if holdings.Cmp(required) >= 0 {
+			return nil
+		}
+		f.log.Debugf("Holdings for asset %d: %v, required: %v", asset.assetIndex, holdings, required)
+
+		select {
+		case <-deposited:
+		case <-ctx.Done():
+			var indices []channel.Index
+			for k, bal := range request.Agreement[asset.assetIndex] {
+				if bal.Sign() == 1 {
+					indices = append(indices, channel.Index(k))
+				}
+			}
+			return &channel.AssetFundingError{Asset: asset.assetIndex, TimedOutPeers: indices}
+		case err := <-subErr:
+			return err
+		}
+	}
+}
+
 func partIdx(partID [32]byte, fundingIDs [][32]byte) int {
 	for i, id := range fundingIDs {
 		if id == partID {
@@ -372,6 +372,89 @@ func testFunderFunding(t *testing.T, n int) {
 	assert.NoError(t, compareOnChainAlloc(ctx, params, alloc.Balances, alloc.Assets, &funders[0].ContractBackend))
 }
 
+func TestFunder_TopUp(t *testing.T) {
+	t.Parallel()
+	n := 2
+	ctx, cancel := context.WithTimeout(context.Background(), 2*defaultTxTimeout*time.Duration(n))
+	defer cancel()
+	rng := pkgtest.Prng(t)
+
+	_, funders, params, alloc := newNFunders(ctx, t, rng, n)
+	fund := func(req func(idx channel.Index) *channel.FundingReq) {
+		ct := pkgtest.NewConcurrent(t)
+		for i, funder := range funders {
+			i, funder := i, funder
+			go ct.StageN("funding", n, func(rt pkgtest.ConcT) {
+				err := funder.Fund(ctx, *req(channel.Index(i)))
+				require.NoError(rt, err, "funding should succeed")
+			})
+		}
+		ct.Wait("funding")
+	}
+
+	fund(func(idx channel.Index) *channel.FundingReq {
+		return channel.NewFundingReq(params, &channel.State{Allocation: *alloc}, idx, alloc.Balances)
+	})
+
+	// Participant 0 deposits additional funds of all assets.
+	deposits := channel.MakeBalances(len(alloc.Assets), n)
+	for a := range deposits {
+		deposits[a][0] = big.NewInt(rng.Int63n(1000) + 1)
+		deposits[a][1] = big.NewInt(0)
+	}
+	topUp := alloc.Clone()
+	topUp.Balances = topUp.Balances.Add(deposits)
+	topUpReq := func(idx channel.Index) *channel.FundingReq {
+		return channel.NewTopUpReq(params, &channel.State{Allocation: topUp}, idx, deposits)
+	}
+	fund(topUpReq)
+	assert.NoError(t, compareOnChainAlloc(ctx, params, topUp.Balances, alloc.Assets, &funders[0].ContractBackend))
+
+	// Repeating the top-up, e.g., on restore, does not deposit again.
+	fund(topUpReq)
+	assert.NoError(t, compareOnChainAlloc(ctx, params, topUp.Balances, alloc.Assets, &funders[0].ContractBackend))
+}
+
+func TestFunder_AddAsset(t *testing.T) {
+	t.Parallel()
+	n := 2
+	ctx, cancel := context.WithTimeout(context.Background(), 2*defaultTxTimeout*time.Duration(n))
+	defer cancel()
+	rng := pkgtest.Prng(t)
+
+	_, funders, params, alloc := newNFunders(ctx, t, rng, n)
+	fund := func(req func(idx channel.Index) *channel.FundingReq) {
+		ct := pkgtest.NewConcurrent(t)
+		for i, funder := range funders {
+			i, funder := i, funder
+			go ct.StageN("funding", n, func(rt pkgtest.ConcT) {
+				err := funder.Fund(ctx, *req(channel.Index(i)))
+				require.NoError(rt, err, "funding should succeed")
+			})
+		}
+		ct.Wait("funding")
+	}
+
+	// The channel is opened with the first asset only.
+	initAlloc := alloc.Clone()
+	initAlloc.Assets = initAlloc.Assets[:1]
+	initAlloc.Balances = initAlloc.Balances[:1]
+	fund(func(idx channel.Index) *channel.FundingReq {
+		return channel.NewFundingReq(params, &channel.State{Allocation: initAlloc}, idx, initAlloc.Balances)
+	})
+
+	// The second asset is added and funded by all participants.
+	deposits := alloc.Balances.Clone()
+	for i := range deposits[0] {
+		deposits[0][i] = big.NewInt(0)
+	}
+	fund(func(idx channel.Index) *channel.FundingReq {
+		return channel.NewTopUpReq(params, &channel.State{Allocation: *alloc}, idx, deposits)
+	})
+
+	assert.NoError(t, compareOnChainAlloc(ctx, params, alloc.Balances, alloc.Assets, &funders[0].ContractBackend))
+}
+
 func newNFunders(
 	ctx context.Context,
 	t *testing.T,
@@ -54,6 +54,8 @@ type (
 		Funders []*ethchannel.Funder // funders, bound to respective account
 		Adjs    []*SimAdjudicator    // adjudicator, withdrawal bound to respecive receivers
 		Asset   *ethchannel.Asset    // the asset
+
+		adjudicator common.Address // address of the adjudicator contract
 	}
 )
 
@@ -108,6 +110,7 @@ func NewSetup(t *testing.T, rng *rand.Rand, n int, blockInterval time.Duration,
 	defer cancel()
 	adjudicator, err := ethchannel.DeployAdjudicator(ctx, *s.CB, s.TxSender.Account)
 	require.NoError(t, err)
+	s.adjudicator = adjudicator
 	ethAsset, err := ethchannel.DeployETHAssetholder(ctx, *s.CB, adjudicator, s.TxSender.Account)
 	require.NoError(t, err)
 	s.Asset = ethchannel.NewAssetFromAddress(ethAsset)
@@ -132,3 +135,18 @@ func NewSetup(t *testing.T, rng *rand.Rand, n int, blockInterval time.Duration,
 
 	return s
 }
+
+// DeployETHAsset deploys another ETH asset holder and registers it with all
+// funders. It is used to test channels with several assets.
+func (s *Setup) DeployETHAsset(t *testing.T) *ethchannel.Asset {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTxTimeout)
+	defer cancel()
+	ethAsset, err := ethchannel.DeployETHAssetholder(ctx, *s.CB, s.adjudicator, s.TxSender.Account)
+	require.NoError(t, err)
+	asset := ethchannel.NewAssetFromAddress(ethAsset)
+	for i, funder := range s.Funders {
+		require.True(t, funder.RegisterAsset(*asset, ethchannel.NewETHDepositor(), s.Accs[i].Account))
+	}
+	return asset
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/backend/ethereum/channel/test"
+	ctest "perun.network/go-perun/backend/ethereum/client/test"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wire"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestChangeAssets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+	rng := pkgtest.Prng(t)
+
+	s := test.NewSetup(t, rng, 2, ctest.BlockInterval, TxFinalityDepth)
+	setups := ctest.MakeRoleSetups(s, [2]string{"Alice", "Bob"})
+	newClient := func(i int) *client.Client {
+		c, err := client.New(setups[i].Identity.Address(), setups[i].Bus, setups[i].Funder,
+			setups[i].Adjudicator, setups[i].Wallet, setups[i].Watcher)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	alice, bob := newClient(0), newClient(1)
+
+	channelsBob := make(chan *client.Channel, 1)
+	acceptUpdates := client.UpdateHandlerFunc(func(_ *channel.State, _ client.ChannelUpdate, ur *client.UpdateResponder) {
+		assert.NoError(t, ur.Accept(ctx))
+	})
+	go bob.Handle(
+		client.ProposalHandlerFunc(func(cp client.ChannelProposal, pr *client.ProposalResponder) {
+			part := setups[1].Wallet.NewRandomAccount(rng).Address()
+			ch, err := pr.Accept(ctx, cp.(*client.LedgerChannelProposal).Accept(part, client.WithRandomNonce()))
+			assert.NoError(t, err)
+			channelsBob <- ch
+		}),
+		acceptUpdates,
+	)
+	go alice.Handle(
+		client.ProposalHandlerFunc(func(_ client.ChannelProposal, pr *client.ProposalResponder) {
+			pr.Reject(ctx, "unexpected proposal") //nolint:errcheck
+		}),
+		acceptUpdates,
+	)
+
+	peers := []wire.Address{setups[0].Identity.Address(), setups[1].Identity.Address()}
+	initAlloc := channel.NewAllocation(len(peers), s.Asset)
+	initAlloc.SetAssetBalances(s.Asset, []channel.Bal{big.NewInt(100), big.NewInt(100)})
+	part := setups[0].Wallet.NewRandomAccount(rng).Address()
+	prop, err := client.NewLedgerChannelProposal(setups[0].ChallengeDuration, part, initAlloc, peers, client.WithRandomNonce())
+	require.NoError(t, err)
+	chAlice, err := alice.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	chBob := <-channelsBob
+
+	// Both participants deposit their share of the added asset into its asset
+	// holder. An asset without balances is added and removed again.
+	added, empty := s.DeployETHAsset(t), s.DeployETHAsset(t)
+	require.NoError(t, chAlice.AddAsset(ctx, added, []channel.Bal{big.NewInt(50), big.NewInt(30)}))
+	require.NoError(t, chBob.AddAsset(ctx, empty, []channel.Bal{big.NewInt(0), big.NewInt(0)}))
+	require.NoError(t, chAlice.RemoveAsset(ctx, empty))
+
+	require.NoError(t, chAlice.Update(ctx, func(s *channel.State) error {
+		s.Balances[1] = []channel.Bal{big.NewInt(10), big.NewInt(70)}
+		s.IsFinal = true
+		return nil
+	}))
+	require.NoError(t, chAlice.Settle(ctx, false))
+	require.NoError(t, chBob.Settle(ctx, false))
+
+	// The receivers get the outcome of both assets.
+	for i, expected := range []int64{110, 170} {
+		bal, err := s.SimBackend.BalanceAt(ctx, common.Address(*s.Recvs[i]), nil)
+		require.NoError(t, err)
+		assert.Zerof(t, bal.Cmp(big.NewInt(expected)), "ETH balance mismatch: %v", bal)
+	}
+}
@@ -16,6 +16,7 @@ package channel
 
 import (
 	"bytes"
+	"fmt"
 	"log"
 
 	"github.com/pkg/errors"
@@ -53,6 +54,22 @@ func NewActionMachine(acc wallet.Account, params Params) (*ActionMachine, error)
 	}, nil
 }
 
+// ActionMachineOf returns an ActionMachine that operates on the same underlying
+// machine as the given StateMachine. This allows to advance an ActionApp channel
+// by actions while all other transitions are made by the StateMachine.
+func ActionMachineOf(m *StateMachine) (*ActionMachine, error) {
+	app, ok := m.params.App.(ActionApp)
+	if !ok {
+		return nil, errors.New("app must be ActionApp")
+	}
+
+	return &ActionMachine{
+		machine:        m.machine,
+		app:            app,
+		stagingActions: make([]Action, m.N()),
+	}, nil
+}
+
 var actionPhases = []Phase{InitActing, Acting}
 
 // AddAction adds the action of participant idx to the staging actions.
@@ -101,7 +118,8 @@ func (m *ActionMachine) Init() error {
 }
 
 // Update applies all staged actions to the current state to create the new
-// staging state for signing.
+// staging state for signing. The resulting state must pass the
+// application-independent transition checks.
 func (m *ActionMachine) Update() error {
 	if err := m.expect(PhaseTransition{Acting, Signing}); err != nil {
 		return err
@@ -111,11 +129,20 @@ func (m *ActionMachine) Update() error {
 	if err != nil {
 		return err
 	}
+	if err := m.machine.validTransition(stagingState); err != nil {
+		return err
+	}
 
 	m.setStaging(Signing, stagingState)
 	return nil
 }
 
+// DiscardActions discards all staging actions. It should be called if not all
+// actions of a round could be collected.
+func (m *ActionMachine) DiscardActions() {
+	m.stagingActions = make([]Action, m.N())
+}
+
 // setStaging sets the current staging phase and state and additionally clears
 // the staging actions.
 func (m *ActionMachine) setStaging(phase Phase, state *State) {
@@ -146,3 +173,41 @@ func (m *ActionMachine) Clone() *ActionMachine {
 		stagingActions: clonedActions,
 	}
 }
+
+// actionStateApp adapts an ActionApp to the StateApp interface so that a
+// StateMachine can be used for ActionApp channels. The states of ActionApp
+// channels result from applying actions, so the only full state transition that
+// is accepted is the finalization of the current state.
+type actionStateApp struct {
+	ActionApp
+}
+
+// stateApp returns the StateApp that checks full state transitions of app.
+func stateApp(app App) (StateApp, error) {
+	switch app := app.(type) {
+	case StateApp:
+		return app, nil
+	case ActionApp:
+		return actionStateApp{app}, nil
+	default:
+		return nil, errors.New("app must be StateApp or ActionApp")
+	}
+}
+
+// ValidTransition checks that `to` is the finalization of `from`.
+func (a actionStateApp) ValidTransition(params *Params, from, to *State, _ Index) error {
+	final := from.Clone()
+	final.Version = to.Version
+	final.IsFinal = true
+	if err := final.Equal(to); err != nil {
+		return NewStateTransitionError(params.ID(),
+			fmt.Sprintf("ActionApp channel states can only be finalized: %v", err))
+	}
+	return nil
+}
+
+// ValidInit accepts all initial states as ActionApps do not define checks
+// for initial states that are not created from actions.
+func (actionStateApp) ValidInit(*Params, *State) error {
+	return nil
+}
@@ -26,6 +26,7 @@ import (
 
 //go:generate mockery --name AdjudicatorSubscription --output ../watcher/internal/mocks
 //go:generate mockery --name RegisterSubscriber --output ../watcher/internal/mocks
+//go:generate mockery --name Withdrawer --output ../watcher/internal/mocks
 
 type (
 
@@ -80,6 +81,25 @@ type (
 		Withdraw(context.Context, AdjudicatorReq, StateMap) error
 	}
 
+	// PartialWithdrawer is the interface that wraps the WithdrawPartial method.
+	// It is an optional extension of the Adjudicator.
+	//
+	// WithdrawPartial should withdraw the amounts authorized by the fully
+	// signed WithdrawalAuth in the request from the channel's holdings to the
+	// participant at index Auth.Idx, while the channel stays open. It should
+	// only return once the withdrawal is final on-chain. It must be idempotent,
+	// as all participants may call it for the same withdrawal, and it is
+	// repeated until it succeeds.
+	// After a withdrawal with version v, the adjudicator must not accept
+	// registrations of states with a version lower than v, because these
+	// states do not account for the withdrawn funds.
+	// If the withdrawal was not executed and can never be executed anymore,
+	// e.g., because the channel was registered in a dispute, a
+	// WithdrawalExpiredError should be returned.
+	PartialWithdrawer interface {
+		WithdrawPartial(context.Context, PartialWithdrawalReq) error
+	}
+
 	// Progresser is the interface that wraps the Progress method.
 	//
 	// Progress should try to progress an on-chain registered state to the new
@@ -116,6 +136,16 @@ type (
 		Secondary bool  // Optimized secondary call protocol
 	}
 
+	// A PartialWithdrawalReq collects all necessary information to withdraw
+	// funds from an open channel. Tx is the fully signed state that reflects
+	// the withdrawal and AuthSigs are the signatures of all participants on
+	// Auth.
+	PartialWithdrawalReq struct {
+		AdjudicatorReq
+		Auth     WithdrawalAuth
+		AuthSigs []wallet.Sig
+	}
+
 	// SignedState represents a signed channel state including parameters.
 	SignedState struct {
 		Params *Params
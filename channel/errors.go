@@ -38,6 +38,13 @@ type (
 		current Phase
 		PhaseTransition
 	}
+
+	// WithdrawalExpiredError indicates that a partial withdrawal can not be
+	// executed on-chain anymore, see PartialWithdrawer.
+	WithdrawalExpiredError struct {
+		ID      ID
+		Version uint64
+	}
 )
 
 func (e *StateTransitionError) Error() string {
@@ -55,6 +62,10 @@ func (e *PhaseTransitionError) Error() string {
 	)
 }
 
+func (e *WithdrawalExpiredError) Error() string {
+	return fmt.Sprintf("partial withdrawal expired (ID: %x, version: %d)", e.ID, e.Version)
+}
+
 // NewStateTransitionError creates a new StateTransitionError.
 func NewStateTransitionError(id ID, msg string) error {
 	return errors.Wrap(&StateTransitionError{
@@ -69,6 +80,14 @@ func NewActionError(id ID, msg string) error {
 	}, msg)
 }
 
+// NewWithdrawalExpiredError creates a new WithdrawalExpiredError.
+func NewWithdrawalExpiredError(id ID, version uint64, msg string) error {
+	return errors.Wrap(&WithdrawalExpiredError{
+		ID:      id,
+		Version: version,
+	}, msg)
+}
+
 func newPhaseTransitionError(id ID, current Phase, expected PhaseTransition, msg string) error {
 	return errors.Wrap(&PhaseTransitionError{
 		ID:              id,
@@ -111,3 +130,11 @@ func IsPhaseTransitionError(err error) bool {
 	_, ok := cause.(*PhaseTransitionError)
 	return ok
 }
+
+// IsWithdrawalExpiredError returns true if the error was a
+// WithdrawalExpiredError.
+func IsWithdrawalExpiredError(err error) bool {
+	cause := errors.Cause(err)
+	_, ok := cause.(*WithdrawalExpiredError)
+	return ok
+}
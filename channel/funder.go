@@ -35,6 +35,14 @@ type (
 		// return a PeerTimedOutFundingError containing the index of the peer who
 		// did not fund in time. The framework will then initiate the dispute
 		// process.
+		// Fund must be idempotent: when a client is restored while a channel
+		// is still being funded, Fund is called again with the same request.
+		// Funds that were already deposited must not be deposited again.
+		//
+		// Fund is also called to deposit additional funds into a funded
+		// ledger channel, see FundingReq.TopUp. Top-ups are repeated on
+		// retry and restore and thus must be idempotent, too: a top-up is
+		// complete once the channel's holdings cover the requested state.
 		Fund(context.Context, FundingReq) error
 	}
 
@@ -44,6 +52,11 @@ type (
 		State     *State
 		Idx       Index    // our index
 		Agreement Balances // FundingAgreement from the channel proposal.
+		// TopUp is set if funds are deposited into a channel that is already
+		// funded. State is then the new state, which must be covered by the
+		// channel's holdings once all deposits are complete, and Agreement
+		// contains the amounts that each participant deposits additionally.
+		TopUp bool
 	}
 
 	// A FundingTimeoutError indicates that some peers failed funding some assets in time.
@@ -69,6 +82,19 @@ func NewFundingReq(params *Params, state *State, idx Index, agreement Balances)
 	}
 }
 
+// NewTopUpReq returns a new FundingReq for depositing additional funds into a
+// funded channel. The deposits and the balances of the previous state sum to
+// the balances of the given new state, for each asset.
+func NewTopUpReq(params *Params, state *State, idx Index, deposits Balances) *FundingReq {
+	return &FundingReq{
+		Params:    params,
+		State:     state,
+		Idx:       idx,
+		Agreement: deposits,
+		TopUp:     true,
+	}
+}
+
 // NewFundingTimeoutError creates a new FundingTimeoutError.
 func NewFundingTimeoutError(fundingErrs []*AssetFundingError) error {
 	if len(fundingErrs) == 0 {
@@ -62,10 +62,19 @@ type (
 		CurrentTX() Transaction // CurrentTX is the current transaction (State+complete list of sigs).
 		Phase() Phase           // Phase is the phase in which the channel is currently in.
 	}
+
+	// A PipelinedSource is a Source that additionally provides the pipelined
+	// transactions of a channel, see StateMachine.Pipeline.
+	PipelinedSource interface {
+		Source
+		// PipelinedTXs are the transactions that are staged after the staging
+		// transaction, in ascending version order.
+		PipelinedTXs() []Transaction
+	}
 )
 
 var (
-	_ Source             = (*machine)(nil)
+	_ PipelinedSource    = (*machine)(nil)
 	_ perunio.Serializer = (*Phase)(nil)
 )
 
@@ -137,6 +146,10 @@ type machine struct {
 	currentTX Transaction
 	prevTXs   []Transaction
 
+	// pipelinedTXs are the transactions that are staged after stagingTX, each
+	// building on its predecessor. They are only used in the Signing phase.
+	pipelinedTXs []Transaction
+
 	// logger embedding
 	log.Embedding
 }
@@ -165,6 +178,9 @@ func restoreMachine(acc wallet.Account, source Source) (*machine, error) {
 	m.phase = source.Phase()
 	m.stagingTX = source.StagingTX()
 	m.currentTX = source.CurrentTX()
+	if ps, ok := source.(PipelinedSource); ok {
+		m.pipelinedTXs = ps.PipelinedTXs()
+	}
 	return m, nil
 }
 
@@ -274,6 +290,115 @@ func (m *machine) StagingTX() Transaction {
 	return m.stagingTX
 }
 
+// PipelinedTXs returns the transactions that are staged after the staging
+// transaction, in ascending version order.
+func (m *machine) PipelinedTXs() []Transaction {
+	return m.pipelinedTXs
+}
+
+// LatestState returns the newest state of the machine, i.e., the last
+// pipelined state, the staging state or the current state, in that order.
+// Clone the state first if you need to modify it.
+func (m *machine) LatestState() *State {
+	if n := len(m.pipelinedTXs); n > 0 {
+		return m.pipelinedTXs[n-1].State
+	}
+	if m.phase == Signing && m.stagingTX.State != nil {
+		return m.stagingTX.State
+	}
+	return m.currentTX.State
+}
+
+// StagedTX returns the staging or pipelined transaction with the given
+// version and whether it exists.
+func (m *machine) StagedTX(version uint64) (Transaction, bool) {
+	tx := m.stagedTX(version)
+	if tx == nil {
+		return Transaction{}, false
+	}
+	return *tx, true
+}
+
+// stagedTX returns a pointer to the staging or pipelined transaction with the
+// given version, or nil if there is none.
+func (m *machine) stagedTX(version uint64) *Transaction {
+	if m.phase != Signing || m.stagingTX.State == nil {
+		return nil
+	}
+	if m.stagingTX.Version == version {
+		return &m.stagingTX
+	}
+	for i := range m.pipelinedTXs {
+		if m.pipelinedTXs[i].Version == version {
+			return &m.pipelinedTXs[i]
+		}
+	}
+	return nil
+}
+
+// SigAt returns the own signature on the staging or pipelined state with the
+// given version. Like Sig, the signature is calculated and saved if it was
+// not calculated before.
+func (m *machine) SigAt(version uint64) (sig wallet.Sig, err error) {
+	tx := m.stagedTX(version)
+	if tx == nil {
+		return nil, errors.Errorf("no staged transaction with version %d", version)
+	}
+
+	if tx.Sigs[m.idx] == nil {
+		if tx.Sigs[m.idx], err = Sign(m.acc, tx.State); err != nil {
+			return nil, err
+		}
+	}
+	return tx.Sigs[m.idx], nil
+}
+
+// AddSigAt verifies the provided signature of another participant on the
+// staging or pipelined state with the given version and if successful adds it
+// to the respective transaction. Like AddSig, it errors if the signature has
+// already been set.
+func (m *machine) AddSigAt(version uint64, idx Index, sig wallet.Sig) error {
+	tx := m.stagedTX(version)
+	if tx == nil {
+		return errors.Errorf("no staged transaction with version %d", version)
+	}
+
+	if tx.Sigs[idx] != nil {
+		return errors.Errorf("signature for idx %d already present (ID: %x)", idx, m.params.id)
+	}
+
+	if ok, err := Verify(m.params.Parts[idx], tx.State, sig); err != nil {
+		return err
+	} else if !ok {
+		return errors.Errorf("invalid signature for idx %d (ID: %x)", idx, m.params.id)
+	}
+
+	tx.Sigs[idx] = sig
+	return nil
+}
+
+// DiscardFrom discards the staging or pipelined transaction with the given
+// version and all transactions that are pipelined after it. If the staging
+// transaction is discarded, the machine's phase is set back to Acting.
+func (m *machine) DiscardFrom(version uint64) error {
+	if m.stagedTX(version) == nil {
+		return errors.Errorf("no staged transaction with version %d", version)
+	}
+	if m.stagingTX.Version == version {
+		return m.DiscardUpdate()
+	}
+	for i := range m.pipelinedTXs {
+		if m.pipelinedTXs[i].Version == version {
+			m.pipelinedTXs = m.pipelinedTXs[:i]
+			break
+		}
+	}
+	if len(m.pipelinedTXs) == 0 {
+		m.pipelinedTXs = nil
+	}
+	return nil
+}
+
 // AddSig verifies the provided signature of another participant on the staging
 // state and if successful adds it to the staged transaction. It also checks
 // whether the signature has already been set and in that case errors.
@@ -306,6 +431,12 @@ func (m *machine) setStaging(phase Phase, state *State) {
 	m.setPhase(phase)
 }
 
+// appendPipelined appends a new transaction with the given state to the
+// pipelined transactions.
+func (m *machine) appendPipelined(state *State) {
+	m.pipelinedTXs = append(m.pipelinedTXs, *m.newTransaction(state))
+}
+
 // DiscardUpdate discards the current staging transaction and sets the machine's
 // phase back to Acting. This method is useful in the case where a valid update
 // request is rejected.
@@ -315,6 +446,7 @@ func (m *machine) DiscardUpdate() error {
 	}
 
 	m.stagingTX = Transaction{} // clear staging tx
+	m.pipelinedTXs = nil        // pipelined txs build on the staging tx
 	m.setPhase(Acting)
 	return nil
 }
@@ -362,6 +494,16 @@ func (m *machine) enableStaged(expected PhaseTransition) error {
 	m.setPhase(expected.To)
 	m.addTx(&m.stagingTX)
 
+	// The next pipelined transaction becomes the staging transaction.
+	if len(m.pipelinedTXs) > 0 {
+		m.stagingTX = m.pipelinedTXs[0]
+		m.pipelinedTXs = m.pipelinedTXs[1:]
+		if len(m.pipelinedTXs) == 0 {
+			m.pipelinedTXs = nil
+		}
+		m.setPhase(Signing)
+	}
+
 	return nil
 }
 
@@ -484,6 +626,12 @@ func (m *machine) expect(tr PhaseTransition) error {
 // A StateMachine will additionally check the validity of the app-specific
 // transition whereas an ActionMachine checks each Action as being valid.
 func (m *machine) validTransition(to *State) error {
+	return m.validTransitionFrom(m.currentTX.State, to)
+}
+
+// validTransitionFrom makes the checks of validTransition for a transition
+// from the state `from` instead of the current state.
+func (m *machine) validTransitionFrom(from, to *State) error {
 	if to.ID != m.params.id {
 		return errors.New("new state's ID doesn't match")
 	}
@@ -494,19 +642,19 @@ func (m *machine) validTransition(to *State) error {
 		return newError(fmt.Sprintf("new state's App doesn't match: %v", err))
 	}
 
-	if m.currentTX.IsFinal {
+	if from.IsFinal {
 		return newError("cannot advance final state")
 	}
 
-	if m.currentTX.Version+1 != to.Version {
-		return newError(fmt.Sprintf("expected version %d, got version %d", m.currentTX.Version+1, to.Version))
+	if from.Version+1 != to.Version {
+		return newError(fmt.Sprintf("expected version %d, got version %d", from.Version+1, to.Version))
 	}
 
 	if err := to.Allocation.Valid(); err != nil {
 		return newError(fmt.Sprintf("invalid allocation: %v", err))
 	}
 
-	if eq, err := big.EqualSum(m.currentTX.Allocation, to.Allocation); err != nil {
+	if eq, err := big.EqualSum(from.Allocation, to.Allocation); err != nil {
 		return newError(fmt.Sprintf("allocation: %v", err))
 	} else if !eq {
 		return newError("allocations must be preserved")
@@ -515,6 +663,143 @@ func (m *machine) validTransition(to *State) error {
 	return nil
 }
 
+// validDeposit checks that `to` is a valid deposit of participant `actor`
+// into the current state. A deposit increases the balances of the depositor
+// and does not change anything else, so the app's transition function is not
+// consulted. Besides the checks of validTransition, it is checked that
+// * the depositor's balances do not decrease and at least one increases
+// * all other fields of the state are unchanged.
+func (m *machine) validDeposit(to *State, actor Index) error {
+	return m.validFundsChange(to, actor, "deposit", 1)
+}
+
+// validWithdrawal checks that `to` is a valid partial withdrawal of
+// participant `actor` from the current state. It is the counterpart of
+// validDeposit: the withdrawer's balances do not increase, at least one
+// decreases, none becomes negative and all other fields are unchanged.
+func (m *machine) validWithdrawal(to *State, actor Index) error {
+	return m.validFundsChange(to, actor, "withdrawal", -1)
+}
+
+// validFundsChange checks that `to` only changes the balances of `actor` in
+// direction `dir`, which is 1 for deposits and -1 for withdrawals.
+func (m *machine) validFundsChange(to *State, actor Index, kind string, dir int) error {
+	if actor >= m.N() {
+		return errors.New("actor index is out of range")
+	}
+	if to.ID != m.params.id {
+		return errors.New("new state's ID doesn't match")
+	}
+
+	newError := func(s string) error { return NewStateTransitionError(m.params.id, s) }
+
+	if m.currentTX.IsFinal {
+		return newError("cannot advance final state")
+	}
+
+	if m.currentTX.Version+1 != to.Version {
+		return newError(fmt.Sprintf("expected version %d, got version %d", m.currentTX.Version+1, to.Version))
+	}
+
+	if len(to.Balances) != len(m.currentTX.Balances) {
+		return newError(kind + " must not change the assets")
+	}
+	expected := m.currentTX.State.Clone()
+	expected.Version = to.Version
+	changed := false
+	for a, bals := range to.Balances {
+		if len(bals) != len(expected.Balances[a]) {
+			return newError(fmt.Sprintf("wrong number of balances for asset %d", a))
+		}
+		if bals[actor] == nil || bals[actor].Sign() < 0 {
+			return newError(fmt.Sprintf("invalid balance for asset %d", a))
+		}
+		switch bals[actor].Cmp(expected.Balances[a][actor]) {
+		case 0:
+			continue
+		case dir:
+			changed = true
+			expected.Balances[a][actor] = bals[actor]
+		default:
+			return newError(fmt.Sprintf("%s must not move balances in the opposite direction", kind))
+		}
+	}
+	if !changed {
+		return newError(kind + " must change a balance")
+	}
+	if err := expected.Equal(to); err != nil {
+		return newError(fmt.Sprintf("%s must only change the actor's balances: %v", kind, err))
+	}
+	return nil
+}
+
+// validAssetChange checks that `to` adds or removes exactly one asset of the
+// current state. An added asset is appended to the assets and may have
+// arbitrary balances, which need to be funded before the state is enabled.
+// A removed asset must not hold any balance. Asset changes are not possible
+// while funds are locked in sub-channels. All other fields of the state must
+// be unchanged.
+func (m *machine) validAssetChange(to *State, actor Index) error {
+	if actor >= m.N() {
+		return errors.New("actor index is out of range")
+	}
+	if to.ID != m.params.id {
+		return errors.New("new state's ID doesn't match")
+	}
+
+	newError := func(s string) error { return NewStateTransitionError(m.params.id, s) }
+
+	if m.currentTX.IsFinal {
+		return newError("cannot advance final state")
+	}
+
+	if m.currentTX.Version+1 != to.Version {
+		return newError(fmt.Sprintf("expected version %d, got version %d", m.currentTX.Version+1, to.Version))
+	}
+
+	if err := to.Allocation.Valid(); err != nil {
+		return newError(fmt.Sprintf("invalid allocation: %v", err))
+	}
+
+	cur := m.currentTX.State
+	if len(cur.Locked) > 0 || len(to.Locked) > 0 {
+		return newError("assets cannot be changed while funds are locked in sub-channels")
+	}
+
+	expected := cur.Clone()
+	expected.Version = to.Version
+	switch len(to.Assets) {
+	case len(cur.Assets) + 1:
+		added := len(to.Assets) - 1
+		if _, ok := cur.AssetIndex(to.Assets[added]); ok {
+			return newError("added asset is already in the channel")
+		}
+		expected.Assets = append(expected.Assets, to.Assets[added])
+		expected.Balances = append(expected.Balances, CloneBals(to.Balances[added]))
+	case len(cur.Assets) - 1:
+		removed := len(to.Assets)
+		for a := range to.Assets {
+			if !cur.Assets[a].Equal(to.Assets[a]) {
+				removed = a
+				break
+			}
+		}
+		for _, bal := range cur.Balances[removed] {
+			if bal.Sign() != 0 {
+				return newError("only assets without balances can be removed")
+			}
+		}
+		expected.Assets = append(expected.Assets[:removed], expected.Assets[removed+1:]...)
+		expected.Balances = append(expected.Balances[:removed], expected.Balances[removed+1:]...)
+	default:
+		return newError("exactly one asset must be added or removed")
+	}
+	if err := expected.Equal(to); err != nil {
+		return newError(fmt.Sprintf("asset change must not change anything else: %v", err))
+	}
+	return nil
+}
+
 // phaseErrorf constructs a new PhaseTransitionError.
 func (m *machine) phaseErrorf(expected PhaseTransition, format string, args ...interface{}) error {
 	return newPhaseTransitionErrorf(m.params.ID(), m.phase, expected, format, args...)
@@ -534,15 +819,24 @@ func (m *machine) Clone() *machine {
 		}
 	}
 
+	var pipelinedTXs []Transaction
+	if m.pipelinedTXs != nil {
+		pipelinedTXs = make([]Transaction, len(m.pipelinedTXs))
+		for i, tx := range m.pipelinedTXs {
+			pipelinedTXs[i] = tx.Clone()
+		}
+	}
+
 	return &machine{
-		phase:     m.phase,
-		acc:       m.acc,
-		idx:       m.idx,
-		params:    *m.params.Clone(),
-		stagingTX: m.stagingTX.Clone(),
-		currentTX: m.currentTX.Clone(),
-		prevTXs:   prevTXs,
-		Embedding: m.Embedding,
+		phase:        m.phase,
+		acc:          m.acc,
+		idx:          m.idx,
+		params:       *m.params.Clone(),
+		stagingTX:    m.stagingTX.Clone(),
+		currentTX:    m.currentTX.Clone(),
+		prevTXs:      prevTXs,
+		pipelinedTXs: pipelinedTXs,
+		Embedding:    m.Embedding,
 	}
 }
 
@@ -15,8 +15,10 @@
 package channel_test
 
 import (
+	"math/big"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/channel/test"
@@ -38,3 +40,372 @@ func TestMachineClone(t *testing.T) {
 	require.NoError(t, err)
 	pkgtest.VerifyClone(t, am)
 }
+
+// actionApp hides the StateApp methods of the wrapped MockApp.
+type actionApp struct {
+	channel.ActionApp
+}
+
+func TestActionMachineOf(t *testing.T) {
+	rng := pkgtest.Prng(t)
+
+	accs, parts := wtest.NewRandomAccounts(rng, 2)
+	app := actionApp{channel.NewMockApp(wtest.NewRandomAddress(rng))}
+	params := *test.NewRandomParams(rng, test.WithParts(parts...), test.WithApp(app))
+	alloc := test.NewRandomAllocation(rng, test.WithNumParts(2))
+
+	sm, err := channel.NewStateMachine(accs[0], params)
+	require.NoError(t, err)
+	require.NoError(t, sm.Init(*alloc, channel.NewMockOp(channel.OpValid)))
+	_, err = sm.Sig()
+	require.NoError(t, err)
+	sig, err := channel.Sign(accs[1], sm.StagingState())
+	require.NoError(t, err)
+	require.NoError(t, sm.AddSig(1, sig))
+	require.NoError(t, sm.EnableInit())
+	require.NoError(t, sm.SetFunded())
+
+	t.Run("full state update", func(t *testing.T) {
+		next := sm.State().Clone()
+		next.Version++
+		next.Data = channel.NewMockOp(channel.OpErr)
+		assert.True(t, channel.IsStateTransitionError(sm.Update(next, 0)))
+
+		next.Data = sm.State().Data
+		next.IsFinal = true
+		assert.NoError(t, sm.Update(next, 0))
+		assert.NoError(t, sm.DiscardUpdate())
+	})
+
+	t.Run("actions", func(t *testing.T) {
+		am, err := channel.ActionMachineOf(sm)
+		require.NoError(t, err)
+
+		assert.True(t, channel.IsActionError(am.AddAction(0, channel.NewMockOp(channel.OpActionErr))))
+		require.NoError(t, am.AddAction(0, channel.NewMockOp(channel.OpValid)))
+		require.NoError(t, am.AddAction(1, channel.NewMockOp(channel.OpValid)))
+		require.NoError(t, am.Update())
+
+		// The machine is shared with the StateMachine.
+		assert.Equal(t, channel.Signing, sm.Phase())
+		assert.Equal(t, sm.State().Version+1, sm.StagingState().Version)
+	})
+
+	t.Run("no ActionApp", func(t *testing.T) {
+		params := *test.NewRandomParams(rng, test.WithParts(parts...), test.WithoutApp())
+		sm, err := channel.NewStateMachine(accs[0], params)
+		require.NoError(t, err)
+		_, err = channel.ActionMachineOf(sm)
+		assert.Error(t, err)
+	})
+}
+
+func TestStateMachineDeposit(t *testing.T) {
+	rng := pkgtest.Prng(t)
+
+	accs, parts := wtest.NewRandomAccounts(rng, 2)
+	params := *test.NewRandomParams(rng, test.WithParts(parts...), test.WithoutApp())
+	alloc := test.NewRandomAllocation(rng, test.WithNumParts(2), test.WithNumLocked(0))
+
+	sm, err := channel.NewStateMachine(accs[0], params)
+	require.NoError(t, err)
+	require.NoError(t, sm.Init(*alloc, channel.NoData()))
+	_, err = sm.Sig()
+	require.NoError(t, err)
+	sig, err := channel.Sign(accs[1], sm.StagingState())
+	require.NoError(t, err)
+	require.NoError(t, sm.AddSig(1, sig))
+	require.NoError(t, sm.EnableInit())
+	require.NoError(t, sm.SetFunded())
+
+	deposit := func(actor channel.Index, amount int64) *channel.State {
+		next := sm.State().Clone()
+		next.Version++
+		next.Balances[0][actor] = new(big.Int).Add(next.Balances[0][actor], big.NewInt(amount))
+		return next
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		// A deposit must not be a regular update and vice versa.
+		assert.True(t, channel.IsStateTransitionError(sm.Update(deposit(1, 1), 1)))
+		assert.True(t, channel.IsStateTransitionError(sm.Deposit(deposit(1, 0), 1)))
+		assert.True(t, channel.IsStateTransitionError(sm.Deposit(deposit(1, -1), 1)))
+		// Only the depositor's balances may change.
+		assert.True(t, channel.IsStateTransitionError(sm.Deposit(deposit(1, 1), 0)))
+		next := deposit(1, 1)
+		next.IsFinal = true
+		assert.True(t, channel.IsStateTransitionError(sm.Deposit(next, 1)))
+		next = deposit(1, 1)
+		next.Version++
+		assert.True(t, channel.IsStateTransitionError(sm.Deposit(next, 1)))
+		assert.Equal(t, channel.Acting, sm.Phase())
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		next := deposit(1, 1)
+		sig, err := channel.Sign(accs[1], next)
+		require.NoError(t, err)
+		require.NoError(t, sm.CheckDeposit(next, 1, sig, 1))
+		assert.Error(t, sm.CheckDeposit(next, 1, sig, 0))
+
+		require.NoError(t, sm.Deposit(next, 1))
+		assert.Equal(t, channel.Signing, sm.Phase())
+		_, err = sm.Sig()
+		require.NoError(t, err)
+		require.NoError(t, sm.AddSig(1, sig))
+		require.NoError(t, sm.EnableUpdate())
+		assert.Equal(t, next, sm.State())
+	})
+}
+
+func TestStateMachineWithdrawPartial(t *testing.T) {
+	rng := pkgtest.Prng(t)
+
+	accs, parts := wtest.NewRandomAccounts(rng, 2)
+	params := *test.NewRandomParams(rng, test.WithParts(parts...), test.WithoutApp())
+	alloc := test.NewRandomAllocation(rng, test.WithNumParts(2), test.WithNumLocked(0))
+	alloc.Balances[0][1] = big.NewInt(10)
+
+	sm, err := channel.NewStateMachine(accs[0], params)
+	require.NoError(t, err)
+	require.NoError(t, sm.Init(*alloc, channel.NoData()))
+	_, err = sm.Sig()
+	require.NoError(t, err)
+	sig, err := channel.Sign(accs[1], sm.StagingState())
+	require.NoError(t, err)
+	require.NoError(t, sm.AddSig(1, sig))
+	require.NoError(t, sm.EnableInit())
+	require.NoError(t, sm.SetFunded())
+
+	withdraw := func(actor channel.Index, amount int64) *channel.State {
+		next := sm.State().Clone()
+		next.Version++
+		next.Balances[0][actor] = new(big.Int).Sub(next.Balances[0][actor], big.NewInt(amount))
+		return next
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		// A withdrawal must not be a regular update or a deposit.
+		assert.True(t, channel.IsStateTransitionError(sm.Update(withdraw(1, 1), 1)))
+		assert.True(t, channel.IsStateTransitionError(sm.Deposit(withdraw(1, 1), 1)))
+		assert.True(t, channel.IsStateTransitionError(sm.WithdrawPartial(withdraw(1, 0), 1)))
+		assert.True(t, channel.IsStateTransitionError(sm.WithdrawPartial(withdraw(1, -1), 1)))
+		assert.True(t, channel.IsStateTransitionError(sm.WithdrawPartial(withdraw(1, 11), 1)))
+		// Only the withdrawer's balances may change.
+		assert.True(t, channel.IsStateTransitionError(sm.WithdrawPartial(withdraw(1, 1), 0)))
+		next := withdraw(1, 1)
+		next.IsFinal = true
+		assert.True(t, channel.IsStateTransitionError(sm.WithdrawPartial(next, 1)))
+		assert.Equal(t, channel.Acting, sm.Phase())
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		next := withdraw(1, 10)
+		sig, err := channel.Sign(accs[1], next)
+		require.NoError(t, err)
+		require.NoError(t, sm.CheckWithdrawPartial(next, 1, sig, 1))
+		assert.Error(t, sm.CheckWithdrawPartial(next, 1, sig, 0))
+
+		auth := channel.NewWithdrawalAuth(sm.State(), next, 1)
+		assert.Equal(t, big.NewInt(10), auth.Amounts[0])
+		authSig, err := channel.SignWithdrawalAuth(accs[1], auth)
+		require.NoError(t, err)
+		ok, err := channel.VerifyWithdrawalAuth(parts[1], auth, authSig)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = channel.VerifyWithdrawalAuth(parts[0], auth, authSig)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		require.NoError(t, sm.WithdrawPartial(next, 1))
+		assert.Equal(t, channel.Signing, sm.Phase())
+		_, err = sm.Sig()
+		require.NoError(t, err)
+		require.NoError(t, sm.AddSig(1, sig))
+		require.NoError(t, sm.EnableUpdate())
+		assert.Equal(t, next, sm.State())
+	})
+}
+
+func TestStateMachineChangeAssets(t *testing.T) {
+	rng := pkgtest.Prng(t)
+
+	accs, parts := wtest.NewRandomAccounts(rng, 2)
+	params := *test.NewRandomParams(rng, test.WithParts(parts...), test.WithoutApp())
+	alloc := test.NewRandomAllocation(rng, test.WithNumParts(2), test.WithNumAssets(1), test.WithNumLocked(0))
+
+	sm, err := channel.NewStateMachine(accs[0], params)
+	require.NoError(t, err)
+	require.NoError(t, sm.Init(*alloc, channel.NoData()))
+	_, err = sm.Sig()
+	require.NoError(t, err)
+	sig, err := channel.Sign(accs[1], sm.StagingState())
+	require.NoError(t, err)
+	require.NoError(t, sm.AddSig(1, sig))
+	require.NoError(t, sm.EnableInit())
+	require.NoError(t, sm.SetFunded())
+
+	addAsset := func(bals ...int64) *channel.State {
+		next := sm.State().Clone()
+		next.Version++
+		next.Assets = append(next.Assets, test.NewRandomAsset(rng))
+		next.Balances = append(next.Balances, []channel.Bal{big.NewInt(bals[0]), big.NewInt(bals[1])})
+		return next
+	}
+	enable := func(next *channel.State) {
+		t.Helper()
+		sig, err := channel.Sign(accs[1], next)
+		require.NoError(t, err)
+		require.NoError(t, sm.CheckAssetChange(next, 1, sig, 1))
+		require.NoError(t, sm.ChangeAssets(next, 1))
+		_, err = sm.Sig()
+		require.NoError(t, err)
+		require.NoError(t, sm.AddSig(1, sig))
+		require.NoError(t, sm.EnableUpdate())
+		assert.Equal(t, next, sm.State())
+	}
+
+	t.Run("invalid add", func(t *testing.T) {
+		// An asset change must not be a regular update.
+		assert.True(t, channel.IsStateTransitionError(sm.Update(addAsset(1, 1), 1)))
+		assert.True(t, channel.IsStateTransitionError(sm.ChangeAssets(addAsset(-1, 1), 1)))
+		// Existing assets can't be added again.
+		next := addAsset(1, 1)
+		next.Assets[1] = next.Assets[0]
+		assert.True(t, channel.IsStateTransitionError(sm.ChangeAssets(next, 1)))
+		// Other balances must not change.
+		next = addAsset(1, 1)
+		next.Balances[0][0] = new(big.Int).Add(next.Balances[0][0], big.NewInt(1))
+		assert.True(t, channel.IsStateTransitionError(sm.ChangeAssets(next, 1)))
+		// Only one asset can be added at a time.
+		next = addAsset(1, 1)
+		next.Assets = append(next.Assets, test.NewRandomAsset(rng))
+		next.Balances = append(next.Balances, []channel.Bal{big.NewInt(1), big.NewInt(1)})
+		assert.True(t, channel.IsStateTransitionError(sm.ChangeAssets(next, 1)))
+		assert.Equal(t, channel.Acting, sm.Phase())
+	})
+
+	t.Run("add", func(t *testing.T) {
+		enable(addAsset(1, 2))
+		enable(addAsset(0, 0))
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		remove := func(idx int) *channel.State {
+			next := sm.State().Clone()
+			next.Version++
+			next.Assets = append(next.Assets[:idx], next.Assets[idx+1:]...)
+			next.Balances = append(next.Balances[:idx], next.Balances[idx+1:]...)
+			return next
+		}
+		// Assets with balances can't be removed.
+		assert.True(t, channel.IsStateTransitionError(sm.ChangeAssets(remove(1), 1)))
+		enable(remove(2))
+		assert.Len(t, sm.State().Assets, 2)
+	})
+}
+
+func TestStateMachinePipeline(t *testing.T) {
+	rng := pkgtest.Prng(t)
+
+	accs, parts := wtest.NewRandomAccounts(rng, 2)
+	params := *test.NewRandomParams(rng, test.WithParts(parts...), test.WithoutApp())
+	alloc := test.NewRandomAllocation(rng, test.WithNumParts(2), test.WithNumLocked(0))
+
+	sm, err := channel.NewStateMachine(accs[0], params)
+	require.NoError(t, err)
+	require.NoError(t, sm.Init(*alloc, channel.NoData()))
+	_, err = sm.Sig()
+	require.NoError(t, err)
+	sig, err := channel.Sign(accs[1], sm.StagingState())
+	require.NoError(t, err)
+	require.NoError(t, sm.AddSig(1, sig))
+	require.NoError(t, sm.EnableInit())
+	require.NoError(t, sm.SetFunded())
+
+	next := func() *channel.State {
+		s := sm.LatestState().Clone()
+		s.Version++
+		return s
+	}
+	sign := func(version uint64) {
+		_, err := sm.SigAt(version)
+		require.NoError(t, err)
+		tx, ok := sm.StagedTX(version)
+		require.True(t, ok)
+		sig, err := channel.Sign(accs[1], tx.State)
+		require.NoError(t, err)
+		require.NoError(t, sm.AddSigAt(version, 1, sig))
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		// Pipelining requires a staging transaction.
+		assert.Error(t, sm.Pipeline(next(), 0))
+		require.NoError(t, sm.Update(next(), 0))
+		s := next()
+		s.Version++
+		assert.True(t, channel.IsStateTransitionError(sm.Pipeline(s, 0)))
+		s = next()
+		s.Balances[0][0] = new(big.Int).Add(s.Balances[0][0], big.NewInt(1))
+		assert.True(t, channel.IsStateTransitionError(sm.Pipeline(s, 0)))
+		assert.Error(t, sm.AddSigAt(3, 1, sig))
+		require.NoError(t, sm.DiscardUpdate())
+	})
+
+	t.Run("in order", func(t *testing.T) {
+		v := sm.State().Version
+		require.NoError(t, sm.Update(next(), 0))
+		s := next()
+		sig, err := channel.Sign(accs[1], s)
+		require.NoError(t, err)
+		require.NoError(t, sm.CheckPipelined(s, 1, sig, 1))
+		require.NoError(t, sm.Pipeline(s, 1))
+		require.NoError(t, sm.Pipeline(next(), 0))
+		assert.Equal(t, v+3, sm.LatestState().Version)
+		assert.Len(t, sm.PipelinedTXs(), 2)
+
+		// A pipelined transaction is only enabled after its predecessors.
+		sign(v + 2)
+		sign(v + 1)
+		require.NoError(t, sm.EnableUpdate())
+		assert.Equal(t, v+1, sm.State().Version)
+		assert.Equal(t, channel.Signing, sm.Phase())
+		require.NoError(t, sm.EnableUpdate())
+		assert.Equal(t, v+2, sm.State().Version)
+		assert.Error(t, sm.EnableUpdate())
+		sign(v + 3)
+		require.NoError(t, sm.EnableUpdate())
+		assert.Equal(t, v+3, sm.State().Version)
+		assert.Equal(t, channel.Acting, sm.Phase())
+		assert.Empty(t, sm.PipelinedTXs())
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		v := sm.State().Version
+		require.NoError(t, sm.Update(next(), 0))
+		require.NoError(t, sm.Pipeline(next(), 0))
+		require.NoError(t, sm.Pipeline(next(), 0))
+		assert.Error(t, sm.DiscardFrom(v+4))
+
+		require.NoError(t, sm.DiscardFrom(v+3))
+		assert.Equal(t, v+2, sm.LatestState().Version)
+		assert.Equal(t, channel.Signing, sm.Phase())
+
+		require.NoError(t, sm.DiscardFrom(v+1))
+		assert.Equal(t, v, sm.LatestState().Version)
+		assert.Equal(t, channel.Acting, sm.Phase())
+		assert.Empty(t, sm.PipelinedTXs())
+	})
+
+	t.Run("final", func(t *testing.T) {
+		require.NoError(t, sm.Update(next(), 0))
+		s := next()
+		s.IsFinal = true
+		require.NoError(t, sm.Pipeline(s, 0))
+		assert.True(t, channel.IsStateTransitionError(sm.Pipeline(next(), 0)))
+		clone := sm.Clone()
+		assert.Equal(t, sm.PipelinedTXs(), clone.PipelinedTXs())
+		require.NoError(t, sm.DiscardUpdate())
+		assert.Len(t, clone.PipelinedTXs(), 1)
+	})
+}
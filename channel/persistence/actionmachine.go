@@ -0,0 +1,48 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+)
+
+// An ActionMachine is a wrapper around a channel.ActionMachine that forwards
+// calls to it and, if successful, persists changed data using a Persister.
+type ActionMachine struct {
+	*channel.ActionMachine
+	pr Persister
+}
+
+// FromActionMachine creates a persisting ActionMachine wrapper around the
+// passed ActionMachine using the Persister pr.
+func FromActionMachine(m *channel.ActionMachine, pr Persister) ActionMachine {
+	return ActionMachine{
+		ActionMachine: m,
+		pr:            pr,
+	}
+}
+
+// Update calls Update on the channel.ActionMachine and then persists the
+// changed staging state.
+func (m ActionMachine) Update(ctx context.Context) error {
+	if err := m.ActionMachine.Update(); err != nil {
+		return err
+	}
+	return errors.WithMessage(m.pr.Staged(ctx, m.ActionMachine), "Persister.Staged")
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvalue
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
+	"perun.network/go-perun/wire/perunio"
+	"polycry.pt/poly-go/sortedkv"
+)
+
+var _ persistence.TransactionIterator = (*TransactionIterator)(nil)
+
+// TransactionIterator implements the persistence.TransactionIterator
+// interface.
+type TransactionIterator struct {
+	err error
+	tx  channel.Transaction
+	it  sortedkv.Iterator
+}
+
+// RestoreHistory returns an iterator over all archived transactions of the
+// given channel, in ascending version order. History must be enabled.
+func (pr *PersistRestorer) RestoreHistory(_ context.Context, id channel.ID) (persistence.TransactionIterator, error) {
+	if !pr.history {
+		return nil, errors.New("history not enabled")
+	}
+	return &TransactionIterator{it: pr.historyDB(id).NewIterator()}, nil
+}
+
+// Next advances the iterator and returns whether there is another
+// transaction.
+func (i *TransactionIterator) Next(context.Context) bool {
+	if i.err != nil || !i.it.Next() {
+		return false
+	}
+	i.tx = channel.Transaction{}
+	buf := bytes.NewBuffer(i.it.ValueBytes())
+	if i.err = errors.WithMessage(perunio.Decode(buf, &i.tx), "decoding transaction"); i.err != nil {
+		return false
+	}
+	if buf.Len() != 0 {
+		i.err = errors.Errorf("decoding transaction incomplete (%d bytes left)", buf.Len())
+	}
+	return i.err == nil
+}
+
+// Transaction returns the iterator's current transaction.
+func (i *TransactionIterator) Transaction() channel.Transaction {
+	return i.tx
+}
+
+// Close closes the iterator and releases its resources. It returns the last
+// error that occurred when advancing the iterator.
+func (i *TransactionIterator) Close() error {
+	if err := i.it.Close(); err != nil && i.err == nil {
+		i.err = err
+	}
+	return i.err
+}
@@ -75,3 +75,36 @@ func (id optChannelIDDec) Decode(r io.Reader) error {
 	*id.ID = nil
 	return nil
 }
+
+// pipelinedTXs is a helper type to allow for de-/encoding of a channel's
+// pipelined transactions. An empty list is encoded as an empty value.
+type pipelinedTXs []channel.Transaction
+
+func (txs pipelinedTXs) Encode(w io.Writer) error {
+	if len(txs) == 0 {
+		return nil
+	}
+	if err := perunio.Encode(w, uint32(len(txs))); err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if err := perunio.Encode(w, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (txs *pipelinedTXs) Decode(r io.Reader) error {
+	var n uint32
+	if err := perunio.Decode(r, &n); err != nil {
+		return err
+	}
+	*txs = make(pipelinedTXs, n)
+	for i := range *txs {
+		if err := perunio.Decode(r, &(*txs)[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ package keyvalue
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"math"
 	"regexp"
@@ -26,6 +27,7 @@ import (
 	"github.com/pkg/errors"
 
 	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
 	"perun.network/go-perun/wire/perunio"
 	"polycry.pt/poly-go/sortedkv"
@@ -36,7 +38,7 @@ func (pr *PersistRestorer) ChannelCreated(_ context.Context, s channel.Source, p
 	db := pr.channelDB(s.ID()).NewBatch()
 	// Write the channel data in the "Channel" table.
 	numParts := len(s.Params().Parts)
-	keys := append([]string{"current", "index", "params", "phase", "staging:state"},
+	keys := append([]string{"current", "index", "params", "phase", "pipelined", "staging:state"},
 		sigKeys(numParts)...)
 	if err := dbPutSource(db, s, keys...); err != nil {
 		return err
@@ -46,6 +48,21 @@ func (pr *PersistRestorer) ChannelCreated(_ context.Context, s channel.Source, p
 		return errors.WithMessage(err, "putting parent ID")
 	}
 
+	// The funding agreement is set by FundingAgreed.
+	if err := dbPut(db, "funding", []byte("")); err != nil {
+		return errors.WithMessage(err, "putting funding agreement")
+	}
+
+	// The next hop is set by VirtualChannelForwarded.
+	if err := dbPut(db, "nexthop", optChannelIDEnc{nil}); err != nil {
+		return errors.WithMessage(err, "putting next hop")
+	}
+
+	// The withdrawal signatures are set by WithdrawalAuthorized.
+	if err := dbPut(db, "withdrawal", []byte("")); err != nil {
+		return errors.WithMessage(err, "putting withdrawal signatures")
+	}
+
 	// Write peers in the "Channel" table.
 	if err := dbPut(db, prefix.Peers, wire.AddressesWithLen(peers)); err != nil {
 		return errors.WithMessage(err, "putting peers into channel table")
@@ -66,7 +83,10 @@ func (pr *PersistRestorer) ChannelCreated(_ context.Context, s channel.Source, p
 	if err := db.Apply(); err != nil {
 		return errors.WithMessage(err, "applying channel batch")
 	}
-	return errors.WithMessage(peerdb.Apply(), "applying peer batch")
+	if err := peerdb.Apply(); err != nil {
+		return errors.WithMessage(err, "applying peer batch")
+	}
+	return pr.archive(s)
 }
 
 // sigKey creates a key for given idx and number of channel
@@ -85,7 +105,7 @@ func (pr *PersistRestorer) ChannelRemoved(ctx context.Context, id channel.ID) er
 	if err != nil {
 		return err
 	}
-	keys := append([]string{"current", "index", "params", "peers", "phase", "staging:state"},
+	keys := append([]string{"current", "funding", "index", "nexthop", "params", "peers", "phase", "pipelined", "staging:state", "withdrawal"},
 		sigKeys(len(params.Parts))...)
 
 	for _, key := range keys {
@@ -170,7 +190,42 @@ func (pr *PersistRestorer) Enabled(_ context.Context, s channel.Source) error {
 	if err := dbPutSource(db, s, keys...); err != nil {
 		return err
 	}
-	return errors.WithMessage(db.Apply(), "applying batch")
+	if err := db.Apply(); err != nil {
+		return errors.WithMessage(err, "applying batch")
+	}
+	return pr.archive(s)
+}
+
+// FundingAgreed persists the funding agreement of a ledger channel.
+func (pr *PersistRestorer) FundingAgreed(_ context.Context, id channel.ID, agreement channel.Balances) error {
+	return dbPut(pr.channelDB(id), "funding", agreement)
+}
+
+// WithdrawalAuthorized persists the signatures on the authorization of the
+// staged partial withdrawal.
+func (pr *PersistRestorer) WithdrawalAuthorized(_ context.Context, id channel.ID, sigs []wallet.Sig) error {
+	return dbPut(pr.channelDB(id), "withdrawal", wallet.SigsWithLen(sigs))
+}
+
+// VirtualChannelForwarded persists the next hop of a forwarded virtual
+// channel.
+func (pr *PersistRestorer) VirtualChannelForwarded(_ context.Context, id, next channel.ID) error {
+	return dbPut(pr.channelDB(id), "nexthop", optChannelIDEnc{&next})
+}
+
+// Pipelined persists the channel's pipelined transactions.
+func (pr *PersistRestorer) Pipelined(_ context.Context, s channel.PipelinedSource) error {
+	return dbPutSource(pr.channelDB(s.ID()), s, "pipelined")
+}
+
+// archive adds the channel's current transaction to its history, if history
+// is enabled.
+func (pr *PersistRestorer) archive(s channel.Source) error {
+	tx := s.CurrentTX()
+	if !pr.history || tx.State == nil {
+		return nil
+	}
+	return dbPut(pr.historyDB(s.ID()), historyKey(tx.Version), tx)
 }
 
 // PhaseChanged persists the channel's phase.
@@ -197,6 +252,12 @@ func dbPutSourceField(db sortedkv.Writer, s channel.Source, key string) error {
 		return dbPut(db, key, s.Params())
 	case "phase":
 		return dbPut(db, key, s.Phase())
+	case "pipelined":
+		var txs []channel.Transaction
+		if ps, ok := s.(channel.PipelinedSource); ok {
+			txs = ps.PipelinedTXs()
+		}
+		return dbPut(db, key, pipelinedTXs(txs))
 	case "staging:state":
 		stagingState := s.StagingTX().State
 		return dbPut(db, key, PersistedState{&stagingState})
@@ -256,6 +317,20 @@ func peerChannelKey(p wire.Address, ch channel.ID) (string, error) {
 	return key.String(), nil
 }
 
+// historyKey creates the key of the archived transaction with the given
+// version. The keys sort in the order of the versions.
+func historyKey(version uint64) string {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], version)
+	return string(key[:])
+}
+
+// historyDB creates a prefixed database for archiving a channel's
+// transactions.
+func (pr *PersistRestorer) historyDB(id channel.ID) sortedkv.Database {
+	return sortedkv.NewTable(pr.db, prefix.HistoryDB+string(id[:])+":")
+}
+
 // channelDB creates a prefixed database for persisting a channel's data.
 func (pr *PersistRestorer) channelDB(id channel.ID) sortedkv.Database {
 	return sortedkv.NewTable(pr.db, prefix.ChannelDB+string(id[:])+":")
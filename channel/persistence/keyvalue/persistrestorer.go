@@ -19,12 +19,20 @@ import (
 	"polycry.pt/poly-go/sortedkv"
 )
 
-var _ persistence.PersistRestorer = (*PersistRestorer)(nil)
+var (
+	_ persistence.PersistRestorer     = (*PersistRestorer)(nil)
+	_ persistence.HistoryRestorer     = (*PersistRestorer)(nil)
+	_ persistence.PipelinePersister   = (*PersistRestorer)(nil)
+	_ persistence.FundingPersister    = (*PersistRestorer)(nil)
+	_ persistence.WithdrawalPersister = (*PersistRestorer)(nil)
+	_ persistence.ForwardingPersister = (*PersistRestorer)(nil)
+)
 
 // PersistRestorer implements both the persister and the restorer interface
 // using a sorted key-value store.
 type PersistRestorer struct {
-	db sortedkv.Database
+	db      sortedkv.Database
+	history bool
 }
 
 // Close closes the PersistRestorer and releases all resources it holds.
@@ -42,9 +50,17 @@ func NewPersistRestorer(db sortedkv.Database) *PersistRestorer {
 	}
 }
 
-var prefix = struct{ ChannelDB, PeerDB, SigKey, Peers string }{
+// EnableHistory enables the archiving of every enabled transaction, see
+// persistence.HistoryRestorer. It must be called before the PersistRestorer is
+// used.
+func (pr *PersistRestorer) EnableHistory() {
+	pr.history = true
+}
+
+var prefix = struct{ ChannelDB, PeerDB, HistoryDB, SigKey, Peers string }{
 	ChannelDB: "Chan:",
 	PeerDB:    "Peer:",
+	HistoryDB: "History:",
 	SigKey:    "staging:sig:",
 	Peers:     "peers",
 }
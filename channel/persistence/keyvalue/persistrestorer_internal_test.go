@@ -23,6 +23,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	_ "perun.network/go-perun/backend/sim"
+	"perun.network/go-perun/channel"
 	"perun.network/go-perun/channel/persistence/test"
 	"polycry.pt/poly-go/sortedkv"
 	"polycry.pt/poly-go/sortedkv/leveldb"
@@ -64,3 +65,42 @@ func TestChannelIterator_Next_Empty(t *testing.T) {
 	assert.False(t, success)
 	assert.NoError(t, it.err)
 }
+
+func TestPersistRestorer_History(t *testing.T) {
+	pr := NewPersistRestorer(memorydb.NewDatabase())
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	_, err := pr.RestoreHistory(context.Background(), channel.ID{})
+	assert.Error(t, err, "history not enabled")
+
+	pr.EnableHistory()
+	test.GenericHistoryTest(context.Background(), t, pkgtest.Prng(t), pr)
+}
+
+func TestPersistRestorer_Pipeline(t *testing.T) {
+	pr := NewPersistRestorer(memorydb.NewDatabase())
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	test.GenericPipelineTest(context.Background(), t, pkgtest.Prng(t), pr)
+}
+
+func TestPersistRestorer_Funding(t *testing.T) {
+	pr := NewPersistRestorer(memorydb.NewDatabase())
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	test.GenericFundingTest(context.Background(), t, pkgtest.Prng(t), pr)
+}
+
+func TestPersistRestorer_Withdrawal(t *testing.T) {
+	pr := NewPersistRestorer(memorydb.NewDatabase())
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	test.GenericWithdrawalTest(context.Background(), t, pkgtest.Prng(t), pr)
+}
+
+func TestPersistRestorer_Forwarding(t *testing.T) {
+	pr := NewPersistRestorer(memorydb.NewDatabase())
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	test.GenericForwardingTest(context.Background(), t, pkgtest.Prng(t), pr)
+}
@@ -187,11 +187,14 @@ func (i *ChannelIterator) Next(context.Context) bool {
 
 	i.ch = persistence.NewChannel()
 	if !i.decodeNext("current", &i.ch.CurrentTXV, allowEnd) ||
+		!i.decodeNext("funding", &i.ch.FundingAgreement, allowEmpty) ||
 		!i.decodeNext("index", &i.ch.IdxV, noOpts) ||
+		!i.decodeNext("nexthop", optChannelIDDec{&i.ch.NextHop}, noOpts) ||
 		!i.decodeNext("params", i.ch.ParamsV, noOpts) ||
 		!i.decodeNext("parent", optChannelIDDec{&i.ch.Parent}, noOpts) ||
 		!i.decodeNext("peers", (*wire.AddressesWithLen)(&i.ch.PeersV), noOpts) ||
-		!i.decodeNext("phase", &i.ch.PhaseV, noOpts) {
+		!i.decodeNext("phase", &i.ch.PhaseV, noOpts) ||
+		!i.decodeNext("pipelined", (*pipelinedTXs)(&i.ch.PipelinedTXsV), allowEmpty) {
 		return false
 	}
 	i.ch.StagingTXV.Sigs = make([]wallet.Sig, len(i.ch.ParamsV.Parts))
@@ -199,7 +202,8 @@ func (i *ChannelIterator) Next(context.Context) bool {
 		i.decodeNext(key, wallet.SigDec{Sig: &i.ch.StagingTXV.Sigs[idx]}, allowEmpty)
 	}
 
-	return i.decodeNext("staging:state", &PersistedState{&i.ch.StagingTXV.State}, allowEmpty)
+	return i.decodeNext("staging:state", &PersistedState{&i.ch.StagingTXV.State}, allowEmpty) &&
+		i.decodeNext("withdrawal", (*wallet.SigsWithLen)(&i.ch.WithdrawalAuthSigs), allowEmpty)
 }
 
 // recoverFromEmptyIterator is called when there is no iterator or when the
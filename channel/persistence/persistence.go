@@ -19,6 +19,7 @@ import (
 	"io"
 
 	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
 )
 
@@ -82,6 +83,76 @@ type (
 		RestoreChannel(context.Context, channel.ID) (*Channel, error)
 	}
 
+	// A HistoryRestorer is a Restorer that additionally archives every enabled
+	// transaction of a channel, i.e., every current transaction passed to
+	// ChannelCreated or Enabled. The history of a channel is kept after the
+	// channel is removed.
+	HistoryRestorer interface {
+		Restorer
+
+		// RestoreHistory should return an iterator over all archived
+		// transactions of the channel with the given ID, in ascending version
+		// order.
+		RestoreHistory(context.Context, channel.ID) (TransactionIterator, error)
+	}
+
+	// A PipelinePersister is a Persister that additionally persists the
+	// pipelined transactions of a channel, see channel.StateMachine.Pipeline.
+	// If the Persister of a client does not implement this interface, pipelined
+	// transactions are lost on restart and get resolved by the channel sync.
+	PipelinePersister interface {
+		Persister
+
+		// Pipelined is called when the pipelined transactions of a channel
+		// changed, i.e., a transaction was pipelined, a signature was added to a
+		// pipelined transaction, or pipelined transactions were enabled or
+		// discarded. All pipelined transactions of the source, together with
+		// their currently known signatures, should be persisted, replacing any
+		// previously persisted ones.
+		Pipelined(context.Context, channel.PipelinedSource) error
+	}
+
+	// A FundingPersister is a Persister that additionally persists the funding
+	// agreement of ledger channels, which may differ from the initial balances.
+	// The funding of a ledger channel that is restored before it was funded is
+	// only resumed if its funding agreement was persisted.
+	FundingPersister interface {
+		Persister
+
+		// FundingAgreed is called after ChannelCreated for every ledger
+		// channel. The funding agreement should be persisted until the channel
+		// is removed.
+		FundingAgreed(ctx context.Context, id channel.ID, agreement channel.Balances) error
+	}
+
+	// A WithdrawalPersister is a Persister that additionally persists the
+	// signatures on the authorization of a partial withdrawal, see
+	// channel.WithdrawalAuth. A partial withdrawal that is staged when the
+	// channel is restored is only resumed if its signatures were persisted.
+	WithdrawalPersister interface {
+		Persister
+
+		// WithdrawalAuthorized is called with the signatures of all
+		// participants on the authorization of the staged partial withdrawal
+		// before it is executed on-chain. It is called with nil signatures once
+		// the withdrawal was executed or expired. The signatures should be
+		// persisted until they are replaced or the channel is removed.
+		WithdrawalAuthorized(ctx context.Context, id channel.ID, sigs []wallet.Sig) error
+	}
+
+	// A ForwardingPersister is a Persister that additionally persists the next
+	// hop of virtual channels whose funding was forwarded by an intermediary.
+	// The settlement of a forwarded virtual channel that is restored can only
+	// be forwarded if its next hop was persisted.
+	ForwardingPersister interface {
+		Persister
+
+		// VirtualChannelForwarded is called after ChannelCreated when the
+		// funding of the virtual channel id is forwarded to the ledger channel
+		// next. The next hop should be persisted until the channel is removed.
+		VirtualChannelForwarded(ctx context.Context, id, next channel.ID) error
+	}
+
 	// PersistRestorer is a Persister and Restorer on the same data source and
 	// data sink.
 	PersistRestorer interface {
@@ -110,6 +181,25 @@ type (
 		io.Closer
 	}
 
+	// A TransactionIterator is an iterator over the archived transactions of a
+	// channel.
+	TransactionIterator interface {
+		// Next should restore the next archived transaction. If no transaction
+		// was found, or the context times out, it should return false.
+		Next(context.Context) bool
+
+		// Transaction should return the latest transaction that was restored via
+		// Next. It is guaranteed by the framework to only be called after Next
+		// returned true.
+		Transaction() channel.Transaction
+
+		// Close is called when Next returned false, or when prematurely
+		// aborting. If an error occurred during the last Next call, this error
+		// should be returned. This call should free up all resources used by
+		// the iterator.
+		io.Closer
+	}
+
 	// A chSource holds all data that is necessary for restoring a channel
 	// controller.
 	chSource struct {
@@ -118,6 +208,10 @@ type (
 		StagingTXV channel.Transaction // StagingTxV is the staging transaction.
 		CurrentTXV channel.Transaction // CurrentTXV is the current transaction.
 		PhaseV     channel.Phase       // PhaseV is the current channel phase.
+
+		// PipelinedTXsV are the transactions pipelined after the staging
+		// transaction.
+		PipelinedTXsV []channel.Transaction
 	}
 
 	// Channel holds all data that is necessary to restore a channel controller
@@ -127,10 +221,24 @@ type (
 		chSource
 		PeersV []wire.Address
 		Parent *channel.ID
+
+		// FundingAgreement is the funding agreement of a ledger channel, see
+		// FundingPersister. It is nil if it was not persisted.
+		FundingAgreement channel.Balances
+
+		// WithdrawalAuthSigs are the signatures on the authorization of the
+		// staged partial withdrawal, see WithdrawalPersister. They are empty if
+		// none were persisted.
+		WithdrawalAuthSigs []wallet.Sig
+
+		// NextHop is the ledger channel to which the funding of a virtual
+		// channel was forwarded, see ForwardingPersister. It is nil if the
+		// funding was not forwarded or the next hop was not persisted.
+		NextHop *channel.ID
 	}
 )
 
-var _ channel.Source = (*Channel)(nil)
+var _ channel.PipelinedSource = (*Channel)(nil)
 
 // CloneSource creates a new Channel object whose fields are clones of the data
 // coming from Source s.
@@ -141,16 +249,22 @@ func CloneSource(s channel.Source) channel.Source {
 		StagingTXV: s.StagingTX().Clone(),
 		CurrentTXV: s.CurrentTX().Clone(),
 		PhaseV:     s.Phase(),
+
+		PipelinedTXsV: clonePipelinedTXs(s),
 	}
 }
 
 // NewChannel creates a new Channel object whose fields are initialized.
-// The peers and parent field are unset.
+// The peers, parent, funding agreement, withdrawal and next hop fields are
+// unset.
 func NewChannel() *Channel {
 	return &Channel{
 		chSource{ParamsV: new(channel.Params)},
 		nil,
 		nil,
+		nil,
+		nil,
+		nil,
 	}
 }
 
@@ -164,9 +278,14 @@ func FromSource(s channel.Source, ps []wire.Address, parent *channel.ID) *Channe
 			StagingTXV: s.StagingTX().Clone(),
 			CurrentTXV: s.CurrentTX().Clone(),
 			PhaseV:     s.Phase(),
+
+			PipelinedTXsV: clonePipelinedTXs(s),
 		},
 		ps,
 		parent,
+		nil,
+		nil,
+		nil,
 	}
 }
 
@@ -187,3 +306,20 @@ func (c *chSource) CurrentTX() channel.Transaction { return c.CurrentTXV }
 
 // Phase is the phase in which the channel is currently in.
 func (c *chSource) Phase() channel.Phase { return c.PhaseV }
+
+// PipelinedTXs are the transactions pipelined after the staging transaction.
+func (c *chSource) PipelinedTXs() []channel.Transaction { return c.PipelinedTXsV }
+
+// clonePipelinedTXs returns clones of the pipelined transactions of s, if s is
+// a channel.PipelinedSource.
+func clonePipelinedTXs(s channel.Source) []channel.Transaction {
+	ps, ok := s.(channel.PipelinedSource)
+	if !ok || len(ps.PipelinedTXs()) == 0 {
+		return nil
+	}
+	txs := make([]channel.Transaction, len(ps.PipelinedTXs()))
+	for i, tx := range ps.PipelinedTXs() {
+		txs[i] = tx.Clone()
+	}
+	return txs
+}
@@ -0,0 +1,23 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sql contains an implementation of the channel persister interface
+// using an SQL database via the database/sql package.
+//
+// Channel data is spread over the tables channels, peers, transactions,
+// balances and signatures, so that channel states, balances and signatures
+// can be inspected with ordinary SQL queries. If history is enabled, every
+// enabled transaction is additionally kept with kind "history". The schema and
+// queries are written for SQLite.
+package sql // import "perun.network/go-perun/channel/persistence/sql"
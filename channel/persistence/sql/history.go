@@ -0,0 +1,86 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
+)
+
+var _ persistence.TransactionIterator = (*TransactionIterator)(nil)
+
+// TransactionIterator implements the persistence.TransactionIterator
+// interface. The transactions are loaded one by one from the database when
+// advancing the iterator.
+type TransactionIterator struct {
+	err      error
+	tx       channel.Transaction
+	id       channel.ID
+	versions []string
+
+	restorer *PersistRestorer
+}
+
+// RestoreHistory returns an iterator over all archived transactions of the
+// given channel, in ascending version order. History must be enabled.
+func (pr *PersistRestorer) RestoreHistory(ctx context.Context, id channel.ID) (persistence.TransactionIterator, error) {
+	if !pr.history {
+		return nil, errors.New("history not enabled")
+	}
+	rows, err := pr.db.QueryContext(ctx,
+		"SELECT version FROM transactions WHERE channel_id = ? AND kind = ? ORDER BY version",
+		id[:], kindHistory)
+	if err != nil {
+		return nil, errors.WithMessage(err, "querying history")
+	}
+	defer rows.Close()
+
+	it := &TransactionIterator{id: id, restorer: pr}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, errors.WithMessage(err, "scanning version")
+		}
+		it.versions = append(it.versions, version)
+	}
+	return it, errors.WithMessage(rows.Err(), "iterating history")
+}
+
+// Next advances the iterator and returns whether there is another
+// transaction.
+func (i *TransactionIterator) Next(ctx context.Context) bool {
+	if i.err != nil || len(i.versions) == 0 {
+		return false
+	}
+	i.tx, i.err = i.restorer.loadTX(ctx, i.id, kindHistory, i.versions[0])
+	i.versions = i.versions[1:]
+	return i.err == nil
+}
+
+// Transaction returns the iterator's current transaction.
+func (i *TransactionIterator) Transaction() channel.Transaction {
+	return i.tx
+}
+
+// Close closes the iterator and releases its resources. It returns the last
+// error that occurred when advancing the iterator.
+func (i *TransactionIterator) Close() error {
+	i.versions = nil
+	return i.err
+}
@@ -0,0 +1,306 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+// ChannelCreated inserts a channel into the database.
+func (pr *PersistRestorer) ChannelCreated(ctx context.Context, s channel.Source, peers []wire.Address, parent *channel.ID) error {
+	id := s.ID()
+	params, err := encode(s.Params())
+	if err != nil {
+		return errors.WithMessage(err, "encoding params")
+	}
+	var parentID []byte
+	if parent != nil {
+		parentID = parent[:]
+	}
+
+	return pr.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO channels (id, idx, params, parent, phase) VALUES (?, ?, ?, ?, ?)",
+			id[:], s.Idx(), params, parentID, s.Phase()); err != nil {
+			return errors.WithMessage(err, "inserting channel")
+		}
+		for i, peer := range peers {
+			addr, err := encode(peer)
+			if err != nil {
+				return errors.WithMessage(err, "encoding peer address")
+			}
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO peers (channel_id, peer_idx, address) VALUES (?, ?, ?)",
+				id[:], i, addr); err != nil {
+				return errors.WithMessage(err, "inserting peer")
+			}
+		}
+		return pr.putTXs(ctx, tx, s)
+	})
+}
+
+// ChannelRemoved deletes a channel from the database.
+func (pr *PersistRestorer) ChannelRemoved(ctx context.Context, id channel.ID) error {
+	return pr.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM channels WHERE id = ?", id[:])
+		if err != nil {
+			return errors.WithMessage(err, "deleting channel")
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return errors.WithMessage(err, "counting deleted channels")
+		} else if n == 0 {
+			return errors.Errorf("could not find channel %x", id)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM peers WHERE channel_id = ?", id[:]); err != nil {
+			return errors.WithMessage(err, "deleting peers")
+		}
+		// The history is kept.
+		for _, kind := range []string{kindCurrent, kindStaging, kindPipelined} {
+			if err := deleteTX(ctx, tx, id, kind); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Staged persists the staging transaction as well as the channel's phase.
+func (pr *PersistRestorer) Staged(ctx context.Context, s channel.Source) error {
+	return pr.withTx(ctx, func(tx *sql.Tx) error {
+		if err := putPhase(ctx, tx, s); err != nil {
+			return err
+		}
+		id := s.ID()
+		if err := deleteTX(ctx, tx, id, kindStaging); err != nil {
+			return err
+		}
+		return insertTX(ctx, tx, id, kindStaging, s.StagingTX())
+	})
+}
+
+// SigAdded persists the signature of the given participant on the channel's
+// staging transaction.
+func (pr *PersistRestorer) SigAdded(ctx context.Context, s channel.Source, idx channel.Index) error {
+	id, staging := s.ID(), s.StagingTX()
+	if staging.State == nil || int(idx) >= len(staging.Sigs) || staging.Sigs[idx] == nil {
+		return errors.Errorf("no staging signature for index %d", idx)
+	}
+	version := formatVersion(staging.Version)
+	return pr.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM signatures WHERE channel_id = ? AND kind = ? AND version = ? AND part_idx = ?",
+			id[:], kindStaging, version, idx); err != nil {
+			return errors.WithMessage(err, "deleting signature")
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO signatures (channel_id, kind, version, part_idx, sig) VALUES (?, ?, ?, ?, ?)",
+			id[:], kindStaging, version, idx, staging.Sigs[idx])
+		return errors.WithMessage(err, "inserting signature")
+	})
+}
+
+// Enabled persists the channel's staging and current transaction, and phase.
+func (pr *PersistRestorer) Enabled(ctx context.Context, s channel.Source) error {
+	return pr.withTx(ctx, func(tx *sql.Tx) error {
+		if err := putPhase(ctx, tx, s); err != nil {
+			return err
+		}
+		for _, kind := range []string{kindCurrent, kindStaging} {
+			if err := deleteTX(ctx, tx, s.ID(), kind); err != nil {
+				return err
+			}
+		}
+		return pr.putTXs(ctx, tx, s)
+	})
+}
+
+// FundingAgreed persists the funding agreement of a ledger channel.
+func (pr *PersistRestorer) FundingAgreed(ctx context.Context, id channel.ID, agreement channel.Balances) error {
+	funding, err := encode(agreement)
+	if err != nil {
+		return errors.WithMessage(err, "encoding funding agreement")
+	}
+	return errors.WithMessage(pr.updateChannel(ctx, id, "funding", funding), "updating funding agreement")
+}
+
+// WithdrawalAuthorized persists the signatures on the authorization of the
+// staged partial withdrawal.
+func (pr *PersistRestorer) WithdrawalAuthorized(ctx context.Context, id channel.ID, sigs []wallet.Sig) error {
+	withdrawal, err := encode(wallet.SigsWithLen(sigs))
+	if err != nil {
+		return errors.WithMessage(err, "encoding withdrawal signatures")
+	}
+	return errors.WithMessage(pr.updateChannel(ctx, id, "withdrawal", withdrawal), "updating withdrawal signatures")
+}
+
+// VirtualChannelForwarded persists the next hop of a forwarded virtual
+// channel.
+func (pr *PersistRestorer) VirtualChannelForwarded(ctx context.Context, id, next channel.ID) error {
+	return errors.WithMessage(pr.updateChannel(ctx, id, "nexthop", next[:]), "updating next hop")
+}
+
+// updateChannel sets the given column of the channel to value.
+func (pr *PersistRestorer) updateChannel(ctx context.Context, id channel.ID, column string, value []byte) error {
+	return pr.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE channels SET "+column+" = ? WHERE id = ?", value, id[:])
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return errors.WithMessage(err, "counting updated channels")
+		} else if n == 0 {
+			return errors.Errorf("could not find channel %x", id)
+		}
+		return nil
+	})
+}
+
+// Pipelined persists the channel's pipelined transactions, replacing the
+// previously persisted ones.
+func (pr *PersistRestorer) Pipelined(ctx context.Context, s channel.PipelinedSource) error {
+	return pr.withTx(ctx, func(tx *sql.Tx) error {
+		id := s.ID()
+		if err := deleteTX(ctx, tx, id, kindPipelined); err != nil {
+			return err
+		}
+		for _, t := range s.PipelinedTXs() {
+			if err := insertTX(ctx, tx, id, kindPipelined, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PhaseChanged persists the channel's phase.
+func (pr *PersistRestorer) PhaseChanged(ctx context.Context, s channel.Source) error {
+	return pr.withTx(ctx, func(tx *sql.Tx) error {
+		return putPhase(ctx, tx, s)
+	})
+}
+
+// putPhase updates the phase of an existing channel.
+func putPhase(ctx context.Context, tx *sql.Tx, s channel.Source) error {
+	id := s.ID()
+	res, err := tx.ExecContext(ctx, "UPDATE channels SET phase = ? WHERE id = ?", s.Phase(), id[:])
+	if err != nil {
+		return errors.WithMessage(err, "updating phase")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.WithMessage(err, "counting updated channels")
+	} else if n == 0 {
+		return errors.Errorf("could not find channel %x", id)
+	}
+	return nil
+}
+
+// putTXs inserts the current and staging transaction of a channel and
+// archives the current transaction, if history is enabled. The channel's
+// previous current and staging transactions must have been deleted.
+func (pr *PersistRestorer) putTXs(ctx context.Context, tx *sql.Tx, s channel.Source) error {
+	id, current := s.ID(), s.CurrentTX()
+	if err := insertTX(ctx, tx, id, kindCurrent, current); err != nil {
+		return err
+	}
+	if err := insertTX(ctx, tx, id, kindStaging, s.StagingTX()); err != nil {
+		return err
+	}
+	if !pr.history || current.State == nil {
+		return nil
+	}
+	// Archiving the same version twice replaces the previous entry.
+	for _, table := range []string{"transactions", "balances", "signatures"} {
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM "+table+" WHERE channel_id = ? AND kind = ? AND version = ?",
+			id[:], kindHistory, formatVersion(current.Version)); err != nil {
+			return errors.WithMessagef(err, "deleting history %s", table)
+		}
+	}
+	return insertTX(ctx, tx, id, kindHistory, current)
+}
+
+// deleteTX deletes all transactions of the given kind, including their
+// balances and signatures.
+func deleteTX(ctx context.Context, tx *sql.Tx, id channel.ID, kind string) error {
+	for _, table := range []string{"transactions", "balances", "signatures"} {
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM "+table+" WHERE channel_id = ? AND kind = ?", id[:], kind); err != nil {
+			return errors.WithMessagef(err, "deleting %s %s", kind, table)
+		}
+	}
+	return nil
+}
+
+// insertTX inserts a transaction of the given kind, including its balances and
+// signatures. An empty transaction is not stored.
+func insertTX(ctx context.Context, tx *sql.Tx, id channel.ID, kind string, t channel.Transaction) error {
+	if t.State == nil {
+		return nil
+	}
+
+	state, err := encode(t.State)
+	if err != nil {
+		return errors.WithMessagef(err, "encoding %s state", kind)
+	}
+	version := formatVersion(t.Version)
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO transactions (channel_id, kind, version, is_final, state) VALUES (?, ?, ?, ?, ?)",
+		id[:], kind, version, t.IsFinal, state); err != nil {
+		return errors.WithMessagef(err, "inserting %s transaction", kind)
+	}
+	for asset, bals := range t.Balances {
+		for part, bal := range bals {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO balances (channel_id, kind, version, asset_idx, part_idx, amount) VALUES (?, ?, ?, ?, ?, ?)",
+				id[:], kind, version, asset, part, bal.String()); err != nil {
+				return errors.WithMessagef(err, "inserting %s balance", kind)
+			}
+		}
+	}
+	for part, sig := range t.Sigs {
+		if sig == nil {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO signatures (channel_id, kind, version, part_idx, sig) VALUES (?, ?, ?, ?, ?)",
+			id[:], kind, version, part, sig); err != nil {
+			return errors.WithMessagef(err, "inserting %s signature", kind)
+		}
+	}
+	return nil
+}
+
+// formatVersion formats a version so that the lexicographic order of the
+// formatted versions equals their numerical order.
+func formatVersion(v uint64) string {
+	return fmt.Sprintf("%020d", v)
+}
+
+// encode encodes v using perunio.
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := perunio.Encode(&buf, v)
+	return buf.Bytes(), err
+}
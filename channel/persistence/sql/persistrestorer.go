@@ -0,0 +1,140 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel/persistence"
+)
+
+var (
+	_ persistence.PersistRestorer     = (*PersistRestorer)(nil)
+	_ persistence.HistoryRestorer     = (*PersistRestorer)(nil)
+	_ persistence.PipelinePersister   = (*PersistRestorer)(nil)
+	_ persistence.FundingPersister    = (*PersistRestorer)(nil)
+	_ persistence.WithdrawalPersister = (*PersistRestorer)(nil)
+	_ persistence.ForwardingPersister = (*PersistRestorer)(nil)
+)
+
+// PersistRestorer implements both the persister and the restorer interface
+// using an SQL database.
+type PersistRestorer struct {
+	db      *sql.DB
+	history bool
+}
+
+// Transaction kinds, as stored in the kind column of the transactions,
+// balances and signatures tables. There is at most one current and one staging
+// transaction per channel, but any number of pipelined and history
+// transactions.
+const (
+	kindCurrent   = "current"
+	kindStaging   = "staging"
+	kindPipelined = "pipelined"
+	kindHistory   = "history"
+)
+
+// schema creates all tables, if they do not exist yet.
+//
+// Versions are stored as zero-padded decimal strings and amounts as decimal
+// strings, because SQL integers cannot hold all uint64 and big.Int values.
+// The binary columns contain the perunio encoding of the respective values.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS channels (
+		id BLOB NOT NULL PRIMARY KEY,
+		idx INTEGER NOT NULL,
+		params BLOB NOT NULL,
+		parent BLOB,
+		phase INTEGER NOT NULL,
+		funding BLOB,
+		withdrawal BLOB,
+		nexthop BLOB
+	)`,
+	`CREATE TABLE IF NOT EXISTS peers (
+		channel_id BLOB NOT NULL,
+		peer_idx INTEGER NOT NULL,
+		address BLOB NOT NULL,
+		PRIMARY KEY (channel_id, peer_idx)
+	)`,
+	`CREATE INDEX IF NOT EXISTS peers_address ON peers (address)`,
+	`CREATE TABLE IF NOT EXISTS transactions (
+		channel_id BLOB NOT NULL,
+		kind TEXT NOT NULL,
+		version TEXT NOT NULL,
+		is_final BOOLEAN NOT NULL,
+		state BLOB NOT NULL,
+		PRIMARY KEY (channel_id, kind, version)
+	)`,
+	`CREATE TABLE IF NOT EXISTS balances (
+		channel_id BLOB NOT NULL,
+		kind TEXT NOT NULL,
+		version TEXT NOT NULL,
+		asset_idx INTEGER NOT NULL,
+		part_idx INTEGER NOT NULL,
+		amount TEXT NOT NULL,
+		PRIMARY KEY (channel_id, kind, version, asset_idx, part_idx)
+	)`,
+	`CREATE TABLE IF NOT EXISTS signatures (
+		channel_id BLOB NOT NULL,
+		kind TEXT NOT NULL,
+		version TEXT NOT NULL,
+		part_idx INTEGER NOT NULL,
+		sig BLOB NOT NULL,
+		PRIMARY KEY (channel_id, kind, version, part_idx)
+	)`,
+}
+
+// NewPersistRestorer creates a new PersistRestorer for the supplied database
+// and creates the necessary tables if they do not exist yet.
+func NewPersistRestorer(ctx context.Context, db *sql.DB) (*PersistRestorer, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, errors.WithMessage(err, "creating schema")
+		}
+	}
+	return &PersistRestorer{db: db}, nil
+}
+
+// EnableHistory enables the archiving of every enabled transaction, see
+// persistence.HistoryRestorer. It must be called before the PersistRestorer is
+// used.
+func (pr *PersistRestorer) EnableHistory() {
+	pr.history = true
+}
+
+// Close closes the PersistRestorer and releases all resources it holds.
+func (pr *PersistRestorer) Close() error {
+	return pr.db.Close()
+}
+
+// withTx runs f in a database transaction, which is committed if f succeeds
+// and rolled back otherwise.
+func (pr *PersistRestorer) withTx(ctx context.Context, f func(*sql.Tx) error) error {
+	tx, err := pr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithMessage(err, "beginning transaction")
+	}
+	if err := f(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return errors.WithMessagef(err, "(error rolling back: %v)", rerr)
+		}
+		return err
+	}
+	return errors.WithMessage(tx.Commit(), "committing transaction")
+}
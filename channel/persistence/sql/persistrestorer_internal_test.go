@@ -0,0 +1,154 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	_ "perun.network/go-perun/backend/sim"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
+	"perun.network/go-perun/channel/persistence/test"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/wallet"
+	wiretest "perun.network/go-perun/wire/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+// openDB opens an SQLite database. A single connection is used because
+// SQLite does not support concurrent writes.
+func openDB(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestPersistRestorer_Generic(t *testing.T) {
+	dsns := []string{
+		filepath.Join(t.TempDir(), "perun.db"),
+		":memory:",
+	}
+
+	for i, dsn := range dsns {
+		func(i int64) {
+			pr, err := NewPersistRestorer(context.Background(), openDB(t, dsn))
+			require.NoError(t, err)
+			defer func() { require.NoError(t, pr.Close()) }()
+			rng := pkgtest.Prng(t, i)
+			test.GenericPersistRestorerTest(
+				context.Background(),
+				t,
+				rng,
+				pr,
+				4,
+				16)
+		}(int64(i))
+	}
+}
+
+func TestPersistRestorer_History(t *testing.T) {
+	ctx := context.Background()
+	pr, err := NewPersistRestorer(ctx, openDB(t, ":memory:"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	_, err = pr.RestoreHistory(ctx, channel.ID{})
+	assert.Error(t, err, "history not enabled")
+
+	pr.EnableHistory()
+	test.GenericHistoryTest(ctx, t, pkgtest.Prng(t), pr)
+}
+
+func TestPersistRestorer_Balances(t *testing.T) {
+	ctx := context.Background()
+	rng := pkgtest.Prng(t)
+	pr, err := NewPersistRestorer(ctx, openDB(t, ":memory:"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	params, state := chtest.NewRandomParamsAndState(rng, chtest.WithNumParts(2), chtest.WithNumAssets(1))
+	ch := persistence.NewChannel()
+	ch.ParamsV = params
+	ch.CurrentTXV = channel.Transaction{State: state, Sigs: make([]wallet.Sig, 2)}
+	ch.PhaseV = channel.Acting
+	id := ch.ID()
+	require.NoError(t, pr.ChannelCreated(ctx, ch, wiretest.NewRandomAddresses(rng, 2), nil))
+
+	rows, err := pr.db.QueryContext(ctx,
+		"SELECT part_idx, amount FROM balances WHERE channel_id = ? AND kind = ? AND asset_idx = 0 ORDER BY part_idx",
+		id[:], kindCurrent)
+	require.NoError(t, err)
+	defer rows.Close()
+	var n int
+	for ; rows.Next(); n++ {
+		var part int
+		var amount string
+		require.NoError(t, rows.Scan(&part, &amount))
+		assert.Equal(t, n, part)
+		assert.Equal(t, state.Balances[0][part].String(), amount)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, 2, n)
+
+	require.NoError(t, pr.ChannelRemoved(ctx, id))
+	var count int
+	require.NoError(t, pr.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM balances").Scan(&count))
+	assert.Zero(t, count)
+}
+
+func TestPersistRestorer_Pipeline(t *testing.T) {
+	ctx := context.Background()
+	pr, err := NewPersistRestorer(ctx, openDB(t, ":memory:"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	test.GenericPipelineTest(ctx, t, pkgtest.Prng(t), pr)
+}
+
+func TestPersistRestorer_Funding(t *testing.T) {
+	ctx := context.Background()
+	pr, err := NewPersistRestorer(ctx, openDB(t, ":memory:"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	test.GenericFundingTest(ctx, t, pkgtest.Prng(t), pr)
+}
+
+func TestPersistRestorer_Withdrawal(t *testing.T) {
+	ctx := context.Background()
+	pr, err := NewPersistRestorer(ctx, openDB(t, ":memory:"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	test.GenericWithdrawalTest(ctx, t, pkgtest.Prng(t), pr)
+}
+
+func TestPersistRestorer_Forwarding(t *testing.T) {
+	ctx := context.Background()
+	pr, err := NewPersistRestorer(ctx, openDB(t, ":memory:"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, pr.Close()) }()
+
+	test.GenericForwardingTest(ctx, t, pkgtest.Prng(t), pr)
+}
@@ -0,0 +1,311 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+var _ persistence.ChannelIterator = (*ChannelIterator)(nil)
+
+// ChannelIterator implements the persistence.ChannelIterator interface. The
+// channels are loaded one by one from the database when advancing the
+// iterator.
+type ChannelIterator struct {
+	err error
+	ch  *persistence.Channel
+	ids []channel.ID
+
+	restorer *PersistRestorer
+}
+
+// ActivePeers returns a list of all peers with which a channel is persisted.
+func (pr *PersistRestorer) ActivePeers(ctx context.Context) ([]wire.Address, error) {
+	rows, err := pr.db.QueryContext(ctx, "SELECT DISTINCT address FROM peers")
+	if err != nil {
+		return nil, errors.WithMessage(err, "querying peers")
+	}
+	defer rows.Close()
+
+	var peers []wire.Address
+	for rows.Next() {
+		var enc []byte
+		if err := rows.Scan(&enc); err != nil {
+			return nil, errors.WithMessage(err, "scanning peer")
+		}
+		addr := wire.NewAddress()
+		if err := decode(enc, addr); err != nil {
+			return nil, errors.WithMessagef(err, "decoding peer address (%x)", enc)
+		}
+		peers = append(peers, addr)
+	}
+	return peers, errors.WithMessage(rows.Err(), "iterating peers")
+}
+
+// RestoreAll returns an iterator over all persisted channels.
+func (pr *PersistRestorer) RestoreAll() (persistence.ChannelIterator, error) {
+	return pr.channelIterator(context.Background(), "SELECT id FROM channels")
+}
+
+// RestorePeer returns an iterator over all persisted channels which the given
+// peer is a part of.
+func (pr *PersistRestorer) RestorePeer(addr wire.Address) (persistence.ChannelIterator, error) {
+	enc, err := encode(addr)
+	if err != nil {
+		return nil, errors.WithMessage(err, "encoding peer address")
+	}
+	return pr.channelIterator(context.Background(),
+		"SELECT DISTINCT channel_id FROM peers WHERE address = ?", enc)
+}
+
+// channelIterator creates an iterator over the channel IDs returned by the
+// given query.
+func (pr *PersistRestorer) channelIterator(ctx context.Context, query string, args ...interface{}) (*ChannelIterator, error) {
+	rows, err := pr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.WithMessage(err, "querying channel IDs")
+	}
+	defer rows.Close()
+
+	it := &ChannelIterator{restorer: pr}
+	for rows.Next() {
+		var id []byte
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.WithMessage(err, "scanning channel ID")
+		}
+		var cid channel.ID
+		if len(id) != len(cid) {
+			return nil, errors.Errorf("invalid channel ID length %d", len(id))
+		}
+		copy(cid[:], id)
+		it.ids = append(it.ids, cid)
+	}
+	return it, errors.WithMessage(rows.Err(), "iterating channel IDs")
+}
+
+// RestoreChannel restores a single channel.
+func (pr *PersistRestorer) RestoreChannel(ctx context.Context, id channel.ID) (*persistence.Channel, error) {
+	ch := persistence.NewChannel()
+	var params, parent, funding, withdrawal, nextHop []byte
+	err := pr.db.QueryRowContext(ctx,
+		"SELECT idx, params, parent, phase, funding, withdrawal, nexthop FROM channels WHERE id = ?", id[:]).
+		Scan(&ch.IdxV, &params, &parent, &ch.PhaseV, &funding, &withdrawal, &nextHop)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Errorf("could not find channel %x", id)
+	} else if err != nil {
+		return nil, errors.WithMessagef(err, "error restoring channel %x", id)
+	}
+	if err := decode(params, ch.ParamsV); err != nil {
+		return nil, errors.WithMessage(err, "decoding params")
+	}
+	if parent != nil {
+		ch.Parent = new(channel.ID)
+		if len(parent) != len(ch.Parent) {
+			return nil, errors.Errorf("invalid parent ID length %d", len(parent))
+		}
+		copy(ch.Parent[:], parent)
+	}
+	if nextHop != nil {
+		ch.NextHop = new(channel.ID)
+		if len(nextHop) != len(ch.NextHop) {
+			return nil, errors.Errorf("invalid next hop ID length %d", len(nextHop))
+		}
+		copy(ch.NextHop[:], nextHop)
+	}
+	if funding != nil {
+		if err := decode(funding, &ch.FundingAgreement); err != nil {
+			return nil, errors.WithMessage(err, "decoding funding agreement")
+		}
+	}
+	if withdrawal != nil {
+		if err := decode(withdrawal, (*wallet.SigsWithLen)(&ch.WithdrawalAuthSigs)); err != nil {
+			return nil, errors.WithMessage(err, "decoding withdrawal signatures")
+		}
+	}
+
+	if ch.PeersV, err = pr.channelPeers(ctx, id); err != nil {
+		return nil, err
+	}
+	if ch.CurrentTXV, err = pr.channelTX(ctx, id, kindCurrent); err != nil {
+		return nil, err
+	}
+	if ch.StagingTXV, err = pr.channelTX(ctx, id, kindStaging); err != nil {
+		return nil, err
+	}
+	if ch.StagingTXV.Sigs == nil {
+		ch.StagingTXV.Sigs = make([]wallet.Sig, len(ch.ParamsV.Parts))
+	}
+	if ch.PipelinedTXsV, err = pr.channelTXs(ctx, id, kindPipelined); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// channelPeers returns the peers of a channel in their persisted order.
+func (pr *PersistRestorer) channelPeers(ctx context.Context, id channel.ID) ([]wire.Address, error) {
+	rows, err := pr.db.QueryContext(ctx,
+		"SELECT address FROM peers WHERE channel_id = ? ORDER BY peer_idx", id[:])
+	if err != nil {
+		return nil, errors.WithMessage(err, "querying channel peers")
+	}
+	defer rows.Close()
+
+	var peers []wire.Address
+	for rows.Next() {
+		var enc []byte
+		if err := rows.Scan(&enc); err != nil {
+			return nil, errors.WithMessage(err, "scanning channel peer")
+		}
+		addr := wire.NewAddress()
+		if err := decode(enc, addr); err != nil {
+			return nil, errors.WithMessage(err, "decoding channel peer")
+		}
+		peers = append(peers, addr)
+	}
+	return peers, errors.WithMessage(rows.Err(), "iterating channel peers")
+}
+
+// channelTX returns the transaction of the given kind. If no such transaction
+// is persisted, an empty transaction is returned.
+func (pr *PersistRestorer) channelTX(ctx context.Context, id channel.ID, kind string) (channel.Transaction, error) {
+	var version string
+	err := pr.db.QueryRowContext(ctx,
+		"SELECT version FROM transactions WHERE channel_id = ? AND kind = ?", id[:], kind).
+		Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return channel.Transaction{}, nil
+	} else if err != nil {
+		return channel.Transaction{}, errors.WithMessagef(err, "querying %s transaction", kind)
+	}
+	return pr.loadTX(ctx, id, kind, version)
+}
+
+// channelTXs returns all transactions of the given kind, in ascending version
+// order.
+func (pr *PersistRestorer) channelTXs(ctx context.Context, id channel.ID, kind string) ([]channel.Transaction, error) {
+	rows, err := pr.db.QueryContext(ctx,
+		"SELECT version FROM transactions WHERE channel_id = ? AND kind = ? ORDER BY version",
+		id[:], kind)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "querying %s transactions", kind)
+	}
+	var versions []string
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return nil, errors.WithMessage(err, "scanning version")
+		}
+		versions = append(versions, version)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "iterating %s transactions", kind)
+	}
+
+	var txs []channel.Transaction
+	for _, version := range versions {
+		tx, err := pr.loadTX(ctx, id, kind, version)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// loadTX loads the transaction of the given kind and formatted version,
+// including its signatures.
+func (pr *PersistRestorer) loadTX(ctx context.Context, id channel.ID, kind, version string) (channel.Transaction, error) {
+	var tx channel.Transaction
+	var state []byte
+	if err := pr.db.QueryRowContext(ctx,
+		"SELECT state FROM transactions WHERE channel_id = ? AND kind = ? AND version = ?",
+		id[:], kind, version).Scan(&state); err != nil {
+		return tx, errors.WithMessagef(err, "querying %s transaction", kind)
+	}
+	tx.State = new(channel.State)
+	if err := decode(state, tx.State); err != nil {
+		return tx, errors.WithMessagef(err, "decoding %s state", kind)
+	}
+
+	numParts := tx.NumParts()
+	tx.Sigs = make([]wallet.Sig, numParts)
+	rows, err := pr.db.QueryContext(ctx,
+		"SELECT part_idx, sig FROM signatures WHERE channel_id = ? AND kind = ? AND version = ?",
+		id[:], kind, version)
+	if err != nil {
+		return tx, errors.WithMessagef(err, "querying %s signatures", kind)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx int
+		var sig []byte
+		if err := rows.Scan(&idx, &sig); err != nil {
+			return tx, errors.WithMessagef(err, "scanning %s signature", kind)
+		}
+		if idx < 0 || idx >= numParts {
+			return tx, errors.Errorf("invalid %s signature index %d", kind, idx)
+		}
+		if err := decode(sig, wallet.SigDec{Sig: &tx.Sigs[idx]}); err != nil {
+			return tx, errors.WithMessagef(err, "decoding %s signature", kind)
+		}
+	}
+	return tx, errors.WithMessagef(rows.Err(), "iterating %s signatures", kind)
+}
+
+// Next advances the iterator and returns whether there is another channel.
+func (i *ChannelIterator) Next(ctx context.Context) bool {
+	if i.err != nil || len(i.ids) == 0 {
+		return false
+	}
+	i.ch, i.err = i.restorer.RestoreChannel(ctx, i.ids[0])
+	i.ids = i.ids[1:]
+	return i.err == nil
+}
+
+// Channel returns the iterator's current channel.
+func (i *ChannelIterator) Channel() *persistence.Channel {
+	return i.ch
+}
+
+// Close closes the iterator and releases its resources. It returns the last
+// error that occurred when advancing the iterator.
+func (i *ChannelIterator) Close() error {
+	i.ids = nil
+	return i.err
+}
+
+// decode decodes v from b using perunio and checks that b is fully consumed.
+func decode(b []byte, v interface{}) error {
+	buf := bytes.NewBuffer(b)
+	if err := perunio.Decode(buf, v); err != nil {
+		return err
+	}
+	if buf.Len() != 0 {
+		return errors.Errorf("decoding incomplete (%d bytes left)", buf.Len())
+	}
+	return nil
+}
@@ -124,6 +124,45 @@ func (m StateMachine) Update(
 	return errors.WithMessage(m.pr.Staged(ctx, m.StateMachine), "Persister.Staged")
 }
 
+// Deposit calls Deposit on the channel.StateMachine and then persists the
+// changed staging state.
+func (m StateMachine) Deposit(
+	ctx context.Context,
+	stagingState *channel.State,
+	actor channel.Index,
+) error {
+	if err := m.StateMachine.Deposit(stagingState, actor); err != nil {
+		return err
+	}
+	return errors.WithMessage(m.pr.Staged(ctx, m.StateMachine), "Persister.Staged")
+}
+
+// WithdrawPartial calls WithdrawPartial on the channel.StateMachine and then
+// persists the changed staging state.
+func (m StateMachine) WithdrawPartial(
+	ctx context.Context,
+	stagingState *channel.State,
+	actor channel.Index,
+) error {
+	if err := m.StateMachine.WithdrawPartial(stagingState, actor); err != nil {
+		return err
+	}
+	return errors.WithMessage(m.pr.Staged(ctx, m.StateMachine), "Persister.Staged")
+}
+
+// ChangeAssets calls ChangeAssets on the channel.StateMachine and then
+// persists the changed staging state.
+func (m StateMachine) ChangeAssets(
+	ctx context.Context,
+	stagingState *channel.State,
+	actor channel.Index,
+) error {
+	if err := m.StateMachine.ChangeAssets(stagingState, actor); err != nil {
+		return err
+	}
+	return errors.WithMessage(m.pr.Staged(ctx, m.StateMachine), "Persister.Staged")
+}
+
 // ForceUpdate calls ForceUpdate on the channel.StateMachine and then persists the changed
 // staging state.
 func (m StateMachine) ForceUpdate(
@@ -166,28 +205,125 @@ func (m StateMachine) EnableInit(ctx context.Context) error {
 }
 
 // EnableUpdate calls EnableUpdate on the channel.StateMachine and then persists
-// the enabled transaction.
+// the enabled transaction. If a pipelined transaction became the new staging
+// transaction, the staging and pipelined transactions are persisted, too.
 func (m StateMachine) EnableUpdate(ctx context.Context) error {
+	pipelined := m.hasPipelined()
 	if err := m.StateMachine.EnableUpdate(); err != nil {
 		return err
 	}
-	return errors.WithMessage(m.pr.Enabled(ctx, m.StateMachine), "Persister.Enabled")
+	return m.persistEnabled(ctx, pipelined)
 }
 
 // EnableFinal calls EnableFinal on the channel.StateMachine and then persists
 // the enabled transaction.
 func (m StateMachine) EnableFinal(ctx context.Context) error {
+	pipelined := m.hasPipelined()
 	if err := m.StateMachine.EnableFinal(); err != nil {
 		return err
 	}
-	return errors.WithMessage(m.pr.Enabled(ctx, m.StateMachine), "Persister.Enabled")
+	return m.persistEnabled(ctx, pipelined)
 }
 
 // DiscardUpdate calls DiscardUpdate on the channel.StateMachine and then
-// removes the state machine's staged state from persistence.
+// removes the state machine's staged and pipelined states from persistence.
 func (m StateMachine) DiscardUpdate(ctx context.Context) error {
+	pipelined := m.hasPipelined()
 	if err := m.StateMachine.DiscardUpdate(); err != nil {
 		return err
 	}
-	return errors.WithMessage(m.pr.Staged(ctx, m.StateMachine), "Persister.Staged")
+	if err := m.pr.Staged(ctx, m.StateMachine); err != nil {
+		return errors.WithMessage(err, "Persister.Staged")
+	}
+	if !pipelined {
+		return nil
+	}
+	return m.persistPipelined(ctx)
+}
+
+// Pipeline calls Pipeline on the channel.StateMachine and then persists the
+// changed pipelined transactions.
+func (m StateMachine) Pipeline(
+	ctx context.Context,
+	state *channel.State,
+	actor channel.Index,
+) error {
+	if err := m.StateMachine.Pipeline(state, actor); err != nil {
+		return err
+	}
+	return m.persistPipelined(ctx)
+}
+
+// SigAt calls SigAt on the channel.StateMachine and then persists the added
+// signature.
+func (m StateMachine) SigAt(ctx context.Context, version uint64) (sig wallet.Sig, err error) {
+	sig, err = m.StateMachine.SigAt(version)
+	if err != nil {
+		return sig, err
+	}
+	return sig, m.persistSigAt(ctx, version, m.Idx())
+}
+
+// AddSigAt calls AddSigAt on the channel.StateMachine and then persists the
+// added signature.
+func (m StateMachine) AddSigAt(ctx context.Context, version uint64, idx channel.Index, sig wallet.Sig) error {
+	if err := m.StateMachine.AddSigAt(version, idx, sig); err != nil {
+		return err
+	}
+	return m.persistSigAt(ctx, version, idx)
+}
+
+// DiscardFrom calls DiscardFrom on the channel.StateMachine and then removes
+// the discarded transactions from persistence.
+func (m StateMachine) DiscardFrom(ctx context.Context, version uint64) error {
+	staging := m.StagingTX().Version == version
+	if err := m.StateMachine.DiscardFrom(version); err != nil {
+		return err
+	}
+	if staging {
+		if err := m.pr.Staged(ctx, m.StateMachine); err != nil {
+			return errors.WithMessage(err, "Persister.Staged")
+		}
+	}
+	return m.persistPipelined(ctx)
+}
+
+// hasPipelined returns whether the state machine has pipelined transactions.
+func (m StateMachine) hasPipelined() bool {
+	return len(m.PipelinedTXs()) > 0
+}
+
+// persistEnabled persists an enabled transaction. If there were pipelined
+// transactions before enabling, the first of them is now the staging
+// transaction, so the staging and pipelined transactions are persisted, too.
+func (m StateMachine) persistEnabled(ctx context.Context, pipelined bool) error {
+	if err := m.pr.Enabled(ctx, m.StateMachine); err != nil {
+		return errors.WithMessage(err, "Persister.Enabled")
+	}
+	if !pipelined {
+		return nil
+	}
+	if err := m.pr.Staged(ctx, m.StateMachine); err != nil {
+		return errors.WithMessage(err, "Persister.Staged")
+	}
+	return m.persistPipelined(ctx)
+}
+
+// persistSigAt persists the signature of the given index on the staged
+// transaction with the given version.
+func (m StateMachine) persistSigAt(ctx context.Context, version uint64, idx channel.Index) error {
+	if m.StagingTX().Version == version {
+		return errors.WithMessage(m.pr.SigAdded(ctx, m.StateMachine, idx), "Persister.SigAdded")
+	}
+	return m.persistPipelined(ctx)
+}
+
+// persistPipelined persists the pipelined transactions if the Persister is a
+// PipelinePersister.
+func (m StateMachine) persistPipelined(ctx context.Context) error {
+	pr, ok := m.pr.(PipelinePersister)
+	if !ok {
+		return nil
+	}
+	return errors.WithMessage(pr.Pipelined(ctx, m.StateMachine), "Persister.Pipelined")
 }
@@ -0,0 +1,55 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel/persistence"
+	chtest "perun.network/go-perun/channel/test"
+	wiretest "perun.network/go-perun/wire/test"
+)
+
+// ForwardingPersistRestorer is a PersistRestorer that also persists the next
+// hop of forwarded virtual channels.
+type ForwardingPersistRestorer interface {
+	persistence.PersistRestorer
+	persistence.ForwardingPersister
+}
+
+// GenericForwardingTest tests a ForwardingPersistRestorer by persisting the
+// next hop of a channel and asserting that it is restored.
+func GenericForwardingTest(ctx context.Context, t *testing.T, rng *rand.Rand, pr ForwardingPersistRestorer) {
+	t.Helper()
+	peers := wiretest.NewRandomAddresses(rng, channelNumPeers)
+	parent := NewRandomChannel(ctx, t, pr, 0, peers, nil, rng)
+	ch := NewRandomChannel(ctx, t, pr, 0, peers, parent, rng)
+
+	restored, err := pr.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	assert.Nil(t, restored.NextHop, "next hop before VirtualChannelForwarded")
+
+	next := chtest.NewRandomChannelID(rng)
+	require.NoError(t, pr.VirtualChannelForwarded(ctx, ch.ID(), next))
+	restored, err = pr.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	require.NotNil(t, restored.NextHop, "next hop not restored")
+	assert.Equal(t, next, *restored.NextHop, "next hop mismatch")
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel/persistence"
+	chtest "perun.network/go-perun/channel/test"
+	wiretest "perun.network/go-perun/wire/test"
+)
+
+// FundingPersistRestorer is a PersistRestorer that also persists funding
+// agreements.
+type FundingPersistRestorer interface {
+	persistence.PersistRestorer
+	persistence.FundingPersister
+}
+
+// GenericFundingTest tests a FundingPersistRestorer by persisting the funding
+// agreement of a channel and asserting that it is restored until the channel
+// is removed.
+func GenericFundingTest(ctx context.Context, t *testing.T, rng *rand.Rand, pr FundingPersistRestorer) {
+	t.Helper()
+	ch := NewRandomChannel(ctx, t, pr, 0, wiretest.NewRandomAddresses(rng, channelNumPeers), nil, rng)
+	restored, err := pr.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	assert.Nil(t, restored.FundingAgreement, "funding agreement before FundingAgreed")
+
+	agreement := chtest.NewRandomBalances(rng, chtest.WithNumParts(channelNumPeers))
+	require.NoError(t, pr.FundingAgreed(ctx, ch.ID(), agreement))
+	ch.Init(ctx, t, rng)
+	ch.SignAll(ctx, t)
+	ch.EnableInit(t)
+	ch.SetFunded(t)
+
+	restored, err = pr.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	assert.True(t, agreement.Equal(restored.FundingAgreement), "funding agreement mismatch")
+
+	require.NoError(t, pr.ChannelRemoved(ctx, ch.ID()))
+	_, err = pr.RestoreChannel(ctx, ch.ID())
+	assert.Error(t, err, "restoring removed channel")
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
+	wiretest "perun.network/go-perun/wire/test"
+)
+
+// HistoryPersistRestorer is a PersistRestorer that also archives the
+// transaction history.
+type HistoryPersistRestorer interface {
+	persistence.PersistRestorer
+	persistence.HistoryRestorer
+}
+
+// GenericHistoryTest tests a HistoryPersistRestorer by running a channel
+// through several updates and asserting that every enabled transaction is
+// archived, also after the channel is removed.
+func GenericHistoryTest(ctx context.Context, t *testing.T, rng *rand.Rand, pr HistoryPersistRestorer) {
+	t.Helper()
+	ch := NewRandomChannel(ctx, t, pr, 0, wiretest.NewRandomAddresses(rng, channelNumPeers), nil, rng)
+	history := make([]channel.Transaction, 0, 3)
+	enabled := func() { history = append(history, ch.CurrentTX().Clone()) }
+
+	ch.Init(ctx, t, rng)
+	ch.SignAll(ctx, t)
+	ch.EnableInit(t)
+	enabled()
+	ch.SetFunded(t)
+
+	state := ch.State().Clone()
+	state.Version++
+	require.NoError(t, ch.Update(t, state, ch.Idx()))
+	ch.SignAll(ctx, t)
+	ch.EnableUpdate(t)
+	enabled()
+
+	state = ch.State().Clone()
+	state.Version++
+	state.IsFinal = true
+	require.NoError(t, ch.Update(t, state, ch.Idx()))
+	ch.SignAll(ctx, t)
+	ch.EnableFinal(t)
+	enabled()
+
+	ch.SetRegistering(t)
+	ch.SetRegistered(t)
+	ch.SetWithdrawing(t)
+	ch.SetWithdrawn(t)
+
+	it, err := pr.RestoreHistory(ctx, ch.ID())
+	require.NoError(t, err)
+	var restored []channel.Transaction
+	for it.Next(ctx) {
+		restored = append(restored, it.Transaction())
+	}
+	require.NoError(t, it.Close())
+	assert.Equal(t, history, restored)
+}
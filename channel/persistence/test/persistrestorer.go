@@ -27,9 +27,17 @@ import (
 
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/channel/persistence"
+	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
 )
 
+var (
+	_ persistence.PipelinePersister   = (*PersistRestorer)(nil)
+	_ persistence.FundingPersister    = (*PersistRestorer)(nil)
+	_ persistence.WithdrawalPersister = (*PersistRestorer)(nil)
+	_ persistence.ForwardingPersister = (*PersistRestorer)(nil)
+)
+
 // A PersistRestorer is a persistence.PersistRestorer implementation for testing purposes.
 // It is create by passing a *testing.T to NewPersistRestorer. Besides the methods
 // implementing PersistRestorer, it provides methods for asserting the currently
@@ -126,6 +134,53 @@ func (pr *PersistRestorer) Enabled(_ context.Context, s channel.Source) error {
 	return nil
 }
 
+// Pipelined fully persists the pipelined transactions.
+func (pr *PersistRestorer) Pipelined(_ context.Context, s channel.PipelinedSource) error {
+	ch, ok := pr.channel(s.ID())
+	if !ok {
+		return errors.Errorf("channel doesn't exist: %x", s.ID())
+	}
+
+	ch.PipelinedTXsV = nil
+	for _, tx := range s.PipelinedTXs() {
+		ch.PipelinedTXsV = append(ch.PipelinedTXsV, tx.Clone())
+	}
+	return nil
+}
+
+// FundingAgreed persists the funding agreement.
+func (pr *PersistRestorer) FundingAgreed(_ context.Context, id channel.ID, agreement channel.Balances) error {
+	ch, ok := pr.channel(id)
+	if !ok {
+		return errors.Errorf("channel doesn't exist: %x", id)
+	}
+
+	ch.FundingAgreement = agreement.Clone()
+	return nil
+}
+
+// WithdrawalAuthorized persists the withdrawal signatures.
+func (pr *PersistRestorer) WithdrawalAuthorized(_ context.Context, id channel.ID, sigs []wallet.Sig) error {
+	ch, ok := pr.channel(id)
+	if !ok {
+		return errors.Errorf("channel doesn't exist: %x", id)
+	}
+
+	ch.WithdrawalAuthSigs = wallet.CloneSigs(sigs)
+	return nil
+}
+
+// VirtualChannelForwarded persists the next hop.
+func (pr *PersistRestorer) VirtualChannelForwarded(_ context.Context, id, next channel.ID) error {
+	ch, ok := pr.channel(id)
+	if !ok {
+		return errors.Errorf("channel doesn't exist: %x", id)
+	}
+
+	ch.NextHop = &next
+	return nil
+}
+
 // PhaseChanged only persists the phase.
 func (pr *PersistRestorer) PhaseChanged(_ context.Context, s channel.Source) error {
 	ch, ok := pr.channel(s.ID())
@@ -34,3 +34,19 @@ func TestPersistRestorer_Generic(t *testing.T) {
 		8,
 	)
 }
+
+func TestPersistRestorer_Pipeline(t *testing.T) {
+	test.GenericPipelineTest(context.Background(), t, pkgtest.Prng(t), test.NewPersistRestorer(t))
+}
+
+func TestPersistRestorer_Funding(t *testing.T) {
+	test.GenericFundingTest(context.Background(), t, pkgtest.Prng(t), test.NewPersistRestorer(t))
+}
+
+func TestPersistRestorer_Withdrawal(t *testing.T) {
+	test.GenericWithdrawalTest(context.Background(), t, pkgtest.Prng(t), test.NewPersistRestorer(t))
+}
+
+func TestPersistRestorer_Forwarding(t *testing.T) {
+	test.GenericForwardingTest(context.Background(), t, pkgtest.Prng(t), test.NewPersistRestorer(t))
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
+	wiretest "perun.network/go-perun/wire/test"
+)
+
+// PipelinePersistRestorer is a PersistRestorer that also persists pipelined
+// transactions.
+type PipelinePersistRestorer interface {
+	persistence.PersistRestorer
+	persistence.PipelinePersister
+}
+
+// GenericPipelineTest tests a PipelinePersistRestorer by pipelining several
+// updates on a channel, enabling and discarding them, and asserting that the
+// staging and pipelined transactions are persisted after every step.
+func GenericPipelineTest(ctx context.Context, t *testing.T, rng *rand.Rand, pr PipelinePersistRestorer) {
+	t.Helper()
+	ch := NewRandomChannel(ctx, t, pr, 0, wiretest.NewRandomAddresses(rng, channelNumPeers), nil, rng)
+	ch.Init(ctx, t, rng)
+	ch.SignAll(ctx, t)
+	ch.EnableInit(t)
+	ch.SetFunded(t)
+
+	next := func(s *channel.State) *channel.State {
+		s = s.Clone()
+		s.Version++
+		return s
+	}
+
+	// Stage version 1 and pipeline versions 2 and 3.
+	require.NoError(t, ch.Update(t, next(ch.State()), ch.Idx()))
+	ch.Pipeline(t, next(ch.LatestState()))
+	ch.Pipeline(t, next(ch.LatestState()))
+	require.Len(t, ch.PipelinedTXs(), 2)
+
+	// Version 2 can be signed before version 1.
+	ch.SignAllAt(ctx, t, 2)
+	ch.SignAll(ctx, t)
+
+	// Enabling version 1 makes the fully signed version 2 the staging
+	// transaction.
+	ch.EnableUpdate(t)
+	require.Equal(t, uint64(2), ch.StagingTX().Version)
+	require.Len(t, ch.PipelinedTXs(), 1)
+	ch.EnableUpdate(t)
+	require.Equal(t, uint64(3), ch.StagingTX().Version)
+	require.Empty(t, ch.PipelinedTXs())
+
+	// Discard a pipelined transaction and then everything from staging on.
+	ch.Pipeline(t, next(ch.LatestState()))
+	ch.DiscardFrom(t, 4)
+	require.Empty(t, ch.PipelinedTXs())
+	ch.Pipeline(t, next(ch.LatestState()))
+	ch.Pipeline(t, next(ch.LatestState()))
+	ch.SignAllAt(ctx, t, 4)
+	ch.DiscardFrom(t, 3)
+	require.Equal(t, channel.Acting, ch.Phase())
+	require.Empty(t, ch.PipelinedTXs())
+
+	// Discarding an update also discards the pipelined transactions.
+	require.NoError(t, ch.Update(t, next(ch.State()), ch.Idx()))
+	ch.Pipeline(t, next(ch.LatestState()))
+	ch.DiscardUpdate(t)
+	require.Empty(t, ch.PipelinedTXs())
+}
+
+// Pipeline calls Pipeline on the state machine and then checks the
+// persistence.
+func (c *Channel) Pipeline(t require.TestingT, state *channel.State) {
+	require.NoError(t, c.StateMachine.Pipeline(c.ctx, state, c.Idx()))
+	c.AssertPipelinePersisted(c.ctx, t)
+}
+
+// SignAllAt signs the staged state with the given version by all parties.
+func (c *Channel) SignAllAt(ctx context.Context, t require.TestingT, version uint64) {
+	_, err := c.SigAt(ctx, version)
+	require.NoError(t, err)
+	c.AssertPipelinePersisted(ctx, t)
+	tx, ok := c.StagedTX(version)
+	require.True(t, ok)
+	for i := range c.accounts {
+		if channel.Index(i) == c.Idx() {
+			continue
+		}
+		sig, err := channel.Sign(c.accounts[i], tx.State)
+		require.NoError(t, err)
+		require.NoError(t, c.AddSigAt(ctx, version, channel.Index(i), sig))
+		c.AssertPipelinePersisted(ctx, t)
+	}
+}
+
+// DiscardFrom calls DiscardFrom on the state machine and then checks the
+// persistence.
+func (c *Channel) DiscardFrom(t require.TestingT, version uint64) {
+	require.NoError(t, c.StateMachine.DiscardFrom(c.ctx, version))
+	c.AssertPipelinePersisted(c.ctx, t)
+}
+
+// AssertPipelinePersisted is like AssertPersisted but additionally compares
+// the pipelined transactions.
+func (c *Channel) AssertPipelinePersisted(ctx context.Context, t require.TestingT) {
+	c.AssertPersisted(ctx, t)
+	ch, err := c.pr.RestoreChannel(ctx, c.ID())
+	require.NoError(t, err)
+	require.Len(t, ch.PipelinedTXs(), len(c.PipelinedTXs()), "PipelinedTXs")
+	for i, tx := range c.PipelinedTXs() {
+		requireEqualStagingTX(t, tx, ch.PipelinedTXs()[i])
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel/persistence"
+	"perun.network/go-perun/wallet"
+	wiretest "perun.network/go-perun/wire/test"
+)
+
+// WithdrawalPersistRestorer is a PersistRestorer that also persists the
+// signatures on partial withdrawals.
+type WithdrawalPersistRestorer interface {
+	persistence.PersistRestorer
+	persistence.WithdrawalPersister
+}
+
+// GenericWithdrawalTest tests a WithdrawalPersistRestorer by persisting
+// withdrawal signatures of a channel and asserting that they are restored
+// until they are cleared.
+func GenericWithdrawalTest(ctx context.Context, t *testing.T, rng *rand.Rand, pr WithdrawalPersistRestorer) {
+	t.Helper()
+	ch := NewRandomChannel(ctx, t, pr, 0, wiretest.NewRandomAddresses(rng, channelNumPeers), nil, rng)
+	ch.Init(ctx, t, rng)
+	ch.SignAll(ctx, t)
+	ch.EnableInit(t)
+	ch.SetFunded(t)
+
+	restored, err := pr.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	assert.Empty(t, restored.WithdrawalAuthSigs, "withdrawal signatures before WithdrawalAuthorized")
+
+	// Any signatures can be used, but they need to be decodable.
+	sigs := wallet.CloneSigs(ch.CurrentTX().Sigs)
+	sigs[len(sigs)-1] = nil
+	require.NoError(t, pr.WithdrawalAuthorized(ctx, ch.ID(), sigs))
+	restored, err = pr.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	assert.Equal(t, sigs, restored.WithdrawalAuthSigs, "withdrawal signatures mismatch")
+
+	require.NoError(t, pr.WithdrawalAuthorized(ctx, ch.ID(), nil))
+	restored, err = pr.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	assert.Empty(t, restored.WithdrawalAuthSigs, "withdrawal signatures after clearing")
+}
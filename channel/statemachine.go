@@ -29,10 +29,15 @@ type StateMachine struct {
 }
 
 // NewStateMachine creates a new StateMachine.
+//
+// If the channel's app is an ActionApp, but no StateApp, the only full state
+// update that the StateMachine accepts is the finalization of the current
+// state. Other updates must be made by the ActionMachine returned by
+// ActionMachineOf.
 func NewStateMachine(acc wallet.Account, params Params) (*StateMachine, error) {
-	app, ok := params.App.(StateApp)
-	if !ok {
-		return nil, errors.New("app must be StateApp")
+	app, err := stateApp(params.App)
+	if err != nil {
+		return nil, err
 	}
 
 	m, err := newMachine(acc, params)
@@ -48,9 +53,9 @@ func NewStateMachine(acc wallet.Account, params Params) (*StateMachine, error) {
 
 // RestoreStateMachine restores a state machine to the data given by Source.
 func RestoreStateMachine(acc wallet.Account, source Source) (*StateMachine, error) {
-	app, ok := source.Params().App.(StateApp)
-	if !ok {
-		return nil, errors.New("app must be StateApp")
+	app, err := stateApp(source.Params().App)
+	if err != nil {
+		return nil, err
 	}
 
 	m, err := restoreMachine(acc, source)
@@ -105,6 +110,63 @@ func (m *StateMachine) ForceUpdate(stagingState *State, actor Index) error {
 	return nil
 }
 
+// Deposit makes the provided state the staging state. It is checked whether
+// the state is a valid deposit of the given actor, that is, it only increases
+// the actor's balances. The deposit must only be enabled after the additional
+// funds have been deposited on-chain.
+func (m *StateMachine) Deposit(stagingState *State, actor Index) error {
+	if err := m.expect(PhaseTransition{Acting, Signing}); err != nil {
+		return err
+	}
+
+	if err := m.validDeposit(stagingState, actor); err != nil {
+		return err
+	}
+
+	m.setStaging(Signing, stagingState)
+	return nil
+}
+
+// WithdrawPartial makes the provided state the staging state. It is checked
+// whether the state is a valid partial withdrawal of the given actor, that is,
+// it only decreases the actor's balances. The withdrawal must only be enabled
+// after the funds have been withdrawn on-chain.
+func (m *StateMachine) WithdrawPartial(stagingState *State, actor Index) error {
+	if err := m.expect(PhaseTransition{Acting, Signing}); err != nil {
+		return err
+	}
+
+	if err := m.validWithdrawal(stagingState, actor); err != nil {
+		return err
+	}
+
+	m.setStaging(Signing, stagingState)
+	return nil
+}
+
+// ChangeAssets makes the provided state the staging state. It is checked
+// whether the state adds or removes exactly one asset. If an asset is added,
+// the state must only be enabled after the new asset has been funded.
+func (m *StateMachine) ChangeAssets(stagingState *State, actor Index) error {
+	if err := m.expect(PhaseTransition{Acting, Signing}); err != nil {
+		return err
+	}
+
+	if err := m.validAssetChange(stagingState, actor); err != nil {
+		return err
+	}
+
+	m.setStaging(Signing, stagingState)
+	return nil
+}
+
+// CheckTransition checks if the given state is a valid transition by the given
+// actor from the current state, without verifying any signature. It is a
+// read-only operation that does not advance the state machine.
+func (m *StateMachine) CheckTransition(state *State, actor Index) error {
+	return m.validTransition(state, actor)
+}
+
 // CheckUpdate checks if the given state is a valid transition from the current
 // state and if the given signature is valid. It is a read-only operation that
 // does not advance the state machine.
@@ -124,21 +186,130 @@ func (m *StateMachine) CheckUpdate(
 	return nil
 }
 
+// Pipeline stages the provided state after the latest staged state without
+// waiting for the staging state to be enabled. The machine has to be in the
+// Signing phase. It is checked whether this is a valid state transition from
+// the latest staged state. Pipelined states are enabled in order by
+// EnableUpdate, once all previous states have been enabled.
+func (m *StateMachine) Pipeline(state *State, actor Index) error {
+	if m.phase != Signing {
+		return m.phaseErrorf(m.selfTransition(), "can only pipeline in Signing phase")
+	}
+
+	if err := m.validTransitionFrom(m.LatestState(), state, actor); err != nil {
+		return err
+	}
+
+	m.appendPipelined(state)
+	return nil
+}
+
+// CheckPipelined checks if the given state is a valid transition from the
+// current or staged state of the previous version and if the given signature
+// is valid. It is a read-only operation that does not advance the state
+// machine.
+func (m *StateMachine) CheckPipelined(
+	state *State, actor Index,
+	sig wallet.Sig, sigIdx Index,
+) error {
+	prev := m.currentTX.State
+	if prev.Version+1 != state.Version {
+		tx := m.stagedTX(state.Version - 1)
+		if tx == nil {
+			return errors.Errorf("no state of version %d", state.Version-1)
+		}
+		prev = tx.State
+	}
+	if err := m.validTransitionFrom(prev, state, actor); err != nil {
+		return err
+	}
+
+	if ok, err := Verify(m.params.Parts[sigIdx], state, sig); err != nil {
+		return errors.WithMessagef(err, "verifying signature[%d]", sigIdx)
+	} else if !ok {
+		return errors.Errorf("invalid signature[%d]", sigIdx)
+	}
+	return nil
+}
+
+// CheckDeposit checks if the given state is a valid deposit of the actor into
+// the current state and if the given signature is valid. It is a read-only
+// operation that does not advance the state machine.
+func (m *StateMachine) CheckDeposit(
+	state *State, actor Index,
+	sig wallet.Sig, sigIdx Index,
+) error {
+	if err := m.validDeposit(state, actor); err != nil {
+		return err
+	}
+
+	if ok, err := Verify(m.params.Parts[sigIdx], state, sig); err != nil {
+		return errors.WithMessagef(err, "verifying signature[%d]", sigIdx)
+	} else if !ok {
+		return errors.Errorf("invalid signature[%d]", sigIdx)
+	}
+	return nil
+}
+
+// CheckWithdrawPartial checks if the given state is a valid partial
+// withdrawal of the actor from the current state and if the given signature is
+// valid. It is a read-only operation that does not advance the state machine.
+func (m *StateMachine) CheckWithdrawPartial(
+	state *State, actor Index,
+	sig wallet.Sig, sigIdx Index,
+) error {
+	if err := m.validWithdrawal(state, actor); err != nil {
+		return err
+	}
+
+	if ok, err := Verify(m.params.Parts[sigIdx], state, sig); err != nil {
+		return errors.WithMessagef(err, "verifying signature[%d]", sigIdx)
+	} else if !ok {
+		return errors.Errorf("invalid signature[%d]", sigIdx)
+	}
+	return nil
+}
+
+// CheckAssetChange checks if the given state is a valid asset change of the
+// current state and if the given signature is valid. It is a read-only
+// operation that does not advance the state machine.
+func (m *StateMachine) CheckAssetChange(
+	state *State, actor Index,
+	sig wallet.Sig, sigIdx Index,
+) error {
+	if err := m.validAssetChange(state, actor); err != nil {
+		return err
+	}
+
+	if ok, err := Verify(m.params.Parts[sigIdx], state, sig); err != nil {
+		return errors.WithMessagef(err, "verifying signature[%d]", sigIdx)
+	} else if !ok {
+		return errors.Errorf("invalid signature[%d]", sigIdx)
+	}
+	return nil
+}
+
 // validTransition makes all the default transition checks and additionally
 // checks for a valid application specific transition.
 // This is where a StateMachine and ActionMachine differ. In an ActionMachine,
 // every action is checked as being a valid action by the application definition
 // and the resulting state by applying all actions to the old state is by
 // definition a valid new state.
-func (m *StateMachine) validTransition(to *State, actor Index) (err error) {
+func (m *StateMachine) validTransition(to *State, actor Index) error {
+	return m.validTransitionFrom(m.currentTX.State, to, actor)
+}
+
+// validTransitionFrom makes the checks of validTransition for a transition
+// from the state `from` instead of the current state.
+func (m *StateMachine) validTransitionFrom(from, to *State, actor Index) (err error) {
 	if actor >= m.N() {
 		return errors.New("actor index is out of range")
 	}
-	if err := m.machine.validTransition(to); err != nil {
+	if err := m.machine.validTransitionFrom(from, to); err != nil {
 		return err
 	}
 
-	if err = m.app.ValidTransition(&m.params, m.currentTX.State, to, actor); IsStateTransitionError(err) {
+	if err = m.app.ValidTransition(&m.params, from, to, actor); IsStateTransitionError(err) {
 		return err
 	}
 	return errors.WithMessagef(err, "runtime error in application's ValidTransition()")
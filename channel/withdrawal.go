@@ -0,0 +1,107 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire/perunio"
+)
+
+// WithdrawalAuth authorizes a partial withdrawal from an open ledger channel.
+// It is signed by all participants together with the channel state that
+// reflects the withdrawal, which has version Version. Participant Idx is
+// allowed to withdraw Amounts[i] of Assets[i] from the channel's holdings.
+type WithdrawalAuth struct {
+	ChannelID ID
+	Version   uint64
+	Idx       Index
+	Assets    []Asset
+	Amounts   []Bal
+}
+
+var _ perunio.Encoder = WithdrawalAuth{}
+
+// withdrawalAuthDomain separates the signatures on withdrawal authorizations
+// from signatures on other data.
+const withdrawalAuthDomain = "perun/channel/WithdrawalAuth"
+
+// NewWithdrawalAuth returns the withdrawal authorization for participant idx
+// moving the channel from state `from` to state `to`. The withdrawn amounts
+// are the differences of idx's balances.
+func NewWithdrawalAuth(from, to *State, idx Index) *WithdrawalAuth {
+	amounts := make([]Bal, len(to.Assets))
+	for a := range amounts {
+		amounts[a] = new(big.Int).Sub(from.Balances[a][idx], to.Balances[a][idx])
+	}
+	return &WithdrawalAuth{
+		ChannelID: to.ID,
+		Version:   to.Version,
+		Idx:       idx,
+		Assets:    to.Assets,
+		Amounts:   amounts,
+	}
+}
+
+// Encode encodes the withdrawal authorization into an io.Writer.
+func (a WithdrawalAuth) Encode(w io.Writer) error {
+	if len(a.Assets) != len(a.Amounts) {
+		return errors.New("assets and amounts length mismatch")
+	}
+	if err := perunio.Encode(w, a.ChannelID, a.Version, a.Idx, Index(len(a.Assets))); err != nil {
+		return err
+	}
+	for i, asset := range a.Assets {
+		if err := perunio.Encode(w, asset, a.Amounts[i]); err != nil {
+			return errors.WithMessagef(err, "encoding asset %d", i)
+		}
+	}
+	return nil
+}
+
+// SignWithdrawalAuth signs the withdrawal authorization with the given
+// account.
+func SignWithdrawalAuth(acc wallet.Account, auth *WithdrawalAuth) (wallet.Sig, error) {
+	data, err := auth.signingData()
+	if err != nil {
+		return nil, err
+	}
+	return acc.SignData(data)
+}
+
+// VerifyWithdrawalAuth verifies that sig is a signature of addr on the
+// withdrawal authorization.
+func VerifyWithdrawalAuth(addr wallet.Address, auth *WithdrawalAuth, sig wallet.Sig) (bool, error) {
+	data, err := auth.signingData()
+	if err != nil {
+		return false, err
+	}
+	return wallet.VerifySignature(data, sig, addr)
+}
+
+// signingData returns the data that is signed to authorize the withdrawal. It
+// is the encoding of the authorization, prefixed with withdrawalAuthDomain.
+func (a WithdrawalAuth) signingData() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := perunio.Encode(&buf, withdrawalAuthDomain, a); err != nil {
+		return nil, errors.WithMessage(err, "encoding withdrawal authorization")
+	}
+	return buf.Bytes(), nil
+}
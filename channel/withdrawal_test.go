@@ -0,0 +1,54 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channel_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "perun.network/go-perun/backend/sim" // backend init
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/test"
+	wallettest "perun.network/go-perun/wallet/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestWithdrawalAuth_Sign(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	from := test.NewRandomState(rng, test.WithNumParts(2))
+	to := from.Clone()
+	to.Version++
+	to.Balances[0][0].SetInt64(0)
+	auth := channel.NewWithdrawalAuth(from, to, 0)
+	acc := wallettest.NewRandomAccount(rng)
+
+	sig, err := channel.SignWithdrawalAuth(acc, auth)
+	require.NoError(t, err)
+	ok, err := channel.VerifyWithdrawalAuth(acc.Address(), auth, sig)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// A signature on the plain encoding is not a valid authorization.
+	var buf bytes.Buffer
+	require.NoError(t, auth.Encode(&buf))
+	sig, err = acc.SignData(buf.Bytes())
+	require.NoError(t, err)
+	ok, err = channel.VerifyWithdrawalAuth(acc.Address(), auth, sig)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
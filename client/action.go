@@ -0,0 +1,158 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+	pcontext "polycry.pt/poly-go/context"
+)
+
+// Act contributes the given action to the next update of an ActionApp channel.
+//
+// Every participant has to call Act on the same channel state, each with its
+// own action. Once the actions of all participants are collected, the
+// channel's ActionApp applies them to the current state and all participants
+// sign the resulting state. In turn-based apps, the participants that are not
+// on turn should contribute an action that does not change the state.
+//
+// Returns nil if all participants signed the resulting state. Returns
+// RequestTimedOutError if any peer did not send its action or signature before
+// the context expires or is cancelled. Returns an ActionError if any action is
+// invalid and an error if any other runtime error occurs or any peer rejects
+// the update.
+func (c *Channel) Act(ctx context.Context, action channel.Action) (err error) {
+	if ctx == nil {
+		return errors.New("context must not be nil")
+	}
+	if c.actions == nil {
+		return errors.New("channel app is not an ActionApp")
+	}
+
+	// Lock machine while update is in progress.
+	if !c.machMtx.TryLockCtx(ctx) {
+		return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
+	}
+	defer c.machMtx.Unlock()
+
+	version := c.machine.State().Version
+	actRecv, err := c.conn.NewActionRecv(version)
+	if err != nil {
+		return errors.WithMessage(err, "creating action receiver")
+	}
+	defer actRecv.Close()
+
+	if err := c.actions.AddAction(c.machine.Idx(), action); err != nil {
+		return errors.WithMessage(err, "adding own action")
+	}
+	// if anything goes wrong until the actions are applied, we discard them.
+	applied := false
+	defer func() {
+		if !applied {
+			c.actions.DiscardActions()
+		}
+	}()
+
+	data, err := action.MarshalBinary()
+	if err != nil {
+		return errors.WithMessage(err, "marshaling action")
+	}
+	msgAct := &msgChannelAction{
+		ChannelID: c.ID(),
+		Version:   version,
+		Action:    data,
+	}
+	if err = c.conn.Send(ctx, msgAct); err != nil {
+		return errors.WithMessage(err, "sending action")
+	}
+
+	if err = c.receiveActions(ctx, actRecv); err != nil {
+		return err
+	}
+
+	resRecv, err := c.conn.NewUpdateResRecv(version + 1)
+	if err != nil {
+		return errors.WithMessage(err, "creating update response receiver")
+	}
+	defer resRecv.Close()
+
+	if err = c.actions.Update(ctx); err != nil {
+		return errors.WithMessage(err, "applying actions")
+	}
+	applied = true
+	// if anything goes wrong from now on, we discard the update.
+	defer func() { c.checkUpdateError(ctx, err) }()
+
+	sig, err := c.machine.Sig(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "signing update")
+	}
+
+	msgUpAcc := &msgChannelUpdateAcc{
+		ChannelID: c.ID(),
+		Version:   version + 1,
+		Sig:       sig,
+	}
+	if err = c.conn.Send(ctx, msgUpAcc); err != nil {
+		return errors.WithMessage(err, "sending signature")
+	}
+
+	if err = c.receiveUpdateSigs(ctx, resRecv, c.machine.Idx()); err != nil {
+		return err
+	}
+
+	return c.enableNotifyUpdate(ctx)
+}
+
+// receiveActions receives the actions of all peers and adds them to the action
+// machine.
+//
+// Returns RequestTimedOutError if any peer did not send its action before the
+// context expires or is cancelled.
+func (c *Channel) receiveActions(ctx context.Context, actRecv *channelMsgRecv) error {
+	app, ok := c.Params().App.(channel.ActionApp) // safe as there is an action machine
+	if !ok {
+		log.Panic("channel app is not an ActionApp")
+	}
+
+	for numMissing := len(c.Peers()) - 1; numMissing > 0; {
+		pidx, msg, err := actRecv.Next(ctx)
+		if err != nil {
+			if pcontext.IsContextError(err) {
+				return newRequestTimedOutError("channel action", err.Error())
+			}
+			return errors.WithMessage(err, "receiving action")
+		}
+		c.Log().Tracef("Received action (%T): %v", msg, msg)
+
+		msgAct, ok := msg.(*msgChannelAction) // safe by predicate of the actRecv
+		if !ok {
+			log.Panic("wrong message type")
+		}
+		action := app.NewAction()
+		if err := action.UnmarshalBinary(msgAct.Action); err != nil {
+			return errors.WithMessagef(err, "unmarshaling action of peer %d", pidx)
+		}
+		if err := c.actions.AddAction(pidx, action); err != nil {
+			return errors.WithMessagef(err, "adding action of peer %d", pidx)
+		}
+		numMissing--
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wallet"
+	wtest "perun.network/go-perun/wallet/test"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/test"
+)
+
+// actionApp hides the StateApp methods of the wrapped MockApp.
+type actionApp struct {
+	channel.ActionApp
+}
+
+func TestChannel_Act(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	app := actionApp{channel.NewMockApp(wtest.NewRandomAddress(rng))}
+	channel.RegisterApp(app)
+	chs := openActionChannel(ctx, t, rng, app)
+
+	act := func(ch *client.Channel, op channel.MockOp) <-chan error {
+		errs := make(chan error, 1)
+		go func() { errs <- ch.Act(ctx, channel.NewMockOp(op)) }()
+		return errs
+	}
+
+	t.Run("valid actions", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			errs := []<-chan error{act(chs[0], channel.OpValid), act(chs[1], channel.OpValid)}
+			for _, err := range errs {
+				require.NoError(t, <-err)
+			}
+			for _, ch := range chs {
+				assert.Equal(t, uint64(i+1), ch.State().Version)
+			}
+		}
+	})
+
+	t.Run("invalid own action", func(t *testing.T) {
+		err := chs[0].Act(ctx, channel.NewMockOp(channel.OpActionErr))
+		assert.True(t, channel.IsActionError(err))
+	})
+
+	t.Run("finalize and settle", func(t *testing.T) {
+		require.NoError(t, chs[0].Update(ctx, func(s *channel.State) error {
+			s.IsFinal = true
+			return nil
+		}))
+		assert.NoError(t, chs[0].Settle(ctx, false))
+		assert.NoError(t, chs[1].Settle(ctx, true))
+	})
+}
+
+func TestChannel_ActNoActionApp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	chs := openActionChannel(ctx, t, rng, channel.NoApp())
+	assert.Error(t, chs[0].Act(ctx, channel.NewMockOp(channel.OpValid)))
+}
+
+// openActionChannel opens a channel with the given app between two new
+// clients. The initial app data is a valid MockOp.
+func openActionChannel(ctx context.Context, t *testing.T, rng *rand.Rand, app channel.App) [2]*client.Channel {
+	t.Helper()
+	clients := NewClients(t, rng, []string{"Alice", "Bob"})
+	t.Cleanup(func() {
+		for _, c := range clients {
+			assert.NoError(t, c.Close())
+		}
+	})
+	peers := []wire.Address{clients[0].Identity.Address(), clients[1].Identity.Address()}
+	parts := []wallet.Address{
+		clients[0].Wallet.NewRandomAccount(rng).Address(),
+		clients[1].Wallet.NewRandomAccount(rng).Address(),
+	}
+
+	var chs [2]*client.Channel
+	accepted := make(chan error, 1)
+	go clients[1].Handle(
+		client.ProposalHandlerFunc(func(p client.ChannelProposal, r *client.ProposalResponder) {
+			acc := p.(*client.LedgerChannelProposal).Accept(parts[1], client.WithRandomNonce())
+			ch, err := r.Accept(ctx, acc)
+			chs[1] = ch
+			accepted <- err
+		}),
+		client.UpdateHandlerFunc(func(_ *channel.State, _ client.ChannelUpdate, r *client.UpdateResponder) {
+			assert.NoError(t, r.Accept(ctx))
+		}),
+	)
+
+	asset := chtest.NewRandomAsset(rng)
+	alloc := channel.NewAllocation(len(peers), asset)
+	alloc.SetAssetBalances(asset, []*big.Int{big.NewInt(10), big.NewInt(10)})
+	appOpt := client.WithoutApp()
+	if !channel.IsNoApp(app) {
+		appOpt = client.WithApp(app, channel.NewMockOp(channel.OpValid))
+	}
+	prop, err := client.NewLedgerChannelProposal(60, parts[0], alloc, peers, appOpt, client.WithRandomNonce())
+	require.NoError(t, err)
+
+	chs[0], err = clients[0].ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	require.NoError(t, <-accepted)
+	return chs
+}
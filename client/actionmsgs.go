@@ -0,0 +1,64 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"io"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+func init() {
+	wire.RegisterDecoder(wire.ChannelAction,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelAction
+			return &m, m.Decode(r)
+		})
+}
+
+// msgChannelAction is the wire message by which a participant of an ActionApp
+// channel contributes its action to the next channel update. The action is
+// sent in its binary representation because its decoding depends on the
+// channel's app.
+type msgChannelAction struct {
+	// ChannelID is the channel ID.
+	ChannelID channel.ID
+	// Version of the state that the action is applied to.
+	Version uint64
+	// Action is the binary representation of the action.
+	Action []byte
+}
+
+var _ ChannelMsg = (*msgChannelAction)(nil)
+
+// Type returns this message's type: ChannelAction.
+func (*msgChannelAction) Type() wire.Type {
+	return wire.ChannelAction
+}
+
+// ID returns the id of the channel this action refers to.
+func (m *msgChannelAction) ID() channel.ID {
+	return m.ChannelID
+}
+
+func (m msgChannelAction) Encode(w io.Writer) error {
+	return perunio.Encode(w, m.ChannelID, m.Version, bytesWithLen(m.Action))
+}
+
+func (m *msgChannelAction) Decode(r io.Reader) error {
+	return perunio.Decode(r, &m.ChannelID, &m.Version, (*bytesWithLen)(&m.Action))
+}
@@ -88,7 +88,10 @@ func (c *Channel) startWatching() (watcher.StatesPub, watcher.AdjudicatorSub, er
 		}
 	})
 	if !ok {
-		return nil, nil, errors.WithMessage(err, "channel already closed")
+		if err := c.client.watcher.StopWatching(c.Ctx(), c.ID()); err != nil {
+			c.Log().Errorf("Error de-registering channel from watcher: %v", err)
+		}
+		return nil, nil, errors.New("channel already closed")
 	}
 	return statesPub, eventsSub, nil
 }
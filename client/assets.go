@@ -0,0 +1,159 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+)
+
+// AddAsset proposes to add `asset` to the ledger channel with the given
+// initial balances of the participants.
+//
+// Asset changes are passed to the peers' UpdateHandlers, as accepting them
+// requires the peers to fund their share of the new asset. After all
+// participants signed the new state, each participant calls the
+// channel.Funder with a top-up request, see channel.NewTopUpReq, which
+// deposits its balance of the new asset and waits until the channel's holdings
+// cover the new state. Only then the new state is enabled. No other update
+// can be made while the asset is being funded.
+//
+// Assets cannot be changed while funds are locked in sub-channels. If the
+// funding fails, the update is discarded. Interrupted asset changes are not
+// resumed when the client is restored.
+func (c *Channel) AddAsset(ctx context.Context, asset channel.Asset, bals []channel.Bal) error {
+	if len(bals) != len(c.Peers()) {
+		return errors.Errorf("expected %d balances, got %d", len(c.Peers()), len(bals))
+	}
+	return c.changeAssets(ctx, func(next *channel.State) error {
+		if _, ok := next.AssetIndex(asset); ok {
+			return errors.New("asset already in channel")
+		}
+		next.Assets = append(next.Assets, asset)
+		next.Balances = append(next.Balances, channel.CloneBals(bals))
+		return nil
+	})
+}
+
+// RemoveAsset proposes to remove `asset` from the ledger channel. The asset
+// must not hold any balances. Like AddAsset, the removal is passed to the
+// peers' UpdateHandlers.
+func (c *Channel) RemoveAsset(ctx context.Context, asset channel.Asset) error {
+	return c.changeAssets(ctx, func(next *channel.State) error {
+		idx, ok := next.AssetIndex(asset)
+		if !ok {
+			return errors.New("asset not in channel")
+		}
+		next.Assets = append(next.Assets[:idx], next.Assets[idx+1:]...)
+		next.Balances = append(next.Balances[:idx], next.Balances[idx+1:]...)
+		return nil
+	})
+}
+
+// changeAssets proposes the asset change done by `change` on a copy of the
+// current state and funds it.
+func (c *Channel) changeAssets(ctx context.Context, change func(*channel.State) error) (err error) {
+	if ctx == nil {
+		return errors.New("context must not be nil")
+	}
+	if !c.IsLedgerChannel() {
+		return errors.New("assets can only be changed in ledger channels")
+	}
+
+	// Lock machine while the asset change is in progress.
+	if !c.machMtx.TryLockCtx(ctx) {
+		return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
+	}
+	defer c.machMtx.Unlock()
+
+	next := c.machine.State().Clone()
+	if err := change(next); err != nil {
+		return err
+	}
+	next.Version++
+
+	up := makeChannelUpdate(next, c.machine.Idx())
+	if err = c.machine.ChangeAssets(ctx, up.State, up.ActorIdx); err != nil {
+		return errors.WithMessage(err, "staging asset change")
+	}
+	// if anything goes wrong from now on, we discard the update.
+	defer func() { c.checkUpdateError(ctx, err) }()
+
+	if err = c.proposeStaged(ctx, up, func(m *msgChannelUpdate) wire.Msg {
+		return &msgChannelAssetChange{*m}
+	}); err != nil {
+		return err
+	}
+
+	if err = c.fundAssetChange(ctx); err != nil {
+		return err
+	}
+	return c.enableNotifyUpdate(ctx)
+}
+
+// handleAssetChangeReq checks an asset change of a peer and passes it to the
+// UpdateHandler. It is called by handleUpdateReq, which holds the machine
+// mutex.
+func (c *Channel) handleAssetChangeReq(pidx channel.Index, req *msgChannelAssetChange, uh UpdateHandler) {
+	up := req.Base().ChannelUpdate
+	var err error
+	switch {
+	case !c.IsLedgerChannel():
+		err = errors.New("assets can only be changed in ledger channels")
+	case up.ActorIdx != pidx:
+		err = errors.New("actor must be the proposer")
+	default:
+		err = c.machine.CheckAssetChange(up.State, up.ActorIdx, req.Base().Sig, pidx)
+	}
+	if err != nil {
+		c.logPeer(pidx).Warnf("invalid asset change received: %v", err)
+		return
+	}
+
+	responder := &UpdateResponder{channel: c, pidx: pidx, req: req}
+	uh.HandleUpdate(c.machine.State(), up, responder)
+}
+
+// fundAssetChange funds our balance of an asset that is added by the staged
+// state and waits until the channel's holdings cover the staged state. It
+// does nothing if no asset is added.
+func (c *Channel) fundAssetChange(ctx context.Context) error {
+	cur, next := c.machine.State(), c.machine.StagingState()
+	if len(next.Assets) <= len(cur.Assets) {
+		return nil
+	}
+
+	deposits := make(channel.Balances, len(next.Assets))
+	for a, asset := range next.Assets {
+		if _, ok := cur.AssetIndex(asset); ok {
+			deposits[a] = make([]channel.Bal, len(c.Peers()))
+			for i := range deposits[a] {
+				deposits[a][i] = big.NewInt(0)
+			}
+		} else {
+			deposits[a] = channel.CloneBals(next.Balances[a])
+		}
+	}
+	req := channel.NewTopUpReq(c.Params(), next, c.machine.Idx(), deposits)
+	if err := c.client.funder.Fund(ctx, *req); err != nil {
+		return errors.WithMessage(err, "funding added asset")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/test"
+)
+
+func TestChannel_ChangeAssets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	rng := test.Prng(t)
+	assets := []channel.Asset{chtest.NewRandomAsset(rng), chtest.NewRandomAsset(rng), chtest.NewRandomAsset(rng)}
+
+	clients := NewClients(t, rng, []string{"Alice", "Bob"})
+	alice, bob := clients[0], clients[1]
+
+	// Bob accepts the ledger channel. Both accept all updates, except that
+	// Bob rejects adding assets with a balance of more than 10 for him.
+	channelsBob := make(chan *client.Channel, 1)
+	var proposalHandlerBob client.ProposalHandlerFunc = func(cp client.ChannelProposal, pr *client.ProposalResponder) {
+		lcp, ok := cp.(*client.LedgerChannelProposal)
+		if !ok {
+			pr.Reject(ctx, "unexpected proposal") //nolint:errcheck
+			return
+		}
+		ch, err := pr.Accept(ctx, lcp.Accept(bob.Identity.Address(), client.WithRandomNonce()))
+		assert.NoError(t, err)
+		channelsBob <- ch
+	}
+	var updateHandlerBob client.UpdateHandlerFunc = func(s *channel.State, up client.ChannelUpdate, ur *client.UpdateResponder) {
+		if n := len(up.State.Assets); n > len(s.Assets) && up.State.Balances[n-1][1].Cmp(big.NewInt(10)) > 0 {
+			ur.Reject(ctx, "too much") //nolint:errcheck
+			return
+		}
+		ur.Accept(ctx) //nolint:errcheck
+	}
+	go bob.Handle(proposalHandlerBob, updateHandlerBob)
+	var proposalHandlerAlice client.ProposalHandlerFunc = func(_ client.ChannelProposal, pr *client.ProposalResponder) {
+		pr.Reject(ctx, "unexpected proposal") //nolint:errcheck
+	}
+	var updateHandlerAlice client.UpdateHandlerFunc = func(_ *channel.State, _ client.ChannelUpdate, ur *client.UpdateResponder) {
+		ur.Accept(ctx) //nolint:errcheck
+	}
+	go alice.Handle(proposalHandlerAlice, updateHandlerAlice)
+
+	peers := []wire.Address{alice.Identity.Address(), bob.Identity.Address()}
+	initAlloc := channel.NewAllocation(len(peers), assets[0])
+	initAlloc.SetAssetBalances(assets[0], []channel.Bal{big.NewInt(10), big.NewInt(10)})
+	prop, err := client.NewLedgerChannelProposal(challengeDuration, alice.Identity.Address(), initAlloc, peers)
+	require.NoError(t, err)
+	chAlice, err := alice.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	chBob := <-channelsBob
+
+	// assertAssets asserts that both channels eventually have the given assets
+	// in the given version.
+	assertAssets := func(version uint64, assets ...channel.Asset) {
+		t.Helper()
+		for _, ch := range []*client.Channel{chAlice, chBob} {
+			require.Eventually(t, func() bool {
+				s := ch.State()
+				return s.Version == version && channel.AssetsAssertEqual(s.Assets, assets) == nil
+			}, testDuration, 10*time.Millisecond)
+		}
+	}
+
+	require.NoError(t, chAlice.AddAsset(ctx, assets[1], []channel.Bal{big.NewInt(5), big.NewInt(3)}))
+	assertAssets(1, assets[0], assets[1])
+	require.NoError(t, chBob.AddAsset(ctx, assets[2], []channel.Bal{big.NewInt(0), big.NewInt(0)}))
+	assertAssets(2, assets[0], assets[1], assets[2])
+
+	// Invalid and rejected asset changes.
+	assert.Error(t, chAlice.AddAsset(ctx, assets[1], []channel.Bal{big.NewInt(1), big.NewInt(1)}))
+	assert.Error(t, chAlice.AddAsset(ctx, chtest.NewRandomAsset(rng), []channel.Bal{big.NewInt(1), big.NewInt(11)}))
+	assert.Error(t, chAlice.RemoveAsset(ctx, assets[0]))
+	assertAssets(2, assets[0], assets[1], assets[2])
+
+	require.NoError(t, chAlice.RemoveAsset(ctx, assets[2]))
+	assertAssets(3, assets[0], assets[1])
+
+	// The added asset can be used.
+	require.NoError(t, chAlice.Update(ctx, func(s *channel.State) error {
+		s.Balances[1] = []channel.Bal{big.NewInt(1), big.NewInt(7)}
+		s.IsFinal = true
+		return nil
+	}))
+	assertAssets(4, assets[0], assets[1])
+
+	require.NoError(t, chAlice.Settle(ctx, false))
+	require.NoError(t, chBob.Settle(ctx, false))
+	for _, c := range []struct {
+		client   *Client
+		expected int64
+	}{{alice, 1}, {bob, 7}} {
+		got := alice.BalanceReader.Balance(c.client.Identity.Address(), assets[1])
+		assert.Zerof(t, got.Cmp(big.NewInt(c.expected)), "%s: wrong balance: %v", c.client.Name, got)
+	}
+}
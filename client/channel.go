@@ -31,23 +31,48 @@ import (
 // Channel is the channel controller, progressing the channel state machine and
 // executing the channel update and dispute protocols.
 //
-// Currently, only the two-party protocol is fully implemented.
+// Ledger channels support any number of participants, while virtual channels
+// are currently restricted to two participants.
 type Channel struct {
 	perunsync.OnCloser
 	log.Embedding
 
-	client      *Client
-	conn        *channelConn
-	machine     persistence.StateMachine
-	machMtx     perunsync.Mutex
-	statesPub   watcher.StatesPub
-	onUpdate    func(from, to *channel.State)
-	adjudicator channel.Adjudicator
-	wallet      wallet.Wallet
+	client          *Client
+	conn            *channelConn
+	machine         persistence.StateMachine
+	actions         *persistence.ActionMachine // must be nil if the app is no ActionApp
+	machMtx         perunsync.Mutex
+	statesPub       watcher.StatesPub
+	onUpdate        func(from, to *channel.State)
+	onCounterUpdate CounterUpdateHandler
+	adjudicator     channel.Adjudicator
+	wallet          wallet.Wallet
 
 	parent                *Channel            // must be nil for ledger channel
 	subChannelFundings    *updateInterceptors // awaited subchannel funding updates
 	subChannelWithdrawals *updateInterceptors // awaited subchannel settlement updates
+
+	// virtualNextHop is the ledger channel to which the funding of this
+	// virtual channel was forwarded, or nil if we are not a forwarding
+	// intermediary. It is persisted by a persistence.ForwardingPersister.
+	virtualNextHop *Channel
+
+	// withdrawal collects the signatures on the authorization of the partial
+	// withdrawal in progress, or is nil. It is guarded by machMtx.
+	withdrawal *pendingWithdrawal
+
+	// onChain is closed when the on-chain part of the staged deposit or
+	// partial withdrawal, which is in progress, completed, or is nil. It is
+	// guarded by machMtx.
+	onChain chan struct{}
+
+	// pipeline holds the outstanding updates in pipelined mode, or is nil.
+	// It is guarded by machMtx.
+	pipeline *pipeline
+
+	// updateQueue holds the updates that wait to be proposed as part of a
+	// batched update.
+	updateQueue updateQueue
 }
 
 // newChannel is internally used by the Client to create a new channel
@@ -67,7 +92,14 @@ func (c *Client) newChannel(
 
 // channelFromSource is used to create a channel controller from restored data.
 func (c *Client) channelFromSource(s channel.Source, parent *Channel, peers ...wire.Address) (*Channel, error) {
-	acc, err := c.wallet.Unlock(s.Params().Parts[s.Idx()])
+	var acc wallet.Account
+	addr := s.Params().Parts[s.Idx()]
+	acc, err := c.wallet.Unlock(addr)
+	if err != nil && parent != nil {
+		// We are an intermediary of a virtual channel, which we hold with a
+		// dummy account, see persistVirtualChannel.
+		acc, err = &dummyAccount{addr}, nil
+	}
 	if err != nil {
 		return nil, errors.WithMessage(err, "unlocking account for channel")
 	}
@@ -86,6 +118,16 @@ func (c *Client) channelFromMachine(machine *channel.StateMachine, parent *Chann
 	machine.SetLog(logger) // client logger has more fields
 	pmachine := persistence.FromStateMachine(machine, c.pr)
 
+	var actions *persistence.ActionMachine
+	if channel.IsActionApp(machine.Params().App) {
+		am, err := channel.ActionMachineOf(machine)
+		if err != nil {
+			return nil, errors.WithMessage(err, "creating action machine")
+		}
+		pam := persistence.FromActionMachine(am, c.pr)
+		actions = &pam
+	}
+
 	// bundle peers into channel connection
 	conn, err := newChannelConn(machine.ID(), peers, machine.Idx(), &c.conn, &c.conn)
 	if err != nil {
@@ -101,6 +143,7 @@ func (c *Client) channelFromMachine(machine *channel.StateMachine, parent *Chann
 		Embedding:             log.MakeEmbedding(logger),
 		conn:                  conn,
 		machine:               pmachine,
+		actions:               actions,
 		adjudicator:           c.adjudicator,
 		wallet:                c.wallet,
 		subChannelFundings:    newUpdateInterceptors(),
@@ -207,7 +250,7 @@ func (c *Channel) initExchangeSigsAndEnable(ctx context.Context) error {
 	}
 	defer resRecv.Close()
 
-	send := make(chan error)
+	send := make(chan error, 1)
 	go func() {
 		send <- c.conn.Send(ctx, &msgChannelUpdateAcc{
 			ChannelID: c.ID(),
@@ -216,19 +259,8 @@ func (c *Channel) initExchangeSigsAndEnable(ctx context.Context) error {
 		})
 	}()
 
-	pidx, cm, err := resRecv.Next(ctx)
-	if err != nil {
-		return errors.WithMessage(err, "receiving initial state sig")
-	}
-	acc, ok := cm.(*msgChannelUpdateAcc)
-	if !ok {
-		return errors.Errorf(
-			"received unexpected message of type (%T) from peer[%d]: %v",
-			cm, pidx, cm)
-	}
-
-	if err := c.machine.AddSig(ctx, pidx, acc.Sig); err != nil {
-		return err
+	if err := c.receiveUpdateSigs(ctx, resRecv, c.machine.Idx()); err != nil {
+		return errors.WithMessage(err, "receiving initial state sigs")
 	}
 	if err := c.machine.EnableInit(ctx); err != nil {
 		return err
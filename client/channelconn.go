@@ -43,7 +43,7 @@ type channelConn struct {
 // newChannelConn creates a new channel connection for the given channel ID. It
 // subscribes on the subscriber to all messages regarding this channel.
 func newChannelConn(id channel.ID, peers []wire.Address, idx channel.Index, sub wire.Subscriber, pub wire.Publisher) (_ *channelConn, err error) {
-	// relay to receive all update responses
+	// relay to receive all update responses and actions
 	relay := wire.NewRelay()
 	// we cache all responses for the lifetime of the relay
 	cacheAll := func(*wire.Envelope) bool { return true }
@@ -59,12 +59,16 @@ func newChannelConn(id channel.ID, peers []wire.Address, idx channel.Index, sub
 		}
 	}()
 
-	isUpdateRes := func(e *wire.Envelope) bool {
-		ok := e.Msg.Type() == wire.ChannelUpdateAcc || e.Msg.Type() == wire.ChannelUpdateRej
+	isChannelMsg := func(e *wire.Envelope) bool {
+		ok := e.Msg.Type() == wire.ChannelUpdateAcc ||
+			e.Msg.Type() == wire.ChannelUpdateRej ||
+			e.Msg.Type() == wire.ChannelUpdateCounter ||
+			e.Msg.Type() == wire.ChannelWithdrawalAcc ||
+			e.Msg.Type() == wire.ChannelAction
 		return ok && e.Msg.(ChannelMsg).ID() == id
 	}
 
-	if err = sub.Subscribe(relay, isUpdateRes); err != nil {
+	if err = sub.Subscribe(relay, isChannelMsg); err != nil {
 		return nil, errors.WithMessagef(err, "subscribing relay")
 	}
 
@@ -136,6 +140,25 @@ func (c *channelConn) NewUpdateResRecv(version uint64) (*channelMsgRecv, error)
 	}, nil
 }
 
+// NewActionRecv creates a new receiver for the actions on the state of the
+// given version. The receiver should be closed after all expected actions are
+// received. The receiver is also closed when the channel connection is closed.
+func (c *channelConn) NewActionRecv(version uint64) (*channelMsgRecv, error) {
+	recv := wire.NewReceiver()
+	if err := c.r.Subscribe(recv, func(e *wire.Envelope) bool {
+		act, ok := e.Msg.(*msgChannelAction)
+		return ok && act.Version == version
+	}); err != nil {
+		return nil, errors.WithMessagef(err, "subscribing action receiver")
+	}
+
+	return &channelMsgRecv{
+		Receiver: recv,
+		peers:    c.peers,
+		log:      c.log.WithField("version", version),
+	}, nil
+}
+
 type (
 	// A channelMsgRecv is a receiver of channel messages. Messages are received
 	// with Next(), which returns the peer's channel index and the message.
@@ -33,7 +33,8 @@ import (
 // with a state channel network. It can be used to propose channels to other
 // channel network peers.
 //
-// Currently, only the two-party protocol is fully implemented.
+// Ledger channels may have any number of participants, while virtual
+// channels are currently restricted to two participants.
 type Client struct {
 	address           wire.Address
 	conn              clientConn
@@ -48,6 +49,9 @@ type Client struct {
 	settlementWatcher *stateWatcher
 	watcher           watcher.Watcher
 
+	counterHandlerMtx sync.Mutex
+	counterHandler    CounterProposalHandler
+
 	sync.Closer
 }
 
@@ -136,6 +140,24 @@ func (c *Client) OnNewChannel(handler func(*Channel)) {
 	c.channels.OnNewChannel(handler)
 }
 
+// OnCounterProposal sets the callback that is called by ProposeChannel
+// whenever a peer answers a channel proposal with a counter-proposal. Only one
+// such handler can be set at a time, and repeated calls to this function will
+// overwrite the currently existing handler. If no handler is set,
+// ProposeChannel returns a PeerCounteredError on a counter-proposal. This
+// function may be safely called at any time.
+func (c *Client) OnCounterProposal(handler CounterProposalHandler) {
+	c.counterHandlerMtx.Lock()
+	defer c.counterHandlerMtx.Unlock()
+	c.counterHandler = handler
+}
+
+func (c *Client) counterProposalHandler() CounterProposalHandler {
+	c.counterHandlerMtx.Lock()
+	defer c.counterHandlerMtx.Unlock()
+	return c.counterHandler
+}
+
 // EnablePersistence sets the PersistRestorer that the client is going to use for channel
 // persistence. This methods is expected to be called once during the setup of
 // the client and is hence not thread-safe.
@@ -183,6 +205,14 @@ func (c *Client) Handle(ph ProposalHandler, uh UpdateHandler) {
 			go c.handleChannelUpdate(uh, env.Sender, msg)
 		case *virtualChannelSettlementProposal:
 			go c.handleChannelUpdate(uh, env.Sender, msg)
+		case *msgChannelDeposit:
+			go c.handleChannelUpdate(uh, env.Sender, msg)
+		case *msgChannelWithdrawal:
+			go c.handleChannelUpdate(uh, env.Sender, msg)
+		case *msgChannelAssetChange:
+			go c.handleChannelUpdate(uh, env.Sender, msg)
+		case *msgChannelPipelinedUpdate:
+			go c.handleChannelUpdate(uh, env.Sender, msg)
 		case *msgChannelSync:
 			go c.handleSyncMsg(env.Sender, msg)
 		default:
@@ -218,14 +248,32 @@ func (c *Client) Restore(ctx context.Context) error {
 		return errors.WithMessage(err, "restoring active peers")
 	}
 
-	var eg errgroup.Group
+	// The channels are loaded per peer in parallel and then merged, as
+	// channels with more than two participants are shared with several
+	// peers.
+	var (
+		eg    errgroup.Group
+		dbMtx sync.Mutex
+		db    = make(map[channel.ID]*persistence.Channel)
+	)
 	for _, p := range ps {
 		if p.Equal(c.address) {
 			continue // skip own peer
 		}
 		p := p
-		eg.Go(func() error { return c.restorePeerChannels(ctx, p) })
+		eg.Go(func() error {
+			chs, err := c.loadPeerChannels(ctx, p)
+			dbMtx.Lock()
+			defer dbMtx.Unlock()
+			for id, ch := range chs {
+				db[id] = ch
+			}
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
 	}
 
-	return eg.Wait()
+	return c.restoreChannels(ctx, db)
 }
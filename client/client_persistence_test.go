@@ -16,11 +16,23 @@ package client_test
 
 import (
 	"context"
+	"math/big"
 	"math/rand"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
 	chprtest "perun.network/go-perun/channel/persistence/test"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
 	ctest "perun.network/go-perun/client/test"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/test"
 )
 
 func TestPersistencePetraRobert(t *testing.T) {
@@ -45,3 +57,408 @@ func NewSetupsPersistence(t *testing.T, rng *rand.Rand, names []string) []ctest.
 	}
 	return setups
 }
+
+// persistentPair holds Alice and Bob with persistence enabled. Bob accepts all
+// channel proposals and updates.
+type persistentPair struct {
+	setups []ctest.RoleSetup
+	alice  *client.Client
+	asset  channel.Asset
+}
+
+// setupPersistentPair creates Alice and Bob from the given setups, which may be
+// modified before, e.g., to record Alice's funding requests. Bob is closed when
+// the test ends, whereas Alice has to be closed by the test.
+func setupPersistentPair(ctx context.Context, t *testing.T, rng *rand.Rand, setups []ctest.RoleSetup) *persistentPair {
+	t.Helper()
+	bob := newPersistentClient(t, setups[1])
+	t.Cleanup(func() { bob.Close() })
+	acceptAll(ctx, t, rng, bob, setups[1])
+	return &persistentPair{
+		setups: setups,
+		alice:  newPersistentClient(t, setups[0]),
+		asset:  chtest.NewRandomAsset(rng),
+	}
+}
+
+// openChannel opens a channel from Alice to Bob with a balance of 10 each. It
+// returns Alice's channel and her participant address.
+func (p *persistentPair) openChannel(ctx context.Context, t *testing.T, rng *rand.Rand, opts ...client.ProposalOpts) (*client.Channel, wire.Address) {
+	t.Helper()
+	peers := []wire.Address{p.setups[0].Identity.Address(), p.setups[1].Identity.Address()}
+	alloc := channel.NewAllocation(len(peers), p.asset)
+	alloc.SetAssetBalances(p.asset, []*big.Int{big.NewInt(10), big.NewInt(10)})
+	part := p.setups[0].Wallet.NewRandomAccount(rng).Address()
+	prop, err := client.NewLedgerChannelProposal(60, part, alloc, peers,
+		append([]client.ProposalOpts{client.WithRandomNonce()}, opts...)...)
+	require.NoError(t, err)
+	ch, err := p.alice.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	return ch, part
+}
+
+// newPersistentClient creates a client from the setup with persistence
+// enabled.
+func newPersistentClient(t *testing.T, setup ctest.RoleSetup) *client.Client {
+	t.Helper()
+	c, err := client.New(setup.Identity.Address(), setup.Bus, setup.Funder, setup.Adjudicator, setup.Wallet, setup.Watcher)
+	require.NoError(t, err)
+	c.EnablePersistence(setup.PR)
+	return c
+}
+
+// acceptAll lets c accept all channel proposals and updates.
+func acceptAll(ctx context.Context, t *testing.T, rng *rand.Rand, c *client.Client, setup ctest.RoleSetup) {
+	part := setup.Wallet.NewRandomAccount(rng).Address()
+	go c.Handle(
+		client.ProposalHandlerFunc(func(p client.ChannelProposal, r *client.ProposalResponder) {
+			_, err := r.Accept(ctx, p.(*client.LedgerChannelProposal).Accept(part, client.WithRandomNonce()))
+			assert.NoError(t, err)
+		}),
+		client.UpdateHandlerFunc(func(_ *channel.State, _ client.ChannelUpdate, r *client.UpdateResponder) {
+			assert.NoError(t, r.Accept(ctx))
+		}),
+	)
+}
+
+// TestPersistenceSyncInterruptedUpdate tests that a client that crashed during
+// an update adopts the peer's newer state when restoring the channel.
+func TestPersistenceSyncInterruptedUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	setups := NewSetupsPersistence(t, rng, []string{"Alice", "Bob"})
+	pair := setupPersistentPair(ctx, t, rng, setups)
+	alice := pair.alice
+	acceptAll(ctx, t, rng, alice, setups[0])
+
+	// Open a channel and update it twice.
+	ch, _ := pair.openChannel(ctx, t, rng)
+
+	transfer := func(s *channel.State) error {
+		s.Balances[0][0].Sub(s.Balances[0][0], big.NewInt(1))
+		s.Balances[0][1].Add(s.Balances[0][1], big.NewInt(1))
+		return nil
+	}
+	require.NoError(t, ch.Update(ctx, transfer))
+	pch, err := setups[0].PR.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	prevTX := pch.CurrentTXV.Clone()
+	require.NoError(t, ch.Update(ctx, transfer))
+	require.NoError(t, alice.Close())
+
+	// Rewind Alice's persisted data as if she crashed before receiving Bob's
+	// signature on the last update.
+	pch, err = setups[0].PR.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	interrupted := *pch
+	interrupted.StagingTXV = pch.CurrentTXV.Clone()
+	interrupted.StagingTXV.Sigs[1] = nil
+	interrupted.CurrentTXV = prevTX
+	interrupted.PhaseV = channel.Signing
+	require.NoError(t, setups[0].PR.Enabled(ctx, &interrupted))
+
+	// Restore Alice and check that she adopted Bob's state.
+	alice = newPersistentClient(t, setups[0])
+	defer alice.Close()
+	restored := make(chan *client.Channel, 1)
+	alice.OnNewChannel(func(ch *client.Channel) { restored <- ch })
+	acceptAll(ctx, t, rng, alice, setups[0])
+	require.NoError(t, alice.Restore(ctx))
+
+	select {
+	case rch := <-restored:
+		assert.Equal(t, uint64(2), rch.State().Version)
+		assert.Equal(t, channel.Acting, rch.Phase())
+		pch, err := setups[0].PR.RestoreChannel(ctx, rch.ID())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), pch.CurrentTXV.Version)
+		assert.Equal(t, channel.Acting, pch.PhaseV)
+	case <-ctx.Done():
+		t.Fatal("channel not restored")
+	}
+}
+
+// fundingRecorder is a Funder that records the funding requests. If err is
+// set, it is returned instead of funding.
+type fundingRecorder struct {
+	channel.Funder
+	reqs chan channel.FundingReq
+	err  error
+}
+
+func (f *fundingRecorder) Fund(ctx context.Context, req channel.FundingReq) error {
+	f.reqs <- req
+	if f.err != nil {
+		return f.err
+	}
+	return f.Funder.Fund(ctx, req)
+}
+
+func TestPersistenceResumeFunding(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		phase       channel.Phase
+		signed      bool
+		noAgreement bool // whether the funding agreement is not persisted
+		timeout     bool // whether Bob does not fund the restored channel
+		resumed     bool
+	}{
+		{"Funding", channel.Funding, true, false, false, true},
+		{"Funding/no agreement", channel.Funding, true, true, false, false},
+		{"Funding/timeout", channel.Funding, true, false, true, true},
+		{"InitSigning/signed", channel.InitSigning, true, false, false, true},
+		{"InitSigning/unsigned", channel.InitSigning, false, false, false, false},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+			defer cancel()
+			rng := test.Prng(t)
+
+			setups := NewSetupsPersistence(t, rng, []string{"Alice", "Bob"})
+			funder := &fundingRecorder{Funder: setups[0].Funder, reqs: make(chan channel.FundingReq, 2)}
+			setups[0].Funder = funder
+			pair := setupPersistentPair(ctx, t, rng, setups)
+
+			// Open a channel whose funding agreement differs from the initial
+			// balances.
+			agreement := channel.Balances{{big.NewInt(5), big.NewInt(15)}}
+			ch, part := pair.openChannel(ctx, t, rng, client.WithFundingAgreement(agreement))
+			require.NoError(t, pair.alice.Close())
+			<-funder.reqs
+
+			// Rewind Alice's persisted data as if she crashed during funding.
+			pch, err := setups[0].PR.RestoreChannel(ctx, ch.ID())
+			require.NoError(t, err)
+			interrupted := *pch
+			interrupted.PhaseV = tt.phase
+			if tt.phase == channel.InitSigning {
+				interrupted.StagingTXV = pch.CurrentTXV.Clone()
+				interrupted.CurrentTXV = channel.Transaction{}
+				if !tt.signed {
+					interrupted.StagingTXV.Sigs[1] = nil
+				}
+			}
+			if tt.noAgreement {
+				// Like a Persister that is not a FundingPersister.
+				fp := setups[0].PR.(persistence.FundingPersister)
+				require.NoError(t, fp.FundingAgreed(ctx, ch.ID(), nil))
+			}
+			require.NoError(t, setups[0].PR.Enabled(ctx, &interrupted))
+			if tt.timeout {
+				funder.err = channel.NewFundingTimeoutError([]*channel.AssetFundingError{
+					{Asset: 0, TimedOutPeers: []channel.Index{1}},
+				})
+			}
+
+			// Restore Alice and check that she resumed funding.
+			alice := newPersistentClient(t, setups[0])
+			defer alice.Close()
+			restored := make(chan *client.Channel, 1)
+			alice.OnNewChannel(func(ch *client.Channel) { restored <- ch })
+			require.NoError(t, alice.Restore(ctx))
+
+			if tt.noAgreement {
+				// The channel is kept, but not funded.
+				select {
+				case req := <-funder.reqs:
+					t.Fatalf("funding resumed without funding agreement: %v", req)
+				case <-time.After(100 * time.Millisecond):
+				}
+				_, err := setups[0].PR.RestoreChannel(ctx, ch.ID())
+				assert.NoError(t, err)
+				return
+			}
+			if !tt.resumed {
+				assert.Eventually(t, func() bool {
+					_, err := setups[0].PR.RestoreChannel(ctx, ch.ID())
+					return err != nil
+				}, time.Second, 10*time.Millisecond, "channel not removed")
+				return
+			}
+
+			select {
+			case req := <-funder.reqs:
+				assert.True(t, agreement.Equal(req.Agreement), "funding agreement")
+			case <-ctx.Done():
+				t.Fatal("funding not resumed")
+			}
+			if tt.timeout {
+				// Alice reclaims her funds by settling the initial state.
+				assert.Eventually(t, func() bool {
+					return setups[0].BalanceReader.Balance(part, pair.asset).Cmp(big.NewInt(10)) == 0
+				}, time.Second, 10*time.Millisecond, "funds not reclaimed")
+				return
+			}
+			select {
+			case rch := <-restored:
+				assert.Equal(t, uint64(0), rch.State().Version)
+				assert.Equal(t, channel.Acting, rch.Phase())
+				pch, err := setups[0].PR.RestoreChannel(ctx, rch.ID())
+				require.NoError(t, err)
+				assert.Equal(t, uint64(0), pch.CurrentTXV.Version)
+				assert.Equal(t, channel.Acting, pch.PhaseV)
+			case <-ctx.Done():
+				t.Fatal("channel not restored")
+			}
+		})
+	}
+}
+
+func TestPersistenceResumeDeposit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	setups := NewSetupsPersistence(t, rng, []string{"Alice", "Bob"})
+	funder := &fundingRecorder{Funder: setups[0].Funder, reqs: make(chan channel.FundingReq, 3)}
+	setups[0].Funder = funder
+	pair := setupPersistentPair(ctx, t, rng, setups)
+	ch, _ := pair.openChannel(ctx, t, rng)
+	<-funder.reqs
+
+	// The funding of the deposit times out, so it stays staged.
+	funder.err = channel.NewFundingTimeoutError([]*channel.AssetFundingError{
+		{Asset: 0, TimedOutPeers: []channel.Index{0}},
+	})
+	err := ch.Deposit(ctx, pair.asset, big.NewInt(5))
+	require.Error(t, err)
+	assert.True(t, errors.As(err, new(client.DepositTimeoutError)), err)
+	<-funder.reqs
+	require.NoError(t, pair.alice.Close())
+	funder.err = nil
+
+	// Restore Alice and check that she completed the deposit.
+	alice := newPersistentClient(t, setups[0])
+	defer alice.Close()
+	restored := make(chan *client.Channel, 1)
+	alice.OnNewChannel(func(ch *client.Channel) { restored <- ch })
+	require.NoError(t, alice.Restore(ctx))
+
+	select {
+	case req := <-funder.reqs:
+		assert.True(t, req.TopUp)
+		assert.Equal(t, uint64(1), req.State.Version)
+	case <-ctx.Done():
+		t.Fatal("deposit not resumed")
+	}
+	rch := <-restored
+	require.Eventually(t, func() bool { return rch.State().Version == 1 },
+		time.Second, 10*time.Millisecond, "deposit not completed")
+	// The new state is persisted under the machine mutex, so it is complete
+	// once the restored channel is at the new version.
+	pch, err := setups[0].PR.RestoreChannel(ctx, rch.ID())
+	require.NoError(t, err)
+	assert.Equal(t, channel.Acting, pch.PhaseV)
+	assert.Equal(t, uint64(1), pch.CurrentTXV.Version)
+	assert.True(t, pch.CurrentTXV.Balances.Equal(channel.Balances{{big.NewInt(15), big.NewInt(10)}}))
+}
+
+// TestPersistenceResumeWithdrawal tests that a client that was interrupted
+// while withdrawing on-chain completes the withdrawal after restoring.
+func TestPersistenceResumeWithdrawal(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	setups := NewSetupsPersistence(t, rng, []string{"Alice", "Bob"})
+	faults := ctest.NewFaults()
+	setups[0].Adjudicator = ctest.NewFaultyAdjudicator(setups[0].Adjudicator, faults)
+	pair := setupPersistentPair(ctx, t, rng, setups)
+	ch, _ := pair.openChannel(ctx, t, rng)
+
+	// The on-chain withdrawal times out, so it stays staged and authorized.
+	faults.Fail(ctest.FaultWithdrawPartial, 1, ctest.TxTimedoutFault(ctest.FaultWithdrawPartial))
+	require.Error(t, ch.WithdrawPartial(ctx, pair.asset, big.NewInt(4)))
+	pch, err := setups[0].PR.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	require.NotEmpty(t, pch.WithdrawalAuthSigs)
+	require.NoError(t, pair.alice.Close())
+
+	// Restore Alice and check that she completed the withdrawal.
+	alice := newPersistentClient(t, setups[0])
+	defer alice.Close()
+	restored := make(chan *client.Channel, 1)
+	alice.OnNewChannel(func(ch *client.Channel) { restored <- ch })
+	require.NoError(t, alice.Restore(ctx))
+
+	rch := <-restored
+	require.Eventually(t, func() bool { return rch.State().Version == 1 },
+		time.Second, 10*time.Millisecond, "withdrawal not completed")
+	// The withdrawal is completed under the machine mutex, so its persisted
+	// data is complete once the restored channel is at the new version.
+	pch, err = setups[0].PR.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	assert.Equal(t, channel.Acting, pch.PhaseV)
+	assert.Empty(t, pch.WithdrawalAuthSigs)
+	assert.True(t, pch.CurrentTXV.Balances.Equal(channel.Balances{{big.NewInt(6), big.NewInt(10)}}))
+	assert.Equal(t, 1, faults.Injected(ctest.FaultWithdrawPartial))
+}
+
+// TestPersistenceResumeMultiParty tests that the funding of a channel with
+// several peers is resumed only once when the client is restored.
+func TestPersistenceResumeMultiParty(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	setups := NewSetupsPersistence(t, rng, []string{"Alice", "Bob", "Carol"})
+	funder := &fundingRecorder{Funder: setups[0].Funder, reqs: make(chan channel.FundingReq, 4)}
+	setups[0].Funder = funder
+	alice := newPersistentClient(t, setups[0])
+	for _, setup := range setups[1:] {
+		c := newPersistentClient(t, setup)
+		defer c.Close()
+		acceptAll(ctx, t, rng, c, setup)
+	}
+
+	peers := make([]wire.Address, len(setups))
+	for i, setup := range setups {
+		peers[i] = setup.Identity.Address()
+	}
+	asset := chtest.NewRandomAsset(rng)
+	alloc := channel.NewAllocation(len(peers), asset)
+	alloc.SetAssetBalances(asset, []*big.Int{big.NewInt(10), big.NewInt(10), big.NewInt(10)})
+	part := setups[0].Wallet.NewRandomAccount(rng).Address()
+	prop, err := client.NewLedgerChannelProposal(60, part, alloc, peers, client.WithRandomNonce())
+	require.NoError(t, err)
+	ch, err := alice.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	require.NoError(t, alice.Close())
+	<-funder.reqs
+
+	// Rewind Alice's persisted data as if she crashed during funding.
+	pch, err := setups[0].PR.RestoreChannel(ctx, ch.ID())
+	require.NoError(t, err)
+	interrupted := *pch
+	interrupted.PhaseV = channel.Funding
+	require.NoError(t, setups[0].PR.Enabled(ctx, &interrupted))
+
+	// Restore Alice. The channel is shared with Bob and Carol, but its
+	// funding is only resumed once.
+	alice = newPersistentClient(t, setups[0])
+	defer alice.Close()
+	restored := make(chan *client.Channel, 2)
+	alice.OnNewChannel(func(ch *client.Channel) { restored <- ch })
+	require.NoError(t, alice.Restore(ctx))
+
+	select {
+	case <-funder.reqs:
+	case <-ctx.Done():
+		t.Fatal("funding not resumed")
+	}
+	select {
+	case req := <-funder.reqs:
+		t.Fatalf("funding resumed twice: %v", req)
+	case <-time.After(100 * time.Millisecond):
+	}
+	select {
+	case rch := <-restored:
+		assert.Equal(t, channel.Acting, rch.Phase())
+	case <-ctx.Done():
+		t.Fatal("channel not restored")
+	}
+	assert.Empty(t, restored)
+}
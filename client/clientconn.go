@@ -18,6 +18,7 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 
 	"perun.network/go-perun/log"
 	"perun.network/go-perun/wire"
@@ -67,6 +68,10 @@ func isReqMsg(m *wire.Envelope) bool {
 		m.Msg.Type() == wire.VirtualChannelFundingProposal ||
 		m.Msg.Type() == wire.VirtualChannelSettlementProposal ||
 		m.Msg.Type() == wire.ChannelUpdate ||
+		m.Msg.Type() == wire.ChannelPipelinedUpdate ||
+		m.Msg.Type() == wire.ChannelDeposit ||
+		m.Msg.Type() == wire.ChannelWithdrawal ||
+		m.Msg.Type() == wire.ChannelAssetChange ||
 		m.Msg.Type() == wire.ChannelSync
 }
 
@@ -85,6 +90,17 @@ func (c *clientConn) pubMsg(ctx context.Context, msg wire.Msg, rec wire.Address)
 	})
 }
 
+// pubMsgs publishes the given message to all given recipients concurrently,
+// setting the own client as the sender.
+func (c *clientConn) pubMsgs(ctx context.Context, msg wire.Msg, recs ...wire.Address) error {
+	var eg errgroup.Group
+	for _, rec := range recs {
+		rec := rec
+		eg.Go(func() error { return c.pubMsg(ctx, msg, rec) })
+	}
+	return eg.Wait()
+}
+
 // Publish publishes the message on the bus. Makes clientConn implement the
 // wire.Publisher interface.
 func (c *clientConn) Publish(ctx context.Context, env *wire.Envelope) error {
@@ -0,0 +1,114 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/test"
+)
+
+func TestClient_CounterProposal(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	rng := test.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+
+	clients := NewClients(t, rng, []string{"Alice", "Bob"})
+	alice, bob := clients[0], clients[1]
+	peers := []wire.Address{alice.Identity.Address(), bob.Identity.Address()}
+
+	// Bob counters proposals that give him less than Alice with equal
+	// balances and a doubled challenge duration. Proposals with a challenge
+	// duration of 1 are countered unchanged, so they are countered forever.
+	var numProposalsBob atomic.Int32
+	var proposalHandlerBob client.ProposalHandlerFunc = func(cp client.ChannelProposal, pr *client.ProposalResponder) {
+		numProposalsBob.Add(1)
+		lcp, ok := cp.(*client.LedgerChannelProposal)
+		if !ok {
+			pr.Reject(ctx, "unexpected proposal") //nolint:errcheck
+			return
+		}
+		bals := lcp.InitBals.Balances[0]
+		if lcp.ChallengeDuration != 1 && bals[1].Cmp(bals[0]) >= 0 {
+			_, err := pr.Accept(ctx, lcp.Accept(bob.Identity.Address(), client.WithRandomNonce()))
+			assert.NoError(t, err)
+			return
+		}
+		counterDuration := lcp.ChallengeDuration
+		if counterDuration != 1 {
+			counterDuration *= 2
+		}
+		alloc := channel.NewAllocation(len(peers), asset)
+		alloc.SetAssetBalances(asset, []channel.Bal{new(big.Int).Set(bals[0]), new(big.Int).Set(bals[0])})
+		counter, err := client.NewLedgerChannelProposal(counterDuration, lcp.Participant, alloc, lcp.Peers)
+		require.NoError(t, err)
+		assert.NoError(t, pr.Counter(ctx, counter))
+	}
+	go bob.Handle(proposalHandlerBob, client.UpdateHandlerFunc(func(_ *channel.State, _ client.ChannelUpdate, ur *client.UpdateResponder) {
+		ur.Reject(ctx, "unexpected update") //nolint:errcheck
+	}))
+
+	propose := func(challengeDuration uint64) (*client.Channel, error) {
+		initAlloc := channel.NewAllocation(len(peers), asset)
+		initAlloc.SetAssetBalances(asset, []channel.Bal{big.NewInt(10), big.NewInt(5)})
+		prop, err := client.NewLedgerChannelProposal(challengeDuration, alice.Identity.Address(), initAlloc, peers)
+		require.NoError(t, err)
+		return alice.ProposeChannel(ctx, prop)
+	}
+
+	t.Run("no handler", func(t *testing.T) {
+		_, err := propose(challengeDuration)
+		var counterErr client.PeerCounteredError
+		require.True(t, errors.As(err, &counterErr))
+		assert.Equal(t, uint64(2*challengeDuration), counterErr.Counter.Base().ChallengeDuration)
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		alice.OnCounterProposal(func(_, _ client.ChannelProposal) (client.ChannelProposal, bool) {
+			return nil, false
+		})
+		_, err := propose(challengeDuration)
+		assert.True(t, errors.As(err, new(client.PeerCounteredError)))
+	})
+
+	t.Run("accepted", func(t *testing.T) {
+		alice.OnCounterProposal(func(_, counter client.ChannelProposal) (client.ChannelProposal, bool) {
+			return counter, true
+		})
+		ch, err := propose(challengeDuration)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2*challengeDuration), ch.Params().ChallengeDuration)
+		assert.Equal(t, []channel.Bal{big.NewInt(10), big.NewInt(10)}, ch.State().Balances[0])
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		numProposalsBob.Store(0)
+		_, err := propose(1)
+		assert.True(t, errors.As(err, new(client.PeerCounteredError)))
+		assert.EqualValues(t, client.MaxCounterProposals+1, numProposalsBob.Load())
+	})
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+)
+
+// depositFundingTimeout is the maximal time that a deposit waits for its
+// funding. Afterwards, the deposit stays staged until it is retried.
+var depositFundingTimeout = 10 * time.Minute
+
+// Deposit deposits `amount` of `asset` into the ledger channel, increasing
+// our balance accordingly.
+//
+// First, all participants sign a state in which our balance is increased.
+// Then, each participant calls the channel.Funder with a top-up request, see
+// channel.NewTopUpReq, which deposits our funds on-chain and waits until the
+// channel's holdings are confirmed. Only then the new state is enabled. Peers
+// accept deposits automatically, as they only increase the depositor's
+// balance. No other update can be made while the deposit is in progress.
+//
+// If the deposit is rejected, the update is discarded. Once the deposit is
+// signed by all participants, it is kept staged, even if the funding fails
+// or does not complete within the context's deadline or 10 minutes, in which
+// case a DepositTimeoutError is returned. A staged deposit is completed by
+// RetryDeposit and is resumed when the client is restored. As the funding is
+// idempotent, funds that were already deposited are not deposited again.
+func (c *Channel) Deposit(ctx context.Context, asset channel.Asset, amount channel.Bal) error {
+	if ctx == nil {
+		return errors.New("context must not be nil")
+	}
+	if !c.IsLedgerChannel() {
+		return errors.New("deposits are only supported for ledger channels")
+	}
+	if amount.Sign() <= 0 {
+		return errors.New("deposit must be positive")
+	}
+	if err := c.proposeDeposit(ctx, asset, amount); err != nil {
+		return err
+	}
+	return c.completeDeposit(ctx)
+}
+
+// RetryDeposit completes the deposit that is staged in the channel, see
+// Deposit. It returns an error if no deposit is staged.
+func (c *Channel) RetryDeposit(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("context must not be nil")
+	}
+	return c.completeDeposit(ctx)
+}
+
+// proposeDeposit stages a deposit and collects the signatures of all peers on
+// it. The update is discarded if it is not signed by all peers.
+func (c *Channel) proposeDeposit(ctx context.Context, asset channel.Asset, amount channel.Bal) (err error) {
+	if !c.machMtx.TryLockCtx(ctx) {
+		return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
+	}
+	defer c.machMtx.Unlock()
+
+	next := c.machine.State().Clone()
+	assetIdx, ok := next.AssetIndex(asset)
+	if !ok {
+		return errors.New("asset not in channel")
+	}
+	bal := &next.Balances[assetIdx][c.machine.Idx()]
+	*bal = new(big.Int).Add(*bal, amount)
+	next.Version++
+
+	up := makeChannelUpdate(next, c.machine.Idx())
+	if err = c.machine.Deposit(ctx, up.State, up.ActorIdx); err != nil {
+		return errors.WithMessage(err, "staging deposit")
+	}
+	// if anything goes wrong from now on, we discard the update.
+	defer func() { c.checkUpdateError(ctx, err) }()
+
+	return c.proposeStaged(ctx, up, func(m *msgChannelUpdate) wire.Msg {
+		return &msgChannelDeposit{*m}
+	})
+}
+
+// handleDepositReq checks and accepts a deposit of a peer. It is called by
+// handleUpdateReq, which holds the machine mutex. The funding is completed in
+// the background, as the mutex is released while waiting for it. It is marked
+// as in progress before, so that the depositor's next update waits for it.
+func (c *Channel) handleDepositReq(pidx channel.Index, req *msgChannelDeposit) {
+	ctx, cancel := context.WithTimeout(c.Ctx(), responseTimeout)
+	defer cancel()
+	up := req.Base().ChannelUpdate
+
+	var err error
+	switch {
+	case !c.IsLedgerChannel():
+		err = errors.New("deposits are only supported for ledger channels")
+	case up.ActorIdx != pidx:
+		err = errors.New("depositor must be the proposer")
+	default:
+		err = c.machine.CheckDeposit(up.State, up.ActorIdx, req.Base().Sig, pidx)
+	}
+	if err != nil {
+		c.logPeer(pidx).Warnf("invalid deposit received: %v", err)
+		if rerr := c.handleUpdateRej(ctx, pidx, req, err.Error()); rerr != nil {
+			c.logPeer(pidx).Warnf("rejecting deposit: %v", rerr)
+		}
+		return
+	}
+
+	if err := c.acceptDeposit(ctx, pidx, req); err != nil {
+		c.logPeer(pidx).Errorf("accepting deposit: %v", err)
+		return
+	}
+	c.resumeDeposit()
+}
+
+// acceptDeposit stages the deposit of a peer and sends our signature on it.
+// The update is discarded if it is not signed by all participants.
+func (c *Channel) acceptDeposit(ctx context.Context, pidx channel.Index, req *msgChannelDeposit) (err error) {
+	if err = c.machine.Deposit(ctx, req.Base().State, req.Base().ActorIdx); err != nil {
+		return errors.WithMessage(err, "staging deposit")
+	}
+	// if anything goes wrong from now on, we discard the update.
+	defer func() { c.checkUpdateError(ctx, err) }()
+
+	return c.acceptStaged(ctx, pidx, req, func(m *msgChannelUpdateAcc) wire.Msg { return m })
+}
+
+// resumeDeposit completes the staged deposit in the background. It is used
+// when a peer's deposit was accepted and when the client is restored. It must
+// be called with the machine mutex held, so that the deposit is marked as in
+// progress before any other update request is handled.
+func (c *Channel) resumeDeposit() {
+	req, done, err := c.beginDeposit()
+	if err != nil {
+		c.Log().Errorf("Completing deposit: %v", err)
+		return
+	}
+	go func() {
+		if err := c.fundDeposit(c.Ctx(), req, done); err != nil {
+			c.Log().Errorf("Completing deposit: %v", err)
+		}
+	}()
+}
+
+// completeDeposit funds the staged deposit and enables it. The machine mutex
+// is released while waiting for the funding, which is bound by the
+// depositFundingTimeout. If the funding fails, the deposit stays staged.
+func (c *Channel) completeDeposit(ctx context.Context) error {
+	if !c.machMtx.TryLockCtx(ctx) {
+		return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
+	}
+	req, done, err := c.beginDeposit()
+	c.machMtx.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.fundDeposit(ctx, req, done)
+}
+
+// beginDeposit marks the staged deposit as being funded and returns its
+// top-up request and the channel that must be closed by fundDeposit. The
+// machine mutex must be held.
+func (c *Channel) beginDeposit() (*channel.FundingReq, chan struct{}, error) {
+	req, err := c.stagedDepositReq()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.onChain != nil {
+		return nil, nil, errors.New("deposit funding already in progress")
+	}
+	done := make(chan struct{})
+	c.onChain = done
+	return req, done, nil
+}
+
+// fundDeposit funds the deposit that was begun by beginDeposit and enables
+// it. It must be called without holding the machine mutex.
+func (c *Channel) fundDeposit(ctx context.Context, req *channel.FundingReq, done chan struct{}) error {
+	defer close(done)
+	version := req.State.Version
+
+	fundCtx, cancel := context.WithTimeout(ctx, depositFundingTimeout)
+	defer cancel()
+	err := c.client.funder.Fund(fundCtx, *req)
+
+	// The machine mutex is locked before the funding is marked complete, so
+	// that waiting update requests see the enabled deposit.
+	c.machMtx.Lock()
+	defer c.machMtx.Unlock()
+	c.onChain = nil
+	if err != nil {
+		if fundCtx.Err() != nil || channel.IsFundingTimeoutError(err) || errors.As(err, new(TxTimedoutError)) {
+			return NewDepositTimeoutError(version, err.Error())
+		}
+		return errors.WithMessage(err, "funding deposit")
+	}
+
+	// The deposit may have been completed concurrently, e.g., by a retry.
+	if c.machine.State().Version >= version {
+		return nil
+	}
+	if c.machine.Phase() != channel.Signing || c.machine.StagingState().Version != version {
+		return errors.New("deposit was discarded while funding")
+	}
+	return c.enableNotifyUpdate(ctx)
+}
+
+// stagedDepositReq returns the top-up request for the staged deposit. It
+// returns an error if no deposit signed by all participants is staged.
+func (c *Channel) stagedDepositReq() (*channel.FundingReq, error) {
+	if c.machine.Phase() != channel.Signing || !isDeposit(c.machine.State(), c.machine.StagingTX()) {
+		return nil, errors.New("no deposit staged")
+	}
+	cur, next := c.machine.State(), c.machine.StagingState()
+	return channel.NewTopUpReq(c.Params(), next, c.machine.Idx(), next.Balances.Sub(cur.Balances)), nil
+}
+
+// isDeposit returns whether the staged transaction `tx` is a deposit into the
+// state `cur` that is signed by all participants. In contrast to other
+// updates, deposits increase the channel's funds.
+func isDeposit(cur *channel.State, tx channel.Transaction) bool {
+	if !fullySigned(tx) || len(tx.Assets) != len(cur.Assets) {
+		return false
+	}
+	curSum, nextSum := cur.Sum(), tx.Sum()
+	for i := range curSum {
+		if nextSum[i].Cmp(curSum[i]) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -35,6 +35,15 @@ type (
 	// ChainNotReachableError indicates problems in connecting to the blockchain
 	// network when trying to do on-chain transactions or reading from the blockchain.
 	ChainNotReachableError struct{}
+
+	// DepositTimeoutError indicates that a deposit, which was signed by all
+	// participants, was not funded in time.
+	//
+	// The deposit stays staged, so that no other update can be made until it
+	// is completed with Channel.RetryDeposit or when the client is restored.
+	DepositTimeoutError struct {
+		Version uint64 // Version of the staged deposit state.
+	}
 )
 
 // Error implements the error interface.
@@ -47,6 +56,11 @@ func (e ChainNotReachableError) Error() string {
 	return "blockchain network not reachable"
 }
 
+// Error implements the error interface.
+func (e DepositTimeoutError) Error() string {
+	return fmt.Sprintf("timed out funding deposit of version %d", e.Version)
+}
+
 // NewTxTimedoutError constructs a TxTimedoutError and wraps it with the actual
 // error message.
 //
@@ -65,3 +79,10 @@ func NewTxTimedoutError(txType, txID, actualErrMsg string) error {
 func NewChainNotReachableError(actualErr error) error {
 	return errors.Wrap(ChainNotReachableError{}, actualErr.Error())
 }
+
+// NewDepositTimeoutError constructs a DepositTimeoutError for the staged
+// deposit state of the given version and wraps it with the actual error
+// message.
+func NewDepositTimeoutError(version uint64, actualErrMsg string) error {
+	return errors.Wrap(DepositTimeoutError{Version: version}, actualErrMsg)
+}
@@ -0,0 +1,330 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	ctest "perun.network/go-perun/client/test"
+	"perun.network/go-perun/wallet"
+	wtest "perun.network/go-perun/wallet/test"
+	"perun.network/go-perun/watcher/local"
+	"perun.network/go-perun/wire"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+// faultTestTimeout is the time after which an operation that hangs because of
+// an injected fault is cancelled.
+const faultTestTimeout = 500 * time.Millisecond
+
+// faultSetup consists of Alice, whose funder, adjudicator and bus inject the
+// faults, and Bob, who accepts all proposals and updates.
+type faultSetup struct {
+	faults   *ctest.Faults
+	backend  *ctest.MockBackend
+	alice    *client.Client
+	aliceAcc wallet.Address
+	bobAcc   wallet.Address
+	bobChs   chan *client.Channel // Channels accepted by Bob.
+	peers    []wire.Address
+	asset    channel.Asset
+}
+
+func newFaultSetup(t *testing.T, rng *rand.Rand) *faultSetup {
+	t.Helper()
+	s := &faultSetup{
+		faults:  ctest.NewFaults(),
+		backend: ctest.NewMockBackend(rng),
+		bobChs:  make(chan *client.Channel, 2),
+		asset:   chtest.NewRandomAsset(rng),
+	}
+	bus := wire.NewLocalBus()
+	newClient := func(bus wire.Bus, funder channel.Funder, adj channel.Adjudicator) (*client.Client, wallet.Address) {
+		watcher, err := local.NewWatcher(s.backend)
+		require.NoError(t, err)
+		w := wtest.NewWallet()
+		id := wtest.NewRandomAccount(rng).Address()
+		c, err := client.New(id, bus, funder, adj, w, watcher)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() }) //nolint:errcheck
+		s.peers = append(s.peers, id)
+		return c, w.NewRandomAccount(rng).Address()
+	}
+	s.alice, s.aliceAcc = newClient(ctest.NewFaultyBus(bus, s.faults),
+		ctest.NewFaultyFunder(s.backend, s.faults), ctest.NewFaultyAdjudicator(s.backend, s.faults))
+	bob, bobAcc := newClient(bus, s.backend, s.backend)
+	s.bobAcc = bobAcc
+
+	go bob.Handle(
+		client.ProposalHandlerFunc(func(p client.ChannelProposal, r *client.ProposalResponder) {
+			ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+			defer cancel()
+			ch, err := r.Accept(ctx, p.(*client.LedgerChannelProposal).Accept(bobAcc, client.WithRandomNonce()))
+			assert.NoError(t, err)
+			select {
+			case s.bobChs <- ch:
+			default:
+			}
+		}),
+		client.UpdateHandlerFunc(func(_ *channel.State, _ client.ChannelUpdate, r *client.UpdateResponder) {
+			ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+			defer cancel()
+			assert.NoError(t, r.Accept(ctx))
+		}),
+	)
+	return s
+}
+
+// open opens a channel in which Alice and Bob deposit 10 each.
+func (s *faultSetup) open(ctx context.Context) (*client.Channel, error) {
+	alloc := channel.NewAllocation(2, s.asset)
+	alloc.SetAssetBalances(s.asset, []*big.Int{big.NewInt(10), big.NewInt(10)})
+	prop, err := client.NewLedgerChannelProposal(60, s.aliceAcc, alloc, s.peers, client.WithRandomNonce())
+	if err != nil {
+		return nil, err
+	}
+	return s.alice.ProposeChannel(ctx, prop)
+}
+
+// payBob lets Alice send one coin to Bob. If final is true, the resulting
+// state is final.
+func payBob(final bool) func(*channel.State) error {
+	return func(s *channel.State) error {
+		s.Balances[0][0].Sub(s.Balances[0][0], big.NewInt(1))
+		s.Balances[0][1].Add(s.Balances[0][1], big.NewInt(1))
+		s.IsFinal = final
+		return nil
+	}
+}
+
+// assertWithdrawn asserts that Alice and Bob withdrew their final balances
+// after Alice transferred one coin.
+func (s *faultSetup) assertWithdrawn(t *testing.T) {
+	t.Helper()
+	assert.Equal(t, big.NewInt(9), s.backend.Balance(s.aliceAcc, s.asset))
+	assert.Equal(t, big.NewInt(11), s.backend.Balance(s.bobAcc, s.asset))
+}
+
+func isTxTimedout(err error) bool {
+	return errors.As(err, new(client.TxTimedoutError))
+}
+
+func isChainNotReachable(err error) bool {
+	return errors.As(err, new(client.ChainNotReachableError))
+}
+
+func TestFaults_Funding(t *testing.T) {
+	rng := pkgtest.Prng(t)
+
+	for _, tt := range []struct {
+		name     string
+		inject   func(*ctest.Faults)
+		isFault  func(error) bool
+		executed bool // Whether the funding was executed despite the fault.
+	}{
+		{"TxTimedout", func(f *ctest.Faults) {
+			f.Fail(ctest.FaultFund, 1, ctest.TxTimedoutFault(ctest.FaultFund))
+		}, isTxTimedout, false},
+		{"TxTimedout/executed", func(f *ctest.Faults) {
+			f.FailAfterCall(ctest.FaultFund, 1, ctest.TxTimedoutFault(ctest.FaultFund))
+		}, isTxTimedout, true},
+		{"ChainNotReachable", func(f *ctest.Faults) {
+			f.Fail(ctest.FaultFund, 1, ctest.ChainNotReachableFault())
+		}, isChainNotReachable, false},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+			defer cancel()
+			s := newFaultSetup(t, rng)
+			tt.inject(s.faults)
+
+			// The fault is reported to the proposer and a new channel can be
+			// opened afterwards.
+			_, err := s.open(ctx)
+			require.Error(t, err)
+			assert.True(t, tt.isFault(err), err)
+			first := <-s.bobChs
+			ch, err := s.open(ctx)
+			require.NoError(t, err)
+			require.NoError(t, ch.Update(ctx, payBob(true)))
+			require.NoError(t, ch.Settle(ctx, false))
+			assert.Equal(t, 1, s.faults.Injected(ctest.FaultFund))
+			if !tt.executed {
+				s.assertWithdrawn(t)
+				return
+			}
+
+			// Alice's deposit into the first channel is recovered when Bob,
+			// whose funding succeeded, settles it in its initial state.
+			require.NoError(t, first.Settle(ctx, false))
+			assert.Equal(t, big.NewInt(19), s.backend.Balance(s.aliceAcc, s.asset))
+			assert.Equal(t, big.NewInt(21), s.backend.Balance(s.bobAcc, s.asset))
+		})
+	}
+}
+
+func TestFaults_Withdraw(t *testing.T) {
+	rng := pkgtest.Prng(t)
+
+	for _, tt := range []struct {
+		name    string
+		inject  func(*ctest.Faults)
+		isFault func(error) bool
+	}{
+		{"TxTimedout", func(f *ctest.Faults) {
+			f.Fail(ctest.FaultWithdraw, 1, ctest.TxTimedoutFault(ctest.FaultWithdraw))
+		}, isTxTimedout},
+		{"TxTimedout/executed", func(f *ctest.Faults) {
+			f.FailAfterCall(ctest.FaultWithdraw, 1, ctest.TxTimedoutFault(ctest.FaultWithdraw))
+		}, isTxTimedout},
+		{"ChainNotReachable", func(f *ctest.Faults) {
+			f.Fail(ctest.FaultWithdraw, 1, ctest.ChainNotReachableFault())
+		}, isChainNotReachable},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+			defer cancel()
+			s := newFaultSetup(t, rng)
+			ch, err := s.open(ctx)
+			require.NoError(t, err)
+			require.NoError(t, ch.Update(ctx, payBob(true)))
+
+			// Settling is retried after the fault was reported.
+			tt.inject(s.faults)
+			err = ch.Settle(ctx, false)
+			require.Error(t, err)
+			assert.True(t, tt.isFault(err), err)
+			require.NoError(t, ch.Settle(ctx, false))
+			s.assertWithdrawn(t)
+		})
+	}
+}
+
+func TestFaults_Dispute(t *testing.T) {
+	rng := pkgtest.Prng(t)
+
+	// Settling a non-final state requires registering it. While the
+	// registration fails or its event is lost, settling does not complete.
+	// It succeeds when it is retried.
+	for _, tt := range []struct {
+		name   string
+		inject func(*ctest.Faults)
+	}{
+		{"Register/TxTimedout", func(f *ctest.Faults) {
+			f.Fail(ctest.FaultRegister, 1, ctest.TxTimedoutFault(ctest.FaultRegister))
+		}},
+		{"Register/ChainNotReachable", func(f *ctest.Faults) {
+			f.Fail(ctest.FaultRegister, 1, ctest.ChainNotReachableFault())
+		}},
+		{"Subscribe/ChainNotReachable", func(f *ctest.Faults) {
+			f.Fail(ctest.FaultSubscribe, 1, ctest.ChainNotReachableFault())
+		}},
+		{"Event/dropped", func(f *ctest.Faults) {
+			f.DropEvents(1)
+		}},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+			defer cancel()
+			s := newFaultSetup(t, rng)
+			ch, err := s.open(ctx)
+			require.NoError(t, err)
+			require.NoError(t, ch.Update(ctx, payBob(false)))
+
+			tt.inject(s.faults)
+			settleCtx, settleCancel := context.WithTimeout(ctx, faultTestTimeout)
+			defer settleCancel()
+			require.Error(t, ch.Settle(settleCtx, false))
+			assert.False(t, s.faults.Pending())
+			require.NoError(t, ch.Settle(ctx, false))
+			s.assertWithdrawn(t)
+		})
+	}
+
+	// Delayed events only delay the settlement.
+	t.Run("Event/delayed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+		defer cancel()
+		s := newFaultSetup(t, rng)
+		ch, err := s.open(ctx)
+		require.NoError(t, err)
+		require.NoError(t, ch.Update(ctx, payBob(false)))
+
+		s.faults.DelayEvents(1, 100*time.Millisecond)
+		require.NoError(t, ch.Settle(ctx, false))
+		assert.Equal(t, 1, s.faults.Injected(ctest.FaultEvent))
+		s.assertWithdrawn(t)
+	})
+}
+
+func TestFaults_LostMessages(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	isType := func(typ wire.Type) func(*wire.Envelope) bool {
+		return func(e *wire.Envelope) bool { return e.Msg.Type() == typ }
+	}
+
+	// If a proposal or an update request is lost, the operation times out and
+	// can be retried. Note that the loss of an update acceptance is not
+	// recoverable this way, because the peer already adopted the update.
+	for _, tt := range []struct {
+		name string
+		typ  wire.Type
+	}{
+		{"proposal", wire.LedgerChannelProposal},
+		{"update", wire.ChannelUpdate},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+			defer cancel()
+			s := newFaultSetup(t, rng)
+			if tt.typ == wire.LedgerChannelProposal {
+				s.faults.LoseMessages(1, isType(tt.typ))
+				openCtx, openCancel := context.WithTimeout(ctx, faultTestTimeout)
+				defer openCancel()
+				_, err := s.open(openCtx)
+				require.Error(t, err)
+			}
+			ch, err := s.open(ctx)
+			require.NoError(t, err)
+
+			if tt.typ == wire.ChannelUpdate {
+				s.faults.LoseMessages(1, isType(tt.typ))
+				updateCtx, updateCancel := context.WithTimeout(ctx, faultTestTimeout)
+				defer updateCancel()
+				require.Error(t, ch.Update(updateCtx, payBob(false)))
+				assert.Equal(t, uint64(0), ch.State().Version)
+			}
+			require.NoError(t, ch.Update(ctx, payBob(true)))
+			assert.Equal(t, 1, s.faults.Injected(ctest.FaultMessage))
+			require.NoError(t, ch.Settle(ctx, false))
+			s.assertWithdrawn(t)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	ctest "perun.network/go-perun/client/test"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/test"
+)
+
+const multiPartyTestTimeout = 20 * time.Second
+
+func TestHappyMultiParty(t *testing.T) {
+	for _, n := range []int{3, 5} {
+		n := n
+		t.Run(fmt.Sprintf("%d parties", n), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), multiPartyTestTimeout)
+			defer cancel()
+			rng := test.Prng(t)
+
+			names := []string{"Hub"}
+			for i := 1; i < n; i++ {
+				names = append(names, fmt.Sprintf("Merchant%d", i))
+			}
+			setups := NewSetups(rng, names)
+
+			roles := []ctest.MultiPartyExecuter{ctest.NewHub(t, setups[0])}
+			cfg := &ctest.MultiPartyExecConfig{
+				Asset:       chtest.NewRandomAsset(rng),
+				App:         client.WithoutApp(),
+				NumPayments: 2,
+				TxAmount:    big.NewInt(3),
+			}
+			for i, setup := range setups {
+				if i > 0 {
+					roles = append(roles, ctest.NewMerchant(t, setup))
+				}
+				cfg.Peers = append(cfg.Peers, setup.Identity.Address())
+				cfg.InitBals = append(cfg.InitBals, big.NewInt(100))
+			}
+
+			assert.NoError(t, ctest.ExecuteMultiPartyTest(ctx, roles, cfg))
+		})
+	}
+}
+
+func TestMultiPartyProposalRejected(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), multiPartyTestTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	clients := NewClients(t, rng, []string{"Hub", "Merchant1", "Merchant2"})
+	peers := make([]wire.Address, len(clients))
+	for i, c := range clients {
+		peers[i] = c.Identity.Address()
+	}
+
+	// Merchant1 accepts, Merchant2 rejects.
+	part := clients[1].Wallet.NewRandomAccount(rng).Address()
+	accepted := make(chan error, 1)
+	go clients[1].Handle(
+		client.ProposalHandlerFunc(func(p client.ChannelProposal, r *client.ProposalResponder) {
+			acc := p.(*client.LedgerChannelProposal).Accept(part, client.WithRandomNonce())
+			_, err := r.Accept(ctx, acc)
+			accepted <- err
+		}),
+		client.UpdateHandlerFunc(func(*channel.State, client.ChannelUpdate, *client.UpdateResponder) {}),
+	)
+	go clients[2].Handle(
+		client.ProposalHandlerFunc(func(_ client.ChannelProposal, r *client.ProposalResponder) {
+			assert.NoError(t, r.Reject(ctx, "not interested"))
+		}),
+		client.UpdateHandlerFunc(func(*channel.State, client.ChannelUpdate, *client.UpdateResponder) {}),
+	)
+
+	asset := chtest.NewRandomAsset(rng)
+	alloc := channel.NewAllocation(len(peers), asset)
+	alloc.SetAssetBalances(asset, []*big.Int{big.NewInt(10), big.NewInt(10), big.NewInt(10)})
+	prop, err := client.NewLedgerChannelProposal(
+		60,
+		clients[0].Wallet.NewRandomAccount(rng).Address(),
+		alloc,
+		peers,
+		client.WithRandomNonce(),
+	)
+	require.NoError(t, err)
+
+	_, err = clients[0].ProposeChannel(ctx, prop)
+	assert.ErrorAs(t, err, new(client.PeerRejectedError))
+
+	select {
+	case err := <-accepted:
+		assert.ErrorAs(t, err, new(client.PeerRejectedError))
+	case <-ctx.Done():
+		t.Fatal("accepting merchant did not return")
+	}
+
+	for _, c := range clients {
+		assert.NoError(t, c.Close())
+	}
+}
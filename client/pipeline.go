@@ -0,0 +1,531 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wallet"
+	pcontext "polycry.pt/poly-go/context"
+)
+
+// pipelineReorderTimeout is how long a pipelined update request waits for the
+// request of its predecessor state, which may be received out of order.
+var pipelineReorderTimeout = 1 * time.Second
+
+type (
+	// pipeline holds the outstanding own updates of a channel in pipelined
+	// mode, see Channel.EnablePipelining. It is guarded by machMtx.
+	pipeline struct {
+		slots   chan struct{}               // limits the number of outstanding updates
+		pending map[uint64]*pipelinedUpdate // own outstanding updates by version
+		changed chan struct{}               // closed and replaced on every change
+
+		// awaiting holds the versions of own requests whose response was not
+		// received yet. The channel is closed once it is received.
+		awaiting map[uint64]chan struct{}
+	}
+
+	// pipelinedUpdate is an own outstanding update. The result of the update
+	// is sent on done once it is enabled or discarded.
+	pipelinedUpdate struct {
+		done chan error
+	}
+
+	// PipelineConflictError indicates that a pipelined update was discarded
+	// because the peer proposed a different state of the same version and
+	// won the conflict resolution.
+	PipelineConflictError struct {
+		Version uint64 // Version of the discarded state.
+	}
+)
+
+// EnablePipelining enables the pipelined update mode, in which Update does not
+// wait for the previous update to complete before proposing the next one.
+// Instead, up to depth updates can be outstanding at the same time. Each
+// update builds on the latest proposed state and the updates are enabled in
+// order once they are signed by all participants. If both participants
+// propose a state of the same version at the same time, the update of the
+// participant with the lower index wins and the other one fails with a
+// PipelineConflictError. All updates building on a failed update fail, too.
+//
+// Pipelining is only supported for two-party ledger channels and both
+// participants need to enable it. It cannot be disabled again. In pipelined
+// mode, counter-updates are not taken up and other channel operations, like
+// deposits or settlement, fail while updates are outstanding.
+func (c *Channel) EnablePipelining(depth int) error {
+	if depth < 1 {
+		return errors.New("pipeline depth must be positive")
+	}
+	if !c.IsLedgerChannel() || len(c.Peers()) != 2 {
+		return errors.New("pipelining is only supported for two-party ledger channels")
+	}
+
+	c.machMtx.Lock()
+	defer c.machMtx.Unlock()
+	if c.pipeline != nil {
+		return errors.New("pipelining already enabled")
+	}
+	c.pipeline = &pipeline{
+		slots:    make(chan struct{}, depth),
+		pending:  make(map[uint64]*pipelinedUpdate),
+		changed:  make(chan struct{}),
+		awaiting: make(map[uint64]chan struct{}),
+	}
+	return nil
+}
+
+// updatePipelined proposes an update in pipelined mode. It waits for a free
+// slot, proposes the update on top of the latest state and waits until the
+// update is enabled or discarded. It must be called without holding machMtx.
+func (c *Channel) updatePipelined(ctx context.Context, p *pipeline, update func(*channel.State) error) error {
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	case <-ctx.Done():
+		return newRequestTimedOutError("channel update", ctx.Err().Error())
+	}
+
+	if !c.machMtx.TryLockCtx(ctx) {
+		return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
+	}
+	version, pu, resRecv, err := c.proposePipelined(ctx, p, update)
+	c.machMtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	pidx, res, err := resRecv.Next(ctx)
+	resRecv.Close()
+	if pcontext.IsContextError(err) {
+		err = newRequestTimedOutError("channel update", err.Error())
+	}
+
+	c.machMtx.Lock()
+	close(p.awaiting[version])
+	delete(p.awaiting, version)
+	err = c.handlePipelinedRes(ctx, p, version, pu, pidx, res, err)
+	c.machMtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-pu.done:
+		return err
+	case <-ctx.Done():
+		return newRequestTimedOutError("channel update", ctx.Err().Error())
+	}
+}
+
+// proposePipelined stages the next state on top of the latest state, signs it
+// and sends it to the peer. It returns the receiver for the peer's response.
+//
+// It assumes that the channel is locked.
+func (c *Channel) proposePipelined(
+	ctx context.Context,
+	p *pipeline,
+	update func(*channel.State) error,
+) (version uint64, pu *pipelinedUpdate, resRecv *channelMsgRecv, err error) {
+	// Versions may be proposed again after their states were discarded. The
+	// responses to the previous requests must be received first, so that
+	// they are not mistaken for responses to new requests.
+	if err := c.awaitResponses(ctx, p); err != nil {
+		return 0, nil, nil, err
+	}
+
+	state := c.machine.LatestState().Clone()
+	if err := update(state); err != nil {
+		return 0, nil, nil, err
+	}
+	if err := c.validUpdateState(state); err != nil {
+		return 0, nil, nil, err
+	}
+	state.Version++
+	version = state.Version
+
+	prevSig, err := c.pipelinePrevSig(ctx)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if err := c.stagePipelined(ctx, state, c.Idx()); err != nil {
+		return 0, nil, nil, errors.WithMessage(err, "updating machine")
+	}
+	// if anything goes wrong from now on, we discard the update.
+	defer func() {
+		if err != nil {
+			c.discardPipelined(ctx, p, version, err)
+		}
+	}()
+
+	sig, err := c.machine.SigAt(ctx, version)
+	if err != nil {
+		return 0, nil, nil, errors.WithMessage(err, "signing update")
+	}
+	if resRecv, err = c.conn.NewUpdateResRecv(version); err != nil {
+		return 0, nil, nil, errors.WithMessage(err, "creating update response receiver")
+	}
+
+	msg := &msgChannelPipelinedUpdate{
+		msgChannelUpdate: msgChannelUpdate{
+			ChannelUpdate: makeChannelUpdate(state, c.Idx()),
+			Sig:           sig,
+		},
+		PrevSig: prevSig,
+	}
+	if err = c.conn.Send(ctx, msg); err != nil {
+		resRecv.Close()
+		return 0, nil, nil, errors.WithMessage(err, "sending update")
+	}
+
+	pu = &pipelinedUpdate{done: make(chan error, 1)}
+	p.pending[version] = pu
+	p.awaiting[version] = make(chan struct{})
+	return version, pu, resRecv, nil
+}
+
+// awaitResponses waits until the responses to all own requests of discarded
+// states beyond the latest state were received.
+//
+// It assumes that the channel is locked and temporarily unlocks it while
+// waiting.
+func (c *Channel) awaitResponses(ctx context.Context, p *pipeline) error {
+	for {
+		awaiting, ok := p.awaitingAfter(c.machine.LatestState().Version)
+		if !ok {
+			return nil
+		}
+		c.machMtx.Unlock()
+		select {
+		case <-awaiting:
+			c.machMtx.Lock()
+		case <-ctx.Done():
+			c.machMtx.Lock()
+			return newRequestTimedOutError("channel update", ctx.Err().Error())
+		}
+	}
+}
+
+// handlePipelinedRes handles the peer's response to the own pipelined update
+// of the given version. On acceptance, the peer's signature is added and all
+// fully signed updates are enabled. Otherwise, the update and all updates
+// building on it are discarded.
+//
+// It assumes that the channel is locked.
+func (c *Channel) handlePipelinedRes(
+	ctx context.Context,
+	p *pipeline,
+	version uint64,
+	pu *pipelinedUpdate,
+	pidx channel.Index,
+	res ChannelMsg,
+	resErr error,
+) error {
+	if p.pending[version] != pu {
+		// The update was already enabled or discarded.
+		return nil
+	}
+
+	var err error
+	switch res := res.(type) {
+	case nil:
+		err = errors.WithMessage(resErr, "receiving update response")
+	case *msgChannelUpdateRej:
+		err = newPeerRejectedError("channel update", res.Reason)
+		if res.Reason == (PipelineConflictError{}).Error() {
+			err = newPipelineConflictError(version)
+		}
+	case *msgChannelUpdateCounter:
+		err = newPeerCounteredUpdateError(res.State)
+	case *msgChannelUpdateAcc:
+		if err = c.addPipelinedSig(ctx, version, pidx, res.Sig); err == nil {
+			return c.enableReady(ctx, p)
+		}
+	default:
+		log.Panic("wrong message type")
+	}
+	c.discardPipelined(ctx, p, version, err)
+	return nil
+}
+
+// handlePipelinedUpdateReq is called by the controller on incoming pipelined
+// update requests. It resolves conflicts with own outstanding updates and
+// checks that the update builds on the latest state before calling the update
+// handler.
+//
+// It assumes that the channel is locked.
+func (c *Channel) handlePipelinedUpdateReq(
+	pidx channel.Index,
+	req *msgChannelPipelinedUpdate,
+	uh UpdateHandler,
+) {
+	ctx, cancel := context.WithTimeout(c.Ctx(), responseTimeout)
+	defer cancel()
+
+	prev, err := c.pipelinedPredecessor(ctx, pidx, req)
+	if err == nil {
+		err = c.machine.CheckPipelined(req.State, req.ActorIdx, req.Sig, pidx)
+	}
+	if err == nil {
+		err = c.validUpdate(req.ChannelUpdate, pidx)
+	}
+	if err != nil {
+		c.logPeer(pidx).Warnf("invalid pipelined update received: %v", err)
+		if rerr := c.handleUpdateRej(ctx, pidx, req, err.Error()); rerr != nil {
+			c.logPeer(pidx).Warnf("rejecting pipelined update: %v", rerr)
+		}
+		return
+	}
+
+	responder := &UpdateResponder{channel: c, pidx: pidx, req: req}
+	uh.HandleUpdate(prev, req.ChannelUpdate, responder)
+}
+
+// pipelinedPredecessor returns the state on which the requested pipelined
+// update builds. Own conflicting updates are discarded if the peer wins the
+// conflict resolution. If the predecessor's request was not received yet, it
+// waits for it for at most pipelineReorderTimeout.
+//
+// It assumes that the channel is locked and temporarily unlocks it while
+// waiting.
+func (c *Channel) pipelinedPredecessor(
+	ctx context.Context,
+	pidx channel.Index,
+	req *msgChannelPipelinedUpdate,
+) (*channel.State, error) {
+	p := c.pipeline
+	if p == nil {
+		return nil, errors.New("pipelining not enabled")
+	}
+
+	version := req.State.Version
+	timeout := time.NewTimer(pipelineReorderTimeout)
+	defer timeout.Stop()
+	for version > c.machine.LatestState().Version+1 {
+		changed := p.changed
+		c.machMtx.Unlock()
+		select {
+		case <-changed:
+		case <-timeout.C:
+		case <-ctx.Done():
+		}
+		c.machMtx.Lock()
+		if !isOpen(changed) {
+			continue
+		}
+		return nil, errors.Errorf("unexpected version %d", version)
+	}
+
+	if version <= c.machine.State().Version {
+		return nil, PipelineConflictError{version}
+	}
+	// The predecessor is checked before resolving a conflict, so that
+	// requests of updates that the peer already discarded are ignored.
+	prev := c.machine.State()
+	if tx, ok := c.machine.StagedTX(version - 1); ok {
+		prev = tx.State
+	}
+	if ok, err := channel.Verify(c.Params().Parts[pidx], prev, req.PrevSig); err != nil {
+		return nil, errors.WithMessage(err, "verifying predecessor signature")
+	} else if !ok {
+		return nil, errors.New("unknown predecessor")
+	}
+
+	// On conflict, the peer wins if it has the lower index. Our own updates
+	// are only discarded once the peer's update is accepted. Until then, our
+	// request may still be accepted by the peer.
+	tx, staged := c.machine.StagedTX(version)
+	_, awaiting := p.awaiting[version]
+	if staged && tx.Sigs[pidx] != nil || (staged || awaiting) && c.Idx() < pidx {
+		return nil, PipelineConflictError{version}
+	}
+	return prev, nil
+}
+
+// acceptPipelined stages the pipelined update, adds the proposer's signatures
+// on it and its predecessor, sends our own signature and enables all fully
+// signed updates.
+//
+// It assumes that the channel is locked.
+func (c *Channel) acceptPipelined(
+	ctx context.Context,
+	pidx channel.Index,
+	req *msgChannelPipelinedUpdate,
+) (err error) {
+	p := c.pipeline
+	version := req.State.Version
+	prevVersion := version - 1
+	if tx, ok := c.machine.StagedTX(version); ok {
+		if tx.Sigs[pidx] != nil {
+			return PipelineConflictError{version}
+		}
+		// The peer won the conflict with our own update.
+		c.discardPipelined(ctx, p, version, newPipelineConflictError(version))
+	}
+	if err = c.stagePipelined(ctx, req.State, req.ActorIdx); err != nil {
+		return errors.WithMessage(err, "updating machine")
+	}
+	// if anything goes wrong from now on, we discard the update.
+	defer func() {
+		if err != nil {
+			c.discardPipelined(ctx, p, version, err)
+		}
+	}()
+
+	// The signature on the predecessor completes our own outstanding update,
+	// even if the peer's response to it was not received yet.
+	if _, ok := c.machine.StagedTX(prevVersion); ok {
+		if err = c.addPipelinedSig(ctx, prevVersion, pidx, req.PrevSig); err != nil {
+			return err
+		}
+	}
+	if err = c.machine.AddSigAt(ctx, version, pidx, req.Sig); err != nil {
+		return errors.WithMessage(err, "adding peer signature")
+	}
+	sig, err := c.machine.SigAt(ctx, version)
+	if err != nil {
+		return errors.WithMessage(err, "signing updated state")
+	}
+
+	msgUpAcc := &msgChannelUpdateAcc{
+		ChannelID: c.ID(),
+		Version:   version,
+		Sig:       sig,
+	}
+	if err = c.conn.Send(ctx, msgUpAcc); err != nil {
+		return errors.WithMessage(err, "sending accept message")
+	}
+
+	return c.enableReady(ctx, p)
+}
+
+// stagePipelined stages the given state on top of the latest state. If there
+// is no staged state yet, it becomes the staging state.
+func (c *Channel) stagePipelined(ctx context.Context, state *channel.State, actor channel.Index) error {
+	defer c.pipeline.notify()
+	if c.machine.Phase() == channel.Acting {
+		return c.machine.Update(ctx, state, actor)
+	}
+	return c.machine.Pipeline(ctx, state, actor)
+}
+
+// pipelinePrevSig returns the own signature on the latest state.
+func (c *Channel) pipelinePrevSig(ctx context.Context) (wallet.Sig, error) {
+	if c.machine.Phase() == channel.Acting {
+		return c.machine.CurrentTX().Sigs[c.Idx()], nil
+	}
+	return c.machine.SigAt(ctx, c.machine.LatestState().Version)
+}
+
+// addPipelinedSig adds the peer's signature to the staged state of the given
+// version, unless it is already present.
+func (c *Channel) addPipelinedSig(ctx context.Context, version uint64, pidx channel.Index, sig wallet.Sig) error {
+	tx, ok := c.machine.StagedTX(version)
+	if !ok {
+		return errors.Errorf("no staged state of version %d", version)
+	}
+	if tx.Sigs[pidx] != nil {
+		return nil
+	}
+	return errors.WithMessage(c.machine.AddSigAt(ctx, version, pidx, sig), "adding peer signature")
+}
+
+// enableReady enables the staging state as long as it is signed by all
+// participants and resolves the respective own outstanding updates.
+func (c *Channel) enableReady(ctx context.Context, p *pipeline) error {
+	defer p.notify()
+	for c.machine.Phase() == channel.Signing && fullySigned(c.machine.StagingTX()) {
+		version := c.machine.StagingTX().Version
+		if err := c.enableNotifyUpdate(ctx); err != nil {
+			return err
+		}
+		if pu, ok := p.pending[version]; ok {
+			pu.done <- nil
+			delete(p.pending, version)
+		}
+	}
+	return nil
+}
+
+// discardPipelined discards the staged state of the given version and all
+// states building on it. The respective own outstanding updates fail with the
+// given error.
+func (c *Channel) discardPipelined(ctx context.Context, p *pipeline, version uint64, err error) {
+	defer p.notify()
+	if _, ok := c.machine.StagedTX(version); ok {
+		if derr := c.machine.DiscardFrom(ctx, version); derr != nil {
+			// discarding update should never fail
+			c.Log().Warn("discarding pipelined update failed:", derr)
+		}
+	}
+	p.fail(version, err)
+}
+
+// awaitingAfter returns the channel of an own request awaiting its response
+// whose version is greater than the given version, if any.
+func (p *pipeline) awaitingAfter(version uint64) (chan struct{}, bool) {
+	for v, awaiting := range p.awaiting {
+		if v > version {
+			return awaiting, true
+		}
+	}
+	return nil, false
+}
+
+// notify signals a change of the pipeline to waiting update requests.
+func (p *pipeline) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// abort resolves all own outstanding updates with the given error after the
+// staged states were discarded outside of the pipeline.
+func (p *pipeline) abort(err error) {
+	p.fail(0, err)
+	p.notify()
+}
+
+// fail resolves all own outstanding updates from the given version on with
+// the given error.
+func (p *pipeline) fail(version uint64, err error) {
+	for v, pu := range p.pending {
+		if v >= version {
+			pu.done <- err
+			delete(p.pending, v)
+		}
+	}
+}
+
+func isOpen(c chan struct{}) bool {
+	select {
+	case <-c:
+		return false
+	default:
+		return true
+	}
+}
+
+func (e PipelineConflictError) Error() string {
+	return "pipelined update conflicts with update of peer"
+}
+
+func newPipelineConflictError(version uint64) error {
+	return errors.WithStack(PipelineConflictError{version})
+}
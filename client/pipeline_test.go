@@ -0,0 +1,108 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+)
+
+func TestChannel_Pipelining(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+
+	accept := func(_ *channel.State, _ client.ChannelUpdate, ur *client.UpdateResponder) {
+		assert.NoError(t, ur.Accept(ctx))
+	}
+	chAlice, chBob := setupUpdateTestWithHandlers(ctx, t, accept, accept)
+
+	assert.Error(t, chAlice.EnablePipelining(0))
+	require.NoError(t, chAlice.EnablePipelining(4))
+	require.NoError(t, chBob.EnablePipelining(4))
+	assert.Error(t, chAlice.EnablePipelining(4))
+
+	// requireSynced asserts that both channels reach the given version and
+	// Bob's balance.
+	requireSynced := func(version uint64, balBob int64) {
+		for _, ch := range []*client.Channel{chAlice, chBob} {
+			require.Eventually(t, func() bool {
+				s := ch.State()
+				return s.Version == version && s.Balances[0][1].Cmp(big.NewInt(balBob)) == 0
+			}, testDuration, 10*time.Millisecond)
+		}
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		const numUpdates = 10
+		var wg sync.WaitGroup
+		wg.Add(numUpdates)
+		for i := 0; i < numUpdates; i++ {
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, chAlice.Update(ctx, transfer(1)))
+			}()
+		}
+		wg.Wait()
+		requireSynced(numUpdates, 100+numUpdates)
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		const numUpdates = 8
+		v0 := chAlice.State().Version
+		var mtx sync.Mutex
+		var succAlice, succBob int
+		var wg sync.WaitGroup
+		wg.Add(2 * numUpdates)
+		update := func(ch *client.Channel, amount int64, succ *int) {
+			defer wg.Done()
+			err := ch.Update(ctx, transfer(amount))
+			if err == nil {
+				mtx.Lock()
+				*succ++
+				mtx.Unlock()
+				return
+			}
+			// Failed updates either lost a conflict or built on a state
+			// that lost a conflict.
+			assert.True(t, errors.As(err, new(client.PipelineConflictError)) ||
+				errors.As(err, new(client.PeerRejectedError)), err)
+		}
+		for i := 0; i < numUpdates; i++ {
+			go update(chAlice, 1, &succAlice)
+			go update(chBob, -1, &succBob)
+		}
+		wg.Wait()
+
+		// Both channels converge on the successful updates.
+		assert.Positive(t, succAlice)
+		requireSynced(v0+uint64(succAlice+succBob), 110+int64(succAlice-succBob))
+	})
+
+	t.Run("other operations", func(t *testing.T) {
+		// Other operations only need the machine to be idle.
+		require.NoError(t, chAlice.Update(ctx, transfer(1)))
+		assert.Equal(t, channel.Acting, chAlice.Phase())
+	})
+}
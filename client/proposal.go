@@ -23,6 +23,7 @@ import (
 	"github.com/pkg/errors"
 
 	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
 	"perun.network/go-perun/log"
 	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
@@ -33,9 +34,16 @@ import (
 
 const proposerIdx, proposeeIdx = 0, 1
 
-// number of participants that is used unless specified otherwise.
+// number of participants of a two-party channel. Proposals with more
+// participants require the proposer to forward all accept messages to the
+// proposees.
 const proposalNumParts = 2
 
+// MaxCounterProposals is the maximum number of counter-proposals that
+// ProposeChannel processes during a single channel opening. If the peers
+// counter more often, the channel opening fails with a PeerCounteredError.
+const MaxCounterProposals = 8
+
 type (
 	// A ProposalHandler decides how to handle incoming channel proposals from
 	// other channel network peers.
@@ -51,10 +59,19 @@ type (
 	// f when HandleProposal is called.
 	ProposalHandlerFunc func(ChannelProposal, *ProposalResponder)
 
+	// A CounterProposalHandler decides how to continue a channel opening after
+	// a peer answered the proposal prop with the counter-proposal counter. It
+	// returns the proposal to send next, which usually is counter itself, and
+	// whether the negotiation should continue at all. The next proposal must
+	// only differ from prop in its initial balances, challenge duration and
+	// funding agreement. Its nonce share is replaced by the one of prop, so
+	// that the proposer's nonce share cannot be chosen by a peer.
+	CounterProposalHandler func(prop, counter ChannelProposal) (next ChannelProposal, ok bool)
+
 	// ProposalResponder lets the user respond to a channel proposal. If the user
-	// wants to accept the proposal, they should call Accept(), otherwise Reject().
-	// Only a single function must be called and every further call causes a
-	// panic.
+	// wants to accept the proposal, they should call Accept(), otherwise Reject()
+	// or Counter(). Only a single function must be called and every further call
+	// causes a panic.
 	ProposalResponder struct {
 		client *Client
 		peer   wire.Address
@@ -68,6 +85,12 @@ type (
 		ItemType string // ItemType indicates the type of item rejected (channel proposal or channel update).
 		Reason   string // Reason sent by the peer for the rejection.
 	}
+
+	// PeerCounteredError indicates that a peer answered the channel proposal
+	// with a counter-proposal that was not taken up.
+	PeerCounteredError struct {
+		Counter ChannelProposal // Counter-proposal sent by the peer.
+	}
 )
 
 // HandleProposal calls the proposal handler function.
@@ -119,6 +142,22 @@ func (r *ProposalResponder) Reject(ctx context.Context, reason string) error {
 	return r.client.handleChannelProposalRej(ctx, r.peer, r.req, reason)
 }
 
+// Counter lets the user answer the channel proposal with a counter-proposal.
+// The counter-proposal must have the same type, participants and app as the
+// proposal that was passed to the handler, and may only change the initial
+// balances, the challenge duration and the funding agreement.
+//
+// The proposer decides whether to continue with the counter-proposal. If it
+// does, the counter-proposal is received by the proposal handler as a new
+// proposal. Returns whether the counter-proposal was successfully sent.
+// Panics if the proposal was already accepted, rejected or countered.
+func (r *ProposalResponder) Counter(ctx context.Context, counter ChannelProposal) error {
+	if !r.called.TrySet() {
+		log.Panic("multiple calls on proposal responder")
+	}
+	return r.client.handleChannelProposalCounter(ctx, r.peer, r.req, counter)
+}
+
 // ProposeChannel attempts to open a channel with the parameters and peers from
 // ChannelProposal prop:
 // - the proposal is sent to the peers and if all peers accept,
@@ -137,7 +176,14 @@ func (r *ProposalResponder) Reject(ctx context.Context, reason string) error {
 // channel watcher with Channel.Watch() on the returned channel
 // controller.
 //
+// If a peer answers with a counter-proposal, it is passed to the handler set
+// with Client.OnCounterProposal, which decides whether the proposal is
+// repeated with changed parameters. At most MaxCounterProposals
+// counter-proposals are processed.
+//
 // Returns PeerRejectedProposalError if the channel is rejected by the peer.
+// Returns PeerCounteredError if the peer countered the proposal and the
+// counter-proposal was not taken up.
 // Returns RequestTimedOutError if the peer did not respond before the context
 // expires or is cancelled.
 // Returns FundingTimeoutError if any of the participants do not fund the
@@ -159,17 +205,16 @@ func (c *Client) ProposeChannel(ctx context.Context, prop ChannelProposal) (*Cha
 	defer c.cleanupChannelOpening(prop, proposerIdx)
 
 	// 1. validate input
-	peer := c.proposalPeers(prop)[proposeeIdx]
-	if err := c.validTwoPartyProposal(prop, proposerIdx, peer); err != nil {
+	if err := c.validProposal(prop, proposerIdx, c.address); err != nil {
 		return nil, errors.WithMessage(err, "invalid channel proposal")
 	}
 
-	// 2. send proposal, wait for response, create channel object
+	// 2. send proposal, wait for responses, create channel object
 	// cache version 1 updates until channel is opened
 	c.enableVer1Cache()
 	// replay cached version 1 updates
 	defer c.releaseVer1Cache() //nolint:contextcheck
-	ch, err := c.proposeTwoPartyChannel(ctx, prop)
+	ch, prop, err := c.negotiateChannel(ctx, prop)
 	if err != nil {
 		return nil, errors.WithMessage(err, "channel proposal")
 	}
@@ -179,6 +224,44 @@ func (c *Client) ProposeChannel(ctx context.Context, prop ChannelProposal) (*Cha
 	return ch, fundingErr
 }
 
+// negotiateChannel runs the proposal protocol for prop. As long as a peer
+// counters and the counter-proposal handler agrees, the protocol is repeated
+// with the proposal returned by the handler. It returns the new channel
+// controller and the proposal that was finally accepted.
+func (c *Client) negotiateChannel(
+	ctx context.Context,
+	prop ChannelProposal,
+) (*Channel, ChannelProposal, error) {
+	for numCounters := 0; ; numCounters++ {
+		ch, err := c.proposeChannel(ctx, prop)
+		var counterErr PeerCounteredError
+		if err == nil || !errors.As(err, &counterErr) {
+			return ch, prop, err
+		}
+
+		handler := c.counterProposalHandler()
+		if handler == nil {
+			return nil, nil, err
+		}
+		if numCounters >= MaxCounterProposals {
+			return nil, nil, errors.WithMessagef(err, "exceeded %d counter-proposals", MaxCounterProposals)
+		}
+		next, ok := handler(prop, counterErr.Counter)
+		if !ok {
+			return nil, nil, err
+		}
+		if err := c.validCounterProposal(prop, next); err != nil {
+			return nil, nil, errors.WithMessage(err, "invalid proposal from counter-proposal handler")
+		}
+		next.Base().NonceShare = prop.Base().NonceShare
+		if err := c.validProposal(next, proposerIdx, c.address); err != nil {
+			return nil, nil, errors.WithMessage(err, "invalid proposal from counter-proposal handler")
+		}
+		c.log.WithField("round", numCounters+1).Debug("repeating channel proposal after counter-proposal")
+		prop = next
+	}
+}
+
 func (c *Client) prepareChannelOpening(ctx context.Context, prop ChannelProposal, ourIdx channel.Index) (err error) {
 	_, parentCh, err := c.proposalParent(prop, ourIdx)
 	if err != nil {
@@ -203,23 +286,27 @@ func (c *Client) cleanupChannelOpening(prop ChannelProposal, ourIdx channel.Inde
 	}
 }
 
-// handleChannelProposal implements the receiving side of the (currently)
-// two-party channel proposal protocol.
+// handleChannelProposal implements the receiving side of the multi-party
+// channel proposal protocol.
 // The proposer is expected to be the first peer in the participant list.
 //
 // This handler is dispatched from the Client.Handle routine.
 func (c *Client) handleChannelProposal(handler ProposalHandler, p wire.Address, req ChannelProposal) {
-	ourIdx := channel.Index(proposeeIdx)
+	ourIdx, err := c.proposalIdx(req)
+	if err != nil {
+		c.logPeer(p).Debugf("received invalid channel proposal: %v", err)
+		return
+	}
 
 	// Prepare and cleanup, e.g., for locking and unlocking parent channel.
-	err := c.prepareChannelOpening(c.Ctx(), req, ourIdx)
+	err = c.prepareChannelOpening(c.Ctx(), req, ourIdx)
 	if err != nil {
 		c.log.Warn("preparing channel opening:", err)
 		return
 	}
 	defer c.cleanupChannelOpening(req, ourIdx)
 
-	if err := c.validTwoPartyProposal(req, ourIdx, p); err != nil {
+	if err := c.validProposal(req, ourIdx, p); err != nil {
 		c.logPeer(p).Debugf("received invalid channel proposal: %v", err)
 		return
 	}
@@ -268,12 +355,94 @@ func (c *Client) acceptChannelProposal(
 	pred := enableVer0Cache(c.conn)
 	defer c.conn.ReleaseCache(pred)
 
+	ourIdx, err := c.proposalIdx(prop)
+	if err != nil {
+		return nil, err
+	}
+	peers := c.proposalPeers(prop)
+	accs := make([]ChannelProposalAccept, len(peers))
+	accs[ourIdx] = acc
+
+	// In the multi-party case, the proposer answers with the accept messages
+	// of all proposees. We subscribe before sending our acceptance so that we
+	// cannot miss the answer.
+	var recv *wire.Receiver
+	if len(peers) > proposalNumParts {
+		recv = wire.NewReceiver()
+		defer recv.Close()
+		proposalID := prop.ProposalID()
+		isProposerRes := func(e *wire.Envelope) bool {
+			if !e.Sender.Equal(p) {
+				return false
+			}
+			switch msg := e.Msg.(type) {
+			case *msgChannelProposalAccs:
+				return msg.ProposalID == proposalID
+			case *ChannelProposalRej:
+				return msg.ProposalID == proposalID
+			}
+			return false
+		}
+		if err := c.conn.Subscribe(recv, isProposerRes); err != nil {
+			return nil, errors.WithMessage(err, "subscribing proposal accepts recv")
+		}
+	}
+
 	if err := c.conn.pubMsg(ctx, acc, p); err != nil {
 		c.logPeer(p).Errorf("error sending proposal acceptance: %v", err)
 		return nil, errors.WithMessage(err, "sending proposal acceptance")
 	}
 
-	return c.completeCPP(ctx, prop, acc, proposeeIdx)
+	if recv != nil {
+		if accs, err = c.receiveProposalAccs(ctx, prop, recv, ourIdx, acc); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.completeCPP(ctx, prop, accs, ourIdx)
+}
+
+// receiveProposalAccs receives the accept messages of all proposees that the
+// proposer forwards in the multi-party case. It returns them indexed by
+// participant index, where the proposer's entry is nil.
+func (c *Client) receiveProposalAccs(
+	ctx context.Context,
+	prop ChannelProposal,
+	recv *wire.Receiver,
+	ourIdx channel.Index,
+	ourAcc ChannelProposalAccept,
+) ([]ChannelProposalAccept, error) {
+	env, err := recv.Next(ctx)
+	if err != nil {
+		if pcontext.IsContextError(err) {
+			return nil, newRequestTimedOutError("channel proposal", err.Error())
+		}
+		return nil, errors.WithMessage(err, "receiving proposal accepts")
+	}
+	if rej, ok := env.Msg.(*ChannelProposalRej); ok {
+		return nil, newPeerRejectedError("channel proposal", rej.Reason)
+	}
+
+	msg, ok := env.Msg.(*msgChannelProposalAccs) // this is safe because of the receiver's predicate
+	if !ok {
+		log.Panic("internal error: wrong message type")
+	}
+	if len(msg.Accs) != len(c.proposalPeers(prop))-1 {
+		return nil, errors.Errorf("expected %d accept messages, got %d",
+			len(c.proposalPeers(prop))-1, len(msg.Accs))
+	}
+
+	accs := append([]ChannelProposalAccept{nil}, msg.Accs...)
+	for i, acc := range accs[proposeeIdx:] {
+		if err := c.validChannelProposalAcc(prop, acc); err != nil {
+			return nil, errors.WithMessagef(err, "validating acceptance of peer %d", i+proposeeIdx)
+		}
+	}
+	if !equalEncoding(accs[ourIdx], ourAcc) {
+		return nil, errors.New("proposer forwarded modified own acceptance")
+	}
+	accs[ourIdx] = ourAcc
+	return accs, nil
 }
 
 func (c *Client) handleChannelProposalRej(
@@ -291,14 +460,41 @@ func (c *Client) handleChannelProposalRej(
 	return nil
 }
 
-// proposeTwoPartyChannel implements the multi-party channel proposal
-// protocol for the two-party case. It returns the agreed upon channel
-// parameters.
-func (c *Client) proposeTwoPartyChannel(
+func (c *Client) handleChannelProposalCounter(
+	ctx context.Context, p wire.Address,
+	req, counter ChannelProposal,
+) error {
+	ourIdx, err := c.proposalIdx(req)
+	if err != nil {
+		return err
+	}
+	if err := c.validCounterProposal(req, counter); err != nil {
+		return errors.WithMessage(err, "invalid counter-proposal")
+	}
+	if err := c.validProposal(counter, ourIdx, p); err != nil {
+		return errors.WithMessage(err, "invalid counter-proposal")
+	}
+
+	msgCounter := &ChannelProposalCounter{
+		ProposalID: req.ProposalID(),
+		Proposal:   counter,
+	}
+	if err := c.conn.pubMsg(ctx, msgCounter, p); err != nil {
+		c.logPeer(p).Warn("error sending counter-proposal")
+		return err
+	}
+	return nil
+}
+
+// proposeChannel implements the proposer side of the multi-party channel
+// proposal protocol. The proposal is sent to all proposees and their responses
+// are collected. If there are more than two participants, the accept messages
+// are then forwarded to all proposees. It returns the new channel controller.
+func (c *Client) proposeChannel(
 	ctx context.Context,
 	proposal ChannelProposal,
 ) (*Channel, error) {
-	peer := c.proposalPeers(proposal)[proposeeIdx]
+	peers := c.proposalPeers(proposal)
 
 	// enables caching of incoming version 0 signatures before sending any message
 	// that might trigger a fast peer to send those. We don't know the channel id
@@ -308,10 +504,15 @@ func (c *Client) proposeTwoPartyChannel(
 
 	proposalID := proposal.ProposalID()
 	isResponse := func(e *wire.Envelope) bool {
-		acc, isAcc := e.Msg.(ChannelProposalAccept)
-		return (isAcc && acc.Base().ProposalID == proposalID) ||
-			(e.Msg.Type() == wire.ChannelProposalRej &&
-				e.Msg.(*ChannelProposalRej).ProposalID == proposalID)
+		switch msg := e.Msg.(type) {
+		case ChannelProposalAccept:
+			return msg.Base().ProposalID == proposalID
+		case *ChannelProposalRej:
+			return msg.ProposalID == proposalID
+		case *ChannelProposalCounter:
+			return msg.ProposalID == proposalID
+		}
+		return false
 	}
 	receiver := wire.NewReceiver()
 	defer receiver.Close()
@@ -320,41 +521,147 @@ func (c *Client) proposeTwoPartyChannel(
 		return nil, errors.WithMessage(err, "subscribing proposal response recv")
 	}
 
-	if err := c.conn.pubMsg(ctx, proposal, peer); err != nil {
+	if err := c.conn.pubMsgs(ctx, proposal, peers[proposeeIdx:]...); err != nil {
 		return nil, errors.WithMessage(err, "publishing channel proposal")
 	}
 
-	env, err := receiver.Next(ctx)
+	accs, err := c.receiveProposalResponses(ctx, proposal, receiver, peers)
 	if err != nil {
-		if pcontext.IsContextError(err) {
-			return nil, newRequestTimedOutError("channel proposal", err.Error())
+		return nil, err
+	}
+
+	if len(peers) > proposalNumParts {
+		msgAccs := &msgChannelProposalAccs{
+			ProposalID: proposalID,
+			Accs:       accs[proposeeIdx:],
+		}
+		if err := c.conn.pubMsgs(ctx, msgAccs, peers[proposeeIdx:]...); err != nil {
+			return nil, errors.WithMessage(err, "publishing proposal accepts")
 		}
-		return nil, errors.WithMessage(err, "receiving proposal response")
 	}
-	if rej, ok := env.Msg.(*ChannelProposalRej); ok {
-		return nil, newPeerRejectedError("channel proposal", rej.Reason)
+
+	return c.completeCPP(ctx, proposal, accs, proposerIdx)
+}
+
+// receiveProposalResponses collects the responses of all proposees to the
+// proposal. It returns their accept messages indexed by participant index,
+// where the proposer's entry is nil.
+//
+// The proposer waits for all responses before answering, so that the
+// proposees are guaranteed to be subscribed to the answer. If any proposee
+// rejected or countered the proposal or sent an invalid acceptance, all
+// proposees that accepted are notified with a rejection. A valid
+// counter-proposal is returned as PeerCounteredError.
+func (c *Client) receiveProposalResponses(
+	ctx context.Context,
+	proposal ChannelProposal,
+	receiver *wire.Receiver,
+	peers []wire.Address,
+) ([]ChannelProposalAccept, error) {
+	accs := make([]ChannelProposalAccept, len(peers))
+	responded := make([]bool, len(peers))
+	responded[proposerIdx] = true
+
+	var rejErr error
+	for numMissing := len(peers) - 1; numMissing > 0; {
+		env, err := receiver.Next(ctx)
+		if err != nil {
+			if pcontext.IsContextError(err) {
+				return nil, newRequestTimedOutError("channel proposal", err.Error())
+			}
+			return nil, errors.WithMessage(err, "receiving proposal response")
+		}
+
+		idx := wire.IndexOfAddr(peers, env.Sender)
+		if idx < 0 || responded[idx] {
+			c.logPeer(env.Sender).Warn("received unexpected proposal response")
+			continue
+		}
+		responded[idx] = true
+		numMissing--
+
+		switch msg := env.Msg.(type) {
+		case *ChannelProposalRej:
+			if rejErr == nil {
+				rejErr = newPeerRejectedError("channel proposal", msg.Reason)
+			}
+		case *ChannelProposalCounter:
+			if rejErr != nil {
+				continue
+			}
+			if err := c.validCounterProposal(proposal, msg.Proposal); err != nil {
+				rejErr = errors.WithMessagef(err, "validating counter-proposal of peer %d", idx)
+				continue
+			}
+			rejErr = newPeerCounteredError(msg.Proposal)
+		case ChannelProposalAccept: // this is safe because of predicate isResponse
+			if err := c.validChannelProposalAcc(proposal, msg); err != nil {
+				if rejErr == nil {
+					rejErr = errors.WithMessagef(err, "validating acceptance of peer %d", idx)
+				}
+				continue
+			}
+			accs[idx] = msg
+		default:
+			log.Panic("internal error: wrong message type")
+		}
 	}
 
-	acc, ok := env.Msg.(ChannelProposalAccept) // this is safe because of predicate isResponse
-	if !ok {
-		log.Panic("internal error: wrong message type")
+	if rejErr != nil {
+		c.rejectAcceptedProposal(ctx, proposal, peers, accs, rejErr.Error())
+		return nil, rejErr
+	}
+	return accs, nil
+}
+
+// rejectAcceptedProposal notifies all proposees of a multi-party channel
+// proposal that accepted it that the channel opening failed.
+func (c *Client) rejectAcceptedProposal(
+	ctx context.Context,
+	proposal ChannelProposal,
+	peers []wire.Address,
+	accs []ChannelProposalAccept,
+	reason string,
+) {
+	if len(peers) <= proposalNumParts {
+		return
 	}
 
-	if err := c.validChannelProposalAcc(proposal, acc); err != nil {
-		return nil, errors.WithMessage(err, "validating channel proposal acceptance")
+	var accepted []wire.Address
+	for i, acc := range accs {
+		if acc != nil {
+			accepted = append(accepted, peers[i])
+		}
+	}
+	msgReject := &ChannelProposalRej{
+		ProposalID: proposal.ProposalID(),
+		Reason:     reason,
+	}
+	if err := c.conn.pubMsgs(ctx, msgReject, accepted...); err != nil {
+		c.log.Warnf("error sending proposal rejection: %v", err)
 	}
+}
 
-	return c.completeCPP(ctx, proposal, acc, proposerIdx)
+// proposalIdx returns our participant index in the proposed channel.
+func (c *Client) proposalIdx(prop ChannelProposal) (channel.Index, error) {
+	if sub, ok := prop.(*SubChannelProposal); ok && !c.channels.Has(sub.Parent) {
+		return 0, errors.New("parent channel does not exist")
+	}
+	idx := wire.IndexOfAddr(c.proposalPeers(prop), c.address)
+	if idx < 0 {
+		return 0, errors.New("we are not a peer of the proposed channel")
+	}
+	return channel.Index(idx), nil
 }
 
-// validTwoPartyProposal checks that the proposal is valid in the two-party
-// setting, where the proposer is expected to have index 0 in the peer list and
-// the receiver to have index 1. The generic validity of the proposal is also
-// checked.
-func (c *Client) validTwoPartyProposal(
+// validProposal checks that the proposal is valid in the multi-party setting,
+// where the proposer is expected to have index 0 in the peer list and we are
+// expected to have index ourIdx. The peers must be unique. The generic
+// validity of the proposal is also checked.
+func (c *Client) validProposal(
 	proposal ChannelProposal,
 	ourIdx channel.Index,
-	peerAddr wallet.Address,
+	proposer wire.Address,
 ) error {
 	if err := proposal.Valid(); err != nil {
 		return err
@@ -365,21 +672,21 @@ func (c *Client) validTwoPartyProposal(
 		return errors.Errorf("participants (%d) and peers (%d) dimension mismatch",
 			proposal.Base().NumPeers(), len(peers))
 	}
-	if len(peers) != proposalNumParts {
-		return errors.Errorf("expected 2 peers, got %d", len(peers))
+	for i := range peers {
+		if idx := wire.IndexOfAddr(peers[:i], peers[i]); idx >= 0 {
+			return errors.Errorf("peers %d and %d are equal", idx, i)
+		}
 	}
 
-	if !(ourIdx == proposerIdx || ourIdx == proposeeIdx) {
+	if int(ourIdx) >= len(peers) {
 		return errors.Errorf("invalid index: %d", ourIdx)
 	}
 
-	peerIdx := ourIdx ^ 1
-	// In the 2PCPP, the proposer is expected to have index 0
-	if !peers[peerIdx].Equal(peerAddr) {
-		return errors.Errorf("remote peer doesn't have peer index %d", peerIdx)
+	// In the MPCPP, the proposer is expected to have index 0
+	if !peers[proposerIdx].Equal(proposer) {
+		return errors.Errorf("proposer doesn't have peer index %d", proposerIdx)
 	}
 
-	// In the 2PCPP, the receiver is expected to have index 1
 	if !peers[ourIdx].Equal(c.address) {
 		return errors.Errorf("we don't have peer index %d", ourIdx)
 	}
@@ -390,6 +697,9 @@ func (c *Client) validTwoPartyProposal(
 			return errors.WithMessage(err, "validate subchannel proposal")
 		}
 	case *VirtualChannelProposal:
+		if len(peers) != proposalNumParts {
+			return errors.Errorf("expected %d peers for virtual channel, got %d", proposalNumParts, len(peers))
+		}
 		if err := c.validVirtualChannelProposal(prop, ourIdx); err != nil {
 			return errors.WithMessage(err, "validate subchannel proposal")
 		}
@@ -398,6 +708,53 @@ func (c *Client) validTwoPartyProposal(
 	return nil
 }
 
+// validCounterProposal checks that counter is a counter-proposal to prop,
+// i.e., that both are of the same type and only differ in their initial
+// balances, challenge duration, funding agreement and nonce share. The assets
+// and the number of participants must also stay the same.
+func (c *Client) validCounterProposal(prop, counter ChannelProposal) error {
+	if counter == nil {
+		return errors.New("nil counter-proposal")
+	}
+	if prop.Type() != counter.Type() {
+		return errors.Errorf("expected counter-proposal of type %v, got %v", prop.Type(), counter.Type())
+	}
+	if err := counter.Valid(); err != nil {
+		return err
+	}
+	propBase, counterBase := prop.Base(), counter.Base()
+	if propBase.NumPeers() != counterBase.NumPeers() {
+		return errors.New("number of participants changed")
+	}
+	if err := channel.AssetsAssertEqual(propBase.InitBals.Assets, counterBase.InitBals.Assets); err != nil {
+		return errors.WithMessage(err, "assets changed")
+	}
+
+	// Compare the encodings of both proposals with the negotiable fields of
+	// the original proposal copied into the counter-proposal.
+	var buf bytes.Buffer
+	if err := wire.Encode(counter, &buf); err != nil {
+		return errors.WithMessage(err, "encoding counter-proposal")
+	}
+	msg, err := wire.Decode(&buf)
+	if err != nil {
+		return errors.WithMessage(err, "copying counter-proposal")
+	}
+	masked, ok := msg.(ChannelProposal)
+	if !ok {
+		return errors.New("counter-proposal is not a channel proposal")
+	}
+	maskedBase := masked.Base()
+	maskedBase.ChallengeDuration = propBase.ChallengeDuration
+	maskedBase.NonceShare = propBase.NonceShare
+	maskedBase.InitBals = propBase.InitBals
+	maskedBase.FundingAgreement = propBase.FundingAgreement
+	if !equalEncoding(prop, masked) {
+		return errors.New("counter-proposal changes non-negotiable fields")
+	}
+	return nil
+}
+
 func (c *Client) validSubChannelProposal(proposal *SubChannelProposal) error {
 	parent, ok := c.channels.Channel(proposal.Parent)
 	if !ok {
@@ -477,17 +834,27 @@ func (c *Client) validChannelProposalAcc(
 	return nil
 }
 
-func participants(proposer, proposee wallet.Address) []wallet.Address {
-	parts := make([]wallet.Address, proposalNumParts)
-	parts[proposerIdx] = proposer
-	parts[proposeeIdx] = proposee
-	return parts
+// equalEncoding returns whether both messages have the same encoding.
+func equalEncoding(a, b wire.Msg) bool {
+	var bufA, bufB bytes.Buffer
+	if err := wire.Encode(a, &bufA); err != nil {
+		return false
+	}
+	if err := wire.Encode(b, &bufB); err != nil {
+		return false
+	}
+	return bytes.Equal(bufA.Bytes(), bufB.Bytes())
 }
 
-func nonceShares(proposer, proposee NonceShare) []NonceShare {
-	shares := make([]NonceShare, proposalNumParts)
+// nonceShares returns the nonce shares of all participants, ordered by
+// participant index. accs must contain the accept messages of all proposees
+// at their participant index.
+func nonceShares(proposer NonceShare, accs []ChannelProposalAccept) []NonceShare {
+	shares := make([]NonceShare, len(accs))
 	shares[proposerIdx] = proposer
-	shares[proposeeIdx] = proposee
+	for i := proposeeIdx; i < len(accs); i++ {
+		shares[i] = accs[i].Base().NonceShare
+	}
 	return shares
 }
 
@@ -507,8 +874,9 @@ func calcNonce(nonceShares []NonceShare) channel.Nonce {
 // controller. The initial state with signatures is exchanged using the wallet
 // to unlock the account for our participant.
 //
-// It does not perform a validity check on the proposal, so make sure to only
-// pass valid proposals.
+// The accept messages of all proposees must be passed in accs at their
+// participant index. It does not perform a validity check on the proposal, so
+// make sure to only pass valid proposals.
 //
 // It is important that the passed context does not cancel before twice the
 // ChallengeDuration has passed (at least for real blockchain backends with wall
@@ -516,15 +884,15 @@ func calcNonce(nonceShares []NonceShare) channel.Nonce {
 func (c *Client) completeCPP(
 	ctx context.Context,
 	prop ChannelProposal,
-	acc ChannelProposalAccept,
+	accs []ChannelProposalAccept,
 	partIdx channel.Index,
 ) (*Channel, error) {
 	propBase := prop.Base()
 	params := channel.NewParamsUnsafe(
 		propBase.ChallengeDuration,
-		c.mpcppParts(prop, acc),
+		c.mpcppParts(prop, accs),
 		propBase.App,
-		calcNonce(nonceShares(propBase.NonceShare, acc.Base().NonceShare)),
+		calcNonce(nonceShares(propBase.NonceShare, accs)),
 		prop.Type() == wire.LedgerChannelProposal,
 		prop.Type() == wire.VirtualChannelProposal,
 	)
@@ -550,13 +918,18 @@ func (c *Client) completeCPP(
 	}
 
 	// If subchannel proposal receiver, setup register funding update.
-	if prop.Type() == wire.SubChannelProposal && partIdx == proposeeIdx {
+	if prop.Type() == wire.SubChannelProposal && partIdx != proposerIdx {
 		parent.registerSubChannelFunding(ch.ID(), propBase.InitBals.Sum())
 	}
 
 	if err := c.pr.ChannelCreated(ctx, ch.machine, peers, parentChannelID); err != nil {
 		return ch, errors.WithMessage(err, "persisting new channel")
 	}
+	if fp, ok := c.pr.(persistence.FundingPersister); ok && prop.Type() == wire.LedgerChannelProposal {
+		if err := fp.FundingAgreed(ctx, ch.ID(), propBase.FundingAgreement); err != nil {
+			return ch, errors.WithMessage(err, "persisting funding agreement")
+		}
+	}
 
 	if err := ch.init(ctx, propBase.InitBals, propBase.InitData); err != nil {
 		return ch, errors.WithMessage(err, "setting initial bals and data")
@@ -586,16 +959,19 @@ func (c *Client) proposalParent(prop ChannelProposal, partIdx channel.Index) (pa
 	return
 }
 
-// mpcppParts returns a proposed channel's participant addresses.
+// mpcppParts returns a proposed channel's participant addresses. accs must
+// contain the accept messages of all proposees at their participant index.
 func (c *Client) mpcppParts(
 	prop ChannelProposal,
-	acc ChannelProposalAccept,
+	accs []ChannelProposalAccept,
 ) (parts []wallet.Address) {
 	switch p := prop.(type) {
 	case *LedgerChannelProposal:
-		parts = participants(
-			p.Participant,
-			acc.(*LedgerChannelProposalAcc).Participant)
+		parts = make([]wallet.Address, len(accs))
+		parts[proposerIdx] = p.Participant
+		for i := proposeeIdx; i < len(accs); i++ {
+			parts[i] = accs[i].(*LedgerChannelProposalAcc).Participant
+		}
 	case *SubChannelProposal:
 		ch, ok := c.channels.Channel(p.Parent)
 		if !ok {
@@ -603,10 +979,11 @@ func (c *Client) mpcppParts(
 		}
 		parts = ch.Params().Parts
 	case *VirtualChannelProposal:
-		parts = participants(
-			p.Proposer,
-			acc.(*VirtualChannelProposalAcc).Responder,
-		)
+		parts = make([]wallet.Address, len(accs))
+		parts[proposerIdx] = p.Proposer
+		for i := proposeeIdx; i < len(accs); i++ {
+			parts[i] = accs[i].(*VirtualChannelProposalAcc).Responder
+		}
 	default:
 		c.log.Panicf("unhandled %T", p)
 	}
@@ -670,12 +1047,10 @@ func (c *Client) fundSubchannel(ctx context.Context, prop *SubChannelProposal, s
 			return errors.WithMessage(err, "parent channel update failed")
 		}
 
-	case proposeeIdx:
+	default:
 		if err := parentChannel.awaitSubChannelFunding(ctx, subChannel.ID()); err != nil {
 			return errors.WithMessage(err, "await subchannel funding update")
 		}
-	default:
-		return errors.New("invalid participant index")
 	}
 
 	return c.completeFunding(ctx, subChannel)
@@ -733,3 +1108,11 @@ func (e PeerRejectedError) Error() string {
 func newPeerRejectedError(rejectedItemType, reason string) error {
 	return errors.WithStack(PeerRejectedError{rejectedItemType, reason})
 }
+
+func (e PeerCounteredError) Error() string {
+	return "channel proposal countered by peer"
+}
+
+func newPeerCounteredError(counter ChannelProposal) error {
+	return errors.WithStack(PeerCounteredError{counter})
+}
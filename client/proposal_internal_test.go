@@ -31,7 +31,7 @@ import (
 	pkgtest "polycry.pt/poly-go/test"
 )
 
-func TestClient_validTwoPartyProposal(t *testing.T) {
+func TestClient_validProposal(t *testing.T) {
 	rng := pkgtest.Prng(t)
 
 	// dummy client that only has an id
@@ -45,6 +45,13 @@ func TestClient_validTwoPartyProposal(t *testing.T) {
 	require.Len(t, validProp.Peers, 2)
 
 	validProp3Peers := NewRandomLedgerChannelProposal(rng, channeltest.WithNumParts(3))
+	validProp3Peers.Peers[2] = c.address // set us as the last proposee
+	proposer3Peers := validProp3Peers.Peers[0]
+
+	duplicatePeers := NewRandomLedgerChannelProposal(rng, channeltest.WithNumParts(3))
+	duplicatePeers.Peers[0] = c.address
+	duplicatePeers.Peers[2] = duplicatePeers.Peers[1]
+
 	invalidProp := &LedgerChannelProposal{}
 	*invalidProp = *validProp                // shallow copy
 	invalidProp.Base().ChallengeDuration = 0 // invalidate
@@ -52,38 +59,50 @@ func TestClient_validTwoPartyProposal(t *testing.T) {
 	tests := []struct {
 		prop     *LedgerChannelProposal
 		ourIdx   channel.Index
-		peerAddr wallet.Address
+		proposer wallet.Address
 		valid    bool
 	}{
 		{
 			validProp,
-			0, peerAddr, true,
+			0, c.address, true,
 		},
-		// test all three invalid combinations of peer address, index
+		// test all three invalid combinations of proposer address, index
 		{
 			validProp,
-			1, peerAddr, false, // wrong ourIdx
+			1, c.address, false, // wrong ourIdx
 		},
 		{
 			validProp,
-			0, c.address, false, // wrong peerAddr (ours)
+			0, peerAddr, false, // wrong proposer
 		},
 		{
 			validProp,
-			1, c.address, false, // wrong index, wrong peer address
+			1, peerAddr, false, // wrong index, wrong proposer
+		},
+		{
+			validProp3Peers, // valid proposal with three peers
+			2, proposer3Peers, true,
+		},
+		{
+			validProp3Peers,
+			1, proposer3Peers, false, // wrong ourIdx
+		},
+		{
+			validProp3Peers,
+			3, proposer3Peers, false, // out of range ourIdx
 		},
 		{
-			validProp3Peers, // valid proposal but three peers
-			0, peerAddr, false,
+			duplicatePeers, // duplicate peers
+			0, c.address, false,
 		},
 		{
 			invalidProp, // invalid proposal, correct other params
-			0, peerAddr, false,
+			0, c.address, false,
 		},
 	}
 
 	for i, tt := range tests {
-		valid := c.validTwoPartyProposal(tt.prop, tt.ourIdx, tt.peerAddr)
+		valid := c.validProposal(tt.prop, tt.ourIdx, tt.proposer)
 		if tt.valid && valid != nil {
 			t.Errorf("[%d] Exptected proposal to be valid but got: %v", i, valid)
 		} else if !tt.valid && valid == nil {
@@ -159,3 +178,24 @@ func NewRandomLedgerChannelProposal(rng *rand.Rand, opts ...channeltest.RandomOp
 		Peers:               peers,
 	}
 }
+
+func TestChannelProposalAccsSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for i := 0; i < 4; i++ {
+		var propID ProposalID
+		rng.Read(propID[:])
+		m := &msgChannelProposalAccs{
+			ProposalID: propID,
+			Accs:       make([]ChannelProposalAccept, 1+rng.Intn(4)),
+		}
+		for j := range m.Accs {
+			var nonceShare NonceShare
+			rng.Read(nonceShare[:])
+			m.Accs[j] = &LedgerChannelProposalAcc{
+				BaseChannelProposalAcc: makeBaseChannelProposalAcc(propID, nonceShare),
+				Participant:            wallettest.NewRandomAddress(rng),
+			}
+		}
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
@@ -56,6 +56,16 @@ func init() {
 			var m ChannelProposalRej
 			return &m, m.Decode(r)
 		})
+	wire.RegisterDecoder(wire.ChannelProposalAccs,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelProposalAccs
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.ChannelProposalCounter,
+		func(r io.Reader) (wire.Msg, error) {
+			var m ChannelProposalCounter
+			return &m, m.Decode(r)
+		})
 	wire.RegisterDecoder(wire.VirtualChannelProposal,
 		func(r io.Reader) (wire.Msg, error) {
 			m := VirtualChannelProposal{}
@@ -541,6 +551,105 @@ func (rej *ChannelProposalRej) Decode(r io.Reader) error {
 	return perunio.Decode(r, &rej.ProposalID, &rej.Reason)
 }
 
+// ChannelProposalCounter is used to answer a channel proposal with a
+// counter-proposal. The counter-proposal must only differ from the original
+// proposal in its initial balances, challenge duration, funding agreement and
+// nonce share.
+//
+// The message is a response in the Multi-Party Channel Proposal Protocol
+// (MPCPP). It is the proposer's choice whether to continue with the
+// counter-proposal.
+type ChannelProposalCounter struct {
+	ProposalID ProposalID      // The channel proposal to counter.
+	Proposal   ChannelProposal // The counter-proposal.
+}
+
+// Type returns wire.ChannelProposalCounter.
+func (ChannelProposalCounter) Type() wire.Type {
+	return wire.ChannelProposalCounter
+}
+
+// Encode encodes a ChannelProposalCounter into an io.Writer.
+func (m ChannelProposalCounter) Encode(w io.Writer) error {
+	if err := perunio.Encode(w, m.ProposalID); err != nil {
+		return err
+	}
+	return errors.WithMessage(wire.Encode(m.Proposal, w), "encoding counter-proposal")
+}
+
+// Decode decodes a ChannelProposalCounter from an io.Reader.
+func (m *ChannelProposalCounter) Decode(r io.Reader) error {
+	if err := perunio.Decode(r, &m.ProposalID); err != nil {
+		return err
+	}
+	msg, err := wire.Decode(r)
+	if err != nil {
+		return errors.WithMessage(err, "decoding counter-proposal")
+	}
+	prop, ok := msg.(ChannelProposal)
+	if !ok {
+		return errors.Errorf("counter-proposal is not a channel proposal: %v", msg.Type())
+	}
+	m.Proposal = prop
+	return nil
+}
+
+// msgChannelProposalAccs is sent by the proposer of a multi-party channel to
+// all proposees once every proposee accepted the proposal. It contains the
+// accept messages of all proposees, ordered by their participant index, so
+// that every participant can derive the channel parameters.
+type msgChannelProposalAccs struct {
+	ProposalID ProposalID              // The accepted channel proposal.
+	Accs       []ChannelProposalAccept // Accept messages of participants 1..n-1.
+}
+
+// Type returns wire.ChannelProposalAccs.
+func (msgChannelProposalAccs) Type() wire.Type {
+	return wire.ChannelProposalAccs
+}
+
+// Encode encodes a msgChannelProposalAccs into an io.Writer.
+func (m msgChannelProposalAccs) Encode(w io.Writer) error {
+	if len(m.Accs) > channel.MaxNumParts {
+		return errors.Errorf("expected at most %d accept messages, got %d",
+			channel.MaxNumParts, len(m.Accs))
+	}
+	if err := perunio.Encode(w, m.ProposalID, uint16(len(m.Accs))); err != nil {
+		return err
+	}
+	for i, acc := range m.Accs {
+		if err := wire.Encode(acc, w); err != nil {
+			return errors.WithMessagef(err, "encoding accept message %d", i)
+		}
+	}
+	return nil
+}
+
+// Decode decodes a msgChannelProposalAccs from an io.Reader.
+func (m *msgChannelProposalAccs) Decode(r io.Reader) error {
+	var numAccs uint16
+	if err := perunio.Decode(r, &m.ProposalID, &numAccs); err != nil {
+		return err
+	}
+	if numAccs > channel.MaxNumParts {
+		return errors.Errorf("expected at most %d accept messages, got %d",
+			channel.MaxNumParts, numAccs)
+	}
+	m.Accs = make([]ChannelProposalAccept, numAccs)
+	for i := range m.Accs {
+		msg, err := wire.Decode(r)
+		if err != nil {
+			return errors.WithMessagef(err, "decoding accept message %d", i)
+		}
+		acc, ok := msg.(ChannelProposalAccept)
+		if !ok {
+			return errors.Errorf("message %d is not an accept message: %v", i, msg.Type())
+		}
+		m.Accs[i] = acc
+	}
+	return nil
+}
+
 /*
 Virtual channels
 */
@@ -553,6 +662,10 @@ type (
 		Peers     []wire.Address    // Participants' wire addresses.
 		Parents   []channel.ID      // Parent channels for each participant.
 		IndexMaps [][]channel.Index // Index mapping for each participant in relation to the root channel.
+		// Hops are the ledger channels between consecutive intermediaries,
+		// ordered from the side of participant 0. It is empty if both parent
+		// channels share a single intermediary.
+		Hops []channel.ID
 	}
 
 	// VirtualChannelProposalAcc is the accept message type corresponding to
@@ -587,6 +700,7 @@ func NewVirtualChannelProposal(
 		Peers:               peers,
 		Parents:             parents,
 		IndexMaps:           indexMaps,
+		Hops:                union(opts...).hops(),
 	}
 	return
 }
@@ -600,6 +714,7 @@ func (p VirtualChannelProposal) Encode(w io.Writer) error {
 		wire.AddressesWithLen(p.Peers),
 		channelIDsWithLen(p.Parents),
 		indexMapsWithLen(p.IndexMaps),
+		channelIDsWithLen(p.Hops),
 	)
 }
 
@@ -612,6 +727,7 @@ func (p *VirtualChannelProposal) Decode(r io.Reader) error {
 		(*wire.AddressesWithLen)(&p.Peers),
 		(*channelIDsWithLen)(&p.Parents),
 		(*indexMapsWithLen)(&p.IndexMaps),
+		(*channelIDsWithLen)(&p.Hops),
 	)
 }
 
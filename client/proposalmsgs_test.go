@@ -201,6 +201,17 @@ func TestChannelProposalRejSerialization(t *testing.T) {
 	}
 }
 
+func TestChannelProposalCounterSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for i := 0; i < 16; i++ {
+		m := &client.ChannelProposalCounter{
+			ProposalID: newRandomProposalID(rng),
+			Proposal:   clienttest.NewRandomLedgerChannelProposal(rng),
+		}
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
+
 func TestSubChannelProposalSerialization(t *testing.T) {
 	rng := pkgtest.Prng(t)
 	const repeatRandomizedTest = 16
@@ -27,7 +27,7 @@ import (
 // NoData is set, and a random nonce share is generated.
 type ProposalOpts map[string]interface{}
 
-var optNames = struct{ nonce, app, appData, fundingAgreement string }{nonce: "nonce", app: "app", appData: "appData", fundingAgreement: "fundingAgreement"}
+var optNames = struct{ nonce, app, appData, fundingAgreement, hops string }{nonce: "nonce", app: "app", appData: "appData", fundingAgreement: "fundingAgreement", hops: "hops"}
 
 // App returns the option's configured app.
 func (o ProposalOpts) App() channel.App {
@@ -66,6 +66,14 @@ func (o ProposalOpts) fundingAgreement() channel.Balances {
 	return a.(channel.Balances)
 }
 
+// hops returns the intermediary ledger channels set by `WithHops`, or nil.
+func (o ProposalOpts) hops() []channel.ID {
+	if v := o[optNames.hops]; v != nil {
+		return v.([]channel.ID)
+	}
+	return nil
+}
+
 // nonce returns the option's configured nonce share, or a random nonce share.
 func (o ProposalOpts) nonce() NonceShare {
 	n, ok := o[optNames.nonce]
@@ -129,3 +137,11 @@ func WithApp(app channel.App, initData channel.Data) ProposalOpts {
 func WithoutApp() ProposalOpts {
 	return WithApp(channel.NoApp(), channel.NoData())
 }
+
+// WithHops configures the ledger channels between consecutive intermediaries
+// of a virtual channel, ordered from the side of the first participant. It is
+// only needed if the virtual channel is routed over more than one
+// intermediary.
+func WithHops(hops ...channel.ID) ProposalOpts {
+	return ProposalOpts{optNames.hops: hops}
+}
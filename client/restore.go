@@ -18,6 +18,7 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/channel/persistence"
@@ -63,13 +64,24 @@ func (c *Client) reconstructChannel(
 	}
 
 	chans[pch.ID()] = ch
+
+	// A virtual channel whose funding we forwarded is linked to its next hop,
+	// so that its settlement can be forwarded as well.
+	if pch.NextHop != nil {
+		if next, ok := db[*pch.NextHop]; ok {
+			ch.virtualNextHop = c.reconstructChannel(channelFromSource, next, db, chans)
+		} else {
+			c.logChan(pch.ID()).Warnf("Next hop %x not found.", *pch.NextHop)
+		}
+	}
 	return ch
 }
 
-func (c *Client) restorePeerChannels(ctx context.Context, p wire.Address) (err error) {
+// loadPeerChannels loads the persisted channels that are shared with peer p.
+func (c *Client) loadPeerChannels(ctx context.Context, p wire.Address) (db map[channel.ID]*persistence.Channel, err error) {
 	it, err := c.pr.RestorePeer(p)
 	if err != nil {
-		return errors.WithMessagef(err, "restoring channels for peer: %v", err)
+		return nil, errors.WithMessagef(err, "restoring channels for peer: %v", err)
 	}
 	defer func() {
 		if cerr := it.Close(); cerr != nil {
@@ -77,23 +89,179 @@ func (c *Client) restorePeerChannels(ctx context.Context, p wire.Address) (err e
 		}
 	}()
 
-	db := make(map[channel.ID]*persistence.Channel)
+	db = make(map[channel.ID]*persistence.Channel)
 
-	// Serially restore channels. We might change this to parallel restoring once
-	// we initiate the sync protocol from here again.
+	// Serially restore channels.
 	for it.Next(ctx) {
 		chdata := it.Channel()
 		db[chdata.ID()] = chdata
 	}
 
-	if err := it.Close(); err != nil {
+	return db, it.Close()
+}
+
+// restoreChannels restores the loaded channels of all peers. Each channel is
+// restored once, even if it is shared with several peers, so that its funding,
+// deposit or withdrawal is only resumed once.
+func (c *Client) restoreChannels(ctx context.Context, db map[channel.ID]*persistence.Channel) error {
+	// Channels with an interrupted update are synchronized with the peers in
+	// parallel before their controllers are reconstructed. Staged deposits
+	// and authorized withdrawals are signed by all participants and are
+	// completed instead.
+	var eg errgroup.Group
+	var deposits []channel.ID
+	withdrawals := make(map[channel.ID]channel.Index)
+	for _, chdata := range db {
+		if chdata.PhaseV != channel.Signing {
+			continue
+		}
+		if isDeposit(chdata.CurrentTXV.State, chdata.StagingTXV) {
+			deposits = append(deposits, chdata.ID())
+			continue
+		}
+		if idx, ok := isWithdrawal(chdata.CurrentTXV.State, chdata.StagingTXV); ok && len(chdata.WithdrawalAuthSigs) > 0 {
+			withdrawals[chdata.ID()] = idx
+			continue
+		}
+		chdata := chdata
+		eg.Go(func() error {
+			return errors.WithMessagef(c.syncChannel(ctx, chdata), "syncing channel %x", chdata.ID())
+		})
+	}
+	if err := eg.Wait(); err != nil {
 		return err
 	}
 
+	// Ledger channels that were not completely funded are funded in the
+	// background. They are published once the funding succeeded.
+	for id, chdata := range db {
+		if chdata.PhaseV > channel.Funding || chdata.Parent != nil {
+			continue
+		}
+		delete(db, id)
+		go func(chdata *persistence.Channel) {
+			if err := c.resumeFunding(c.Ctx(), chdata); err != nil {
+				c.logChan(chdata.ID()).Errorf("Resuming funding: %v", err)
+			}
+		}(chdata)
+	}
+
 	c.restoreChannelCollection(db, clientChannelFromSource)
+	for _, id := range deposits {
+		if ch, ok := c.channels.Channel(id); ok {
+			ch.machMtx.Lock()
+			ch.resumeDeposit()
+			ch.machMtx.Unlock()
+		}
+	}
+	for id, idx := range withdrawals {
+		ch, ok := c.channels.Channel(id)
+		if !ok {
+			continue
+		}
+		if err := ch.restoreWithdrawal(idx, db[id].WithdrawalAuthSigs); err != nil {
+			ch.Log().Errorf("Restoring withdrawal: %v", err)
+			continue
+		}
+		ch.machMtx.Lock()
+		ch.resumeWithdrawal()
+		ch.machMtx.Unlock()
+	}
+	return nil
+}
+
+// resumeFunding resumes the funding of a ledger channel that was restored in
+// the InitSigning or Funding phase. The funding is idempotent, so funds that
+// were already deposited are not deposited again.
+//
+// If the initial state was not signed by all participants, no funds can have
+// been deposited and the channel is discarded. The funding is only resumed if
+// the funding agreement was persisted, see persistence.FundingPersister. If any
+// peer does not fund in time, the deposited funds are reclaimed by a dispute.
+//
+// It is important that the passed context does not cancel before twice the
+// ChallengeDuration has passed, or the channel cannot be settled if a peer
+// times out funding.
+func (c *Client) resumeFunding(ctx context.Context, pch *persistence.Channel) error {
+	log := c.logChan(pch.ID())
+	if pch.PhaseV == channel.InitSigning && !fullySigned(pch.StagingTXV) {
+		log.Warn("Discarding restored channel without signed initial state.")
+		return errors.WithMessage(c.pr.ChannelRemoved(ctx, pch.ID()), "removing channel")
+	}
+	if pch.FundingAgreement == nil {
+		return errors.New("funding agreement not persisted, cannot resume funding")
+	}
+	if pch.PhaseV == channel.InitSigning {
+		// The initial state was signed by everyone, but not yet enabled.
+		pch.CurrentTXV, pch.StagingTXV = pch.StagingTXV, channel.Transaction{}
+		pch.PhaseV = channel.Funding
+		if err := c.pr.Enabled(ctx, pch); err != nil {
+			return errors.WithMessage(err, "persisting enabled initial state")
+		}
+	}
+
+	ch, err := c.channelFromSource(pch, nil, pch.PeersV...)
+	if err != nil {
+		return errors.WithMessage(err, "reconstructing channel")
+	}
+	log.Info("Resuming funding of restored channel...")
+
+	err = c.fundLedgerChannel(ctx, ch, pch.FundingAgreement)
+	if channel.IsFundingTimeoutError(err) {
+		log.Warnf("Peers did not fund restored channel, reclaiming funds: %v", err)
+		if rerr := ch.reclaimFunds(ctx); rerr != nil {
+			err = errors.WithMessagef(err, "reclaiming funds: %v", rerr)
+		}
+	}
+	if err != nil {
+		if cerr := ch.Close(); cerr != nil {
+			log.Warnf("Closing channel: %v", cerr)
+		}
+		return err
+	}
+	log.Info("Restored channel funded.")
 	return nil
 }
 
+// reclaimFunds reclaims the funds deposited into a ledger channel whose funding
+// timed out. Like the user of a channel returned by ProposeChannel with a
+// FundingTimeoutError, it starts watching the channel, so that an older state
+// registered by a peer is refuted, and then settles it.
+func (c *Channel) reclaimFunds(ctx context.Context) error {
+	_, eventsSub, err := c.startWatching()
+	if err != nil {
+		return errors.WithMessage(err, "starting watcher")
+	}
+	go func() {
+		if err := c.handleEvents(eventsSub, reclaimEventHandler{c}); err != nil {
+			c.Log().Warnf("Handling events from watcher: %v", err)
+		}
+	}()
+	return c.Settle(ctx, false)
+}
+
+// reclaimEventHandler logs the adjudicator events of a channel whose funds are
+// reclaimed after a funding timeout.
+type reclaimEventHandler struct{ ch *Channel }
+
+func (h reclaimEventHandler) HandleAdjudicatorEvent(e channel.AdjudicatorEvent) {
+	h.ch.Log().Infof("Adjudicator event while reclaiming funds: %v", e)
+}
+
+// fullySigned returns whether the transaction contains the signatures of all
+// participants.
+func fullySigned(tx channel.Transaction) bool {
+	if tx.State == nil || len(tx.Sigs) != tx.NumParts() {
+		return false
+	}
+	for _, sig := range tx.Sigs {
+		if sig == nil {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Client) restoreChannelCollection(
 	db map[channel.ID]*persistence.Channel,
 	channelFromSource channelFromSourceSig) {
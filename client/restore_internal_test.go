@@ -74,6 +74,18 @@ func TestReconstructChannel(t *testing.T) {
 		parent := c.reconstructChannel(patchChFromSource, restParent, db, chans)
 		assert.Same(t, child.parent, parent)
 	})
+	t.Run("next hop", func(t *testing.T) {
+		restNext := mkRndChan(rng)
+		db[restNext.ID()] = restNext
+		virtual := *restChild
+		virtual.NextHop = new(channel.ID)
+		*virtual.NextHop = restNext.ID()
+
+		chans := map[channel.ID]*Channel{}
+		child := c.reconstructChannel(patchChFromSource, &virtual, db, chans)
+		next := c.reconstructChannel(patchChFromSource, restNext, db, chans)
+		assert.Same(t, child.virtualNextHop, next)
+	})
 }
 
 func TestRestoreChannelCollection(t *testing.T) {
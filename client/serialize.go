@@ -16,6 +16,7 @@ package client
 
 import (
 	"io"
+	"math"
 
 	"github.com/pkg/errors"
 	"perun.network/go-perun/channel"
@@ -27,6 +28,7 @@ type (
 	channelIDsWithLen []channel.ID
 	indexMapWithLen   []channel.Index
 	indexMapsWithLen  [][]channel.Index
+	bytesWithLen      []byte
 )
 
 // Encode encodes the object to the writer.
@@ -52,6 +54,10 @@ func (a *channelIDsWithLen) Decode(r io.Reader) (err error) {
 		return errors.WithMessage(err, "decoding length")
 	}
 
+	if l == 0 {
+		*a = nil // Empty lists are encoded and decoded as nil.
+		return
+	}
 	*a = make(channelIDsWithLen, l)
 	for i := range *a {
 		var id channel.ID
@@ -130,3 +136,25 @@ func (a *indexMapWithLen) Decode(r io.Reader) (err error) {
 	}
 	return
 }
+
+// Encode encodes the object to the writer.
+func (a bytesWithLen) Encode(w io.Writer) error {
+	if len(a) > math.MaxUint16 {
+		return errors.Errorf("byte slice too long: %d", len(a))
+	}
+	if err := perunio.Encode(w, sliceLen(len(a))); err != nil || len(a) == 0 {
+		return err
+	}
+	return perunio.Encode(w, []byte(a))
+}
+
+// Decode decodes the object from the reader.
+func (a *bytesWithLen) Decode(r io.Reader) error {
+	var l sliceLen
+	if err := perunio.Decode(r, &l); err != nil {
+		return errors.WithMessage(err, "decoding length")
+	}
+
+	*a = make(bytesWithLen, l)
+	return perunio.Decode(r, (*[]byte)(a))
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	ctest "perun.network/go-perun/client/test"
+	wtest "perun.network/go-perun/wallet/test"
+	"perun.network/go-perun/watcher/local"
+	"perun.network/go-perun/wire"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+// simReplayEnv is the environment variable that enables the replay tests of
+// simulations. They are not run by default, because the simulation detects
+// quiescence heuristically with real-time delays and clients use real-time
+// contexts, so that replays may diverge on slow or loaded machines.
+const simReplayEnv = "PERUN_TEST_SIM_REPLAY"
+
+func TestSimulation_Dispute(t *testing.T) {
+	seed := pkgtest.Prng(t).Int63()
+	net := ctest.NetworkConfig{MinDelay: 10 * time.Millisecond, MaxDelay: 500 * time.Millisecond}
+	runSimulatedDispute(t, seed, net)
+}
+
+func TestSimulation_DisputeReplay(t *testing.T) {
+	if os.Getenv(simReplayEnv) == "" {
+		t.Skipf("set %s to run simulation replay tests", simReplayEnv)
+	}
+	seed := pkgtest.Prng(t).Int63()
+	net := ctest.NetworkConfig{MinDelay: 10 * time.Millisecond, MaxDelay: 500 * time.Millisecond}
+
+	trace := runSimulatedDispute(t, seed, net)
+	assert.Equal(t, trace, runSimulatedDispute(t, seed, net), "replaying seed %d", seed)
+}
+
+// runSimulatedDispute runs a scenario in which Bob registers an outdated
+// state, Alice's watcher refutes it and Alice settles the channel after the
+// challenge duration elapsed on the virtual clock. It returns the trace of the
+// simulation.
+func runSimulatedDispute(t *testing.T, seed int64, net ctest.NetworkConfig) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+
+	sim := ctest.NewSimulation(seed)
+	rng := sim.Rand("setup")
+	bus := ctest.NewSimBus(sim, net)
+	backend := ctest.NewMockBackend(sim.Rand("backend"), ctest.WithSimulation(sim))
+	simCtx, stopSim := context.WithCancel(ctx)
+	simDone := make(chan struct{})
+	go func() {
+		defer close(simDone)
+		sim.Run(simCtx) //nolint:errcheck
+	}()
+
+	newClient := func() (*client.Client, wire.Address, wtest.Wallet) {
+		w, err := local.NewWatcher(backend)
+		require.NoError(t, err)
+		wallet := wtest.NewWallet()
+		id := wtest.NewRandomAccount(rng).Address()
+		c, err := client.New(id, bus, backend, backend, wallet, w)
+		require.NoError(t, err)
+		return c, id, wallet
+	}
+	alice, aliceID, aliceWallet := newClient()
+	defer alice.Close()
+	bob, bobID, bobWallet := newClient()
+	defer bob.Close()
+
+	bobChs := make(chan *client.Channel, 1)
+	bobAcc := bobWallet.NewRandomAccount(rng).Address()
+	go bob.Handle(
+		client.ProposalHandlerFunc(func(p client.ChannelProposal, r *client.ProposalResponder) {
+			accept := p.(*client.LedgerChannelProposal).Accept(bobAcc, client.WithNonceFrom(sim.Rand("nonce/bob")))
+			ch, err := r.Accept(ctx, accept)
+			assert.NoError(t, err)
+			bobChs <- ch
+		}),
+		client.UpdateHandlerFunc(func(_ *channel.State, _ client.ChannelUpdate, r *client.UpdateResponder) {
+			assert.NoError(t, r.Accept(ctx))
+		}),
+	)
+
+	// Alice opens a channel and sends three payments to Bob.
+	asset := chtest.NewRandomAsset(rng)
+	alloc := channel.NewAllocation(2, asset)
+	alloc.SetAssetBalances(asset, []*big.Int{big.NewInt(10), big.NewInt(10)})
+	aliceAcc := aliceWallet.NewRandomAccount(rng).Address()
+	prop, err := client.NewLedgerChannelProposal(60, aliceAcc, alloc, []wire.Address{aliceID, bobID},
+		client.WithNonceFrom(sim.Rand("nonce/alice")))
+	require.NoError(t, err)
+	ch, err := alice.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	bobCh := <-bobChs
+	outdated := client.NewTestChannel(bobCh).AdjudicatorReq()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ch.Update(ctx, func(s *channel.State) error {
+			s.Balances[0][0].Sub(s.Balances[0][0], big.NewInt(1))
+			s.Balances[0][1].Add(s.Balances[0][1], big.NewInt(1))
+			return nil
+		}))
+	}
+
+	// Bob registers the initial state, which is refuted by Alice's watcher.
+	// Alice can only settle after the challenge duration elapsed.
+	require.NoError(t, backend.Register(ctx, outdated, nil))
+	start := sim.Now()
+	require.NoError(t, ch.Settle(ctx, false))
+	assert.GreaterOrEqual(t, sim.Now().Sub(start), 60*time.Second)
+	assert.Equal(t, big.NewInt(7), backend.Balance(aliceAcc, asset))
+	assert.Equal(t, big.NewInt(13), backend.Balance(bobAcc, asset))
+
+	stopSim()
+	<-simDone
+	return sim.Trace()
+}
+
+func TestSimBus(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	sender, recipient := wtest.NewRandomAddress(rng), wtest.NewRandomAddress(rng)
+
+	// run publishes n messages on a bus with the given configuration and
+	// returns the received messages and the trace of the simulation.
+	run := func(t *testing.T, net ctest.NetworkConfig, n int, disconnect bool) ([]*wire.Envelope, []string) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		sim := ctest.NewSimulation(rng.Int63())
+		bus := ctest.NewSimBus(sim, net)
+		recv := wire.NewReceiver()
+		defer recv.Close()
+		require.NoError(t, bus.SubscribeClient(recv, recipient))
+		if disconnect {
+			bus.Disconnect(recipient)
+		}
+		for i := 0; i < n; i++ {
+			env := &wire.Envelope{Sender: sender, Recipient: recipient, Msg: wire.NewPingMsg()}
+			require.NoError(t, bus.Publish(ctx, env))
+		}
+
+		go sim.Run(ctx) //nolint:errcheck
+		var envs []*wire.Envelope
+		for len(sim.Trace()) < n {
+			time.Sleep(10 * time.Millisecond)
+		}
+		for {
+			recvCtx, recvCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			env, err := recv.Next(recvCtx)
+			recvCancel()
+			if err != nil {
+				return envs, sim.Trace()
+			}
+			envs = append(envs, env)
+		}
+	}
+
+	t.Run("delay", func(t *testing.T) {
+		envs, trace := run(t, ctest.NetworkConfig{MinDelay: time.Second, MaxDelay: time.Minute}, 10, false)
+		assert.Len(t, envs, 10)
+		assert.Len(t, trace, 10)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		envs, trace := run(t, ctest.NetworkConfig{DropRate: 1}, 3, false)
+		assert.Empty(t, envs)
+		for _, e := range trace {
+			assert.Contains(t, e, "drop")
+		}
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		envs, _ := run(t, ctest.NetworkConfig{DuplicateRate: 1}, 3, false)
+		assert.Len(t, envs, 6)
+	})
+
+	t.Run("disconnected", func(t *testing.T) {
+		envs, trace := run(t, ctest.NetworkConfig{}, 3, true)
+		assert.Empty(t, envs)
+		for _, e := range trace {
+			assert.Contains(t, e, "recipient disconnected")
+		}
+	})
+}
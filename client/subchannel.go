@@ -71,14 +71,10 @@ func (c *Channel) withdrawSubChannelIntoParent(ctx context.Context) error {
 	case proposerIdx:
 		err := c.Parent().withdrawSubChannel(ctx, c)
 		return errors.WithMessage(err, "updating parent channel")
-	case proposeeIdx:
+	default:
 		err := c.Parent().awaitSubChannelWithdrawal(ctx, c.ID())
 		return errors.WithMessage(err, "awaiting parent channel update")
-	default:
-		c.Log().Panic("invalid participant index")
 	}
-
-	return nil
 }
 
 // withdrawSubChannel updates c so that the sub-channel allocation for
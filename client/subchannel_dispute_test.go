@@ -28,6 +28,16 @@ import (
 )
 
 func TestSubChannelDispute(t *testing.T) {
+	t.Run("sub-channel", func(t *testing.T) {
+		testSubChannelDispute(t, [2]*big.Int{})
+	})
+	t.Run("sub-sub-channel", func(t *testing.T) {
+		testSubChannelDispute(t, [2]*big.Int{big.NewInt(5), big.NewInt(5)})
+	})
+}
+
+func testSubChannelDispute(t *testing.T, subSubChannelFunds [2]*big.Int) {
+	t.Helper()
 	rng := test.Prng(t)
 
 	setups := NewSetups(rng, []string{"DisputeSusie", "DisputeTim"})
@@ -43,9 +53,10 @@ func TestSubChannelDispute(t *testing.T) {
 		client.WithoutApp(),
 	)
 	cfg := &ctest.DisputeSusieTimExecConfig{
-		BaseExecConfig:  baseCfg,
-		SubChannelFunds: [2]*big.Int{big.NewInt(10), big.NewInt(10)},
-		TxAmount:        big.NewInt(1),
+		BaseExecConfig:     baseCfg,
+		SubChannelFunds:    [2]*big.Int{big.NewInt(10), big.NewInt(10)},
+		SubSubChannelFunds: subSubChannelFunds,
+		TxAmount:           big.NewInt(1),
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
@@ -16,7 +16,6 @@ package client
 
 import (
 	"context"
-	"log"
 	"time"
 
 	"github.com/pkg/errors"
@@ -32,7 +31,14 @@ var syncReplyTimeout = 10 * time.Second
 // exists, it just sends the current channel data to the requester. If the
 // own channel is in the Signing phase, the ongoing update is discarded so that
 // the channel is reverted to the Acting phase.
+//
+// Replies to sync requests are ignored because they are received by the
+// requester's synchronization routine.
 func (c *Client) handleSyncMsg(peer wire.Address, msg *msgChannelSync) {
+	if msg.IsReply {
+		return
+	}
+
 	log := c.logChan(msg.ID()).WithField("peer", peer)
 	ch, ok := c.channels.Channel(msg.ID())
 	if !ok {
@@ -45,10 +51,11 @@ func (c *Client) handleSyncMsg(peer wire.Address, msg *msgChannelSync) {
 	// Lock machine while replying to sync request.
 	if !ch.machMtx.TryLockCtx(ctx) {
 		log.Errorf("Could not lock machine mutex in time: %v", ctx.Err())
+		return
 	}
 	defer ch.machMtx.Unlock()
 
-	syncMsg := newChannelSyncMsg(persistence.CloneSource(ch.machine))
+	syncMsg := newChannelSyncMsg(persistence.CloneSource(ch.machine), true)
 	if err := c.conn.pubMsg(ctx, syncMsg, peer); err != nil {
 		log.Error("Error sending sync reply: ", err)
 		return
@@ -56,22 +63,29 @@ func (c *Client) handleSyncMsg(peer wire.Address, msg *msgChannelSync) {
 	cancel() // can already release context resourcers
 
 	// Revert ongoing update since this is how synchronization is currently
-	// implemented... the peer will do the same.
-	if ch.machine.Phase() == channel.Signing {
+	// implemented... the peer will do the same. An authorized withdrawal is
+	// kept, because it may already have been executed on-chain.
+	authorized := ch.withdrawal != nil && fullySigned(ch.machine.StagingTX())
+	if ch.machine.Phase() == channel.Signing && !authorized {
 		// The passed context is used for persistence, so use client life-time context
 		if err := ch.machine.DiscardUpdate(c.Ctx()); err != nil {
 			log.Error("Error discarding update: ", err)
 		}
+		if ch.pipeline != nil {
+			ch.pipeline.abort(errors.New("update discarded by channel sync"))
+		}
 	}
 }
 
-// syncChannel synchronizes the channel state with the given peer and modifies
-// the current state if required.
-// nolint:unused
-func (c *Client) syncChannel(ctx context.Context, ch *persistence.Channel, p wire.Address) (err error) {
+// syncChannel synchronizes the restored channel data with all reachable peers,
+// adopts a newer fully-signed current transaction and persists the result.
+// Peers that do not reply within the sync reply timeout or send invalid data
+// are skipped.
+func (c *Client) syncChannel(ctx context.Context, ch *persistence.Channel) (err error) {
 	recv := wire.NewReceiver()
 	defer recv.Close() // ignore error
 	id := ch.ID()
+	log := c.logChan(id)
 	err = c.conn.Subscribe(recv, func(m *wire.Envelope) bool {
 		return m.Msg.Type() == wire.ChannelSync && m.Msg.(ChannelMsg).ID() == id
 	})
@@ -79,44 +93,91 @@ func (c *Client) syncChannel(ctx context.Context, ch *persistence.Channel, p wir
 		return errors.WithMessage(err, "subscribing on relay")
 	}
 
-	sendError := make(chan error, 1)
+	peers := make([]wire.Address, 0, len(ch.PeersV))
+	for i, p := range ch.PeersV {
+		if channel.Index(i) != ch.Idx() {
+			peers = append(peers, p)
+		}
+	}
+
+	// Pipelined states are signed independently of their predecessors, so
+	// the newest fully signed staged state can be adopted.
+	adoptSignedStaged(ch)
+
+	syncCtx, cancel := context.WithTimeout(ctx, syncReplyTimeout)
+	defer cancel()
 	// syncMsg needs to be a clone so that there's no data race when updating the
 	// own channel data later.
-	syncMsg := newChannelSyncMsg(persistence.CloneSource(ch))
-	go func() { sendError <- c.conn.pubMsg(ctx, syncMsg, p) }()
-	defer func() {
-		// When returning, either log the send error, or return it.
-		sendErr := <-sendError
-		if err == nil {
-			err = errors.WithMessage(sendErr, "sending sync message")
-		} else if err != nil && sendErr != nil {
-			c.logChan(id).Errorf("Error sending sync message: %v", sendErr)
+	syncMsg := newChannelSyncMsg(persistence.CloneSource(ch), false)
+	for _, p := range peers {
+		go func(p wire.Address) {
+			if err := c.conn.pubMsg(syncCtx, syncMsg, p); err != nil {
+				log.WithField("peer", p).Warnf("Error sending sync message: %v", err)
+			}
+		}(p)
+	}
+
+	// Receive sync messages of all reachable peers.
+	received := make([]bool, len(ch.PeersV))
+	received[ch.Idx()] = true
+	for numMissing := len(peers); numMissing > 0; {
+		env, err := recv.Next(syncCtx)
+		if err != nil {
+			log.Warnf("Synchronized with %d of %d peers: %v", len(peers)-numMissing, len(peers), err)
+			break
 		}
-	}()
+		idx := wire.IndexOfAddr(ch.PeersV, env.Sender)
+		if idx < 0 || received[idx] {
+			log.WithField("peer", env.Sender).Warn("received unexpected sync message")
+			continue
+		}
+		received[idx] = true
+		numMissing--
 
-	// Receive sync message.
-	env, err := recv.Next(ctx)
-	if err != nil {
-		return errors.WithMessage(err, "receiving sync message")
+		msg, ok := env.Msg.(*msgChannelSync)
+		if !ok {
+			log.Panic("internal error: wrong message type")
+		}
+		// Validate sync message.
+		if err := validateMessage(ch, msg); err != nil {
+			log.WithField("peer", env.Sender).Warnf("Invalid sync message: %v", err)
+			continue
+		}
+		// Merge restored state with received state.
+		if msg.CurrentTX.Version > ch.CurrentTXV.Version {
+			ch.CurrentTXV = msg.CurrentTX
+		}
 	}
-	msg, ok := env.Msg.(*msgChannelSync)
-	if !ok {
-		log.Panic("internal error: wrong message type")
+
+	if err := revisePhase(ch); err != nil {
+		return err
 	}
-	// Validate sync message.
-	if err := validateMessage(ch, msg); err != nil {
-		return errors.WithMessage(err, "invalid message")
+	if err := c.pr.Enabled(ctx, ch); err != nil {
+		return errors.WithMessage(err, "persisting synchronized channel")
 	}
-	// Merge restored state with received state.
-	if msg.CurrentTX.Version > ch.CurrentTXV.Version {
-		ch.CurrentTXV = msg.CurrentTX
+	if pr, ok := c.pr.(persistence.PipelinePersister); ok {
+		return errors.WithMessage(pr.Pipelined(ctx, ch), "persisting synchronized channel")
 	}
+	return nil
+}
 
-	return revisePhase(ch)
+// adoptSignedStaged makes the newest staging or pipelined transaction that is
+// signed by all participants the current transaction of a restored channel.
+func adoptSignedStaged(ch *persistence.Channel) {
+	if ch.PhaseV != channel.Signing {
+		return
+	}
+	txs := append([]channel.Transaction{ch.StagingTXV}, ch.PipelinedTXsV...)
+	for i := len(txs) - 1; i >= 0; i-- {
+		if fullySigned(txs[i]) && txs[i].Version > ch.CurrentTXV.Version {
+			ch.CurrentTXV = txs[i]
+			return
+		}
+	}
 }
 
 // validateMessage validates the remote channel sync message.
-// nolint:unused, nestif
+// nolint:nestif
 func validateMessage(ch *persistence.Channel, msg *msgChannelSync) error {
 	v := ch.CurrentTX().Version
 	mv := msg.CurrentTX.Version
@@ -146,7 +207,9 @@ func validateMessage(ch *persistence.Channel, msg *msgChannelSync) error {
 	return nil
 }
 
-// nolint:unused
+// revisePhase reverts a restored channel from the Signing phase to the Acting
+// or Final phase, depending on its current transaction. The staging
+// transaction is discarded.
 func revisePhase(ch *persistence.Channel) error {
 	//nolint:gocritic
 	if ch.PhaseV <= channel.Funding && ch.CurrentTXV.Version == 0 {
@@ -161,9 +224,12 @@ func revisePhase(ch *persistence.Channel) error {
 	}
 
 	// Reset potential Signing phase
+	ch.StagingTXV = channel.Transaction{}
+	ch.PipelinedTXsV = nil
 	if ch.CurrentTXV.IsFinal {
 		ch.PhaseV = channel.Final
+	} else {
+		ch.PhaseV = channel.Acting
 	}
-	ch.PhaseV = channel.Acting
 	return nil
 }
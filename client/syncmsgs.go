@@ -33,14 +33,16 @@ func init() {
 type msgChannelSync struct {
 	Phase     channel.Phase       // Phase is the phase of the sender.
 	CurrentTX channel.Transaction // CurrentTX is the sender's current transaction.
+	IsReply   bool                // IsReply is set if the message answers a sync request.
 }
 
 var _ ChannelMsg = (*msgChannelSync)(nil)
 
-func newChannelSyncMsg(s channel.Source) *msgChannelSync {
+func newChannelSyncMsg(s channel.Source, isReply bool) *msgChannelSync {
 	return &msgChannelSync{
 		Phase:     s.Phase(),
 		CurrentTX: s.CurrentTX(),
+		IsReply:   isReply,
 	}
 }
 
@@ -48,14 +50,16 @@ func newChannelSyncMsg(s channel.Source) *msgChannelSync {
 func (m *msgChannelSync) Encode(w io.Writer) error {
 	return perunio.Encode(w,
 		m.Phase,
-		m.CurrentTX)
+		m.CurrentTX,
+		m.IsReply)
 }
 
 // Decode implements perunio.Decode.
 func (m *msgChannelSync) Decode(r io.Reader) error {
 	return perunio.Decode(r,
 		&m.Phase,
-		&m.CurrentTX)
+		&m.CurrentTX,
+		&m.IsReply)
 }
 
 // ID returns the channel's ID.
@@ -37,8 +37,20 @@ type (
 		latestEvents map[channel.ID]channel.AdjudicatorEvent
 		eventSubs    map[channel.ID][]*mockSubscription
 		balances     map[addressMapKey]map[assetMapKey]*big.Int
+		// withdrawals holds the version of the latest partial withdrawal of
+		// each channel.
+		withdrawals map[channel.ID]uint64
+
+		// sim is the simulation whose virtual clock is used for funding
+		// delays and dispute timeouts. If it is nil, funding sleeps for a
+		// random real time and all timeouts are elapsed immediately.
+		sim        *Simulation
+		fundCounts map[channel.Index]int // Number of Fund calls per participant.
 	}
 
+	// MockBackendOpt represents an optional argument for the mock backend.
+	MockBackendOpt func(*MockBackend)
+
 	rng interface {
 		Intn(n int) int
 	}
@@ -53,13 +65,30 @@ type (
 const fundMaxSleepMs = 100
 
 // NewMockBackend creates a new backend object.
-func NewMockBackend(rng *rand.Rand) *MockBackend {
-	return &MockBackend{
+func NewMockBackend(rng *rand.Rand, opts ...MockBackendOpt) *MockBackend {
+	b := &MockBackend{
 		log:          log.Default(),
 		rng:          newThreadSafePrng(rng),
 		latestEvents: make(map[channel.ID]channel.AdjudicatorEvent),
 		eventSubs:    make(map[channel.ID][]*mockSubscription),
 		balances:     make(map[string]map[string]*big.Int),
+		withdrawals:  make(map[channel.ID]uint64),
+		fundCounts:   make(map[channel.Index]int),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithSimulation lets the backend follow the virtual clock of the given
+// simulation. Funding takes a random virtual time, which is derived from the
+// seed of the simulation, and registered or progressed states can only be
+// withdrawn after the challenge duration of the channel elapsed on the
+// virtual clock.
+func WithSimulation(sim *Simulation) MockBackendOpt {
+	return func(b *MockBackend) {
+		b.sim = sim
 	}
 }
 
@@ -78,12 +107,38 @@ func (g *threadSafeRng) Intn(n int) int {
 }
 
 // Fund funds the channel.
-func (b *MockBackend) Fund(_ context.Context, req channel.FundingReq) error {
-	time.Sleep(time.Duration(b.rng.Intn(fundMaxSleepMs+1)) * time.Millisecond)
+func (b *MockBackend) Fund(ctx context.Context, req channel.FundingReq) error {
+	if b.sim == nil {
+		time.Sleep(time.Duration(b.rng.Intn(fundMaxSleepMs+1)) * time.Millisecond)
+	} else if err := b.simulateFunding(ctx, req.Idx); err != nil {
+		return err
+	}
 	b.log.Infof("Funding: %+v", req)
 	return nil
 }
 
+// simulateFunding waits for a random virtual time. The randomness is derived
+// from the participant index and the number of its previous fundings, so that
+// it does not depend on the order of concurrent calls.
+func (b *MockBackend) simulateFunding(ctx context.Context, idx channel.Index) error {
+	b.mu.Lock()
+	n := b.fundCounts[idx]
+	b.fundCounts[idx]++
+	b.mu.Unlock()
+
+	rng := b.sim.Rand(fmt.Sprintf("fund/%d/%d", idx, n))
+	return b.sim.Sleep(ctx, time.Duration(rng.Intn(fundMaxSleepMs+1))*time.Millisecond)
+}
+
+// timeout returns the timeout of a dispute of a channel with the given
+// parameters, which starts now.
+func (b *MockBackend) timeout(params *channel.Params) channel.Timeout {
+	if b.sim == nil {
+		return &channel.ElapsedTimeout{}
+	}
+	return b.sim.Timeout(time.Duration(params.ChallengeDuration) * time.Second)
+}
+
 // Register registers the channel.
 func (b *MockBackend) Register(_ context.Context, req channel.AdjudicatorReq, subChannels []channel.SignedState) error {
 	b.log.Infof("Register: %+v", req)
@@ -107,6 +162,9 @@ func (b *MockBackend) Register(_ context.Context, req channel.AdjudicatorReq, su
 	if err := b.checkStates(states, checkRegister); err != nil {
 		return err
 	}
+	if v, ok := b.withdrawals[ch]; ok && req.Tx.Version < v {
+		return fmt.Errorf("invalid version: expected >=%v (partial withdrawal), got %v", v, req.Tx.Version)
+	}
 
 	channels := append([]channel.SignedState{
 		{
@@ -121,7 +179,7 @@ func (b *MockBackend) Register(_ context.Context, req channel.AdjudicatorReq, su
 			ch.Params.ID(),
 			channel.NewRegisteredEvent(
 				ch.Params.ID(),
-				&channel.ElapsedTimeout{},
+				b.timeout(ch.Params),
 				ch.State.Version,
 				ch.State,
 				ch.Sigs,
@@ -158,7 +216,7 @@ func (b *MockBackend) Progress(_ context.Context, req channel.ProgressReq) error
 		req.Params.ID(),
 		channel.NewProgressedEvent(
 			req.Params.ID(),
-			&channel.ElapsedTimeout{},
+			b.timeout(req.Params),
 			req.NewState.Clone(),
 			req.Idx,
 		),
@@ -227,7 +285,7 @@ func (b *MockBackend) checkState(s *channel.State, op checkStateFunc) error {
 }
 
 // Withdraw withdraws the channel funds.
-func (b *MockBackend) Withdraw(_ context.Context, req channel.AdjudicatorReq, subStates channel.StateMap) error {
+func (b *MockBackend) Withdraw(ctx context.Context, req channel.AdjudicatorReq, subStates channel.StateMap) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -249,6 +307,9 @@ func (b *MockBackend) Withdraw(_ context.Context, req channel.AdjudicatorReq, su
 		log.Debug("withdraw: already concluded:", ch)
 		return nil
 	}
+	if e, ok := b.latestEvents[ch]; ok && !e.Timeout().IsElapsed(ctx) {
+		return fmt.Errorf("withdraw: timeout not elapsed: %v", e.Timeout())
+	}
 
 	outcome := outcomeRecursive(req.Tx.State, subStates)
 	b.log.Infof("Withdraw: %+v, %+v, %+v", req, subStates, outcome)
@@ -264,6 +325,45 @@ func (b *MockBackend) Withdraw(_ context.Context, req channel.AdjudicatorReq, su
 	return nil
 }
 
+// WithdrawPartial withdraws the authorized amounts from the open channel.
+func (b *MockBackend) WithdrawPartial(_ context.Context, req channel.PartialWithdrawalReq) error {
+	b.log.Infof("WithdrawPartial: %+v", req)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := req.Params.ID()
+	if req.Auth.ChannelID != ch {
+		return fmt.Errorf("withdraw partial: wrong channel: %x", req.Auth.ChannelID)
+	}
+	if len(req.AuthSigs) != len(req.Params.Parts) {
+		return fmt.Errorf("withdraw partial: expected %d signatures, got %d", len(req.Params.Parts), len(req.AuthSigs))
+	}
+	for i, sig := range req.AuthSigs {
+		if ok, err := channel.VerifyWithdrawalAuth(req.Params.Parts[i], &req.Auth, sig); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("withdraw partial: invalid signature[%d]", i)
+		}
+	}
+	if v, ok := b.withdrawals[ch]; ok && v >= req.Auth.Version {
+		log.Debug("withdraw partial: already withdrawn:", ch, req.Auth.Version)
+		return nil
+	}
+	// Once a dispute started, the funds are distributed according to the
+	// registered state.
+	if _, ok := b.latestEvents[ch]; ok {
+		return channel.NewWithdrawalExpiredError(ch, req.Auth.Version, "withdraw partial: channel registered")
+	}
+
+	participant := req.Params.Parts[req.Auth.Idx]
+	for a, asset := range req.Auth.Assets {
+		b.addBalance(participant, asset, req.Auth.Amounts[a])
+	}
+	b.withdrawals[ch] = req.Auth.Version
+	return nil
+}
+
 func (b *MockBackend) isConcluded(ch channel.ID) bool {
 	e, ok := b.latestEvents[ch]
 	if !ok {
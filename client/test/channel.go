@@ -121,6 +121,24 @@ func (ch *paymentChannel) sendTransfer(amount channel.Bal, desc string) {
 	ch.assertBals(ch.State())
 }
 
+// sendTransferTo sends amount to participant to. The balances are checked on
+// the proposed state because in multi-party channels, the next update might
+// already be pending, which holds the channel's machine lock.
+func (ch *paymentChannel) sendTransferTo(amount channel.Bal, to channel.Index, desc string) {
+	var next *channel.State
+	ch.sendUpdate(
+		func(state *channel.State) error {
+			transferBalTo(stateBals(state), ch.Idx(), to, amount)
+			next = state
+			return nil
+		},
+		desc,
+	)
+
+	transferBalTo(ch.bals, ch.Idx(), to, amount)
+	ch.assertBals(next)
+}
+
 func (ch *paymentChannel) recvUpdate(accept bool, desc string) *channel.State {
 	ch.log.Debugf("Receiving update: %s, accept: %t", desc, accept)
 	ch.handler <- accept
@@ -137,23 +155,27 @@ func (ch *paymentChannel) recvUpdate(accept bool, desc string) *channel.State {
 }
 
 func (ch *paymentChannel) recvTransfer(amount channel.Bal, desc string) {
+	ch.recvTransferBetween(amount, ch.Idx()^1, ch.Idx(), desc)
+}
+
+// recvTransferBetween receives a transfer of amount from participant from to
+// participant to. In multi-party channels, we need not be the recipient.
+func (ch *paymentChannel) recvTransferBetween(amount channel.Bal, from, to channel.Index, desc string) {
 	state := ch.recvUpdate(true, desc)
 	if state != nil {
-		transferBal(ch.bals, ch.Idx()^1, amount)
+		transferBalTo(ch.bals, from, to, amount)
 		ch.assertBals(state)
 	} // else recvUpdate timed out
 }
 
 func (ch *paymentChannel) assertBals(state *channel.State) {
 	bals := stateBals(state)
-	ch.log.Infof(
-		"Tracked balance: [ %v %v ], channel: [ %v %v ]",
-		ch.bals[0], ch.bals[1],
-		bals[0], bals[1],
-	)
+	ch.log.Infof("Tracked balance: %v, channel: %v", ch.bals, bals)
 	assert := assert.New(ch.r.t)
-	assert.Zerof(bals[0].Cmp(ch.bals[0]), "bal[0]: %v != %v", bals[0], ch.bals[0])
-	assert.Zerof(bals[1].Cmp(ch.bals[1]), "bal[1]: %v != %v", bals[1], ch.bals[1])
+	assert.Len(bals, len(ch.bals))
+	for i := range ch.bals {
+		assert.Zerof(bals[i].Cmp(ch.bals[i]), "bal[%d]: %v != %v", i, bals[i], ch.bals[i])
+	}
 }
 
 func (ch *paymentChannel) sendFinal() {
@@ -216,12 +238,15 @@ func (ch *paymentChannel) Handle(up client.ChannelUpdate, res *client.UpdateResp
 }
 
 func transferBal(bals []channel.Bal, ourIdx channel.Index, amount *big.Int) {
+	transferBalTo(bals, ourIdx, ourIdx^1, amount)
+}
+
+func transferBalTo(bals []channel.Bal, from, to channel.Index, amount *big.Int) {
 	a := new(big.Int).Set(amount) // local copy because we mutate it
-	otherIdx := ourIdx ^ 1
-	ourBal := bals[ourIdx]
-	otherBal := bals[otherIdx]
-	otherBal.Add(otherBal, a)
-	ourBal.Add(ourBal, a.Neg(a))
+	fromBal := bals[from]
+	toBal := bals[to]
+	toBal.Add(toBal, a)
+	fromBal.Add(fromBal, a.Neg(a))
 }
 
 func stateBals(state *channel.State) []channel.Bal {
@@ -0,0 +1,362 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wire"
+)
+
+// Operations into which faults can be injected.
+const (
+	FaultFund            FaultOp = "Fund"
+	FaultRegister        FaultOp = "Register"
+	FaultProgress        FaultOp = "Progress"
+	FaultWithdraw        FaultOp = "Withdraw"
+	FaultWithdrawPartial FaultOp = "WithdrawPartial"
+	FaultSubscribe       FaultOp = "Subscribe"
+	FaultEvent           FaultOp = "Event"   // Events on adjudicator subscriptions.
+	FaultMessage         FaultOp = "Message" // Messages published on the bus.
+)
+
+// ErrInjectedFault is the cause of the errors returned by
+// ChainNotReachableFault and TxTimedoutFault.
+var ErrInjectedFault = errors.New("injected fault")
+
+type (
+	// FaultOp identifies an operation of a wrapped component into which
+	// faults can be injected.
+	FaultOp string
+
+	// Faults is a schedule of faults that are injected into the components
+	// wrapped by NewFaultyFunder, NewFaultyAdjudicator and NewFaultyBus. The
+	// same schedule can be shared by several components. It is safe for
+	// concurrent use, so that faults can be scheduled while the clients are
+	// running.
+	Faults struct {
+		mtx      sync.Mutex
+		calls    map[FaultOp][]callFault
+		events   []eventFault
+		msgs     []msgFault
+		injected map[FaultOp]int
+	}
+
+	callFault struct {
+		err       error
+		afterCall bool
+	}
+
+	eventFault struct {
+		drop  bool
+		delay time.Duration
+	}
+
+	msgFault struct {
+		match func(*wire.Envelope) bool
+	}
+
+	// FaultyFunder is a channel.Funder that injects faults into the calls
+	// to the wrapped funder.
+	FaultyFunder struct {
+		funder channel.Funder
+		faults *Faults
+	}
+
+	// FaultyAdjudicator is a channel.Adjudicator that injects faults into the
+	// calls to the wrapped adjudicator and into the events of its
+	// subscriptions.
+	FaultyAdjudicator struct {
+		adj    channel.Adjudicator
+		faults *Faults
+	}
+
+	// faultyPartialWithdrawer is a FaultyAdjudicator for adjudicators that
+	// support partial withdrawals.
+	faultyPartialWithdrawer struct {
+		*FaultyAdjudicator
+		pw channel.PartialWithdrawer
+	}
+
+	faultySubscription struct {
+		channel.AdjudicatorSubscription
+		faults *Faults
+	}
+
+	// FaultyBus is a wire.Bus that loses messages.
+	FaultyBus struct {
+		wire.Bus
+		faults *Faults
+	}
+)
+
+var (
+	_ channel.Funder            = (*FaultyFunder)(nil)
+	_ channel.Adjudicator       = (*FaultyAdjudicator)(nil)
+	_ channel.PartialWithdrawer = (*faultyPartialWithdrawer)(nil)
+	_ wire.Bus                  = (*FaultyBus)(nil)
+)
+
+// NewFaults returns an empty fault schedule.
+func NewFaults() *Faults {
+	return &Faults{
+		calls:    make(map[FaultOp][]callFault),
+		injected: make(map[FaultOp]int),
+	}
+}
+
+// TxTimedoutFault returns a client.TxTimedoutError for the operation.
+func TxTimedoutFault(op FaultOp) error {
+	return client.NewTxTimedoutError(string(op), "injected", ErrInjectedFault.Error())
+}
+
+// ChainNotReachableFault returns a client.ChainNotReachableError.
+func ChainNotReachableFault() error {
+	return client.NewChainNotReachableError(ErrInjectedFault)
+}
+
+// Fail lets the next n calls of the operation fail with the given error,
+// without calling the wrapped component.
+func (f *Faults) Fail(op FaultOp, n int, err error) {
+	f.addCallFaults(op, n, callFault{err: err})
+}
+
+// FailAfterCall lets the next n calls of the operation fail with the given
+// error after the wrapped component was called successfully. This models
+// transactions that are executed, but whose confirmation timed out.
+func (f *Faults) FailAfterCall(op FaultOp, n int, err error) {
+	f.addCallFaults(op, n, callFault{err: err, afterCall: true})
+}
+
+func (f *Faults) addCallFaults(op FaultOp, n int, fault callFault) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for i := 0; i < n; i++ {
+		f.calls[op] = append(f.calls[op], fault)
+	}
+}
+
+// DropEvents drops the next n events on any adjudicator subscription.
+func (f *Faults) DropEvents(n int) {
+	f.addEventFaults(n, eventFault{drop: true})
+}
+
+// DelayEvents delays the next n events on any adjudicator subscription by the
+// given duration.
+func (f *Faults) DelayEvents(n int, delay time.Duration) {
+	f.addEventFaults(n, eventFault{delay: delay})
+}
+
+func (f *Faults) addEventFaults(n int, fault eventFault) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for i := 0; i < n; i++ {
+		f.events = append(f.events, fault)
+	}
+}
+
+// LoseMessages loses the next n messages published on the bus that match the
+// given predicate. A nil predicate matches all messages.
+func (f *Faults) LoseMessages(n int, match func(*wire.Envelope) bool) {
+	if match == nil {
+		match = func(*wire.Envelope) bool { return true }
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for i := 0; i < n; i++ {
+		f.msgs = append(f.msgs, msgFault{match: match})
+	}
+}
+
+// Injected returns the number of faults that were injected into the
+// operation so far.
+func (f *Faults) Injected(op FaultOp) int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.injected[op]
+}
+
+// Pending returns whether there are scheduled faults that were not injected
+// yet.
+func (f *Faults) Pending() bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for _, faults := range f.calls {
+		if len(faults) > 0 {
+			return true
+		}
+	}
+	return len(f.events) > 0 || len(f.msgs) > 0
+}
+
+// call calls fn, unless a fault is scheduled for the operation.
+func (f *Faults) call(op FaultOp, fn func() error) error {
+	f.mtx.Lock()
+	faults := f.calls[op]
+	if len(faults) == 0 {
+		f.mtx.Unlock()
+		return fn()
+	}
+	fault := faults[0]
+	f.calls[op] = faults[1:]
+	f.injected[op]++
+	f.mtx.Unlock()
+
+	log.Debugf("Injecting fault into %s: %v", op, fault.err)
+	if fault.afterCall {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return fault.err
+}
+
+// nextEvent returns the fault for the next event, if any.
+func (f *Faults) nextEvent() (eventFault, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if len(f.events) == 0 {
+		return eventFault{}, false
+	}
+	fault := f.events[0]
+	f.events = f.events[1:]
+	f.injected[FaultEvent]++
+	return fault, true
+}
+
+// loseMessage returns whether the message should be lost.
+func (f *Faults) loseMessage(e *wire.Envelope) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for i, fault := range f.msgs {
+		if fault.match(e) {
+			f.msgs = append(f.msgs[:i], f.msgs[i+1:]...)
+			f.injected[FaultMessage]++
+			return true
+		}
+	}
+	return false
+}
+
+// NewFaultyFunder wraps the funder, so that faults are injected according to
+// the given schedule.
+func NewFaultyFunder(funder channel.Funder, faults *Faults) *FaultyFunder {
+	return &FaultyFunder{funder: funder, faults: faults}
+}
+
+// Fund calls Fund on the wrapped funder, unless a fault is injected.
+func (f *FaultyFunder) Fund(ctx context.Context, req channel.FundingReq) error {
+	return f.faults.call(FaultFund, func() error { return f.funder.Fund(ctx, req) })
+}
+
+// NewFaultyAdjudicator wraps the adjudicator, so that faults are injected
+// according to the given schedule. The returned adjudicator implements
+// channel.PartialWithdrawer, if the wrapped adjudicator does.
+func NewFaultyAdjudicator(adj channel.Adjudicator, faults *Faults) channel.Adjudicator {
+	fa := &FaultyAdjudicator{adj: adj, faults: faults}
+	if pw, ok := adj.(channel.PartialWithdrawer); ok {
+		return &faultyPartialWithdrawer{FaultyAdjudicator: fa, pw: pw}
+	}
+	return fa
+}
+
+// Register calls Register on the wrapped adjudicator, unless a fault is
+// injected.
+func (a *FaultyAdjudicator) Register(ctx context.Context, req channel.AdjudicatorReq, subChannels []channel.SignedState) error {
+	return a.faults.call(FaultRegister, func() error { return a.adj.Register(ctx, req, subChannels) })
+}
+
+// Progress calls Progress on the wrapped adjudicator, unless a fault is
+// injected.
+func (a *FaultyAdjudicator) Progress(ctx context.Context, req channel.ProgressReq) error {
+	return a.faults.call(FaultProgress, func() error { return a.adj.Progress(ctx, req) })
+}
+
+// Withdraw calls Withdraw on the wrapped adjudicator, unless a fault is
+// injected.
+func (a *FaultyAdjudicator) Withdraw(ctx context.Context, req channel.AdjudicatorReq, subStates channel.StateMap) error {
+	return a.faults.call(FaultWithdraw, func() error { return a.adj.Withdraw(ctx, req, subStates) })
+}
+
+// Subscribe calls Subscribe on the wrapped adjudicator, unless a fault is
+// injected. Faults are injected into the events of the returned
+// subscription.
+func (a *FaultyAdjudicator) Subscribe(ctx context.Context, chID channel.ID) (channel.AdjudicatorSubscription, error) {
+	var sub channel.AdjudicatorSubscription
+	err := a.faults.call(FaultSubscribe, func() (err error) {
+		sub, err = a.adj.Subscribe(ctx, chID)
+		return err
+	})
+	if err != nil {
+		if sub != nil {
+			if err := sub.Close(); err != nil {
+				log.Warnf("Closing subscription: %v", err)
+			}
+		}
+		return nil, err
+	}
+	return &faultySubscription{AdjudicatorSubscription: sub, faults: a.faults}, nil
+}
+
+// WithdrawPartial calls WithdrawPartial on the wrapped adjudicator, unless a
+// fault is injected.
+func (a *faultyPartialWithdrawer) WithdrawPartial(ctx context.Context, req channel.PartialWithdrawalReq) error {
+	return a.faults.call(FaultWithdrawPartial, func() error { return a.pw.WithdrawPartial(ctx, req) })
+}
+
+// Next returns the next event of the wrapped subscription that is not
+// dropped. Delayed events are returned after their delay elapsed.
+func (s *faultySubscription) Next() channel.AdjudicatorEvent {
+	for {
+		e := s.AdjudicatorSubscription.Next()
+		if e == nil {
+			return nil
+		}
+		fault, ok := s.faults.nextEvent()
+		switch {
+		case !ok:
+			return e
+		case fault.drop:
+			log.Debugf("Dropping event: %v", e)
+			continue
+		}
+		log.Debugf("Delaying event by %v: %v", fault.delay, e)
+		time.Sleep(fault.delay)
+		return e
+	}
+}
+
+// NewFaultyBus wraps the bus, so that messages are lost according to the
+// given schedule.
+func NewFaultyBus(bus wire.Bus, faults *Faults) *FaultyBus {
+	return &FaultyBus{Bus: bus, faults: faults}
+}
+
+// Publish publishes the message on the wrapped bus, unless it is lost. Lost
+// messages are reported as published.
+func (b *FaultyBus) Publish(ctx context.Context, e *wire.Envelope) error {
+	if b.faults.loseMessage(e) {
+		log.Debugf("Losing message: %v", e.Msg.Type())
+		return nil
+	}
+	return b.Bus.Publish(ctx, e)
+}
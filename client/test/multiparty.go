@@ -0,0 +1,210 @@
+// Copyright 2019 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wire"
+	pkgsync "polycry.pt/poly-go/sync"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+// MultiPartyExecConfig contains config parameters for multi-party tests.
+// Each participant sends NumPayments payments of TxAmount to the participant
+// with the next index, in order of their indices.
+type MultiPartyExecConfig struct {
+	Peers       []wire.Address      // must match the RoleSetup.Identity's
+	Asset       channel.Asset       // single Asset to use in this channel
+	InitBals    []*big.Int          // channel deposit of each role
+	App         client.ProposalOpts // must be either WithApp or WithoutApp
+	NumPayments int                 // how many payments each role sends
+	TxAmount    *big.Int            // amount that is sent by each role per payment
+}
+
+const multiPartyNumStages = 2
+
+// A MultiPartyExecuter is a Role that can execute a multi-party protocol.
+type MultiPartyExecuter interface {
+	// Execute executes the protocol according to the given configuration.
+	Execute(cfg *MultiPartyExecConfig)
+	// EnableStages enables role synchronization.
+	EnableStages() Stages
+	// SetStages enables role synchronization using the given stages.
+	SetStages(Stages)
+}
+
+// ExecuteMultiPartyTest executes the specified multi-party client test. The
+// first role is expected to be the Hub.
+func ExecuteMultiPartyTest(ctx context.Context, roles []MultiPartyExecuter, cfg *MultiPartyExecConfig) error {
+	log.Infof("Starting %d-party test", len(roles))
+	defer log.Infof("%d-party test done", len(roles))
+
+	// enable stages synchronization
+	stages := roles[0].EnableStages()
+	for _, r := range roles[1:] {
+		r.SetStages(stages)
+	}
+
+	var wg pkgsync.WaitGroup
+	// start clients
+	for i := range roles {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			log.Infof("Executing role %d", i)
+			roles[i].Execute(cfg)
+		}(i)
+	}
+
+	// wait for clients to finish or timeout
+	wg.WaitCtx(ctx)
+	return ctx.Err()
+}
+
+// Hub is a test client role for multi-party channels. It proposes the new
+// channel to all Merchants.
+type Hub struct {
+	role
+}
+
+// NewHub creates a new party that executes the Hub protocol.
+func NewHub(t *testing.T, setup RoleSetup) *Hub {
+	t.Helper()
+	return &Hub{role: makeRole(t, setup, multiPartyNumStages)}
+}
+
+// Execute executes the Hub protocol.
+func (r *Hub) Execute(cfg *MultiPartyExecConfig) {
+	rng := pkgtest.Prng(r.t, "hub")
+	assert := assert.New(r.t)
+
+	// ignore proposal handler since the Hub doesn't accept any incoming channels
+	_, waitHandler := r.GoHandle(rng)
+	defer func() {
+		assert.NoError(r.Close())
+		waitHandler()
+	}()
+
+	ch, err := r.ProposeChannel(r.multiPartyProposal(rng, cfg))
+	assert.NoError(err)
+	assert.NotNil(ch)
+	if err != nil {
+		return
+	}
+	r.log.Infof("New Channel opened: %v", ch.Channel)
+
+	execMultiParty(&r.role, cfg, ch)
+
+	assert.NoError(ch.Close())
+}
+
+func (r *Hub) multiPartyProposal(rng *rand.Rand, cfg *MultiPartyExecConfig) *client.LedgerChannelProposal {
+	alloc := channel.NewAllocation(len(cfg.Peers), cfg.Asset)
+	alloc.SetAssetBalances(cfg.Asset, cfg.InitBals)
+
+	prop, err := client.NewLedgerChannelProposal(
+		r.challengeDuration,
+		r.setup.Wallet.NewRandomAccount(rng).Address(),
+		alloc,
+		cfg.Peers,
+		client.WithNonceFrom(rng),
+		cfg.App)
+	if err != nil {
+		r.log.Panic("Error generating multi-party channel proposal: " + err.Error())
+	}
+	return prop
+}
+
+// Merchant is a test client role for multi-party channels. It accepts the
+// channel proposal of the Hub.
+type Merchant struct {
+	role
+}
+
+// NewMerchant creates a new party that executes the Merchant protocol.
+func NewMerchant(t *testing.T, setup RoleSetup) *Merchant {
+	t.Helper()
+	return &Merchant{role: makeRole(t, setup, multiPartyNumStages)}
+}
+
+// Execute executes the Merchant protocol.
+func (r *Merchant) Execute(cfg *MultiPartyExecConfig) {
+	rng := pkgtest.Prng(r.t, "merchant", r.setup.Name)
+	assert := assert.New(r.t)
+
+	propHandler, waitHandler := r.GoHandle(rng)
+	defer func() {
+		assert.NoError(r.Close())
+		waitHandler()
+	}()
+
+	// receive one accepted proposal
+	ch, err := propHandler.Next()
+	assert.NoError(err)
+	assert.NotNil(ch)
+	if err != nil {
+		return
+	}
+	r.log.Infof("New Channel opened: %v", ch.Channel)
+
+	execMultiParty(&r.role, cfg, ch)
+
+	assert.NoError(ch.Close())
+}
+
+// execMultiParty executes the common part of the Hub and Merchant protocols.
+// The participants send payments in a round-robin fashion. Then the Hub
+// finalizes the channel and all participants settle.
+func execMultiParty(r *role, cfg *MultiPartyExecConfig, ch *paymentChannel) {
+	we := ch.Idx()
+	n := channel.Index(len(cfg.Peers))
+
+	// 1st round-robin payments
+	for i := 0; i < cfg.NumPayments; i++ {
+		for from := channel.Index(0); from < n; from++ {
+			to := (from + 1) % n
+			desc := fmt.Sprintf("%d->%d#%d", from, to, i)
+			if from == we {
+				ch.sendTransferTo(cfg.TxAmount, to, desc)
+			} else {
+				ch.recvTransferBetween(cfg.TxAmount, from, to, desc)
+			}
+		}
+	}
+	// 1st stage
+	r.waitStage()
+
+	// 2nd Hub sends a final state
+	if we == 0 {
+		ch.sendFinal()
+		ch.settle()
+	} else {
+		ch.recvFinal()
+		ch.settleSecondary()
+	}
+
+	// 2nd final stage
+	r.waitStage()
+}
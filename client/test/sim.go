@@ -0,0 +1,301 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"perun.network/go-perun/channel"
+)
+
+// simEpoch is the virtual time at which each simulation starts.
+var simEpoch = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// DefaultSimSettleTime is the default time that a simulation waits for the
+// simulated system to become quiescent before executing the next event.
+const DefaultSimSettleTime = 10 * time.Millisecond
+
+type (
+	// Simulation is a discrete-event simulation of the environment of a set
+	// of clients. It provides a virtual clock and executes scheduled events,
+	// e.g., the delivery of messages on a SimBus or the elapsing of a
+	// timeout, one after the other in the order of their virtual time.
+	//
+	// Before executing the next event, the simulation waits until no new
+	// events were scheduled for the settle time (real time), i.e., until the
+	// clients reacted to the previous event. Events are ordered by their
+	// virtual time and a key that does not depend on the goroutine
+	// scheduling, and all random decisions are derived from the seed and
+	// the key of the event. Thereby, a scenario in which the clients only
+	// interact through the simulated components is executed in the same way
+	// each time it is run with the same seed. The executed events are
+	// recorded, see Trace, so that the execution of two runs can be
+	// compared.
+	//
+	// Determinism is best effort. Quiescence is detected heuristically: the
+	// simulation cannot observe goroutines that are still computing without
+	// scheduling an event, so a client that takes longer than the settle time
+	// (10 ms of wall-clock inactivity by default) to react to an event may
+	// react after the next event was executed. Likewise, contexts and
+	// timeouts that the clients create with the time package run on the wall
+	// clock and are not virtualized. Replays may therefore diverge on slow or
+	// loaded machines; WithSimSettleTime makes this less likely.
+	Simulation struct {
+		seed   int64
+		settle time.Duration
+
+		mtx      sync.Mutex
+		now      time.Duration // Virtual time elapsed since simEpoch.
+		queue    simQueue
+		timers   map[time.Duration]chan struct{} // Timers by deadline.
+		activity uint64                          // Incremented on each change of the queue.
+		trace    []string
+	}
+
+	// SimOpt represents an optional argument for the simulation.
+	SimOpt func(*Simulation)
+
+	// simEvent is an event that is executed by the simulation at its
+	// virtual time. Events at the same time are ordered by their keys.
+	simEvent struct {
+		at   time.Duration
+		key  string
+		desc string
+		// exec executes the event and returns a description of the outcome,
+		// which is recorded in the trace, if not empty.
+		exec func() string
+	}
+
+	// simQueue is a priority queue of events, implementing heap.Interface.
+	simQueue []*simEvent
+
+	// simTimeout is a channel.Timeout that elapses at a virtual time.
+	simTimeout struct {
+		sim      *Simulation
+		deadline time.Duration
+	}
+)
+
+var _ channel.Timeout = (*simTimeout)(nil)
+
+// NewSimulation creates a new simulation whose random decisions are derived
+// from the given seed.
+func NewSimulation(seed int64, opts ...SimOpt) *Simulation {
+	s := &Simulation{
+		seed:   seed,
+		settle: DefaultSimSettleTime,
+		timers: make(map[time.Duration]chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithSimSettleTime sets the time that the simulation waits for the simulated
+// system to become quiescent before executing the next event. It should be
+// increased if the clients need more time to react to an event, e.g., on a
+// slow machine.
+func WithSimSettleTime(d time.Duration) SimOpt {
+	return func(s *Simulation) {
+		s.settle = d
+	}
+}
+
+// Seed returns the seed of the simulation. Running the same scenario with the
+// same seed replays it.
+func (s *Simulation) Seed() int64 {
+	return s.seed
+}
+
+// Now returns the current virtual time.
+func (s *Simulation) Now() time.Time {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return simEpoch.Add(s.now)
+}
+
+// Timeout returns a timeout that elapses when the virtual clock advanced by
+// the given duration.
+func (s *Simulation) Timeout(d time.Duration) channel.Timeout {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return &simTimeout{sim: s, deadline: s.now + d}
+}
+
+// Sleep blocks until the virtual clock advanced by the given duration or the
+// context is done.
+func (s *Simulation) Sleep(ctx context.Context, d time.Duration) error {
+	return s.Timeout(d).Wait(ctx)
+}
+
+// Rand returns a random number generator that is derived from the seed of the
+// simulation and the given key. The same key always results in the same
+// sequence of random numbers.
+func (s *Simulation) Rand(key string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(key)) //nolint:errcheck // Hash.Write never returns an error.
+	seed := s.seed ^ int64(h.Sum64())
+	return rand.New(rand.NewSource(seed)) //nolint:gosec
+}
+
+// Trace returns the descriptions of all events executed so far, in the order
+// of execution.
+func (s *Simulation) Trace() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]string(nil), s.trace...)
+}
+
+// Run executes the scheduled events until the context is done. It should be
+// started in a separate goroutine before the clients are started and returns
+// the error of the context.
+func (s *Simulation) Run(ctx context.Context) error {
+	for {
+		if err := s.awaitQuiescence(ctx); err != nil {
+			return err
+		}
+		s.step()
+	}
+}
+
+// awaitQuiescence waits until there is at least one scheduled event and the
+// queue did not change for the settle time.
+func (s *Simulation) awaitQuiescence(ctx context.Context) error {
+	for {
+		s.mtx.Lock()
+		activity, pending := s.activity, len(s.queue) > 0
+		s.mtx.Unlock()
+
+		select {
+		case <-time.After(s.settle):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		s.mtx.Lock()
+		quiescent := pending && activity == s.activity
+		s.mtx.Unlock()
+		if quiescent {
+			return nil
+		}
+	}
+}
+
+// step advances the virtual clock to the next event and executes it.
+func (s *Simulation) step() {
+	s.mtx.Lock()
+	e := heap.Pop(&s.queue).(*simEvent)
+	if e.at > s.now {
+		s.now = e.at
+	}
+	s.activity++
+	s.mtx.Unlock()
+
+	desc := e.desc
+	if outcome := e.exec(); outcome != "" {
+		desc += ": " + outcome
+	}
+
+	s.mtx.Lock()
+	s.trace = append(s.trace, fmt.Sprintf("%v %s", s.now, desc))
+	s.mtx.Unlock()
+}
+
+// schedule schedules an event to be executed after the given delay.
+func (s *Simulation) schedule(delay time.Duration, key, desc string, exec func() string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.scheduleAt(s.now+delay, key, desc, exec)
+}
+
+func (s *Simulation) scheduleAt(at time.Duration, key, desc string, exec func() string) {
+	heap.Push(&s.queue, &simEvent{at: at, key: key, desc: desc, exec: exec})
+	s.activity++
+}
+
+// timer returns a channel that is closed when the virtual clock reaches the
+// given deadline. Timers with the same deadline share a single event.
+func (s *Simulation) timer(deadline time.Duration) <-chan struct{} {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if timer, ok := s.timers[deadline]; ok {
+		return timer
+	}
+	timer := make(chan struct{})
+	if deadline <= s.now {
+		close(timer)
+		return timer
+	}
+	s.timers[deadline] = timer
+	s.scheduleAt(deadline, "timer", "timeout", func() string {
+		s.mtx.Lock()
+		delete(s.timers, deadline)
+		s.mtx.Unlock()
+		close(timer)
+		return ""
+	})
+	return timer
+}
+
+// IsElapsed returns whether the virtual clock reached the deadline.
+func (t *simTimeout) IsElapsed(context.Context) bool {
+	t.sim.mtx.Lock()
+	defer t.sim.mtx.Unlock()
+	return t.sim.now >= t.deadline
+}
+
+// Wait waits until the virtual clock reached the deadline or the context is
+// done.
+func (t *simTimeout) Wait(ctx context.Context) error {
+	select {
+	case <-t.sim.timer(t.deadline):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// String returns the deadline of the timeout.
+func (t *simTimeout) String() string {
+	return fmt.Sprintf("<Simulated timeout: %v>", simEpoch.Add(t.deadline))
+}
+
+func (q simQueue) Len() int { return len(q) }
+
+func (q simQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].key < q[j].key
+}
+
+func (q simQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *simQueue) Push(x interface{}) { *q = append(*q, x.(*simEvent)) }
+
+func (q *simQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	*q = old[:n-1]
+	return e
+}
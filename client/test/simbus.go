@@ -0,0 +1,195 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+)
+
+var _ wire.Bus = (*SimBus)(nil)
+
+type (
+	// SimBus is a wire.Bus whose messages are delivered by a Simulation. The
+	// network faults are configured with a NetworkConfig.
+	//
+	// Publishing a message never blocks and only fails if the message cannot
+	// be serialized. Messages to recipients that are disconnected or not
+	// subscribed at the time of delivery are lost.
+	//
+	// The addresses are named n0, n1, ... in the order in which they first
+	// subscribed. The names are used in the trace and for deriving the
+	// randomness of the messages, because the addresses of random accounts
+	// may differ between runs with the same seed.
+	SimBus struct {
+		sim *Simulation
+		cfg NetworkConfig
+
+		mtx          sync.Mutex
+		recvs        map[wallet.AddrKey]wire.Consumer
+		disconnected map[wallet.AddrKey]bool
+		names        map[wallet.AddrKey]string
+		seqs         map[string]uint64 // Number of published messages per link.
+	}
+
+	// NetworkConfig configures the faults of a SimBus. The zero value is a
+	// network that delivers each message exactly once, in order and without
+	// delay.
+	NetworkConfig struct {
+		// MinDelay and MaxDelay are the bounds of the uniformly distributed
+		// delivery delay of a message. Messages are reordered, if MaxDelay is
+		// greater than MinDelay.
+		MinDelay, MaxDelay time.Duration
+		// DropRate is the probability that a message is lost.
+		DropRate float64
+		// DuplicateRate is the probability that a message is delivered
+		// twice.
+		DuplicateRate float64
+	}
+)
+
+// NewSimBus creates a new bus whose messages are delivered by the given
+// simulation.
+func NewSimBus(sim *Simulation, cfg NetworkConfig) *SimBus {
+	return &SimBus{
+		sim:          sim,
+		cfg:          cfg,
+		recvs:        make(map[wallet.AddrKey]wire.Consumer),
+		disconnected: make(map[wallet.AddrKey]bool),
+		names:        make(map[wallet.AddrKey]string),
+		seqs:         make(map[string]uint64),
+	}
+}
+
+// Publish implements wire.Bus.Publish. The message is serialized and
+// scheduled for delivery.
+func (b *SimBus) Publish(_ context.Context, e *wire.Envelope) error {
+	var buf bytes.Buffer
+	if err := e.Encode(&buf); err != nil {
+		return errors.WithMessage(err, "encoding envelope")
+	}
+	var _e wire.Envelope
+	if err := _e.Decode(&buf); err != nil {
+		return errors.WithMessage(err, "decoding envelope")
+	}
+
+	b.mtx.Lock()
+	link := b.name(e.Sender) + "->" + b.name(e.Recipient)
+	seq := b.seqs[link]
+	b.seqs[link]++
+	disconnected := b.disconnected[wallet.Key(e.Sender)]
+	b.mtx.Unlock()
+
+	key := fmt.Sprintf("%s#%d", link, seq)
+	desc := fmt.Sprintf("%s %v", key, e.Msg.Type())
+	rng := b.sim.Rand("bus/" + key)
+	delay := b.cfg.MinDelay
+	if b.cfg.MaxDelay > b.cfg.MinDelay {
+		delay += time.Duration(rng.Int63n(int64(b.cfg.MaxDelay - b.cfg.MinDelay + 1)))
+	}
+
+	switch {
+	case disconnected:
+		b.sim.schedule(0, key, "lose "+desc, func() string { return "sender disconnected" })
+	case rng.Float64() < b.cfg.DropRate:
+		b.sim.schedule(delay, key, "drop "+desc, func() string { return "" })
+	default:
+		b.sim.schedule(delay, key, "deliver "+desc, func() string { return b.deliver(&_e) })
+		if rng.Float64() < b.cfg.DuplicateRate {
+			b.sim.schedule(delay, key+"/dup", "duplicate "+desc, func() string { return b.deliver(&_e) })
+		}
+	}
+	return nil
+}
+
+// deliver passes the envelope to the recipient's consumer. It returns the
+// reason why the envelope was lost, if it could not be delivered.
+func (b *SimBus) deliver(e *wire.Envelope) string {
+	key := wallet.Key(e.Recipient)
+	b.mtx.Lock()
+	recv, ok := b.recvs[key]
+	disconnected := b.disconnected[key]
+	b.mtx.Unlock()
+
+	switch {
+	case disconnected:
+		return "lost, recipient disconnected"
+	case !ok:
+		return "lost, recipient not subscribed"
+	}
+	recv.Put(e)
+	return ""
+}
+
+// SubscribeClient implements wire.Bus.SubscribeClient. There can only be one
+// subscription per receiver address. When the Consumer closes, its
+// subscription is removed, so that the client can subscribe again, e.g.,
+// after a simulated crash.
+func (b *SimBus) SubscribeClient(c wire.Consumer, receiver wire.Address) error {
+	key := wallet.Key(receiver)
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.recvs[key]; ok {
+		return errors.Errorf("address %v already subscribed", receiver)
+	}
+	b.recvs[key] = c
+	b.name(receiver)
+
+	c.OnCloseAlways(func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		if b.recvs[key] == c {
+			delete(b.recvs, key)
+		}
+		log.WithField("id", receiver).Debug("Client unsubscribed.")
+	})
+	return nil
+}
+
+// name returns the name of the address. Unknown addresses are named after
+// the next index. It assumes that the caller holds the mutex.
+func (b *SimBus) name(addr wire.Address) string {
+	key := wallet.Key(addr)
+	if name, ok := b.names[key]; ok {
+		return name
+	}
+	name := fmt.Sprintf("n%d", len(b.names))
+	b.names[key] = name
+	return name
+}
+
+// Disconnect disconnects the address from the network. All messages from and
+// to the address are lost until it is reconnected.
+func (b *SimBus) Disconnect(addr wire.Address) {
+	b.mtx.Lock()
+	b.disconnected[wallet.Key(addr)] = true
+	b.mtx.Unlock()
+}
+
+// Reconnect reconnects the address to the network.
+func (b *SimBus) Reconnect(addr wire.Address) {
+	b.mtx.Lock()
+	delete(b.disconnected, wallet.Key(addr))
+	b.mtx.Unlock()
+}
@@ -31,8 +31,25 @@ const nStagesDisputeSusieTime = 4
 // DisputeSusieTimExecConfig contains config parameters for sub-channel dispute test.
 type DisputeSusieTimExecConfig struct {
 	BaseExecConfig
-	SubChannelFunds [2]*big.Int // sub-channel funding amounts
-	TxAmount        *big.Int    // transaction amount
+	SubChannelFunds    [2]*big.Int // sub-channel funding amounts
+	SubSubChannelFunds [2]*big.Int // sub-sub-channel funding amounts, optional
+	TxAmount           *big.Int    // transaction amount
+}
+
+// hasSubSubChannel returns whether a sub-sub-channel is opened in the
+// sub-channel.
+func (c *DisputeSusieTimExecConfig) hasSubSubChannel() bool {
+	return c.SubSubChannelFunds[0] != nil
+}
+
+// signedState returns the current signed state of the channel.
+func signedState(ch *paymentChannel) channel.SignedState {
+	req := client.NewTestChannel(ch.Channel).AdjudicatorReq()
+	return channel.SignedState{
+		Params: req.Params,
+		State:  req.Tx.State,
+		Sigs:   req.Tx.Sigs,
+	}
 }
 
 // DisputeSusie is a Proposer. She proposes the new channel.
@@ -60,9 +77,16 @@ func (r *DisputeSusie) exec(_cfg ExecConfig, ledgerChannel *paymentChannel) {
 	// Stage 1 - Wait for channel controller setup.
 	r.waitStage()
 
-	// Stage 2 - Open sub-channel.
+	// Stage 2 - Open sub-channel and optionally sub-sub-channel.
+	// The leaf channel is the channel that will be disputed with an outdated state.
 	subChannel := ledgerChannel.openSubChannel(rng, cfg, cfg.SubChannelFunds[:], client.WithoutApp())
-	subReq0 := client.NewTestChannel(subChannel.Channel).AdjudicatorReq() // Store AdjudicatorReq for version 0
+	leafChannel := subChannel
+	var subSubChannel *paymentChannel
+	if cfg.hasSubSubChannel() {
+		subSubChannel = subChannel.openSubChannel(rng, cfg, cfg.SubSubChannelFunds[:], client.WithoutApp())
+		leafChannel = subSubChannel
+	}
+	leafState0 := signedState(leafChannel) // Store signed state for version 0
 	r.waitStage()
 
 	// Stage 3 - Update channels.
@@ -73,23 +97,25 @@ func (r *DisputeSusie) exec(_cfg ExecConfig, ledgerChannel *paymentChannel) {
 
 	update(ledgerChannel)
 	update(subChannel)
+	if subSubChannel != nil {
+		update(subSubChannel)
+	}
 
 	r.waitStage()
 
 	// Stage 4 - Attack.
 
-	// Register version 0 AdjudicatorReq.
+	// Register the channel tree with version 0 of the leaf channel.
 	r.log.Debug("Registering version 0 state.")
-	reqLedger := client.NewTestChannel(subChannel.Channel).AdjudicatorReq() // Current ledger state.
-	subState0 := channel.SignedState{
-		Params: subReq0.Params,
-		State:  subReq0.Tx.State,
-		Sigs:   subReq0.Tx.Sigs,
+	reqLedger := client.NewTestChannel(ledgerChannel.Channel).AdjudicatorReq() // Current ledger state.
+	subStates := []channel.SignedState{leafState0}
+	if subSubChannel != nil {
+		subStates = []channel.SignedState{signedState(subChannel), leafState0}
 	}
-	assert.NoError(r.setup.Adjudicator.Register(ctx, reqLedger, []channel.SignedState{subState0}))
+	assert.NoError(r.setup.Adjudicator.Register(ctx, reqLedger, subStates))
 
 	// Within the challenge duration, other party should refute.
-	sub, err := r.setup.Adjudicator.Subscribe(ctx, subChannel.Params().ID())
+	sub, err := r.setup.Adjudicator.Subscribe(ctx, leafChannel.Params().ID())
 	assert.NoError(err)
 
 	// Wait until other party has refuted.
@@ -104,7 +130,7 @@ func (r *DisputeSusie) exec(_cfg ExecConfig, ledgerChannel *paymentChannel) {
 			assert.NoError(sub.Close())
 			assert.NoError(sub.Err())
 			r.log.Debugln("<Registered> refuted: ", event)
-			assert.Equal(subChannel.State().Version, event.Version(), "expected refutation with current version")
+			assert.Equal(leafChannel.State().Version, event.Version(), "expected refutation with current version")
 			assert.NoError(event.Timeout().Wait(ctx)) // Refutation increased the timeout.
 			break
 		}
@@ -112,7 +138,9 @@ func (r *DisputeSusie) exec(_cfg ExecConfig, ledgerChannel *paymentChannel) {
 
 	r.log.Debug("Attempt withdrawing refuted state.")
 	m := channel.MakeStateMap()
-	m.Add(subState0.State)
+	for _, s := range subStates {
+		m.Add(s.State)
+	}
 	err = r.setup.Adjudicator.Withdraw(ctx, reqLedger, m)
 	assert.Error(err, "withdraw should fail because other party should have refuted.")
 
@@ -162,9 +190,15 @@ func (r *DisputeTim) exec(_cfg ExecConfig, ledgerChannel *paymentChannel, propHa
 	// Stage 1 - Wait for channel controller setup.
 	r.waitStage()
 
-	// Stage 2 - Open sub-channel.
+	// Stage 2 - Open sub-channel and optionally sub-sub-channel.
 	subChannel := ledgerChannel.acceptSubchannel(propHandler, cfg.SubChannelFunds[:])
-	r.subCh = subChannel.ID()
+	leafChannel := subChannel
+	var subSubChannel *paymentChannel
+	if cfg.hasSubSubChannel() {
+		subSubChannel = subChannel.acceptSubchannel(propHandler, cfg.SubSubChannelFunds[:])
+		leafChannel = subSubChannel
+	}
+	r.subCh = leafChannel.ID()
 	// Start ledger channel watcher.
 	go func() {
 		r.log.Info("Starting ledger channel watcher.")
@@ -178,6 +212,15 @@ func (r *DisputeTim) exec(_cfg ExecConfig, ledgerChannel *paymentChannel, propHa
 		err := subChannel.Watch(r)
 		r.log.Infof("Sub-channel watcher returned: %v", err)
 	}()
+	// Start sub-sub-channel watcher.
+	if subSubChannel != nil {
+		time.Sleep(channelWatcherWait) // Wait until parent channel watcher active.
+		go func() {
+			r.log.Info("Starting sub-sub-channel watcher.")
+			err := subSubChannel.Watch(r)
+			r.log.Infof("Sub-sub-channel watcher returned: %v", err)
+		}()
+	}
 	r.waitStage()
 
 	// Stage 3 - Update channels.
@@ -188,6 +231,9 @@ func (r *DisputeTim) exec(_cfg ExecConfig, ledgerChannel *paymentChannel, propHa
 
 	acceptUpdate(ledgerChannel)
 	acceptUpdate(subChannel)
+	if subSubChannel != nil {
+		acceptUpdate(subSubChannel)
+	}
 
 	r.waitStage()
 
@@ -199,7 +245,7 @@ func (r *DisputeTim) exec(_cfg ExecConfig, ledgerChannel *paymentChannel, propHa
 		for {
 			select {
 			case e := <-r.registered:
-				if e.Version() == subChannel.State().Version {
+				if e.Version() == leafChannel.State().Version {
 					return e
 				}
 			case <-r.Ctx().Done():
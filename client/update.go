@@ -40,8 +40,12 @@ func (c *Client) handleChannelUpdate(uh UpdateHandler, p wire.Address, m Channel
 		}
 		return
 	}
-	pidx := ch.Idx() ^ 1
-	ch.handleUpdateReq(pidx, m, uh) //nolint:contextcheck
+	pidx := wire.IndexOfAddr(ch.Peers(), p)
+	if pidx < 0 {
+		c.logChan(m.Base().ID()).WithField("peer", p).Error("received update from non-participant")
+		return
+	}
+	ch.handleUpdateReq(channel.Index(pidx), m, uh) //nolint:contextcheck
 }
 
 func (c *Client) cacheVersion1Update(uh UpdateHandler, p wire.Address, m ChannelUpdateProposal) bool {
@@ -60,6 +64,11 @@ func (c *Client) cacheVersion1Update(uh UpdateHandler, p wire.Address, m Channel
 	return true
 }
 
+// MaxCounterUpdates is the maximum number of counter-updates that are
+// processed for a single channel update. If the peers counter more often, the
+// update fails with a PeerCounteredUpdateError.
+const MaxCounterUpdates = 8
+
 type (
 	// ChannelUpdate is a channel update proposal.
 	ChannelUpdate struct {
@@ -87,7 +96,8 @@ type (
 
 	// The UpdateResponder allows the user to react to the incoming channel update
 	// request. If the user wants to accept the update, Accept() should be called,
-	// otherwise Reject(), possibly giving a reason for the rejection.
+	// otherwise Reject(), possibly giving a reason for the rejection, or
+	// Counter(), proposing an alternative new state.
 	// Only a single function must be called and every further call causes a
 	// panic.
 	UpdateResponder struct {
@@ -97,9 +107,20 @@ type (
 		called  atomic.Bool
 	}
 
+	// A CounterUpdateHandler decides whether the alternative state counter,
+	// which a peer sent in response to the proposed update, should be
+	// proposed instead.
+	CounterUpdateHandler func(proposed, counter *channel.State) bool
+
 	// RequestTimedOutError indicates that a peer has not responded within the
 	// expected time period.
 	RequestTimedOutError string
+
+	// PeerCounteredUpdateError indicates that a peer answered the channel
+	// update with an alternative new state that was not taken up.
+	PeerCounteredUpdateError struct {
+		Counter *channel.State // Alternative new state sent by the peer.
+	}
 )
 
 // HandleUpdate calls the update handler function.
@@ -131,13 +152,44 @@ func (r *UpdateResponder) Reject(ctx context.Context, reason string) error {
 	return r.channel.handleUpdateRej(ctx, r.pidx, r.req, reason)
 }
 
+// Counter lets the user signal that they reject the channel update, but would
+// accept the alternative new state next instead. next must have the same
+// version as the proposed state and the same actor must be able to cause it.
+// Only plain channel updates, as created by Channel.Update, can be countered.
+//
+// The proposer decides whether to propose next instead, see
+// Channel.OnCounterUpdate. If it does, next is received by the update handler
+// as a new update request. If next is not a valid update, the proposed update
+// is rejected and an error is returned.
+func (r *UpdateResponder) Counter(ctx context.Context, next *channel.State) error {
+	if ctx == nil {
+		return errors.New("context must not be nil")
+	}
+	if !r.called.TrySet() {
+		log.Panic("multiple calls on channel update responder")
+	}
+
+	return r.channel.handleUpdateCounter(ctx, r.pidx, r.req, next)
+}
+
 // Update updates the channel state using the update function and proposes the
 // new state to all other channel participants. The update function must not
 // update the version counter.
 //
+// If a peer answers with an alternative new state, it is passed to the
+// handler set with Channel.OnCounterUpdate, which decides whether the
+// alternative state is proposed instead. At most MaxCounterUpdates
+// alternative states are processed.
+//
+// In pipelined mode, see EnablePipelining, the update is applied to the latest
+// proposed state instead of the current state and Update returns once the
+// new state is enabled.
+//
 // Returns nil if all peers accept the update. Returns RequestTimedOutError if
 // any peer did not respond before the context expires or is cancelled. Returns
-// an error if any runtime error occurs or any peer rejects the update.
+// PeerCounteredUpdateError if a peer countered the update and the alternative
+// state was not taken up. Returns an error if any runtime error occurs or any
+// peer rejects the update.
 func (c *Channel) Update(ctx context.Context, update func(*channel.State) error) (err error) {
 	if ctx == nil {
 		return errors.New("context must not be nil")
@@ -147,6 +199,10 @@ func (c *Channel) Update(ctx context.Context, update func(*channel.State) error)
 	if !c.machMtx.TryLockCtx(ctx) {
 		return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
 	}
+	if p := c.pipeline; p != nil {
+		c.machMtx.Unlock()
+		return c.updatePipelined(ctx, p, update)
+	}
 	defer c.machMtx.Unlock()
 
 	return c.update(ctx,
@@ -157,7 +213,7 @@ func (c *Channel) Update(ctx context.Context, update func(*channel.State) error)
 			}
 
 			// validate
-			return c.validTwoPartyUpdateState(state)
+			return c.validUpdateState(state)
 		},
 	)
 }
@@ -183,6 +239,27 @@ func (c *Channel) updateGeneric(
 	// if anything goes wrong from now on, we discard the update.
 	defer func() { c.checkUpdateError(ctx, err) }()
 
+	// If subchannel is final, register settlement update at parent channel.
+	// The participant at the proposer index withdraws the sub-channel, so we
+	// need to await the withdrawal even if we finalized the sub-channel.
+	if c.IsSubChannel() && next.IsFinal && c.Idx() != proposerIdx {
+		c.Parent().registerSubChannelSettlement(c.ID(), next.Balances)
+	}
+
+	if err = c.proposeStaged(ctx, up, prepareMsg); err != nil {
+		return err
+	}
+
+	return c.enableNotifyUpdate(ctx)
+}
+
+// proposeStaged signs the staged update `up`, sends it to all peers and
+// collects their signatures. It does not enable the update.
+func (c *Channel) proposeStaged(
+	ctx context.Context,
+	up ChannelUpdate,
+	prepareMsg func(*msgChannelUpdate) wire.Msg,
+) error {
 	sig, err := c.machine.Sig(ctx)
 	if err != nil {
 		return errors.WithMessage(err, "signing update")
@@ -203,29 +280,83 @@ func (c *Channel) updateGeneric(
 		return errors.WithMessage(err, "sending update")
 	}
 
-	pidx, res, err := resRecv.Next(ctx)
-	if err != nil {
-		if pcontext.IsContextError(err) {
-			err = newRequestTimedOutError("channel update", err.Error())
-			return err
+	return c.receiveUpdateSigs(ctx, resRecv, c.machine.Idx())
+}
+
+// receiveUpdateSigs receives the update responses of all peers, except the
+// ones at the given indices, and adds their signatures to the machine.
+//
+// Returns RequestTimedOutError if any peer did not respond before the context
+// expires or is cancelled. Returns PeerRejectedError if any peer rejects the
+// update.
+func (c *Channel) receiveUpdateSigs(ctx context.Context, resRecv *channelMsgRecv, skip ...channel.Index) error {
+	responded := make([]bool, len(c.Peers()))
+	numMissing := len(responded)
+	for _, idx := range skip {
+		if !responded[idx] {
+			responded[idx] = true
+			numMissing--
 		}
-		return errors.WithMessage(err, "receiving update response")
 	}
-	c.Log().Tracef("Received update response (%T): %v", res, res)
 
-	if rej, ok := res.(*msgChannelUpdateRej); ok {
-		return newPeerRejectedError("channel update", rej.Reason)
-	}
+	for numMissing > 0 {
+		pidx, res, err := resRecv.Next(ctx)
+		if err != nil {
+			if pcontext.IsContextError(err) {
+				return newRequestTimedOutError("channel update", err.Error())
+			}
+			return errors.WithMessage(err, "receiving update response")
+		}
+		c.Log().Tracef("Received update response (%T): %v", res, res)
 
-	acc, ok := res.(*msgChannelUpdateAcc) // safe by predicate of the updateResRecv
-	if !ok {
-		log.Panic("wrong message type")
-	}
-	if err := c.machine.AddSig(ctx, pidx, acc.Sig); err != nil {
-		return errors.WithMessage(err, "adding peer signature")
+		if responded[pidx] {
+			c.logPeer(pidx).Warn("received duplicate update response")
+			continue
+		}
+		responded[pidx] = true
+		numMissing--
+
+		var sig wallet.Sig
+		switch res := res.(type) { // safe by predicate of the updateResRecv
+		case *msgChannelUpdateRej:
+			return newPeerRejectedError("channel update", res.Reason)
+		case *msgChannelUpdateCounter:
+			return newPeerCounteredUpdateError(res.State)
+		case *msgChannelUpdateAcc:
+			sig = res.Sig
+		case *msgChannelWithdrawalAcc:
+			if err := c.addWithdrawalAuthSig(pidx, res.AuthSig); err != nil {
+				return err
+			}
+			sig = res.Sig
+		default:
+			log.Panic("wrong message type")
+		}
+		if err := c.machine.AddSig(ctx, pidx, sig); err != nil {
+			return errors.WithMessage(err, "adding peer signature")
+		}
 	}
+	return nil
+}
 
-	return c.enableNotifyUpdate(ctx)
+// awaitOnChain waits until the on-chain part of the staged deposit or partial
+// withdrawal, if any is in progress, completed. This way, an update that the
+// depositor or withdrawer proposes right after its deposit or withdrawal is
+// not rejected because we still wait for the blockchain. It must be called
+// with the machine mutex held, which is released while waiting.
+func (c *Channel) awaitOnChain() {
+	for c.onChain != nil {
+		done := c.onChain
+		c.machMtx.Unlock()
+		select {
+		case <-done:
+		case <-c.Ctx().Done():
+		}
+		c.machMtx.Lock()
+		if c.Ctx().Err() != nil {
+			return
+		}
+	}
 }
 
 // checkUpdateError is a helper function that checks whether an error occurred
@@ -246,7 +377,36 @@ func (c *Channel) update(ctx context.Context, update func(*channel.State) error)
 	}
 	state.Version++
 
-	return c.updateGeneric(ctx, state, func(mcu *msgChannelUpdate) wire.Msg { return mcu })
+	return c.updateCountered(ctx, state)
+}
+
+// updateCountered proposes the next state to all channel participants. As
+// long as a peer counters and the counter-update handler agrees, the
+// alternative state is proposed instead.
+//
+// It assumes that the channel is locked and the update is validated.
+func (c *Channel) updateCountered(ctx context.Context, next *channel.State) error {
+	for numCounters := 0; ; numCounters++ {
+		err := c.updateGeneric(ctx, next, func(mcu *msgChannelUpdate) wire.Msg { return mcu })
+		var counterErr PeerCounteredUpdateError
+		if err == nil || !errors.As(err, &counterErr) {
+			return err
+		}
+
+		if c.onCounterUpdate == nil {
+			return err
+		}
+		if numCounters >= MaxCounterUpdates {
+			return errors.WithMessagef(err, "exceeded %d counter-updates", MaxCounterUpdates)
+		}
+		if !c.onCounterUpdate(next, counterErr.Counter) {
+			return err
+		}
+		if err := c.validCounterUpdate(next, counterErr.Counter, c.machine.Idx()); err != nil {
+			return errors.WithMessage(err, "invalid counter-update")
+		}
+		next = counterErr.Counter
+	}
 }
 
 // handleUpdateReq is called by the controller on incoming channel update
@@ -258,6 +418,23 @@ func (c *Channel) handleUpdateReq(
 ) {
 	c.machMtx.Lock() // Lock machine while update is in progress.
 	defer c.machMtx.Unlock()
+	c.awaitOnChain()
+
+	// Deposits and withdrawals are checked and accepted by the channel itself.
+	switch req := req.(type) {
+	case *msgChannelDeposit:
+		c.handleDepositReq(pidx, req) //nolint:contextcheck
+		return
+	case *msgChannelWithdrawal:
+		c.handleWithdrawalReq(pidx, req) //nolint:contextcheck
+		return
+	case *msgChannelAssetChange:
+		c.handleAssetChangeReq(pidx, req, uh)
+		return
+	case *msgChannelPipelinedUpdate:
+		c.handlePipelinedUpdateReq(pidx, req, uh) //nolint:contextcheck
+		return
+	}
 
 	if err := c.machine.CheckUpdate(req.Base().State, req.Base().ActorIdx, req.Base().Sig, pidx); err != nil {
 		c.logPeer(pidx).Warnf("invalid update received: %v", err)
@@ -286,8 +463,8 @@ func (c *Channel) handleUpdateReq(
 		return
 	}
 
-	// Check whether this is a valid two-party update.
-	if err := c.validTwoPartyUpdate(req.Base().ChannelUpdate, pidx); err != nil {
+	// Check whether this is a valid update.
+	if err := c.validUpdate(req.Base().ChannelUpdate, pidx); err != nil {
 		c.logPeer(pidx).Warnf("invalid update received: %v", err)
 		return
 	}
@@ -306,8 +483,19 @@ func (c *Channel) handleUpdateAcc(
 		}
 	}()
 
+	if req, ok := req.(*msgChannelPipelinedUpdate); ok {
+		return c.acceptPipelined(ctx, pidx, req)
+	}
+
+	// Asset changes are staged differently and need to be funded.
+	stage := c.machine.Update
+	_, isAssetChange := req.(*msgChannelAssetChange)
+	if isAssetChange {
+		stage = c.machine.ChangeAssets
+	}
+
 	// machine.Update and AddSig should never fail after CheckUpdate...
-	if err = c.machine.Update(ctx, req.Base().State, req.Base().ActorIdx); err != nil {
+	if err = stage(ctx, req.Base().State, req.Base().ActorIdx); err != nil {
 		return errors.WithMessage(err, "updating machine")
 	}
 	// if anything goes wrong from now on, we discard the update.
@@ -322,30 +510,60 @@ func (c *Channel) handleUpdateAcc(
 		}
 	}()
 
-	if err = c.machine.AddSig(ctx, pidx, req.Base().Sig); err != nil {
+	// If subchannel is final, register settlement update at parent channel.
+	if c.IsSubChannel() && req.Base().State.IsFinal {
+		c.Parent().registerSubChannelSettlement(c.ID(), req.Base().State.Balances)
+	}
+
+	if err = c.acceptStaged(ctx, pidx, req, func(m *msgChannelUpdateAcc) wire.Msg { return m }); err != nil {
+		return err
+	}
+
+	if isAssetChange {
+		if err = c.fundAssetChange(ctx); err != nil {
+			return err
+		}
+	}
+
+	return c.enableNotifyUpdate(ctx)
+}
+
+// acceptStaged adds the proposer's signature to the staged update, sends our
+// own signature and collects the signatures of all other peers. It does not
+// enable the update. `prepareAcc` allows to control which message type is
+// being used for the response.
+func (c *Channel) acceptStaged(
+	ctx context.Context,
+	pidx channel.Index,
+	req ChannelUpdateProposal,
+	prepareAcc func(*msgChannelUpdateAcc) wire.Msg,
+) error {
+	if err := c.machine.AddSig(ctx, pidx, req.Base().Sig); err != nil {
 		return errors.WithMessage(err, "adding peer signature")
 	}
-	var sig wallet.Sig
-	sig, err = c.machine.Sig(ctx)
+	sig, err := c.machine.Sig(ctx)
 	if err != nil {
 		return errors.WithMessage(err, "signing updated state")
 	}
 
-	// If subchannel is final, register settlement update at parent channel.
-	if c.IsSubChannel() && req.Base().State.IsFinal {
-		c.Parent().registerSubChannelSettlement(c.ID(), req.Base().State.Balances)
+	// In the multi-party case, we also need the signatures of the other
+	// receivers of the update. They broadcast their responses like we do.
+	resRecv, err := c.conn.NewUpdateResRecv(req.Base().State.Version)
+	if err != nil {
+		return errors.WithMessage(err, "creating update response receiver")
 	}
+	defer resRecv.Close()
 
 	msgUpAcc := &msgChannelUpdateAcc{
 		ChannelID: c.ID(),
 		Version:   req.Base().State.Version,
 		Sig:       sig,
 	}
-	if err := c.conn.Send(ctx, msgUpAcc); err != nil {
+	if err = c.conn.Send(ctx, prepareAcc(msgUpAcc)); err != nil {
 		return errors.WithMessage(err, "sending accept message")
 	}
 
-	return c.enableNotifyUpdate(ctx)
+	return c.receiveUpdateSigs(ctx, resRecv, c.machine.Idx(), pidx)
 }
 
 func (c *Channel) handleUpdateRej(
@@ -368,6 +586,48 @@ func (c *Channel) handleUpdateRej(
 	return errors.WithMessage(c.conn.Send(ctx, msgUpRej), "sending reject message")
 }
 
+func (c *Channel) handleUpdateCounter(
+	ctx context.Context,
+	pidx channel.Index,
+	req ChannelUpdateProposal,
+	next *channel.State,
+) (err error) {
+	defer func() {
+		if err != nil {
+			c.logPeer(pidx).Errorf("error countering state: %v", err)
+		}
+	}()
+
+	if _, ok := req.(*msgChannelUpdate); !ok {
+		return errors.Errorf("cannot counter update of type %v", req.Type())
+	}
+	if err := c.validCounterUpdate(req.Base().State, next, req.Base().ActorIdx); err != nil {
+		err = errors.WithMessage(err, "invalid counter-update")
+		if rerr := c.handleUpdateRej(ctx, pidx, req, err.Error()); rerr != nil {
+			err = errors.WithMessagef(err, "rejecting update: %v", rerr)
+		}
+		return err
+	}
+
+	msgUpCounter := &msgChannelUpdateCounter{
+		msgChannelUpdateRej: msgChannelUpdateRej{
+			ChannelID: c.ID(),
+			Version:   req.Base().State.Version,
+		},
+		State: next,
+	}
+	return errors.WithMessage(c.conn.Send(ctx, msgUpCounter), "sending counter message")
+}
+
+// OnCounterUpdate sets the callback that is called by Channel.Update whenever
+// a peer answers the proposed update with an alternative new state. If the
+// handler returns true, the alternative state is proposed instead. If no
+// handler is set, Update returns a PeerCounteredUpdateError on a
+// counter-update. The handler can be replaced, but not removed.
+func (c *Channel) OnCounterUpdate(handler CounterUpdateHandler) {
+	c.onCounterUpdate = handler
+}
+
 // enableNotifyUpdate enables the current staging state of the machine. If the
 // state is final, machine.EnableFinal is called. Finally, if there is a
 // notification on channel updates, the enabled state is sent on it.
@@ -404,11 +664,11 @@ func (c *Channel) OnUpdate(cb func(from, to *channel.State)) {
 	c.onUpdate = cb
 }
 
-// validTwoPartyUpdate performs additional protocol-dependent checks on the
-// proposed update that go beyond the machine's checks:
+// validUpdate performs additional protocol-dependent checks on the proposed
+// update that go beyond the machine's checks:
 // * Actor and signer must be the same.
 // * Sub-allocations do not change.
-func (c *Channel) validTwoPartyUpdate(up ChannelUpdate, sigIdx channel.Index) error {
+func (c *Channel) validUpdate(up ChannelUpdate, sigIdx channel.Index) error {
 	if up.ActorIdx != sigIdx {
 		return errors.Errorf(
 			"Currently, only update proposals with the proposing peer as actor are allowed.")
@@ -419,9 +679,30 @@ func (c *Channel) validTwoPartyUpdate(up ChannelUpdate, sigIdx channel.Index) er
 	return nil
 }
 
-func (c *Channel) validTwoPartyUpdateState(next *channel.State) error {
+// validCounterUpdate checks that counter is an alternative to the proposed
+// new state, i.e., that it belongs to the same channel and has the same
+// version, and that it is a valid update by actor from the current state. The
+// latter includes the application's transition rules and the conservation of
+// the channel's funds.
+func (c *Channel) validCounterUpdate(proposed, counter *channel.State, actor channel.Index) error {
+	if counter == nil {
+		return errors.New("nil counter state")
+	}
+	if counter.ID != proposed.ID {
+		return errors.New("counter state of different channel")
+	}
+	if counter.Version != proposed.Version {
+		return errors.Errorf("expected counter state version %d, got %d", proposed.Version, counter.Version)
+	}
+	if err := c.validUpdate(makeChannelUpdate(counter, actor), actor); err != nil {
+		return err
+	}
+	return c.machine.CheckTransition(counter, actor)
+}
+
+func (c *Channel) validUpdateState(next *channel.State) error {
 	up := makeChannelUpdate(next, c.machine.Idx())
-	return c.validTwoPartyUpdate(up, c.machine.Idx())
+	return c.validUpdate(up, c.machine.Idx())
 }
 
 func makeChannelUpdate(next *channel.State, actor channel.Index) ChannelUpdate {
@@ -439,3 +720,11 @@ func (e RequestTimedOutError) Error() string {
 func newRequestTimedOutError(requestType, msg string) error {
 	return errors.Wrap(RequestTimedOutError("peer did not respond to the "+requestType), msg)
 }
+
+func (e PeerCounteredUpdateError) Error() string {
+	return "channel update countered by peer"
+}
+
+func newPeerCounteredUpdateError(counter *channel.State) error {
+	return errors.WithStack(PeerCounteredUpdateError{counter})
+}
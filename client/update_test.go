@@ -0,0 +1,222 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/test"
+)
+
+// setupUpdateTest opens a ledger channel between Alice and Bob, where both
+// have a balance of 100. Bob handles update requests with updateHandlerBob.
+func setupUpdateTest(
+	ctx context.Context,
+	t *testing.T,
+	updateHandlerBob client.UpdateHandlerFunc,
+) (chAlice, chBob *client.Channel) {
+	t.Helper()
+	return setupUpdateTestWithHandlers(ctx, t,
+		func(_ *channel.State, _ client.ChannelUpdate, ur *client.UpdateResponder) {
+			ur.Reject(ctx, "unexpected update") //nolint:errcheck
+		},
+		updateHandlerBob)
+}
+
+// setupUpdateTestWithHandlers is like setupUpdateTest, but Alice handles
+// update requests with updateHandlerAlice.
+func setupUpdateTestWithHandlers(
+	ctx context.Context,
+	t *testing.T,
+	updateHandlerAlice, updateHandlerBob client.UpdateHandlerFunc,
+) (chAlice, chBob *client.Channel) {
+	t.Helper()
+	rng := test.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+
+	clients := NewClients(t, rng, []string{"Alice", "Bob"})
+	alice, bob := clients[0], clients[1]
+
+	channelsBob := make(chan *client.Channel, 1)
+	var proposalHandlerBob client.ProposalHandlerFunc = func(cp client.ChannelProposal, pr *client.ProposalResponder) {
+		lcp, ok := cp.(*client.LedgerChannelProposal)
+		if !ok {
+			pr.Reject(ctx, "unexpected proposal") //nolint:errcheck
+			return
+		}
+		ch, err := pr.Accept(ctx, lcp.Accept(bob.Identity.Address(), client.WithRandomNonce()))
+		assert.NoError(t, err)
+		channelsBob <- ch
+	}
+	go bob.Handle(proposalHandlerBob, updateHandlerBob)
+	var proposalHandlerAlice client.ProposalHandlerFunc = func(_ client.ChannelProposal, pr *client.ProposalResponder) {
+		pr.Reject(ctx, "unexpected proposal") //nolint:errcheck
+	}
+	go alice.Handle(proposalHandlerAlice, updateHandlerAlice)
+
+	peers := []wire.Address{alice.Identity.Address(), bob.Identity.Address()}
+	initAlloc := channel.NewAllocation(len(peers), asset)
+	initAlloc.SetAssetBalances(asset, []channel.Bal{big.NewInt(100), big.NewInt(100)})
+	prop, err := client.NewLedgerChannelProposal(challengeDuration, alice.Identity.Address(), initAlloc, peers)
+	require.NoError(t, err)
+	chAlice, err = alice.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	return chAlice, <-channelsBob
+}
+
+// transfer returns an update function that transfers amount from Alice to
+// Bob.
+func transfer(amount int64) func(*channel.State) error {
+	return func(s *channel.State) error {
+		bals := s.Balances[0]
+		bals[0] = new(big.Int).Sub(bals[0], big.NewInt(amount))
+		bals[1] = new(big.Int).Add(bals[1], big.NewInt(amount))
+		return nil
+	}
+}
+
+func TestChannel_CounterUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+
+	// Bob counters transfers of less than 2 with a transfer of 2. Transfers
+	// of 5 are countered unchanged, so they are countered forever. Transfers
+	// of 7 are countered with a state that does not conserve the funds, which
+	// rejects them instead.
+	var numUpdatesBob atomic.Int32
+	chAlice, chBob := setupUpdateTest(ctx, t, func(s *channel.State, up client.ChannelUpdate, ur *client.UpdateResponder) {
+		numUpdatesBob.Add(1)
+		amount := new(big.Int).Sub(up.State.Balances[0][1], s.Balances[0][1]).Int64()
+		switch {
+		case amount == 5:
+			assert.NoError(t, ur.Counter(ctx, up.State))
+		case amount == 7:
+			counter := up.State.Clone()
+			counter.Balances[0][1] = new(big.Int).Add(counter.Balances[0][1], big.NewInt(1))
+			assert.Error(t, ur.Counter(ctx, counter))
+		case amount < 2:
+			counter := s.Clone()
+			counter.Version = up.State.Version
+			assert.NoError(t, transfer(2)(counter))
+			assert.NoError(t, ur.Counter(ctx, counter))
+		default:
+			assert.NoError(t, ur.Accept(ctx))
+		}
+	})
+
+	t.Run("no handler", func(t *testing.T) {
+		err := chAlice.Update(ctx, transfer(1))
+		var counterErr client.PeerCounteredUpdateError
+		require.True(t, errors.As(err, &counterErr))
+		assert.Equal(t, big.NewInt(102), counterErr.Counter.Balances[0][1])
+		assert.Equal(t, uint64(0), chAlice.State().Version)
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		chAlice.OnCounterUpdate(func(_, _ *channel.State) bool { return false })
+		err := chAlice.Update(ctx, transfer(1))
+		assert.True(t, errors.As(err, new(client.PeerCounteredUpdateError)))
+		assert.Equal(t, uint64(0), chAlice.State().Version)
+	})
+
+	t.Run("accepted", func(t *testing.T) {
+		chAlice.OnCounterUpdate(func(_, _ *channel.State) bool { return true })
+		require.NoError(t, chAlice.Update(ctx, transfer(1)))
+		for _, ch := range []*client.Channel{chAlice, chBob} {
+			require.Eventually(t, func() bool {
+				s := ch.State()
+				return s.Version == 1 && s.Balances[0][1].Cmp(big.NewInt(102)) == 0
+			}, testDuration, 10*time.Millisecond)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		chAlice.OnCounterUpdate(func(_, _ *channel.State) bool { return true })
+		err := chAlice.Update(ctx, transfer(7))
+		require.Error(t, err)
+		assert.True(t, errors.As(err, new(client.PeerRejectedError)), err)
+		assert.Equal(t, uint64(1), chAlice.State().Version)
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		numUpdatesBob.Store(0)
+		err := chAlice.Update(ctx, transfer(5))
+		assert.True(t, errors.As(err, new(client.PeerCounteredUpdateError)))
+		assert.EqualValues(t, client.MaxCounterUpdates+1, numUpdatesBob.Load())
+		assert.Equal(t, uint64(1), chAlice.State().Version)
+	})
+}
+
+func TestChannel_UpdateBatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+
+	// Bob is slow to accept the first update, so that the queued updates
+	// pile up in the meantime.
+	var numUpdatesBob atomic.Int32
+	chAlice, chBob := setupUpdateTest(ctx, t, func(_ *channel.State, _ client.ChannelUpdate, ur *client.UpdateResponder) {
+		if numUpdatesBob.Add(1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		assert.NoError(t, ur.Accept(ctx))
+	})
+
+	require.NoError(t, chAlice.UpdateBatch(ctx, transfer(1), transfer(2), transfer(3)))
+	assert.Equal(t, uint64(1), chAlice.State().Version)
+	assert.Equal(t, big.NewInt(106), chAlice.State().Balances[0][1])
+	assert.Error(t, chAlice.UpdateBatch(ctx, transfer(1), func(*channel.State) error {
+		return errors.New("failing update")
+	}))
+	assert.Equal(t, uint64(1), chAlice.State().Version)
+
+	const numUpdates = 20
+	var wg sync.WaitGroup
+	wg.Add(numUpdates + 1)
+	for i := 0; i < numUpdates; i++ {
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, chAlice.QueueUpdate(ctx, transfer(1)))
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		assert.Error(t, chAlice.QueueUpdate(ctx, func(*channel.State) error {
+			return errors.New("failing update")
+		}))
+	}()
+	wg.Wait()
+
+	// All transfers are applied in fewer updates than transfers.
+	for _, ch := range []*client.Channel{chAlice, chBob} {
+		require.Eventually(t, func() bool {
+			return ch.State().Balances[0][1].Cmp(big.NewInt(106+numUpdates)) == 0
+		}, testDuration, 10*time.Millisecond)
+	}
+	assert.Less(t, chAlice.State().Version, uint64(1+numUpdates))
+	assert.Equal(t, chAlice.State().Version, uint64(numUpdatesBob.Load()))
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+)
+
+type (
+	// updateQueue collects the updates that are queued with
+	// Channel.QueueUpdate until they are proposed as one batched update.
+	updateQueue struct {
+		mtx     sync.Mutex
+		pending []*queuedUpdate
+	}
+
+	// queuedUpdate is an update function waiting in the update queue. The
+	// result of the update is sent on done.
+	queuedUpdate struct {
+		update func(*channel.State) error
+		done   chan error
+	}
+)
+
+// UpdateBatch applies all update functions in the given order to the current
+// channel state and proposes the resulting state as a single channel update,
+// so that only one signature round is needed. The update functions must not
+// update the version counter. If any update function fails, no update is
+// proposed.
+//
+// The return values are the same as for Update.
+func (c *Channel) UpdateBatch(ctx context.Context, updates ...func(*channel.State) error) error {
+	return c.Update(ctx, func(state *channel.State) error {
+		for i, update := range updates {
+			if err := update(state); err != nil {
+				return errors.WithMessagef(err, "applying update %d", i)
+			}
+		}
+		return nil
+	})
+}
+
+// QueueUpdate queues the update function and returns once the update was
+// proposed to all other channel participants as part of a batched update.
+// Updates that are queued concurrently while another update is in progress
+// are batched into a single channel update, so that many small updates do not
+// contend for the channel one by one. The update function must not update the
+// version counter.
+//
+// If the update function fails or its result is invalid, the update is
+// skipped and the error is returned, while the other updates of the batch are
+// still proposed. If the batched update fails, the error is returned to all
+// callers whose updates are part of the batch. The batched update is proposed
+// with the context of one of the callers. If the context expires before the
+// update is part of a batch, the update is removed from the queue.
+func (c *Channel) QueueUpdate(ctx context.Context, update func(*channel.State) error) error {
+	if ctx == nil {
+		return errors.New("context must not be nil")
+	}
+
+	q := &queuedUpdate{update: update, done: make(chan error, 1)}
+	c.updateQueue.push(q)
+
+	if !c.machMtx.TryLockCtx(ctx) {
+		if c.updateQueue.remove(q) {
+			return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
+		}
+		// Another caller already took our update into its batch.
+		return <-q.done
+	}
+	defer c.machMtx.Unlock()
+
+	// Our update may have been part of a batch that was proposed while we
+	// were waiting for the machine lock.
+	c.proposeUpdateBatch(ctx, c.updateQueue.popAll())
+	return <-q.done
+}
+
+// proposeUpdateBatch applies the queued updates to the current state and
+// proposes the result as a single channel update. Each queued update is
+// notified of its result.
+//
+// It assumes that the channel is locked.
+func (c *Channel) proposeUpdateBatch(ctx context.Context, batch []*queuedUpdate) {
+	next := c.machine.State().Clone()
+	applied := make([]*queuedUpdate, 0, len(batch))
+	for _, q := range batch {
+		state := next.Clone()
+		if err := q.update(state); err != nil {
+			q.done <- err
+			continue
+		}
+		if err := c.validUpdateState(state); err != nil {
+			q.done <- err
+			continue
+		}
+		next = state
+		applied = append(applied, q)
+	}
+	if len(applied) == 0 {
+		return
+	}
+
+	next.Version++
+	err := c.updateCountered(ctx, next)
+	for _, q := range applied {
+		q.done <- err
+	}
+}
+
+func (q *updateQueue) push(u *queuedUpdate) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.pending = append(q.pending, u)
+}
+
+// remove removes u from the queue and returns whether it was still queued.
+func (q *updateQueue) remove(u *queuedUpdate) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	for i, p := range q.pending {
+		if p == u {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *updateQueue) popAll() []*queuedUpdate {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	batch := q.pending
+	q.pending = nil
+	return batch
+}
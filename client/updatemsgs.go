@@ -39,6 +39,36 @@ func init() {
 			var m msgChannelUpdateRej
 			return &m, m.Decode(r)
 		})
+	wire.RegisterDecoder(wire.ChannelUpdateCounter,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelUpdateCounter
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.ChannelPipelinedUpdate,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelPipelinedUpdate
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.ChannelDeposit,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelDeposit
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.ChannelWithdrawal,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelWithdrawal
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.ChannelWithdrawalAcc,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelWithdrawalAcc
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.ChannelAssetChange,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelAssetChange
+			return &m, m.Decode(r)
+		})
 	wire.RegisterDecoder(wire.VirtualChannelFundingProposal,
 		func(r io.Reader) (wire.Msg, error) {
 			var m virtualChannelFundingProposal
@@ -80,6 +110,52 @@ type (
 		Base() *msgChannelUpdate
 	}
 
+	// msgChannelDeposit is a channel update that proposes a deposit of the
+	// actor into the channel. The new state is only enabled once the deposit
+	// is confirmed on-chain.
+	msgChannelDeposit struct {
+		msgChannelUpdate
+	}
+
+	// msgChannelWithdrawal is a channel update that proposes a partial
+	// withdrawal of the actor from the channel. It additionally holds the
+	// actor's signature on the withdrawal authorization. The new state is
+	// only enabled once the withdrawal is final on-chain.
+	msgChannelWithdrawal struct {
+		msgChannelUpdate
+		// AuthSig is the signature on the channel.WithdrawalAuth by the peer
+		// sending the update.
+		AuthSig wallet.Sig
+	}
+
+	// msgChannelWithdrawalAcc is the positive reply to a msgChannelWithdrawal.
+	// It additionally holds the sender's signature on the withdrawal
+	// authorization.
+	msgChannelWithdrawalAcc struct {
+		msgChannelUpdateAcc
+		// AuthSig is the signature on the channel.WithdrawalAuth by the
+		// sender.
+		AuthSig wallet.Sig
+	}
+
+	// msgChannelAssetChange is a channel update that adds or removes an
+	// asset. If an asset is added, the new state is only enabled once the
+	// new asset is funded.
+	msgChannelAssetChange struct {
+		msgChannelUpdate
+	}
+
+	// msgChannelPipelinedUpdate is a channel update that is proposed before
+	// its predecessor state is enabled, see Channel.EnablePipelining. It
+	// additionally holds the proposer's signature on the predecessor state,
+	// which binds the update to it.
+	msgChannelPipelinedUpdate struct {
+		msgChannelUpdate
+		// PrevSig is the signature on the predecessor state by the peer
+		// sending the update.
+		PrevSig wallet.Sig
+	}
+
 	// msgChannelUpdateAcc is the wire message sent as a positive reply to a
 	// ChannelUpdate.  It references the channel ID and version and contains the
 	// signature on the accepted new state by the sender.
@@ -103,12 +179,27 @@ type (
 		// Reason states why the sender rejectes the proposed new state.
 		Reason string
 	}
+
+	// msgChannelUpdateCounter is the wire message sent as a counter reply to
+	// a ChannelUpdate. It rejects the proposed new state and proposes an
+	// alternative new state of the same version instead.
+	msgChannelUpdateCounter struct {
+		msgChannelUpdateRej
+		// State is the alternative new state.
+		State *channel.State
+	}
 )
 
 var (
 	_ ChannelMsg          = (*msgChannelUpdate)(nil)
+	_ ChannelMsg          = (*msgChannelDeposit)(nil)
+	_ ChannelMsg          = (*msgChannelWithdrawal)(nil)
+	_ ChannelMsg          = (*msgChannelAssetChange)(nil)
+	_ ChannelMsg          = (*msgChannelPipelinedUpdate)(nil)
 	_ channelUpdateResMsg = (*msgChannelUpdateAcc)(nil)
+	_ channelUpdateResMsg = (*msgChannelWithdrawalAcc)(nil)
 	_ channelUpdateResMsg = (*msgChannelUpdateRej)(nil)
+	_ channelUpdateResMsg = (*msgChannelUpdateCounter)(nil)
 )
 
 // Type returns this message's type: ChannelUpdate.
@@ -116,6 +207,31 @@ func (*msgChannelUpdate) Type() wire.Type {
 	return wire.ChannelUpdate
 }
 
+// Type returns this message's type: ChannelDeposit.
+func (*msgChannelDeposit) Type() wire.Type {
+	return wire.ChannelDeposit
+}
+
+// Type returns this message's type: ChannelWithdrawal.
+func (*msgChannelWithdrawal) Type() wire.Type {
+	return wire.ChannelWithdrawal
+}
+
+// Type returns this message's type: ChannelWithdrawalAcc.
+func (*msgChannelWithdrawalAcc) Type() wire.Type {
+	return wire.ChannelWithdrawalAcc
+}
+
+// Type returns this message's type: ChannelAssetChange.
+func (*msgChannelAssetChange) Type() wire.Type {
+	return wire.ChannelAssetChange
+}
+
+// Type returns this message's type: ChannelPipelinedUpdate.
+func (*msgChannelPipelinedUpdate) Type() wire.Type {
+	return wire.ChannelPipelinedUpdate
+}
+
 // Type returns this message's type: ChannelUpdateAcc.
 func (*msgChannelUpdateAcc) Type() wire.Type {
 	return wire.ChannelUpdateAcc
@@ -126,6 +242,11 @@ func (*msgChannelUpdateRej) Type() wire.Type {
 	return wire.ChannelUpdateRej
 }
 
+// Type returns this message's type: ChannelUpdateCounter.
+func (*msgChannelUpdateCounter) Type() wire.Type {
+	return wire.ChannelUpdateCounter
+}
+
 // Base returns the core channel update message.
 func (c *msgChannelUpdate) Base() *msgChannelUpdate {
 	return c
@@ -158,6 +279,42 @@ func (c *msgChannelUpdateAcc) Decode(r io.Reader) (err error) {
 	return err
 }
 
+func (c msgChannelWithdrawal) Encode(w io.Writer) error {
+	return perunio.Encode(w, c.msgChannelUpdate, c.AuthSig)
+}
+
+func (c *msgChannelWithdrawal) Decode(r io.Reader) (err error) {
+	if err := c.msgChannelUpdate.Decode(r); err != nil {
+		return err
+	}
+	c.AuthSig, err = wallet.DecodeSig(r)
+	return err
+}
+
+func (c msgChannelPipelinedUpdate) Encode(w io.Writer) error {
+	return perunio.Encode(w, c.msgChannelUpdate, c.PrevSig)
+}
+
+func (c *msgChannelPipelinedUpdate) Decode(r io.Reader) (err error) {
+	if err := c.msgChannelUpdate.Decode(r); err != nil {
+		return err
+	}
+	c.PrevSig, err = wallet.DecodeSig(r)
+	return err
+}
+
+func (c msgChannelWithdrawalAcc) Encode(w io.Writer) error {
+	return perunio.Encode(w, c.msgChannelUpdateAcc, c.AuthSig)
+}
+
+func (c *msgChannelWithdrawalAcc) Decode(r io.Reader) (err error) {
+	if err := c.msgChannelUpdateAcc.Decode(r); err != nil {
+		return err
+	}
+	c.AuthSig, err = wallet.DecodeSig(r)
+	return err
+}
+
 func (c msgChannelUpdateRej) Encode(w io.Writer) error {
 	return perunio.Encode(w, c.ChannelID, c.Version, c.Reason)
 }
@@ -166,6 +323,17 @@ func (c *msgChannelUpdateRej) Decode(r io.Reader) (err error) {
 	return perunio.Decode(r, &c.ChannelID, &c.Version, &c.Reason)
 }
 
+func (c msgChannelUpdateCounter) Encode(w io.Writer) error {
+	return perunio.Encode(w, c.msgChannelUpdateRej, c.State)
+}
+
+func (c *msgChannelUpdateCounter) Decode(r io.Reader) (err error) {
+	if c.State == nil {
+		c.State = new(channel.State)
+	}
+	return perunio.Decode(r, &c.msgChannelUpdateRej, c.State)
+}
+
 // ID returns the id of the channel this update refers to.
 func (c *msgChannelUpdate) ID() channel.ID {
 	return c.State.ID
@@ -201,6 +369,7 @@ type (
 		msgChannelUpdate
 		Initial  channel.SignedState
 		IndexMap []channel.Index
+		Hops     []channel.ID // Remaining ledger channels the funding is forwarded over.
 	}
 
 	// virtualChannelSettlementProposal is a channel update that proposes the settlement of a virtual channel.
@@ -221,6 +390,7 @@ func (m virtualChannelFundingProposal) Encode(w io.Writer) (err error) {
 		m.Initial.Params,
 		*m.Initial.State,
 		indexMapWithLen(m.IndexMap),
+		channelIDsWithLen(m.Hops),
 	)
 	if err != nil {
 		return
@@ -239,6 +409,7 @@ func (m *virtualChannelFundingProposal) Decode(r io.Reader) (err error) {
 		m.Initial.Params,
 		m.Initial.State,
 		(*indexMapWithLen)(&m.IndexMap),
+		(*channelIDsWithLen)(&m.Hops),
 	)
 	if err != nil {
 		return
@@ -46,6 +46,59 @@ func newRandomMsgChannelUpdate(rng *rand.Rand) *msgChannelUpdate {
 	}
 }
 
+func TestChannelDepositSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for i := 0; i < 4; i++ {
+		m := &msgChannelDeposit{*newRandomMsgChannelUpdate(rng)}
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
+
+func TestChannelAssetChangeSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for i := 0; i < 4; i++ {
+		m := &msgChannelAssetChange{*newRandomMsgChannelUpdate(rng)}
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
+
+func TestChannelPipelinedUpdateSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for i := 0; i < 4; i++ {
+		m := &msgChannelPipelinedUpdate{
+			msgChannelUpdate: *newRandomMsgChannelUpdate(rng),
+			PrevSig:          newRandomSig(rng),
+		}
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
+
+func TestChannelWithdrawalSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for i := 0; i < 4; i++ {
+		m := &msgChannelWithdrawal{
+			msgChannelUpdate: *newRandomMsgChannelUpdate(rng),
+			AuthSig:          newRandomSig(rng),
+		}
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
+
+func TestChannelWithdrawalAccSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for i := 0; i < 4; i++ {
+		m := &msgChannelWithdrawalAcc{
+			msgChannelUpdateAcc: msgChannelUpdateAcc{
+				ChannelID: test.NewRandomChannelID(rng),
+				Version:   uint64(rng.Int63()),
+				Sig:       newRandomSig(rng),
+			},
+			AuthSig: newRandomSig(rng),
+		}
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
+
 func TestSerialization_VirtualChannelFundingProposal(t *testing.T) {
 	rng := pkgtest.Prng(t)
 	for i := 0; i < 4; i++ {
@@ -59,6 +112,7 @@ func TestSerialization_VirtualChannelFundingProposal(t *testing.T) {
 				Sigs:   newRandomSigs(rng, state.NumParts()),
 			},
 			IndexMap: test.NewRandomIndexMap(rng, state.NumParts(), msgUp.State.NumParts()),
+			Hops:     test.NewRandomChannelIDs(rng, i+1),
 		}
 		wiretest.MsgSerializerTest(t, m)
 	}
@@ -135,3 +189,19 @@ func newRandomString(rng *rand.Rand, minLen, maxLenDiff int) string {
 	rng.Read(r)
 	return string(r)
 }
+
+func TestChannelUpdateCounterSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	for i := 0; i < 4; i++ {
+		state := test.NewRandomState(rng)
+		m := &msgChannelUpdateCounter{
+			msgChannelUpdateRej: msgChannelUpdateRej{
+				ChannelID: state.ID,
+				Version:   state.Version,
+				Reason:    newRandomString(rng, 16, 16),
+			},
+			State: state,
+		}
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/pkg/errors"
 
 	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
 	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
 )
@@ -43,8 +44,15 @@ func (c *Client) fundVirtualChannel(ctx context.Context, virtual *Channel, prop
 		return errors.New("referenced parent channel not found")
 	}
 
+	// The funding is forwarded over the intermediary hops from the side of
+	// participant 0.
+	var hops []channel.ID
+	if virtual.Idx() == 0 {
+		hops = prop.Hops
+	}
+
 	indexMap := prop.IndexMaps[virtual.Idx()]
-	err := parent.proposeVirtualChannelFunding(ctx, virtual, indexMap)
+	err := parent.proposeVirtualChannelFunding(ctx, virtual, indexMap, hops)
 	if err != nil {
 		return errors.WithMessage(err, "proposing channel funding")
 	}
@@ -52,7 +60,7 @@ func (c *Client) fundVirtualChannel(ctx context.Context, virtual *Channel, prop
 	return c.completeFunding(ctx, virtual)
 }
 
-func (c *Channel) proposeVirtualChannelFunding(ctx context.Context, virtual *Channel, indexMap []channel.Index) error {
+func (c *Channel) proposeVirtualChannelFunding(ctx context.Context, virtual *Channel, indexMap []channel.Index, hops []channel.ID) error {
 	// We assume that the channel is locked.
 
 	state := c.state().Clone()
@@ -72,6 +80,7 @@ func (c *Channel) proposeVirtualChannelFunding(ctx context.Context, virtual *Cha
 				Sigs:   virtual.machine.CurrentTX().Sigs,
 			},
 			IndexMap: indexMap,
+			Hops:     hops,
 		}
 	})
 	return err
@@ -91,19 +100,113 @@ func (c *Client) handleVirtualChannelFundingProposal(
 	err := c.validateVirtualChannelFundingProposal(ch, prop)
 	if err != nil {
 		c.rejectProposal(responder, err.Error()) //nolint:contextcheck
+		return
 	}
 
 	ctx, cancel := context.WithTimeout(c.Ctx(), virtualFundingTimeout)
 	defer cancel()
 
-	err = c.fundingWatcher.Await(ctx, prop)
+	if len(prop.Hops) > 0 {
+		err = c.forwardVirtualChannelFunding(ctx, ch, prop)
+	} else {
+		err = c.fundingWatcher.Await(ctx, prop)
+	}
 	if err != nil {
 		c.rejectProposal(responder, err.Error()) //nolint:contextcheck
+		return
 	}
 
 	c.acceptProposal(responder) //nolint:contextcheck
 }
 
+// forwardVirtualChannelFunding forwards a virtual channel funding proposal
+// received on ledger channel `in` to the next hop. The intermediary locks the
+// funds of the virtual channel participant on the side of `in` in the next
+// ledger channel and thereby becomes a participant of both parent channels.
+//
+// The returned error is nil if the next hop accepted the funding. We assume
+// that `in` is locked.
+func (c *Client) forwardVirtualChannelFunding(
+	ctx context.Context,
+	in *Channel,
+	prop *virtualChannelFundingProposal,
+) (err error) {
+	next, ok := c.channels.Channel(prop.Hops[0])
+	switch {
+	case !ok:
+		return errors.New("next hop not found")
+	case next == in:
+		return errors.New("next hop equals incoming channel")
+	case !next.IsLedgerChannel():
+		return errors.New("next hop is not a ledger channel")
+	case len(next.Peers()) != gatherNumPeers:
+		return errors.New("next hop must have two participants")
+	}
+
+	if !next.machMtx.TryLockCtx(ctx) {
+		return errors.Errorf("locking next hop in time: %v", ctx.Err())
+	}
+	defer next.machMtx.Unlock()
+
+	if err := channel.AssetsAssertEqual(next.state().Assets, prop.Initial.State.Assets); err != nil {
+		return errors.WithMessage(err, "next hop: assets do not match")
+	}
+
+	// The virtual channel participant on the incoming side is represented by
+	// us in the next hop, the other one by our peer.
+	indexMap := make([]channel.Index, len(prop.IndexMap))
+	for i, idx := range prop.IndexMap {
+		if idx == in.Idx() {
+			indexMap[i] = 1 - next.Idx()
+		} else {
+			indexMap[i] = next.Idx()
+		}
+	}
+
+	virtualBals := transformBalances(prop.Initial.State.Balances, next.state().NumParts(), indexMap)
+	if err := next.state().Balances.AssertGreaterOrEqual(virtualBals); err != nil {
+		return errors.WithMessage(err, "next hop: insufficient funds")
+	}
+
+	// Store state for forwarding the settlement and for withdrawal after
+	// dispute.
+	peers := c.gatherPeers(in, next)
+	virtual, err := c.persistVirtualChannel(ctx, in, peers, *prop.Initial.Params, *prop.Initial.State, prop.Initial.Sigs)
+	if err != nil {
+		return errors.WithMessage(err, "persisting virtual channel")
+	}
+	virtual.virtualNextHop = next
+	if fp, ok := c.pr.(persistence.ForwardingPersister); ok {
+		if err := fp.VirtualChannelForwarded(ctx, virtual.ID(), next.ID()); err != nil {
+			c.discardVirtualChannel(ctx, virtual)
+			return errors.WithMessage(err, "persisting next hop")
+		}
+	}
+
+	if err := next.proposeVirtualChannelFunding(ctx, virtual, indexMap, prop.Hops[1:]); err != nil {
+		c.discardVirtualChannel(ctx, virtual)
+		return errors.WithMessage(err, "forwarding funding proposal")
+	}
+
+	go func() {
+		err := virtual.watchVirtual() //nolint:contextcheck // The context will be derived from the channel context.
+		c.log.Debugf("channel %v: watcher stopped: %v", virtual.ID(), err)
+	}()
+	return nil
+}
+
+// discardVirtualChannel closes and removes a virtual channel whose funding
+// failed. Errors are only logged.
+func (c *Client) discardVirtualChannel(ctx context.Context, virtual *Channel) {
+	c.channels.Delete(virtual.ID())
+	if err := virtual.Close(); err != nil {
+		c.log.Warnf("closing virtual channel: %v", err)
+	}
+	if err := c.pr.ChannelRemoved(ctx, virtual.ID()); err != nil {
+		c.log.Warnf("removing virtual channel from persistence: %v", err)
+	}
+}
+
 func (c *Channel) watchVirtual() error {
 	log := c.Log().WithField("proc", fmt.Sprintf("virtual channel watcher %v", c.ID()))
 	defer log.Info("Watcher returned.")
@@ -175,6 +278,13 @@ func (c *Client) persistVirtualChannel(ctx context.Context, parent *Channel, pee
 		return nil, err
 	}
 
+	// The channel is persisted before the state machine persists its
+	// transitions.
+	parentID := parent.ID()
+	if err := c.pr.ChannelCreated(ctx, ch.machine, peers, &parentID); err != nil {
+		return nil, errors.WithMessage(err, "persisting new channel")
+	}
+
 	err = ch.init(ctx, &state.Allocation, state.Data)
 	if err != nil {
 		return nil, err
@@ -197,9 +307,6 @@ func (c *Client) persistVirtualChannel(ctx context.Context, parent *Channel, pee
 		return nil, err
 	}
 
-	if err := c.pr.ChannelCreated(ctx, ch.machine, peers, nil); err != nil {
-		return ch, errors.WithMessage(err, "persisting new channel")
-	}
 	ok := c.channels.Put(cID, ch)
 	if !ok {
 		return nil, errors.Errorf("failed to put channel into registry: %v", cID)
@@ -0,0 +1,350 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	chprtest "perun.network/go-perun/channel/persistence/test"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	ctest "perun.network/go-perun/client/test"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/sync"
+	"polycry.pt/poly-go/test"
+)
+
+func TestMultiHopVirtualChannelsOptimistic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+
+	mht := setupMultiHopVirtualChannelTest(t, ctx)
+
+	// Settle.
+	var success sync.WaitGroup
+	settleCh := func(ch *client.Channel) {
+		err := ch.Settle(ctx, false)
+		if err != nil {
+			mht.errs <- err
+			return
+		}
+		success.Done()
+	}
+	success.Add(2)
+	go settleCh(mht.chAliceBob)
+	go settleCh(mht.chBobAlice)
+
+	// Wait for success or error.
+	select {
+	case <-success.WaitCh():
+	case err := <-mht.errs:
+		t.Fatalf("Error in go-routine: %v", err)
+	}
+
+	// Test final balances.
+	err := mht.chAliceIngrid1.State().Balances.AssertEqual(channel.Balances{mht.finalBalsAlice})
+	assert.NoError(t, err, "Alice: invalid final balances")
+	err = mht.chIngrid1Ingrid2.State().Balances.AssertEqual(channel.Balances{mht.finalBalsIngrids})
+	assert.NoError(t, err, "Ingrid1: invalid final balances")
+	err = mht.chIngrid2Ingrid1.State().Balances.AssertEqual(channel.Balances{mht.finalBalsIngrids})
+	assert.NoError(t, err, "Ingrid2: invalid final balances")
+	err = mht.chBobIngrid2.State().Balances.AssertEqual(channel.Balances{mht.finalBalsBob})
+	assert.NoError(t, err, "Bob: invalid final balances")
+
+	// The virtual channel is no longer tracked by the intermediaries.
+	for i, c := range []*Client{mht.ingrid1, mht.ingrid2} {
+		_, err := c.Channel(mht.chAliceBob.ID())
+		assert.Errorf(t, err, "intermediary %d: virtual channel still present", i)
+	}
+}
+
+// TestMultiHopVirtualChannelsRestore tests that an intermediary that forwarded
+// the funding of a virtual channel also forwards its settlement after being
+// restored.
+func TestMultiHopVirtualChannelsRestore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+
+	mht := setupMultiHopVirtualChannelTest(t, ctx)
+
+	// Restart Ingrid1.
+	require.NoError(t, mht.ingrid1.Close())
+	setup := mht.ingrid1.RoleSetup
+	ingrid1, err := client.New(setup.Identity.Address(), setup.Bus, setup.Funder, setup.Adjudicator, setup.Wallet, setup.Watcher)
+	require.NoError(t, err)
+	defer ingrid1.Close()
+	ingrid1.EnablePersistence(setup.PR)
+	require.NoError(t, ingrid1.Restore(ctx))
+	go ingrid1.Handle(
+		client.ProposalHandlerFunc(func(cp client.ChannelProposal, pr *client.ProposalResponder) {
+			mht.errs <- errors.Errorf("invalid channel proposal: %v", cp)
+		}),
+		client.UpdateHandlerFunc(func(*channel.State, client.ChannelUpdate, *client.UpdateResponder) {}),
+	)
+
+	// Settle.
+	var success sync.WaitGroup
+	settleCh := func(ch *client.Channel) {
+		if err := ch.Settle(ctx, false); err != nil {
+			mht.errs <- err
+			return
+		}
+		success.Done()
+	}
+	success.Add(2)
+	go settleCh(mht.chAliceBob)
+	go settleCh(mht.chBobAlice)
+
+	select {
+	case <-success.WaitCh():
+	case err := <-mht.errs:
+		t.Fatalf("Error in go-routine: %v", err)
+	}
+
+	// Test final balances.
+	err = mht.chAliceIngrid1.State().Balances.AssertEqual(channel.Balances{mht.finalBalsAlice})
+	assert.NoError(t, err, "Alice: invalid final balances")
+	err = mht.chIngrid2Ingrid1.State().Balances.AssertEqual(channel.Balances{mht.finalBalsIngrids})
+	assert.NoError(t, err, "Ingrid2: invalid final balances")
+	assert.Eventually(t, func() bool {
+		_, err := ingrid1.Channel(mht.chAliceBob.ID())
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "Ingrid1: virtual channel still present")
+}
+
+func TestMultiHopVirtualChannelsDispute(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+
+	mht := setupMultiHopVirtualChannelTest(t, ctx)
+	assert := assert.New(t)
+	waitTimeout := 100 * time.Millisecond
+
+	chs := []*client.Channel{
+		mht.chAliceIngrid1, mht.chIngrid1Alice,
+		mht.chIngrid1Ingrid2, mht.chIngrid2Ingrid1,
+		mht.chBobIngrid2, mht.chIngrid2Bob,
+	}
+	// Register the channels in a random order.
+	perm := rand.Perm(len(chs))
+	t.Logf("perm = %v", perm)
+	for _, i := range perm {
+		err := client.NewTestChannel(chs[i]).Register(ctx)
+		assert.NoErrorf(err, "register channel: %d", i)
+		time.Sleep(waitTimeout) // Sleep to ensure that events have been processed and local client states have been updated.
+	}
+
+	// Settle the channels in a random order.
+	for _, i := range rand.Perm(len(chs)) {
+		err := chs[i].Settle(ctx, false)
+		assert.NoErrorf(err, "settle channel: %d", i)
+	}
+
+	// Test final balances.
+	backend, asset := mht.balanceReader, mht.asset
+	for _, c := range []struct {
+		name     string
+		client   *Client
+		expected *big.Int
+	}{
+		{"alice", mht.alice, mht.finalBalsAlice[0]},
+		{"bob", mht.bob, mht.finalBalsBob[0]},
+		{"ingrid1", mht.ingrid1, new(big.Int).Add(mht.finalBalsAlice[1], mht.finalBalsIngrids[0])},
+		{"ingrid2", mht.ingrid2, new(big.Int).Add(mht.finalBalsIngrids[1], mht.finalBalsBob[1])},
+	} {
+		got := backend.Balance(c.client.Identity.Address(), asset)
+		assert.Truef(got.Cmp(c.expected) == 0, "%s: wrong final balance: got %v, expected %v", c.name, got, c.expected)
+	}
+}
+
+type multiHopVirtualChannelTest struct {
+	alice            *Client
+	bob              *Client
+	ingrid1          *Client
+	ingrid2          *Client
+	chAliceIngrid1   *client.Channel
+	chIngrid1Alice   *client.Channel
+	chIngrid1Ingrid2 *client.Channel
+	chIngrid2Ingrid1 *client.Channel
+	chBobIngrid2     *client.Channel
+	chIngrid2Bob     *client.Channel
+	chAliceBob       *client.Channel
+	chBobAlice       *client.Channel
+	finalBalsAlice   []*big.Int
+	finalBalsIngrids []*big.Int
+	finalBalsBob     []*big.Int
+	errs             chan error
+	balanceReader    ctest.BalanceReader
+	asset            channel.Asset
+}
+
+// setupMultiHopVirtualChannelTest opens a virtual channel between Alice and
+// Bob over the route Alice - Ingrid1 - Ingrid2 - Bob and updates it to a final
+// state.
+func setupMultiHopVirtualChannelTest(t *testing.T, ctx context.Context) (mht multiHopVirtualChannelTest) {
+	t.Helper()
+	rng := test.Prng(t)
+	require := require.New(t)
+
+	// Set test values.
+	asset := chtest.NewRandomAsset(rng)
+	mht.asset = asset
+	initBals := []*big.Int{big.NewInt(10), big.NewInt(10)}         // All ledger channels.
+	initBalsVirtual := []*big.Int{big.NewInt(5), big.NewInt(5)}    // Alice proposes
+	virtualBalsUpdated := []*big.Int{big.NewInt(2), big.NewInt(8)} // Send 3.
+	mht.finalBalsAlice = []*big.Int{big.NewInt(7), big.NewInt(13)}
+	mht.finalBalsIngrids = []*big.Int{big.NewInt(7), big.NewInt(13)}
+	mht.finalBalsBob = []*big.Int{big.NewInt(13), big.NewInt(7)}
+	mht.errs = make(chan error, 10)
+
+	// Setup clients.
+	clients := NewClients(
+		t,
+		rng,
+		[]string{"Alice", "Bob", "Ingrid1", "Ingrid2"},
+	)
+	alice, bob, ingrid1, ingrid2 := clients[0], clients[1], clients[2], clients[3]
+	mht.alice, mht.bob, mht.ingrid1, mht.ingrid2 = alice, bob, ingrid1, ingrid2
+	mht.balanceReader = alice.BalanceReader // Assumes all clients have same backend.
+
+	// Ingrid1 forwards the funding and persists her channels, so that she can
+	// be restored.
+	ingrid1.PR = chprtest.NewPersistRestorer(t)
+	ingrid1.EnablePersistence(ingrid1.PR)
+
+	// The intermediaries accept all ledger channel proposals.
+	var noopUpdateHandler client.UpdateHandlerFunc = func(
+		s *channel.State, cu client.ChannelUpdate, ur *client.UpdateResponder,
+	) {
+	}
+	handleIntermediary := func(ingrid *Client) chan *client.Channel {
+		channels := make(chan *client.Channel, 1)
+		var proposalHandler client.ProposalHandlerFunc = func(cp client.ChannelProposal, pr *client.ProposalResponder) {
+			switch cp := cp.(type) {
+			case *client.LedgerChannelProposal:
+				ch, err := pr.Accept(ctx, cp.Accept(ingrid.Identity.Address(), client.WithRandomNonce()))
+				if err != nil {
+					mht.errs <- errors.WithMessage(err, "accepting ledger channel proposal")
+				}
+				channels <- ch
+			default:
+				mht.errs <- errors.Errorf("invalid channel proposal: %v", cp)
+			}
+		}
+		go ingrid.Client.Handle(proposalHandler, noopUpdateHandler)
+		return channels
+	}
+	channelsIngrid1 := handleIntermediary(ingrid1)
+	channelsIngrid2 := handleIntermediary(ingrid2)
+
+	openLedgerChannel := func(proposer, responder *Client, responderChs chan *client.Channel) (*client.Channel, *client.Channel) {
+		peers := []wire.Address{proposer.Identity.Address(), responder.Identity.Address()}
+		initAlloc := channel.NewAllocation(len(peers), asset)
+		initAlloc.SetAssetBalances(asset, initBals)
+		lcp, err := client.NewLedgerChannelProposal(
+			challengeDuration,
+			proposer.Identity.Address(),
+			initAlloc,
+			peers,
+		)
+		require.NoError(err, "creating ledger channel proposal")
+
+		ch, err := proposer.ProposeChannel(ctx, lcp)
+		require.NoErrorf(err, "opening channel between %s and %s", proposer.Name, responder.Name)
+		select {
+		case resp := <-responderChs:
+			return ch, resp
+		case err := <-mht.errs:
+			t.Fatalf("Error in go-routine: %v", err)
+		}
+		return nil, nil
+	}
+	mht.chAliceIngrid1, mht.chIngrid1Alice = openLedgerChannel(alice, ingrid1, channelsIngrid1)
+	mht.chIngrid1Ingrid2, mht.chIngrid2Ingrid1 = openLedgerChannel(ingrid1, ingrid2, channelsIngrid2)
+	mht.chBobIngrid2, mht.chIngrid2Bob = openLedgerChannel(bob, ingrid2, channelsIngrid2)
+
+	// Setup Bob's proposal and update handler.
+	channelsBob := make(chan *client.Channel, 1)
+	var openingProposalHandlerBob client.ProposalHandlerFunc = func(
+		cp client.ChannelProposal, pr *client.ProposalResponder,
+	) {
+		switch cp := cp.(type) {
+		case *client.VirtualChannelProposal:
+			ch, err := pr.Accept(ctx, cp.Accept(bob.Identity.Address()))
+			if err != nil {
+				mht.errs <- errors.WithMessage(err, "accepting virtual channel proposal")
+			}
+			channelsBob <- ch
+		default:
+			mht.errs <- errors.Errorf("invalid channel proposal: %v", cp)
+		}
+	}
+	var updateProposalHandlerBob client.UpdateHandlerFunc = func(
+		s *channel.State, cu client.ChannelUpdate, ur *client.UpdateResponder,
+	) {
+		err := ur.Accept(ctx)
+		if err != nil {
+			mht.errs <- errors.WithMessage(err, "Bob: accepting channel update")
+		}
+	}
+	go bob.Client.Handle(openingProposalHandlerBob, updateProposalHandlerBob)
+
+	// Establish virtual channel between Alice and Bob via Ingrid1 and Ingrid2.
+	initAllocVirtual := channel.Allocation{
+		Assets:   []channel.Asset{asset},
+		Balances: [][]channel.Bal{initBalsVirtual},
+	}
+	indexMapAlice := []channel.Index{0, 1}
+	indexMapBob := []channel.Index{1, 0}
+	vcp, err := client.NewVirtualChannelProposal(
+		challengeDuration,
+		alice.Identity.Address(),
+		&initAllocVirtual,
+		[]wire.Address{alice.Identity.Address(), bob.Identity.Address()},
+		[]channel.ID{mht.chAliceIngrid1.ID(), mht.chBobIngrid2.ID()},
+		[][]channel.Index{indexMapAlice, indexMapBob},
+		client.WithHops(mht.chIngrid1Ingrid2.ID()),
+	)
+	require.NoError(err, "creating virtual channel proposal")
+
+	mht.chAliceBob, err = alice.ProposeChannel(ctx, vcp)
+	require.NoError(err, "opening channel between Alice and Bob")
+	select {
+	case mht.chBobAlice = <-channelsBob:
+	case err := <-mht.errs:
+		t.Fatalf("Error in go-routine: %v", err)
+	}
+
+	err = mht.chAliceBob.Update(ctx, func(s *channel.State) error {
+		s.Balances = channel.Balances{virtualBalsUpdated}
+		return nil
+	})
+	require.NoError(err, "updating virtual channel")
+
+	err = mht.chAliceBob.Update(ctx, func(s *channel.State) error {
+		s.IsFinal = true
+		return nil
+	})
+	require.NoError(err, "updating virtual channel")
+	return mht
+}
@@ -80,20 +80,63 @@ func (c *Client) handleVirtualChannelSettlementProposal(
 	err := c.validateVirtualChannelSettlementProposal(parent, prop)
 	if err != nil {
 		c.rejectProposal(responder, err.Error()) //nolint:contextcheck
+		return
 	}
 
 	ctx, cancel := context.WithTimeout(c.Ctx(), virtualSettlementTimeout)
 	defer cancel()
 
-	err = c.settlementWatcher.Await(ctx, &proposalAndResponder{
-		prop: prop,
-		resp: responder,
-	})
+	// Forward the settlement if we forwarded the funding of the virtual
+	// channel received on this parent channel.
+	if virtual, ok := c.channels.Channel(prop.Final.State.ID); ok &&
+		virtual.virtualNextHop != nil && virtual.Parent() == parent {
+		err = c.forwardVirtualChannelSettlement(ctx, virtual, prop, responder)
+	} else {
+		err = c.settlementWatcher.Await(ctx, &proposalAndResponder{
+			prop: prop,
+			resp: responder,
+		})
+	}
 	if err != nil {
 		c.rejectProposal(responder, err.Error()) //nolint:contextcheck
 	}
 }
 
+// forwardVirtualChannelSettlement stores the final state of the virtual
+// channel, withdraws it from the next hop and then accepts the settlement
+// proposal on the parent channel.
+func (c *Client) forwardVirtualChannelSettlement(
+	ctx context.Context,
+	virtual *Channel,
+	prop *virtualChannelSettlementProposal,
+	responder *UpdateResponder,
+) error {
+	if err := virtual.forceFinalState(ctx, prop.Final); err != nil {
+		return errors.WithMessage(err, "storing final state")
+	}
+
+	if err := virtual.virtualNextHop.withdrawVirtualChannel(ctx, virtual); err != nil {
+		return errors.WithMessage(err, "forwarding settlement proposal")
+	}
+
+	// Accept parent update proposal and thereby persist parent channel state
+	// before deleting the virtual channel from persistence.
+	if err := responder.Accept(ctx); err != nil {
+		return errors.WithMessage(err, "accepting update")
+	}
+
+	// Close channel and remove from persistence. The update has already been
+	// accepted, so errors are only logged.
+	if err := virtual.Close(); err != nil {
+		c.log.Warnf("closing virtual channel: %v", err)
+	}
+	c.channels.Delete(virtual.ID())
+	if err := virtual.machine.SetWithdrawn(ctx); err != nil {
+		c.log.Debugf("setting virtual channel withdrawn: %v", err)
+	}
+	return nil
+}
+
 func (c *Client) validateVirtualChannelSettlementProposal(
 	parent *Channel,
 	prop *virtualChannelSettlementProposal,
@@ -0,0 +1,421 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+)
+
+// pendingWithdrawal collects the signatures on the authorization of a partial
+// withdrawal.
+type pendingWithdrawal struct {
+	auth *channel.WithdrawalAuth
+	sigs []wallet.Sig
+}
+
+// partialWithdrawalTimeout is the maximal time that a partial withdrawal waits
+// for its on-chain execution. Afterwards, the withdrawal stays staged until it
+// is retried.
+var partialWithdrawalTimeout = 10 * time.Minute
+
+// WithdrawPartial withdraws `amount` of `asset` from the ledger channel to
+// our on-chain account while keeping the channel open. It requires an
+// adjudicator that implements channel.PartialWithdrawer.
+//
+// First, all participants sign a state in which our balance is decreased,
+// together with a channel.WithdrawalAuth for the withdrawn amount. Then, each
+// participant calls the adjudicator's WithdrawPartial, which returns once the
+// withdrawal is final on-chain. Only then the new state is enabled. Peers
+// accept partial withdrawals automatically, as they only decrease the
+// withdrawer's balance. No other update can be made while the withdrawal is
+// in progress.
+//
+// If the withdrawal is rejected, the update is discarded. Once it is signed by
+// all participants, the withdrawal is authorized and might be executed by any
+// of them, so it is kept staged, even if the on-chain withdrawal fails or does
+// not complete within the context's deadline or 10 minutes. A staged
+// withdrawal is completed by RetryWithdrawal and is resumed when the client is
+// restored, if its persister is a persistence.WithdrawalPersister. It is only
+// discarded if the adjudicator reports that it expired, see
+// channel.WithdrawalExpiredError.
+func (c *Channel) WithdrawPartial(ctx context.Context, asset channel.Asset, amount channel.Bal) error {
+	if ctx == nil {
+		return errors.New("context must not be nil")
+	}
+	if !c.IsLedgerChannel() {
+		return errors.New("partial withdrawals are only supported for ledger channels")
+	}
+	if _, ok := c.adjudicator.(channel.PartialWithdrawer); !ok {
+		return errors.New("adjudicator does not support partial withdrawals")
+	}
+	if amount.Sign() <= 0 {
+		return errors.New("withdrawal must be positive")
+	}
+	if err := c.proposeWithdrawal(ctx, asset, amount); err != nil {
+		return err
+	}
+	return c.completeWithdrawal(ctx)
+}
+
+// RetryWithdrawal completes the partial withdrawal that is staged in the
+// channel, see WithdrawPartial. It returns an error if no withdrawal is
+// staged.
+func (c *Channel) RetryWithdrawal(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("context must not be nil")
+	}
+	return c.completeWithdrawal(ctx)
+}
+
+// proposeWithdrawal stages a partial withdrawal and collects the signatures
+// of all peers on it and its authorization. The update is discarded if it is
+// not signed by all peers.
+func (c *Channel) proposeWithdrawal(ctx context.Context, asset channel.Asset, amount channel.Bal) (err error) {
+	if !c.machMtx.TryLockCtx(ctx) {
+		return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
+	}
+	defer c.machMtx.Unlock()
+
+	cur := c.machine.State()
+	next := cur.Clone()
+	assetIdx, ok := next.AssetIndex(asset)
+	if !ok {
+		return errors.New("asset not in channel")
+	}
+	bal := &next.Balances[assetIdx][c.machine.Idx()]
+	if (*bal).Cmp(amount) < 0 {
+		return errors.New("insufficient balance")
+	}
+	*bal = new(big.Int).Sub(*bal, amount)
+	next.Version++
+
+	up := makeChannelUpdate(next, c.machine.Idx())
+	if err = c.machine.WithdrawPartial(ctx, up.State, up.ActorIdx); err != nil {
+		return errors.WithMessage(err, "staging withdrawal")
+	}
+	// if anything goes wrong from now on, we discard the update.
+	defer func() { c.discardWithdrawal(ctx, err) }()
+
+	authSig, err := c.startWithdrawal(cur, next, c.machine.Idx())
+	if err != nil {
+		return err
+	}
+	if err = c.addWithdrawalAuthSig(c.machine.Idx(), authSig); err != nil {
+		return err
+	}
+
+	return c.proposeStaged(ctx, up, func(m *msgChannelUpdate) wire.Msg {
+		return &msgChannelWithdrawal{msgChannelUpdate: *m, AuthSig: authSig}
+	})
+}
+
+// handleWithdrawalReq checks and accepts a partial withdrawal of a peer. It is
+// called by handleUpdateReq, which holds the machine mutex. The withdrawal is
+// completed in the background, as the mutex is released while waiting for it.
+// It is marked as in progress before, so that the withdrawer's next update
+// waits for it.
+func (c *Channel) handleWithdrawalReq(pidx channel.Index, req *msgChannelWithdrawal) {
+	ctx, cancel := context.WithTimeout(c.Ctx(), responseTimeout)
+	defer cancel()
+
+	var err error
+	if _, ok := c.adjudicator.(channel.PartialWithdrawer); !ok {
+		err = errors.New("adjudicator does not support partial withdrawals")
+	} else {
+		err = c.checkWithdrawalReq(pidx, req)
+	}
+	if err != nil {
+		c.logPeer(pidx).Warnf("invalid withdrawal received: %v", err)
+		if rerr := c.handleUpdateRej(ctx, pidx, req, err.Error()); rerr != nil {
+			c.logPeer(pidx).Warnf("rejecting withdrawal: %v", rerr)
+		}
+		return
+	}
+
+	if err := c.acceptWithdrawal(ctx, pidx, req); err != nil {
+		c.logPeer(pidx).Errorf("accepting withdrawal: %v", err)
+		return
+	}
+	c.resumeWithdrawal()
+}
+
+func (c *Channel) checkWithdrawalReq(pidx channel.Index, req *msgChannelWithdrawal) error {
+	up := req.Base().ChannelUpdate
+	switch {
+	case !c.IsLedgerChannel():
+		return errors.New("partial withdrawals are only supported for ledger channels")
+	case up.ActorIdx != pidx:
+		return errors.New("withdrawer must be the proposer")
+	}
+	if err := c.machine.CheckWithdrawPartial(up.State, up.ActorIdx, req.Base().Sig, pidx); err != nil {
+		return err
+	}
+	auth := channel.NewWithdrawalAuth(c.machine.State(), up.State, pidx)
+	if ok, err := channel.VerifyWithdrawalAuth(c.Params().Parts[pidx], auth, req.AuthSig); err != nil {
+		return errors.WithMessage(err, "verifying withdrawal authorization")
+	} else if !ok {
+		return errors.New("invalid withdrawal authorization signature")
+	}
+	return nil
+}
+
+// acceptWithdrawal stages the partial withdrawal of a peer and sends our
+// signatures on it and its authorization. The update is discarded if it is
+// not signed by all participants.
+func (c *Channel) acceptWithdrawal(ctx context.Context, pidx channel.Index, req *msgChannelWithdrawal) (err error) {
+	cur := c.machine.State()
+	if err = c.machine.WithdrawPartial(ctx, req.Base().State, req.Base().ActorIdx); err != nil {
+		return errors.WithMessage(err, "staging withdrawal")
+	}
+	// if anything goes wrong from now on, we discard the update.
+	defer func() { c.discardWithdrawal(ctx, err) }()
+
+	authSig, err := c.startWithdrawal(cur, req.Base().State, pidx)
+	if err != nil {
+		return err
+	}
+	if err = c.addWithdrawalAuthSig(pidx, req.AuthSig); err != nil {
+		return err
+	}
+	if err = c.addWithdrawalAuthSig(c.machine.Idx(), authSig); err != nil {
+		return err
+	}
+
+	return c.acceptStaged(ctx, pidx, req, func(m *msgChannelUpdateAcc) wire.Msg {
+		return &msgChannelWithdrawalAcc{msgChannelUpdateAcc: *m, AuthSig: authSig}
+	})
+}
+
+// discardWithdrawal discards the staged withdrawal if err is not nil.
+func (c *Channel) discardWithdrawal(ctx context.Context, err error) {
+	if err != nil {
+		c.checkUpdateError(ctx, err)
+		c.withdrawal = nil
+	}
+}
+
+// resumeWithdrawal completes the staged withdrawal in the background. It is
+// used when a peer's withdrawal was accepted and when the client is restored.
+// It must be called with the machine mutex held, so that the withdrawal is
+// marked as in progress before any other update request is handled.
+func (c *Channel) resumeWithdrawal() {
+	req, done, err := c.beginWithdrawal(c.Ctx())
+	if err != nil {
+		c.Log().Errorf("Completing withdrawal: %v", err)
+		return
+	}
+	go func() {
+		if err := c.executeWithdrawal(c.Ctx(), req, done); err != nil {
+			c.Log().Errorf("Completing withdrawal: %v", err)
+		}
+	}()
+}
+
+// completeWithdrawal executes the staged withdrawal on-chain and enables it.
+// The machine mutex is released while waiting for the on-chain withdrawal,
+// which is bound by the partialWithdrawalTimeout. If the on-chain withdrawal
+// fails, the withdrawal stays staged, unless it expired.
+func (c *Channel) completeWithdrawal(ctx context.Context) error {
+	if !c.machMtx.TryLockCtx(ctx) {
+		return errors.Errorf("locking machine mutex in time: %v", ctx.Err())
+	}
+	req, done, err := c.beginWithdrawal(ctx)
+	c.machMtx.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.executeWithdrawal(ctx, req, done)
+}
+
+// beginWithdrawal persists the authorization signatures of the staged
+// withdrawal, marks it as being executed and returns its request and the
+// channel that must be closed by executeWithdrawal. The machine mutex must be
+// held.
+func (c *Channel) beginWithdrawal(ctx context.Context) (*channel.PartialWithdrawalReq, chan struct{}, error) {
+	req, err := c.stagedWithdrawalReq()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.onChain != nil {
+		return nil, nil, errors.New("withdrawal already in progress")
+	}
+	if err := c.persistWithdrawal(ctx, req.AuthSigs); err != nil {
+		return nil, nil, err
+	}
+	done := make(chan struct{})
+	c.onChain = done
+	return req, done, nil
+}
+
+// executeWithdrawal executes the withdrawal that was begun by beginWithdrawal
+// on-chain and enables it. It must be called without holding the machine
+// mutex.
+func (c *Channel) executeWithdrawal(ctx context.Context, req *channel.PartialWithdrawalReq, done chan struct{}) error {
+	defer close(done)
+	version := req.Auth.Version
+
+	withdrawCtx, cancel := context.WithTimeout(ctx, partialWithdrawalTimeout)
+	defer cancel()
+	err := c.adjudicator.(channel.PartialWithdrawer).WithdrawPartial(withdrawCtx, *req)
+
+	// The machine mutex is locked before the withdrawal is marked complete,
+	// so that waiting update requests see the enabled withdrawal.
+	c.machMtx.Lock()
+	defer c.machMtx.Unlock()
+	c.onChain = nil
+	// The withdrawal may have been completed concurrently, e.g., by a retry.
+	if c.machine.State().Version >= version {
+		return nil
+	}
+	if c.machine.Phase() != channel.Signing || c.machine.StagingState().Version != version {
+		return errors.New("withdrawal was discarded while withdrawing on-chain")
+	}
+	if channel.IsWithdrawalExpiredError(err) {
+		c.discardWithdrawal(ctx, err)
+		if perr := c.persistWithdrawal(ctx, nil); perr != nil {
+			c.Log().Warnf("Clearing withdrawal signatures: %v", perr)
+		}
+	}
+	if err != nil {
+		return errors.WithMessage(err, "withdrawing on-chain")
+	}
+
+	if err := c.enableNotifyUpdate(ctx); err != nil {
+		return err
+	}
+	c.withdrawal = nil
+	return errors.WithMessage(c.persistWithdrawal(ctx, nil), "clearing withdrawal signatures")
+}
+
+// stagedWithdrawalReq returns the request for the on-chain execution of the
+// staged withdrawal. It returns an error if no withdrawal that is signed by
+// all participants is staged.
+func (c *Channel) stagedWithdrawalReq() (*channel.PartialWithdrawalReq, error) {
+	if c.machine.Phase() != channel.Signing || c.withdrawal == nil ||
+		c.withdrawal.auth.Version != c.machine.StagingState().Version {
+		return nil, errors.New("no withdrawal staged")
+	}
+	if !fullySigned(c.machine.StagingTX()) {
+		return nil, errors.New("withdrawal not signed by all participants")
+	}
+	for i, sig := range c.withdrawal.sigs {
+		if sig == nil {
+			return nil, errors.Errorf("missing withdrawal authorization signature[%d]", i)
+		}
+	}
+	return &channel.PartialWithdrawalReq{
+		AdjudicatorReq: channel.AdjudicatorReq{
+			Params:    c.Params(),
+			Acc:       c.machine.Account(),
+			Tx:        c.machine.StagingTX(),
+			Idx:       c.machine.Idx(),
+			Secondary: c.withdrawal.auth.Idx != c.machine.Idx(),
+		},
+		Auth:     *c.withdrawal.auth,
+		AuthSigs: c.withdrawal.sigs,
+	}, nil
+}
+
+// persistWithdrawal persists the authorization signatures of the staged
+// withdrawal, or clears them if sigs is nil, if the client's persister is a
+// persistence.WithdrawalPersister.
+func (c *Channel) persistWithdrawal(ctx context.Context, sigs []wallet.Sig) error {
+	wp, ok := c.client.pr.(persistence.WithdrawalPersister)
+	if !ok {
+		return nil
+	}
+	return errors.WithMessage(wp.WithdrawalAuthorized(ctx, c.ID(), sigs), "persisting withdrawal signatures")
+}
+
+// restoreWithdrawal restores the staged withdrawal of participant idx with
+// the persisted authorization signatures.
+func (c *Channel) restoreWithdrawal(idx channel.Index, sigs []wallet.Sig) error {
+	c.machMtx.Lock()
+	defer c.machMtx.Unlock()
+
+	c.withdrawal = &pendingWithdrawal{
+		auth: channel.NewWithdrawalAuth(c.machine.State(), c.machine.StagingState(), idx),
+		sigs: make([]wallet.Sig, len(c.Peers())),
+	}
+	for i, sig := range sigs {
+		if err := c.addWithdrawalAuthSig(channel.Index(i), sig); err != nil {
+			c.withdrawal = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// isWithdrawal returns the index of the withdrawer if the staged transaction
+// `tx` is a partial withdrawal from the state `cur` that is signed by all
+// participants. In contrast to other updates, withdrawals decrease the
+// channel's funds.
+func isWithdrawal(cur *channel.State, tx channel.Transaction) (channel.Index, bool) {
+	if !fullySigned(tx) || len(tx.Assets) != len(cur.Assets) {
+		return 0, false
+	}
+	curSum, nextSum := cur.Sum(), tx.Sum()
+	for a := range curSum {
+		if nextSum[a].Cmp(curSum[a]) >= 0 {
+			continue
+		}
+		for i, bal := range tx.Balances[a] {
+			if bal.Cmp(cur.Balances[a][i]) < 0 {
+				return channel.Index(i), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// startWithdrawal sets up the collection of authorization signatures for the
+// withdrawal of participant `idx` from state `from` to state `to` and returns
+// our own signature on the authorization.
+func (c *Channel) startWithdrawal(from, to *channel.State, idx channel.Index) (wallet.Sig, error) {
+	auth := channel.NewWithdrawalAuth(from, to, idx)
+	sig, err := channel.SignWithdrawalAuth(c.machine.Account(), auth)
+	if err != nil {
+		return nil, errors.WithMessage(err, "signing withdrawal authorization")
+	}
+	c.withdrawal = &pendingWithdrawal{
+		auth: auth,
+		sigs: make([]wallet.Sig, len(c.Peers())),
+	}
+	return sig, nil
+}
+
+// addWithdrawalAuthSig verifies and adds the signature of participant `idx`
+// on the authorization of the withdrawal in progress.
+func (c *Channel) addWithdrawalAuthSig(idx channel.Index, sig wallet.Sig) error {
+	if c.withdrawal == nil {
+		return errors.New("no withdrawal in progress")
+	}
+	if ok, err := channel.VerifyWithdrawalAuth(c.Params().Parts[idx], c.withdrawal.auth, sig); err != nil {
+		return errors.WithMessagef(err, "verifying withdrawal authorization signature[%d]", idx)
+	} else if !ok {
+		return errors.Errorf("invalid withdrawal authorization signature[%d]", idx)
+	}
+	c.withdrawal.sigs[idx] = sig
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	ctest "perun.network/go-perun/client/test"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/test"
+)
+
+func TestChannel_WithdrawPartial(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+	defer cancel()
+	rng := test.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+
+	clients := NewClients(t, rng, []string{"Alice", "Bob"})
+	alice, bob := clients[0], clients[1]
+
+	// Bob accepts the ledger channel. Both accept all updates.
+	channelsBob := make(chan *client.Channel, 1)
+	var proposalHandlerBob client.ProposalHandlerFunc = func(cp client.ChannelProposal, pr *client.ProposalResponder) {
+		lcp, ok := cp.(*client.LedgerChannelProposal)
+		if !ok {
+			pr.Reject(ctx, "unexpected proposal") //nolint:errcheck
+			return
+		}
+		ch, err := pr.Accept(ctx, lcp.Accept(bob.Identity.Address(), client.WithRandomNonce()))
+		assert.NoError(t, err)
+		channelsBob <- ch
+	}
+	var updateHandler client.UpdateHandlerFunc = func(_ *channel.State, _ client.ChannelUpdate, ur *client.UpdateResponder) {
+		ur.Accept(ctx) //nolint:errcheck
+	}
+	go bob.Handle(proposalHandlerBob, updateHandler)
+	var proposalHandlerAlice client.ProposalHandlerFunc = func(_ client.ChannelProposal, pr *client.ProposalResponder) {
+		pr.Reject(ctx, "unexpected proposal") //nolint:errcheck
+	}
+	go alice.Handle(proposalHandlerAlice, updateHandler)
+
+	peers := []wire.Address{alice.Identity.Address(), bob.Identity.Address()}
+	initAlloc := channel.NewAllocation(len(peers), asset)
+	initAlloc.SetAssetBalances(asset, []channel.Bal{big.NewInt(10), big.NewInt(10)})
+	prop, err := client.NewLedgerChannelProposal(challengeDuration, alice.Identity.Address(), initAlloc, peers)
+	require.NoError(t, err)
+	chAlice, err := alice.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	chBob := <-channelsBob
+
+	// assertBalances asserts that both channels eventually have the given
+	// balances in the given version.
+	assertBalances := func(version uint64, bals ...int64) {
+		t.Helper()
+		expected := channel.Balances{{big.NewInt(bals[0]), big.NewInt(bals[1])}}
+		for _, ch := range []*client.Channel{chAlice, chBob} {
+			require.Eventually(t, func() bool {
+				s := ch.State()
+				return s.Version == version && s.Balances.Equal(expected)
+			}, testDuration, 10*time.Millisecond)
+		}
+	}
+	// assertOnChain asserts the on-chain balances of Alice and Bob.
+	assertOnChain := func(bals ...int64) {
+		t.Helper()
+		for i, c := range []*Client{alice, bob} {
+			got := alice.BalanceReader.Balance(c.Identity.Address(), asset)
+			assert.Zerof(t, got.Cmp(big.NewInt(bals[i])), "%s: wrong balance: %v", c.Name, got)
+		}
+	}
+
+	require.NoError(t, chAlice.WithdrawPartial(ctx, asset, big.NewInt(4)))
+	assertBalances(1, 6, 10)
+	assertOnChain(4, 0)
+	require.NoError(t, chBob.WithdrawPartial(ctx, asset, big.NewInt(10)))
+	assertBalances(2, 6, 0)
+	assertOnChain(4, 10)
+
+	// Invalid withdrawals.
+	assert.Error(t, chAlice.WithdrawPartial(ctx, asset, big.NewInt(0)))
+	assert.Error(t, chAlice.WithdrawPartial(ctx, asset, big.NewInt(7)))
+	assert.Error(t, chAlice.WithdrawPartial(ctx, chtest.NewRandomAsset(rng), big.NewInt(1)))
+	assertBalances(2, 6, 0)
+
+	// The channel stays usable.
+	require.NoError(t, chAlice.Update(ctx, func(s *channel.State) error {
+		s.Balances = channel.Balances{{big.NewInt(1), big.NewInt(5)}}
+		s.IsFinal = true
+		return nil
+	}))
+	assertBalances(3, 1, 5)
+
+	require.NoError(t, chAlice.Settle(ctx, false))
+	require.NoError(t, chBob.Settle(ctx, false))
+	assertOnChain(5, 15)
+}
+
+func TestChannel_WithdrawPartialRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), twoPartyTestTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+	s := newFaultSetup(t, rng)
+	ch, err := s.open(ctx)
+	require.NoError(t, err)
+
+	// The withdrawal is authorized by both, but Alice's on-chain withdrawal
+	// times out.
+	s.faults.Fail(ctest.FaultWithdrawPartial, 1, ctest.TxTimedoutFault(ctest.FaultWithdrawPartial))
+	err = ch.WithdrawPartial(ctx, s.asset, big.NewInt(4))
+	require.Error(t, err)
+	assert.True(t, isTxTimedout(err), err)
+
+	// The withdrawal stays staged, so that no other update can be made.
+	assert.Equal(t, uint64(0), ch.State().Version)
+	assert.Error(t, ch.Update(ctx, payBob(false)))
+	assert.Error(t, ch.WithdrawPartial(ctx, s.asset, big.NewInt(1)))
+
+	require.NoError(t, ch.RetryWithdrawal(ctx))
+	assert.Equal(t, uint64(1), ch.State().Version)
+	assert.Equal(t, big.NewInt(6), ch.State().Balances[0][0])
+	assert.Error(t, ch.RetryWithdrawal(ctx), "no withdrawal staged")
+
+	require.NoError(t, ch.Update(ctx, payBob(true)))
+	require.NoError(t, ch.Settle(ctx, false))
+	assert.Equal(t, big.NewInt(9), s.backend.Balance(s.aliceAcc, s.asset))
+	assert.Equal(t, big.NewInt(11), s.backend.Balance(s.bobAcc, s.asset))
+}
@@ -0,0 +1,26 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package routing maintains a graph of the Perun payment network and finds
+// routes of ledger channels between two peers.
+//
+// A Graph is fed by the local channels of a client and by channel
+// announcements that are exchanged with other nodes by a Gossiper. Routes
+// returned by Graph.FindRoute can be turned into VirtualChannelProposals that
+// open a virtual channel over the intermediaries of the route.
+//
+// Announcements are not authenticated and only serve as hints. Balances of
+// remote channels may be outdated, so a route can still fail when the
+// intermediaries lock the funds.
+package routing // import "perun.network/go-perun/routing"
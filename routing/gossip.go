@@ -0,0 +1,174 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"context"
+	stdsync "sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+	perror "polycry.pt/poly-go/errors"
+	"polycry.pt/poly-go/sync"
+)
+
+// sendTimeout is the timeout for relaying a single announcement to a peer.
+const sendTimeout = 10 * time.Second
+
+// Gossiper exchanges channel announcements with other nodes. It receives
+// announcements on its own wire address, adds them to the graph and floods
+// announcements that were new to the graph to all other known peers.
+type Gossiper struct {
+	sync.Closer
+
+	graph *Graph
+	bus   wire.Bus
+	addr  wire.Address
+	recv  *wire.Receiver
+	ctx   context.Context
+
+	mu    stdsync.Mutex
+	peers map[wallet.AddrKey]wire.Address
+}
+
+// NewGossiper creates a new Gossiper that feeds the given graph and receives
+// announcements over the bus on the given address. Serve must be called to
+// start handling announcements.
+func NewGossiper(g *Graph, bus wire.Bus, addr wire.Address) (*Gossiper, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	gos := &Gossiper{
+		graph: g,
+		bus:   bus,
+		addr:  addr,
+		recv:  wire.NewReceiver(),
+		ctx:   ctx,
+		peers: make(map[wallet.AddrKey]wire.Address),
+	}
+	if err := bus.SubscribeClient(gos.recv, addr); err != nil {
+		cancel()
+		return nil, errors.WithMessage(err, "subscribing to bus")
+	}
+	gos.OnCloseAlways(func() {
+		cancel()
+		if err := gos.recv.Close(); err != nil {
+			log.Warnf("Closing gossip receiver: %v", err)
+		}
+	})
+	return gos, nil
+}
+
+// AddPeer adds the gossip address of another node. Announcements are sent to
+// all added peers.
+func (g *Gossiper) AddPeer(peer wire.Address) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.peers[wallet.Key(peer)] = peer
+}
+
+// RemovePeer removes a peer that was added with AddPeer.
+func (g *Gossiper) RemovePeer(peer wire.Address) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.peers, wallet.Key(peer))
+}
+
+// Announce sends the given channels to all peers.
+func (g *Gossiper) Announce(ctx context.Context, infos ...ChannelInfo) error {
+	for _, info := range infos {
+		if err := info.Valid(); err != nil {
+			return errors.WithMessagef(err, "invalid channel %x", info.ID)
+		}
+	}
+
+	errg := perror.NewGatherer()
+	for _, peer := range g.peerList(nil) {
+		peer := peer
+		errg.Go(func() error {
+			for _, info := range infos {
+				msg := &msgChannelAnnouncement{Info: info}
+				if err := g.bus.Publish(ctx, &wire.Envelope{Sender: g.addr, Recipient: peer, Msg: msg}); err != nil {
+					return errors.WithMessagef(err, "announcing to peer %v", peer)
+				}
+			}
+			return nil
+		})
+	}
+	return errg.Wait()
+}
+
+// AnnounceLocal sends the current state of all local channels of the graph to
+// all peers.
+func (g *Gossiper) AnnounceLocal(ctx context.Context) error {
+	return g.Announce(ctx, g.graph.LocalChannels()...)
+}
+
+// Serve handles announcements of other nodes until the Gossiper is closed.
+func (g *Gossiper) Serve() error {
+	for {
+		env, err := g.recv.Next(g.ctx)
+		if err != nil {
+			if g.IsClosed() {
+				return nil
+			}
+			return errors.WithMessage(err, "receiving announcement")
+		}
+		g.handle(env)
+	}
+}
+
+func (g *Gossiper) handle(env *wire.Envelope) {
+	m, ok := env.Msg.(*msgChannelAnnouncement)
+	if !ok {
+		log.WithField("peer", env.Sender).Warnf("Gossiper received unexpected message %v", env.Msg.Type())
+		return
+	}
+	updated, err := g.graph.UpdateChannel(m.Info)
+	if err != nil {
+		log.WithField("peer", env.Sender).Warnf("Gossiper received invalid announcement: %v", err)
+		return
+	}
+	if !updated {
+		return
+	}
+	for _, peer := range g.peerList(env.Sender) {
+		go g.send(peer, m)
+	}
+}
+
+func (g *Gossiper) send(peer wire.Address, msg wire.Msg) {
+	ctx, cancel := context.WithTimeout(g.ctx, sendTimeout)
+	defer cancel()
+	if err := g.bus.Publish(ctx, &wire.Envelope{Sender: g.addr, Recipient: peer, Msg: msg}); err != nil {
+		log.WithField("peer", peer).Warnf("Gossiper could not relay announcement: %v", err)
+	}
+}
+
+// peerList returns all peers except the given one, which may be nil.
+func (g *Gossiper) peerList(except wire.Address) []wire.Address {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	peers := make([]wire.Address, 0, len(g.peers))
+	for _, p := range g.peers {
+		if except != nil && p.Equal(except) {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
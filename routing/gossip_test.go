@@ -0,0 +1,188 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	ctest "perun.network/go-perun/client/test"
+	"perun.network/go-perun/routing"
+	wtest "perun.network/go-perun/wallet/test"
+	"perun.network/go-perun/watcher/local"
+	"perun.network/go-perun/wire"
+	wiretest "perun.network/go-perun/wire/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+const (
+	testTimeout       = 10 * time.Second
+	challengeDuration = 60
+)
+
+type node struct {
+	*client.Client
+	addr       wire.Address
+	graph      *routing.Graph
+	gossiper   *routing.Gossiper
+	gossipAddr wire.Address
+	accepted   chan *client.Channel
+}
+
+// TestGossip_VirtualChannel opens a virtual channel over a route that was
+// found from gossiped channel announcements.
+func TestGossip_VirtualChannel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rng := pkgtest.Prng(t)
+	backend := ctest.NewMockBackend(rng)
+	bus := wiretest.NewSerializingLocalBus()
+	asset := chtest.NewRandomAsset(rng)
+
+	// Setup the line Alice - Ingrid1 - Ingrid2 - Bob.
+	nodes := make([]*node, 4)
+	for i := range nodes {
+		w := wtest.NewWallet()
+		acc := w.NewRandomAccount(rng)
+		watcher, err := local.NewWatcher(backend)
+		require.NoError(t, err)
+		c, err := client.New(acc.Address(), bus, backend, backend, w, watcher)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() }) //nolint:errcheck
+
+		g := routing.NewGraph()
+		gossipAddr := wiretest.NewRandomAddress(rng)
+		gos, err := routing.NewGossiper(g, bus, gossipAddr)
+		require.NoError(t, err)
+		t.Cleanup(func() { gos.Close() }) //nolint:errcheck
+		go gos.Serve()                    //nolint:errcheck
+
+		nd := &node{
+			Client:     c,
+			addr:       acc.Address(),
+			graph:      g,
+			gossiper:   gos,
+			gossipAddr: gossipAddr,
+			accepted:   make(chan *client.Channel, 1),
+		}
+		go c.Handle(nd.proposalHandler(ctx), nd.updateHandler(ctx))
+		nodes[i] = nd
+	}
+	alice, ingrid1, ingrid2, bob := nodes[0], nodes[1], nodes[2], nodes[3]
+	openLedgerChannel(ctx, t, asset, alice, ingrid1)
+	openLedgerChannel(ctx, t, asset, ingrid1, ingrid2)
+	openLedgerChannel(ctx, t, asset, bob, ingrid2)
+
+	// Announce the local channels along the line. The announcements are
+	// relayed by the intermediaries.
+	for i := 0; i+1 < len(nodes); i++ {
+		nodes[i].gossiper.AddPeer(nodes[i+1].gossipAddr)
+		nodes[i+1].gossiper.AddPeer(nodes[i].gossipAddr)
+	}
+	for _, nd := range nodes {
+		require.NoError(t, nd.gossiper.AnnounceLocal(ctx))
+	}
+
+	var routes []routing.Route
+	require.Eventually(t, func() bool {
+		var err error
+		routes, err = alice.graph.FindRoute(alice.addr, bob.addr, asset, big.NewInt(5))
+		return err == nil
+	}, testTimeout, 10*time.Millisecond)
+	r := routes[0]
+	require.Len(t, r, 3)
+	assert.True(t, r.Intermediaries()[0].Equal(ingrid1.addr))
+	assert.True(t, r.Intermediaries()[1].Equal(ingrid2.addr))
+
+	// Open the virtual channel over the route.
+	initBals := channel.NewAllocation(2, asset)
+	initBals.SetAssetBalances(asset, []channel.Bal{big.NewInt(5), big.NewInt(5)})
+	prop, err := r.VirtualChannelProposal(challengeDuration, alice.addr, initBals)
+	require.NoError(t, err)
+	vch, err := alice.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	select {
+	case <-bob.accepted:
+	case <-ctx.Done():
+		t.Fatal("Bob did not accept virtual channel")
+	}
+
+	require.NoError(t, vch.Update(ctx, func(s *channel.State) error {
+		s.Balances = channel.Balances{{big.NewInt(2), big.NewInt(8)}}
+		return nil
+	}))
+
+	// The locked funds are reflected in the local channels of the graph.
+	routes, err = alice.graph.FindRoute(alice.addr, ingrid1.addr, asset, big.NewInt(5))
+	require.NoError(t, err)
+	require.Len(t, routes[0], 1)
+	info, ok := alice.graph.Channel(routes[0][0].Channel)
+	require.True(t, ok)
+	assert.Zero(t, info.Alloc.Balance(routes[0][0].FromIdx, asset).Cmp(big.NewInt(5)))
+}
+
+func openLedgerChannel(ctx context.Context, t *testing.T, asset channel.Asset, proposer, responder *node) {
+	t.Helper()
+	peers := []wire.Address{proposer.addr, responder.addr}
+	alloc := channel.NewAllocation(len(peers), asset)
+	alloc.SetAssetBalances(asset, []channel.Bal{big.NewInt(10), big.NewInt(10)})
+	prop, err := client.NewLedgerChannelProposal(challengeDuration, proposer.addr, alloc, peers)
+	require.NoError(t, err)
+
+	ch, err := proposer.ProposeChannel(ctx, prop)
+	require.NoError(t, err)
+	var resp *client.Channel
+	select {
+	case resp = <-responder.accepted:
+	case <-ctx.Done():
+		t.Fatal("responder did not accept ledger channel")
+	}
+	require.NoError(t, proposer.graph.AddLocalChannel(ch))
+	require.NoError(t, responder.graph.AddLocalChannel(resp))
+}
+
+func (nd *node) proposalHandler(ctx context.Context) client.ProposalHandlerFunc {
+	return func(p client.ChannelProposal, r *client.ProposalResponder) {
+		var acc client.ChannelProposalAccept
+		switch p := p.(type) {
+		case *client.LedgerChannelProposal:
+			acc = p.Accept(nd.addr, client.WithRandomNonce())
+		case *client.VirtualChannelProposal:
+			acc = p.Accept(nd.addr)
+		default:
+			r.Reject(ctx, "unexpected proposal") //nolint:errcheck
+			return
+		}
+		ch, err := r.Accept(ctx, acc)
+		if err != nil {
+			return
+		}
+		nd.accepted <- ch
+	}
+}
+
+func (nd *node) updateHandler(ctx context.Context) client.UpdateHandlerFunc {
+	return func(_ *channel.State, _ client.ChannelUpdate, r *client.UpdateResponder) {
+		r.Accept(ctx) //nolint:errcheck
+	}
+}
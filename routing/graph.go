@@ -0,0 +1,303 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+)
+
+const (
+	// MaxHops is the maximum number of channels of a route.
+	MaxHops = 6
+	// MaxRoutes is the maximum number of routes returned by FindRoute.
+	MaxRoutes = 8
+)
+
+// ErrNoRoute is returned by FindRoute if there is no route with enough
+// capacity between the two peers.
+var ErrNoRoute = errors.New("no route found")
+
+type (
+	// ChannelInfo describes a two-party ledger channel of the network.
+	ChannelInfo struct {
+		ID channel.ID
+		// Peers are the wire addresses of the two participants.
+		Peers []wire.Address
+		// Alloc holds the spendable balances of the participants. It does not
+		// contain locked funds.
+		Alloc channel.Allocation
+		// Version is the channel's state version. Updates with a lower
+		// version than the known one are ignored.
+		Version uint64
+	}
+
+	// Graph is a graph of peers connected by ledger channels. It is safe for
+	// concurrent use. As the Graph reads the states of local channels, its
+	// methods can not be called from an update handler.
+	Graph struct {
+		mu       sync.Mutex
+		channels map[channel.ID]*ChannelInfo
+		local    map[channel.ID]*client.Channel
+	}
+
+	// edge is a channel that can be used in one direction.
+	edge struct {
+		ch      *ChannelInfo
+		fromIdx channel.Index
+	}
+)
+
+// NewGraph returns a new, empty Graph.
+func NewGraph() *Graph {
+	return &Graph{
+		channels: make(map[channel.ID]*ChannelInfo),
+		local:    make(map[channel.ID]*client.Channel),
+	}
+}
+
+// Valid checks that the ChannelInfo describes a two-party channel.
+func (info ChannelInfo) Valid() error {
+	if len(info.Peers) != 2 {
+		return errors.New("channel must have two peers")
+	}
+	if info.Peers[0].Equal(info.Peers[1]) {
+		return errors.New("peers must be distinct")
+	}
+	if info.Alloc.NumParts() != 2 {
+		return errors.New("allocation must have two parts")
+	}
+	if len(info.Alloc.Locked) != 0 {
+		return errors.New("allocation must not have locked funds")
+	}
+	return info.Alloc.Valid()
+}
+
+// Clone returns a deep copy of the ChannelInfo.
+func (info ChannelInfo) Clone() ChannelInfo {
+	return ChannelInfo{
+		ID:      info.ID,
+		Peers:   append([]wire.Address(nil), info.Peers...),
+		Alloc:   info.Alloc.Clone(),
+		Version: info.Version,
+	}
+}
+
+// AddLocalChannel adds a two-party ledger channel of the local client to the
+// graph. The balances of local channels are read from the channel's current
+// state whenever the graph is queried. Local channels are removed from the
+// graph once they are closed or final.
+func (g *Graph) AddLocalChannel(ch *client.Channel) error {
+	if !ch.IsLedgerChannel() {
+		return errors.New("not a ledger channel")
+	}
+	if _, err := localInfo(ch); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.local[ch.ID()] = ch
+	delete(g.channels, ch.ID())
+	return nil
+}
+
+// UpdateChannel adds or updates a remote channel. The update is ignored if
+// the graph already knows the same or a newer version of the channel, or if
+// the channel is a local channel. It returns whether the graph was updated.
+func (g *Graph) UpdateChannel(info ChannelInfo) (bool, error) {
+	if err := info.Valid(); err != nil {
+		return false, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.local[info.ID]; ok {
+		return false, nil
+	}
+	if known, ok := g.channels[info.ID]; ok && known.Version >= info.Version {
+		return false, nil
+	}
+	clone := info.Clone()
+	g.channels[info.ID] = &clone
+	return true, nil
+}
+
+// RemoveChannel removes the channel with the given ID from the graph.
+func (g *Graph) RemoveChannel(id channel.ID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.channels, id)
+	delete(g.local, id)
+}
+
+// Channel returns the channel with the given ID.
+func (g *Graph) Channel(id channel.ID) (ChannelInfo, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.refreshLocal()
+	info, ok := g.channels[id]
+	if !ok {
+		return ChannelInfo{}, false
+	}
+	return info.Clone(), true
+}
+
+// LocalChannels returns the current state of all local channels.
+func (g *Graph) LocalChannels() []ChannelInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.refreshLocal()
+	infos := make([]ChannelInfo, 0, len(g.local))
+	for id := range g.local {
+		infos = append(infos, g.channels[id].Clone())
+	}
+	return infos
+}
+
+// FindRoute returns routes from `from` to `to` over which `amount` of `asset`
+// can be sent. The routes are loop-free, sorted by their number of hops and
+// have at most MaxHops hops. At most MaxRoutes routes are returned. If there
+// is no route, ErrNoRoute is returned.
+func (g *Graph) FindRoute(from, to wire.Address, asset channel.Asset, amount channel.Bal) ([]Route, error) {
+	if from.Equal(to) {
+		return nil, errors.New("source and destination are equal")
+	}
+	if amount.Sign() < 0 {
+		return nil, errors.New("negative amount")
+	}
+
+	g.mu.Lock()
+	g.refreshLocal()
+	edges := g.edges(asset, amount)
+	g.mu.Unlock()
+
+	// Breadth-first search over all loop-free paths. As all edges have the
+	// same weight, routes are found in the order of their length.
+	var routes []Route
+	queue := []Route{nil}
+	for len(queue) > 0 && len(routes) < MaxRoutes {
+		r := queue[0]
+		queue = queue[1:]
+
+		head := from
+		if len(r) > 0 {
+			head = r.To()
+		}
+		for _, e := range edges[wallet.Key(head)] {
+			hop := e.hop()
+			if r.visits(hop.To) || hop.To.Equal(from) {
+				continue
+			}
+			next := append(append(Route(nil), r...), hop)
+			if hop.To.Equal(to) {
+				routes = append(routes, next)
+				if len(routes) == MaxRoutes {
+					break
+				}
+			} else if len(next) < MaxHops {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if len(routes) == 0 {
+		return nil, ErrNoRoute
+	}
+	return routes, nil
+}
+
+// edges returns the usable channels of the graph, indexed by their source.
+// The caller must hold the lock.
+func (g *Graph) edges(asset channel.Asset, amount channel.Bal) map[wallet.AddrKey][]edge {
+	ids := make([]channel.ID, 0, len(g.channels))
+	for id := range g.channels {
+		ids = append(ids, id)
+	}
+	// Sort for deterministic results.
+	sort.Slice(ids, func(i, j int) bool {
+		return string(ids[i][:]) < string(ids[j][:])
+	})
+
+	edges := make(map[wallet.AddrKey][]edge)
+	for _, id := range ids {
+		ch := g.channels[id]
+		assetIdx, ok := ch.Alloc.AssetIndex(asset)
+		if !ok {
+			continue
+		}
+		for idx, p := range ch.Peers {
+			if ch.Alloc.Balances[assetIdx][idx].Cmp(amount) < 0 {
+				continue
+			}
+			key := wallet.Key(p)
+			edges[key] = append(edges[key], edge{ch: ch, fromIdx: channel.Index(idx)})
+		}
+	}
+	return edges
+}
+
+// refreshLocal updates the local channels from their current states. The
+// caller must hold the lock.
+func (g *Graph) refreshLocal() {
+	for id, ch := range g.local {
+		info, err := localInfo(ch)
+		if err != nil {
+			delete(g.local, id)
+			delete(g.channels, id)
+			continue
+		}
+		g.channels[id] = &info
+	}
+}
+
+// localInfo returns the ChannelInfo of a local channel.
+func localInfo(ch *client.Channel) (ChannelInfo, error) {
+	if ch.IsClosed() {
+		return ChannelInfo{}, errors.New("channel closed")
+	}
+	if len(ch.Peers()) != 2 {
+		return ChannelInfo{}, errors.New("channel must have two peers")
+	}
+	s := ch.State()
+	if s.IsFinal {
+		return ChannelInfo{}, errors.New("channel final")
+	}
+	return ChannelInfo{
+		ID:    ch.ID(),
+		Peers: append([]wire.Address(nil), ch.Peers()...),
+		Alloc: channel.Allocation{
+			Assets:   append([]channel.Asset(nil), s.Assets...),
+			Balances: s.Balances.Clone(),
+		},
+		Version: s.Version,
+	}, nil
+}
+
+func (e edge) hop() Hop {
+	return Hop{
+		Channel: e.ch.ID,
+		From:    e.ch.Peers[e.fromIdx],
+		To:      e.ch.Peers[1-e.fromIdx],
+		FromIdx: e.fromIdx,
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing_test
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "perun.network/go-perun/backend/sim" // backend init
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/routing"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+	wiretest "perun.network/go-perun/wire/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestGraph_FindRoute(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+	n := wiretest.NewRandomAddresses(rng, 6)
+
+	g := routing.NewGraph()
+	for _, c := range []struct {
+		a, b       int
+		balA, balB int64
+	}{
+		{0, 1, 10, 10},
+		{1, 2, 10, 10},
+		{2, 4, 10, 10},
+		{0, 3, 10, 10},
+		{3, 4, 5, 10},
+		{1, 3, 10, 10},
+	} {
+		updated, err := g.UpdateChannel(newInfo(rng, n[c.a], n[c.b], asset, c.balA, c.balB))
+		require.NoError(t, err)
+		require.True(t, updated)
+	}
+
+	t.Run("shortest first", func(t *testing.T) {
+		routes, err := g.FindRoute(n[0], n[4], asset, big.NewInt(5))
+		require.NoError(t, err)
+		require.Len(t, routes, 4)
+		assertRoute(t, routes[0], n[0], n[3], n[4])
+		for i, r := range routes {
+			assertValidRoute(t, r, n[0], n[4])
+			if i > 0 {
+				assert.LessOrEqual(t, len(routes[i-1]), len(r))
+			}
+		}
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		// The channel between 3 and 4 has not enough funds on 3's side.
+		routes, err := g.FindRoute(n[0], n[4], asset, big.NewInt(6))
+		require.NoError(t, err)
+		require.Len(t, routes, 2)
+		assertRoute(t, routes[0], n[0], n[1], n[2], n[4])
+		assertRoute(t, routes[1], n[0], n[3], n[1], n[2], n[4])
+
+		// The reverse direction has enough funds.
+		routes, err = g.FindRoute(n[4], n[0], asset, big.NewInt(6))
+		require.NoError(t, err)
+		assertRoute(t, routes[0], n[4], n[3], n[0])
+	})
+
+	t.Run("no route", func(t *testing.T) {
+		_, err := g.FindRoute(n[0], n[4], asset, big.NewInt(11))
+		assert.ErrorIs(t, err, routing.ErrNoRoute)
+		_, err = g.FindRoute(n[0], n[5], asset, big.NewInt(1))
+		assert.ErrorIs(t, err, routing.ErrNoRoute)
+		_, err = g.FindRoute(n[0], n[4], chtest.NewRandomAsset(rng), big.NewInt(1))
+		assert.ErrorIs(t, err, routing.ErrNoRoute)
+		_, err = g.FindRoute(n[0], n[0], asset, big.NewInt(1))
+		assert.Error(t, err)
+	})
+
+	t.Run("removed channel", func(t *testing.T) {
+		routes, err := g.FindRoute(n[0], n[1], asset, big.NewInt(1))
+		require.NoError(t, err)
+		g.RemoveChannel(routes[0][0].Channel)
+		routes, err = g.FindRoute(n[0], n[1], asset, big.NewInt(1))
+		require.NoError(t, err)
+		assertRoute(t, routes[0], n[0], n[3], n[1])
+	})
+}
+
+func TestGraph_FindRoute_MaxHops(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+	n := wiretest.NewRandomAddresses(rng, routing.MaxHops+2)
+
+	g := routing.NewGraph()
+	for i := 0; i+1 < len(n); i++ {
+		_, err := g.UpdateChannel(newInfo(rng, n[i], n[i+1], asset, 10, 10))
+		require.NoError(t, err)
+	}
+
+	routes, err := g.FindRoute(n[0], n[routing.MaxHops], asset, big.NewInt(1))
+	require.NoError(t, err)
+	assertValidRoute(t, routes[0], n[0], n[routing.MaxHops])
+	_, err = g.FindRoute(n[0], n[routing.MaxHops+1], asset, big.NewInt(1))
+	assert.ErrorIs(t, err, routing.ErrNoRoute)
+}
+
+func TestGraph_UpdateChannel(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+	peers := wiretest.NewRandomAddresses(rng, 2)
+	g := routing.NewGraph()
+
+	info := newInfo(rng, peers[0], peers[1], asset, 10, 10)
+	info.Version = 1
+	updated, err := g.UpdateChannel(info)
+	require.NoError(t, err)
+	assert.True(t, updated)
+
+	// Outdated versions are ignored.
+	old := info.Clone()
+	old.Version = 0
+	old.Alloc.Balances[0][0] = big.NewInt(20)
+	updated, err = g.UpdateChannel(old)
+	require.NoError(t, err)
+	assert.False(t, updated)
+	updated, err = g.UpdateChannel(info)
+	require.NoError(t, err)
+	assert.False(t, updated)
+
+	newer := old.Clone()
+	newer.Version = 2
+	updated, err = g.UpdateChannel(newer)
+	require.NoError(t, err)
+	assert.True(t, updated)
+	got, ok := g.Channel(info.ID)
+	require.True(t, ok)
+	assert.Equal(t, newer, got)
+
+	// Invalid channels are rejected.
+	invalid := newer.Clone()
+	invalid.Version = 3
+	invalid.Peers = invalid.Peers[:1]
+	_, err = g.UpdateChannel(invalid)
+	assert.Error(t, err)
+	invalid = newer.Clone()
+	invalid.Version = 3
+	invalid.Alloc.Balances[0][1] = big.NewInt(-1)
+	_, err = g.UpdateChannel(invalid)
+	assert.Error(t, err)
+}
+
+func TestRoute_VirtualChannelProposal(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+	n := wiretest.NewRandomAddresses(rng, 4)
+
+	g := routing.NewGraph()
+	chs := []routing.ChannelInfo{
+		newInfo(rng, n[0], n[1], asset, 10, 10),
+		newInfo(rng, n[2], n[1], asset, 10, 10),
+		newInfo(rng, n[3], n[2], asset, 10, 10),
+	}
+	for _, info := range chs {
+		_, err := g.UpdateChannel(info)
+		require.NoError(t, err)
+	}
+	routes, err := g.FindRoute(n[0], n[3], asset, big.NewInt(5))
+	require.NoError(t, err)
+	r := routes[0]
+	assert.Equal(t, []wire.Address{n[1], n[2]}, r.Intermediaries())
+
+	initBals := channel.NewAllocation(2, asset)
+	initBals.SetAssetBalances(asset, []channel.Bal{big.NewInt(5), big.NewInt(5)})
+	prop, err := r.VirtualChannelProposal(60, n[0], initBals)
+	require.NoError(t, err)
+	assert.Equal(t, []wire.Address{n[0], n[3]}, prop.Peers)
+	assert.Equal(t, []channel.ID{chs[0].ID, chs[2].ID}, prop.Parents)
+	assert.Equal(t, [][]channel.Index{{0, 1}, {1, 0}}, prop.IndexMaps)
+	assert.Equal(t, []channel.ID{chs[1].ID}, prop.Hops)
+
+	// A single hop is not enough for a virtual channel.
+	_, err = r[:1].VirtualChannelProposal(60, n[0], initBals)
+	assert.Error(t, err)
+}
+
+// newInfo returns a channel between a and b with the given balances.
+func newInfo(rng *rand.Rand, a, b wire.Address, asset channel.Asset, balA, balB int64) routing.ChannelInfo {
+	alloc := channel.NewAllocation(2, asset)
+	alloc.SetAssetBalances(asset, []channel.Bal{big.NewInt(balA), big.NewInt(balB)})
+	return routing.ChannelInfo{
+		ID:    chtest.NewRandomChannelID(rng),
+		Peers: []wire.Address{a, b},
+		Alloc: *alloc,
+	}
+}
+
+// assertRoute asserts that the route passes exactly the given peers.
+func assertRoute(t *testing.T, r routing.Route, peers ...wire.Address) {
+	t.Helper()
+	require.Len(t, r, len(peers)-1)
+	for i, h := range r {
+		assert.True(t, h.From.Equal(peers[i]), "hop %d: wrong source", i)
+		assert.True(t, h.To.Equal(peers[i+1]), "hop %d: wrong destination", i)
+	}
+}
+
+// assertValidRoute asserts that the route is a loop-free chain from `from` to
+// `to`.
+func assertValidRoute(t *testing.T, r routing.Route, from, to wire.Address) {
+	t.Helper()
+	require.NotEmpty(t, r)
+	assert.True(t, r.From().Equal(from))
+	assert.True(t, r.To().Equal(to))
+	seen := map[wallet.AddrKey]bool{wallet.Key(r.From()): true}
+	for i, h := range r {
+		if i > 0 {
+			assert.True(t, h.From.Equal(r[i-1].To), "hop %d: not connected", i)
+		}
+		assert.False(t, seen[wallet.Key(h.To)], "hop %d: loop", i)
+		seen[wallet.Key(h.To)] = true
+	}
+}
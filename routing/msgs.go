@@ -0,0 +1,55 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"io"
+
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+func init() {
+	wire.RegisterDecoder(wire.ChannelAnnouncement,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgChannelAnnouncement
+			return &m, m.Decode(r)
+		})
+}
+
+// msgChannelAnnouncement announces a ledger channel and its balances to other
+// nodes of the network.
+type msgChannelAnnouncement struct {
+	Info ChannelInfo
+}
+
+// Type returns this message's type: ChannelAnnouncement.
+func (*msgChannelAnnouncement) Type() wire.Type { return wire.ChannelAnnouncement }
+
+func (m msgChannelAnnouncement) Encode(w io.Writer) error {
+	return perunio.Encode(w,
+		m.Info.ID,
+		wire.AddressesWithLen(m.Info.Peers),
+		m.Info.Alloc,
+		m.Info.Version)
+}
+
+func (m *msgChannelAnnouncement) Decode(r io.Reader) error {
+	return perunio.Decode(r,
+		&m.Info.ID,
+		(*wire.AddressesWithLen)(&m.Info.Peers),
+		&m.Info.Alloc,
+		&m.Info.Version)
+}
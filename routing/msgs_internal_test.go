@@ -0,0 +1,36 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"testing"
+
+	_ "perun.network/go-perun/backend/sim"
+	"perun.network/go-perun/channel/test"
+	wiretest "perun.network/go-perun/wire/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestMsgSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	alloc := test.NewRandomAllocation(rng, test.WithNumParts(2), test.WithNumLocked(0))
+	msg := &msgChannelAnnouncement{Info: ChannelInfo{
+		ID:      test.NewRandomChannelID(rng),
+		Peers:   wiretest.NewRandomAddresses(rng, 2),
+		Alloc:   *alloc,
+		Version: rng.Uint64(),
+	}}
+	wiretest.MsgSerializerTest(t, msg)
+}
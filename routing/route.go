@@ -0,0 +1,115 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+)
+
+type (
+	// Hop is a ledger channel of a route, used in the direction from `From`
+	// to `To`.
+	Hop struct {
+		Channel  channel.ID
+		From, To wire.Address
+		// FromIdx is the index of From in the channel. To has index 1-FromIdx.
+		FromIdx channel.Index
+	}
+
+	// Route is a chain of hops between two peers. The destination of each hop
+	// is the source of the next hop.
+	Route []Hop
+)
+
+// ToIdx returns the index of To in the channel.
+func (h Hop) ToIdx() channel.Index {
+	return 1 - h.FromIdx
+}
+
+// From returns the source of the route.
+func (r Route) From() wire.Address {
+	return r[0].From
+}
+
+// To returns the destination of the route.
+func (r Route) To() wire.Address {
+	return r[len(r)-1].To
+}
+
+// Channels returns the IDs of the channels of the route.
+func (r Route) Channels() []channel.ID {
+	ids := make([]channel.ID, len(r))
+	for i, h := range r {
+		ids[i] = h.Channel
+	}
+	return ids
+}
+
+// Intermediaries returns the peers between the source and the destination of
+// the route.
+func (r Route) Intermediaries() []wire.Address {
+	peers := make([]wire.Address, 0, len(r)-1)
+	for _, h := range r[:len(r)-1] {
+		peers = append(peers, h.To)
+	}
+	return peers
+}
+
+// VirtualChannelProposal creates a proposal for a virtual channel between the
+// source and the destination of the route, which must have at least two hops.
+// The source is the proposer and has index 0 in the virtual channel. The
+// parents, index maps and hops of the proposal are derived from the route.
+func (r Route) VirtualChannelProposal(
+	challengeDuration uint64,
+	participant wallet.Address,
+	initBals *channel.Allocation,
+	opts ...client.ProposalOpts,
+) (*client.VirtualChannelProposal, error) {
+	if len(r) < 2 {
+		return nil, errors.New("route must have at least two hops")
+	}
+	first, last := r[0], r[len(r)-1]
+	var hops []channel.ID
+	if len(r) > 2 {
+		hops = r.Channels()[1 : len(r)-1]
+	}
+	return client.NewVirtualChannelProposal(
+		challengeDuration,
+		participant,
+		initBals,
+		[]wire.Address{r.From(), r.To()},
+		[]channel.ID{first.Channel, last.Channel},
+		[][]channel.Index{
+			{first.FromIdx, first.ToIdx()},
+			{last.FromIdx, last.ToIdx()},
+		},
+		append(opts, client.WithHops(hops...))...,
+	)
+}
+
+// visits returns whether the route passes the given peer.
+func (r Route) visits(peer wire.Address) bool {
+	for _, h := range r {
+		if h.To.Equal(peer) {
+			return true
+		}
+	}
+	return false
+}
@@ -41,7 +41,10 @@ func CloneSigs(sigs []Sig) []Sig {
 	return clonedSigs
 }
 
-var _ perunio.Decoder = SigDec{}
+var (
+	_ perunio.Decoder    = SigDec{}
+	_ perunio.Serializer = (*SigsWithLen)(nil)
+)
 
 const bitsPerByte = 8
 
@@ -56,6 +59,28 @@ func (s SigDec) Decode(r io.Reader) (err error) {
 	return err
 }
 
+// SigsWithLen is a helper type for encoding and decoding sparse signature
+// slices of unknown length.
+type SigsWithLen []Sig
+
+// Encode encodes a sparse signature slice with its length.
+func (s SigsWithLen) Encode(w io.Writer) error {
+	if err := perunio.Encode(w, addressSliceLen(len(s))); err != nil {
+		return errors.WithMessage(err, "encoding count")
+	}
+	return EncodeSparseSigs(w, s)
+}
+
+// Decode decodes a sparse signature slice of unknown length.
+func (s *SigsWithLen) Decode(r io.Reader) error {
+	var n addressSliceLen
+	if err := perunio.Decode(r, &n); err != nil {
+		return errors.WithMessage(err, "decoding count")
+	}
+	*s = make(SigsWithLen, n)
+	return DecodeSparseSigs(r, (*[]Sig)(s))
+}
+
 // EncodeSparseSigs encodes a collection of signatures in the form ( mask, sig, sig, sig, ...).
 func EncodeSparseSigs(w io.Writer, sigs []Sig) error {
 	n := len(sigs)
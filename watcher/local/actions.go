@@ -0,0 +1,180 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"perun.network/go-perun/channel"
+)
+
+const actionSubBufferSize = 64
+
+type (
+	// ActionType is the type of an action of the watcher.
+	ActionType uint8
+
+	// Action describes an action of the watcher or a decision it took, e.g.,
+	// for debugging why a dispute was or was not refuted.
+	Action struct {
+		Time    time.Time
+		Client  ClientID
+		Channel channel.ID
+		Type    ActionType
+
+		// Version is the version of the state the action refers to. That is
+		// the version of the received event for ActionEvent, the latest
+		// version known to the watcher for ActionStartWatching,
+		// ActionStopWatching, ActionRefutationNotRequired and
+		// ActionAlreadyRefuted, and the version of the registered or
+		// withdrawn state for ActionRefute and ActionSettle.
+		Version uint64
+
+		// Event is the received adjudicator event. It is only set for
+		// ActionEvent.
+		Event channel.AdjudicatorEvent
+
+		// Err is the error, if the action failed.
+		Err error
+	}
+
+	// ActionSub is a subscription to the actions of a watcher.
+	//
+	// Publishing actions never blocks the watcher. If the subscriber does not
+	// keep up, actions are dropped and counted, see Missed.
+	ActionSub struct {
+		feed   *actionFeed
+		pipe   chan Action
+		once   sync.Once
+		missed uint64 // Accessed atomically.
+	}
+
+	// actionFeed publishes the actions of a watcher to all subscribers.
+	actionFeed struct {
+		mtx  sync.Mutex
+		subs map[*ActionSub]struct{}
+	}
+)
+
+// Action types.
+const (
+	// ActionStartWatching signals that the watcher started watching a
+	// channel.
+	ActionStartWatching ActionType = iota
+	// ActionStopWatching signals that the watcher stopped watching a channel.
+	ActionStopWatching
+	// ActionEvent signals that the watcher received an adjudicator event from
+	// the blockchain.
+	ActionEvent
+	// ActionRefutationNotRequired signals that the watcher did not refute a
+	// registered state, because it is not older than the latest state.
+	ActionRefutationNotRequired
+	// ActionAlreadyRefuted signals that the watcher did not refute a
+	// registered state, because it already registered a newer state.
+	ActionAlreadyRefuted
+	// ActionRefute signals that the watcher registered the latest states of
+	// a channel tree to refute a dispute. The action refers to the ledger
+	// channel.
+	ActionRefute
+	// ActionSettle signals that the watcher withdrew the funds of a disputed
+	// ledger channel.
+	ActionSettle
+)
+
+var actionTypeNames = [...]string{
+	ActionStartWatching:         "StartWatching",
+	ActionStopWatching:          "StopWatching",
+	ActionEvent:                 "Event",
+	ActionRefutationNotRequired: "RefutationNotRequired",
+	ActionAlreadyRefuted:        "AlreadyRefuted",
+	ActionRefute:                "Refute",
+	ActionSettle:                "Settle",
+}
+
+// String returns the name of the action type.
+func (t ActionType) String() string {
+	if int(t) >= len(actionTypeNames) {
+		return fmt.Sprintf("%d", t)
+	}
+	return actionTypeNames[t]
+}
+
+// SubscribeActions returns a subscription to the actions that the watcher
+// takes for any of its clients, from now on. The subscription must be closed
+// when it is no longer needed.
+func (w *Watcher) SubscribeActions() *ActionSub {
+	return w.actions.subscribe()
+}
+
+func newActionFeed() *actionFeed {
+	return &actionFeed{subs: make(map[*ActionSub]struct{})}
+}
+
+func (f *actionFeed) subscribe() *ActionSub {
+	sub := &ActionSub{
+		feed: f,
+		pipe: make(chan Action, actionSubBufferSize),
+	}
+	f.mtx.Lock()
+	f.subs[sub] = struct{}{}
+	f.mtx.Unlock()
+	return sub
+}
+
+// publish publishes the action to all subscribers, without blocking.
+func (f *actionFeed) publish(a Action) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for sub := range f.subs {
+		select {
+		case sub.pipe <- a:
+		default:
+			atomic.AddUint64(&sub.missed, 1)
+		}
+	}
+}
+
+// ActionStream returns a channel for consuming the actions. It always returns
+// the same channel and is closed when the subscription is closed.
+func (s *ActionSub) ActionStream() <-chan Action {
+	return s.pipe
+}
+
+// Missed returns the number of actions that were dropped because the
+// subscriber did not keep up.
+func (s *ActionSub) Missed() uint64 {
+	return atomic.LoadUint64(&s.missed)
+}
+
+// Close closes the subscription. It can be called multiple times.
+func (s *ActionSub) Close() {
+	s.once.Do(func() {
+		s.feed.mtx.Lock()
+		defer s.feed.mtx.Unlock()
+		delete(s.feed.subs, s)
+		close(s.pipe)
+	})
+}
+
+// publishAction publishes an action of the client. The time and the client
+// of the action are set by this function.
+func (w *ClientWatcher) publishAction(a Action) {
+	a.Time = time.Now()
+	a.Client = w.id
+	w.watcher.actions.publish(a)
+}
@@ -0,0 +1,209 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	stderrors "errors"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/watcher"
+)
+
+var _ watcher.Watcher = &ClientWatcher{}
+
+type (
+	// ClientID identifies a client of the watcher. The empty ID refers to the
+	// default client.
+	ClientID string
+
+	// ClientWatcher watches the channels of a single client of a Watcher.
+	//
+	// The channels of each client are kept in a separate namespace, so that
+	// different clients, e.g. the participants of the same channel, can watch
+	// the same channel independently. A channel can only be a sub-channel of a
+	// channel of the same client.
+	ClientWatcher struct {
+		watcher *Watcher
+		id      ClientID
+		*registry
+
+		// store is used for persisting the watched channels. It is nil, if
+		// the watcher is not persistent.
+		store *store
+
+		// usageMtx guards the usage record and the quota set by
+		// SetChannelQuota, which are persisted together.
+		usageMtx sync.Mutex
+		usage    Usage
+		quotaSet bool
+	}
+
+	// Usage records the on-chain operations that the watcher performed on
+	// behalf of a client, e.g., for billing the client.
+	Usage struct {
+		Refutations   uint64 // Number of refuted disputes.
+		Registrations uint64 // Number of registered states, including sub-channel states.
+		Settlements   uint64 // Number of automatically settled channels.
+	}
+)
+
+// ErrQuotaExceeded signals that a channel cannot be watched because the
+// client already watches as many channels as its quota allows.
+var ErrQuotaExceeded = stderrors.New("channel quota exceeded")
+
+// IsErrQuotaExceeded returns whether the cause of the error was an
+// ErrQuotaExceeded error.
+func IsErrQuotaExceeded(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded)
+}
+
+// WithChannelQuota limits the number of channels that each client can watch
+// at the same time, including sub-channels. Zero means unlimited, which is the
+// default. The quota of a single client can be changed with
+// ClientWatcher.SetChannelQuota.
+func WithChannelQuota(quota int) Option {
+	return func(w *Watcher) {
+		w.quota = quota
+	}
+}
+
+// Client returns the watcher for the client with the given ID. It is created,
+// if the client is not known yet. The empty ID refers to the default client,
+// on whose behalf the methods of Watcher act.
+//
+// If the watcher is persistent, the clients are restored along with their
+// channels, usage records and channel quotas.
+func (w *Watcher) Client(id ClientID) (*ClientWatcher, error) {
+	if id == "" {
+		return w.ClientWatcher, nil
+	}
+
+	w.clientsMtx.Lock()
+	defer w.clientsMtx.Unlock()
+	if c, ok := w.clients[id]; ok {
+		return c, nil
+	}
+	var s *store
+	if w.store != nil {
+		if err := w.store.putClient(id); err != nil {
+			return nil, err
+		}
+		s = w.store.forClient(id)
+	}
+	c := w.newClientWatcher(id, s)
+	w.clients[id] = c
+	return c, nil
+}
+
+// Clients returns the IDs of all named clients in ascending order.
+func (w *Watcher) Clients() []ClientID {
+	w.clientsMtx.Lock()
+	defer w.clientsMtx.Unlock()
+	ids := make([]ClientID, 0, len(w.clients))
+	for id := range w.clients {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (w *Watcher) newClientWatcher(id ClientID, s *store) *ClientWatcher {
+	c := &ClientWatcher{
+		watcher:  w,
+		id:       id,
+		registry: newRegistry(),
+		store:    s,
+	}
+	c.registry.quota = w.quota
+	return c
+}
+
+// ID returns the ID of the client.
+func (w *ClientWatcher) ID() ClientID {
+	return w.id
+}
+
+// SetChannelQuota sets the maximum number of channels that the client can
+// watch at the same time, including sub-channels. Zero means unlimited.
+// Channels that are already watched are not affected. If the watcher is
+// persistent, the quota is persisted with the usage record of the client and
+// takes precedence over WithChannelQuota when the client is restored.
+func (w *ClientWatcher) SetChannelQuota(quota int) error {
+	if quota < 0 {
+		return errors.New("quota must not be negative")
+	}
+	w.usageMtx.Lock()
+	defer w.usageMtx.Unlock()
+	w.registry.setQuota(quota)
+	w.quotaSet = true
+	return w.persistUsage()
+}
+
+// NumChannels returns the number of channels currently watched for the
+// client, including sub-channels.
+func (w *ClientWatcher) NumChannels() int {
+	return w.registry.count()
+}
+
+// Usage returns the usage record of the client.
+func (w *ClientWatcher) Usage() Usage {
+	w.usageMtx.Lock()
+	defer w.usageMtx.Unlock()
+	return w.usage
+}
+
+// recordUsage updates the usage record of the client and persists it, if the
+// watcher is persistent.
+func (w *ClientWatcher) recordUsage(update func(*Usage)) {
+	w.usageMtx.Lock()
+	defer w.usageMtx.Unlock()
+	update(&w.usage)
+	if err := w.persistUsage(); err != nil {
+		log.WithField("client", w.id).Errorf("Persisting usage: %v", err)
+	}
+}
+
+// persistUsage persists the usage record and the quota of the client, if the
+// watcher is persistent. The usage mutex must be held.
+func (w *ClientWatcher) persistUsage() error {
+	if w.store == nil {
+		return nil
+	}
+	r := usageRecord{usage: w.usage, quotaSet: w.quotaSet}
+	if w.quotaSet {
+		r.quota = uint64(w.registry.getQuota())
+	}
+	return w.store.putUsage(r)
+}
+
+// restoreUsage restores the usage record and the quota of the client from the
+// store.
+func (w *ClientWatcher) restoreUsage() error {
+	r, err := w.store.usage()
+	if err != nil {
+		return err
+	}
+	w.usageMtx.Lock()
+	defer w.usageMtx.Unlock()
+	w.usage = r.usage
+	if w.quotaSet = r.quotaSet; r.quotaSet {
+		w.registry.setQuota(int(r.quota))
+	}
+	return nil
+}
@@ -26,6 +26,10 @@ type (
 	registry struct {
 		mtx sync.Mutex
 		chs map[channel.ID]*ch
+
+		// quota is the maximum number of channels in the registry. Zero
+		// means unlimited.
+		quota int
 	}
 )
 
@@ -36,13 +40,17 @@ func newRegistry() *registry {
 }
 
 // addIfSucceeds adds the channel to the registry, if it is not already present
-// in the registry and if the "chInitializer" does not return an error.
-func (r *registry) addIfSucceeds(id channel.ID, chInitializer chInitializer) (*ch, error) {
+// in the registry and if the "chInitializer" does not return an error. If
+// checkQuota is true, the channel is only added if the quota is not exceeded.
+func (r *registry) addIfSucceeds(id channel.ID, checkQuota bool, chInitializer chInitializer) (*ch, error) {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 	if _, ok := r.chs[id]; ok {
 		return nil, errors.New("already watching for this channel")
 	}
+	if checkQuota && r.quota > 0 && len(r.chs) >= r.quota {
+		return nil, errors.WithMessagef(ErrQuotaExceeded, "watching %d channels", len(r.chs))
+	}
 
 	ch, err := chInitializer()
 	if err != nil {
@@ -61,6 +69,53 @@ func (r *registry) retrieve(id channel.ID) (*ch, bool) {
 	return ch, ok
 }
 
+// takeRestored retrieves the channel from registry, if it was restored from
+// the store and no client has re-attached to it yet. The channel is marked as
+// re-attached.
+func (r *registry) takeRestored(id channel.ID) (*ch, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	ch, ok := r.chs[id]
+	if !ok || !ch.restored {
+		return nil, false
+	}
+	ch.restored = false
+	return ch, true
+}
+
+// setQuota sets the maximum number of channels in the registry. Channels that
+// are already in the registry are not affected.
+func (r *registry) setQuota(quota int) {
+	r.mtx.Lock()
+	r.quota = quota
+	r.mtx.Unlock()
+}
+
+// getQuota returns the maximum number of channels in the registry.
+func (r *registry) getQuota() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.quota
+}
+
+// count returns the number of channels in the registry.
+func (r *registry) count() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return len(r.chs)
+}
+
+// all returns all channels in the registry.
+func (r *registry) all() []*ch {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	chs := make([]*ch, 0, len(r.chs))
+	for _, ch := range r.chs {
+		chs = append(chs, ch)
+	}
+	return chs
+}
+
 // remove removes the channel from registry, if it is present.
 // It does not do any validation on the channel to be removed.
 func (r *registry) remove(id channel.ID) {
@@ -0,0 +1,157 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wallet"
+)
+
+type (
+	// Option represents an optional argument for the watcher.
+	Option func(*Watcher)
+
+	// settler withdraws the funds of disputed ledger channels on behalf of
+	// the client, once the dispute timeout elapsed.
+	settler struct {
+		withdrawer channel.Withdrawer
+		wallet     wallet.Wallet
+	}
+
+	// settlement keeps track of the pending settlement of a ledger channel.
+	settlement struct {
+		mtx     sync.Mutex
+		cancel  context.CancelFunc // cancels the pending settlement, if any.
+		stopped bool               // set when the watcher stops watching.
+	}
+)
+
+// WithAutoSettlement enables the automatic settlement of disputed ledger
+// channels.
+//
+// Once the timeout of a registered state or, for channels with an app, of a
+// progressed state elapses, the watcher calls Withdraw on the given withdrawer
+// with the latest state of the ledger channel and the latest states of all its
+// sub-channels. Thereby, the funds are recovered even if the client is not
+// running during the whole dispute. The funds are withdrawn for the first
+// participant of the channel whose account can be unlocked in the given
+// wallet.
+func WithAutoSettlement(withdrawer channel.Withdrawer, wallet wallet.Wallet) Option {
+	return func(w *Watcher) {
+		w.settler = &settler{withdrawer: withdrawer, wallet: wallet}
+	}
+}
+
+// scheduleSettlement schedules the settlement of the channel after the
+// timeout of the given adjudicator event elapsed. A previously scheduled
+// settlement is cancelled. Settlement is only scheduled for ledger channels,
+// sub-channels are settled along with their ledger channel.
+func (ch *ch) scheduleSettlement(s *settler, c *ClientWatcher, e channel.AdjudicatorEvent) {
+	if s == nil || ch.isSubChannel() {
+		return
+	}
+
+	ch.settlement.mtx.Lock()
+	defer ch.settlement.mtx.Unlock()
+	if ch.settlement.stopped {
+		return
+	}
+	if ch.settlement.cancel != nil {
+		ch.settlement.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch.settlement.cancel = cancel
+	ch.Go(func() { s.settleAfterTimeout(ctx, c, ch, e) })
+}
+
+// stopSettlement cancels the pending settlement of the channel and prevents
+// further settlements from being scheduled.
+func (ch *ch) stopSettlement() {
+	ch.settlement.mtx.Lock()
+	defer ch.settlement.mtx.Unlock()
+	ch.settlement.stopped = true
+	if ch.settlement.cancel != nil {
+		ch.settlement.cancel()
+	}
+}
+
+// settleAfterTimeout waits for the timeout of the given adjudicator event and
+// withdraws the funds from the ledger channel. The settlement is published as
+// an action and recorded in the client's usage.
+func (s *settler) settleAfterTimeout(ctx context.Context, c *ClientWatcher, ch *ch, e channel.AdjudicatorEvent) {
+	log := log.WithFields(log.Fields{"ID": ch.id, "Version": e.Version()})
+	if err := e.Timeout().Wait(ctx); err != nil {
+		log.Debug("Settlement cancelled")
+		return
+	}
+
+	req, subStates, err := s.settlementReq(c.registry, ch, e)
+	if err != nil {
+		log.Errorf("Creating settlement request: %v", err)
+		c.publishAction(Action{Channel: ch.id, Type: ActionSettle, Version: e.Version(), Err: err})
+		return
+	}
+	log.Debug("Settling channel")
+	if err := s.withdrawer.Withdraw(ctx, req, subStates); err != nil {
+		log.Errorf("Settling channel: %v", err)
+		c.publishAction(Action{Channel: ch.id, Type: ActionSettle, Version: req.Tx.Version, Err: err})
+		return
+	}
+	c.recordUsage(func(u *Usage) { u.Settlements++ })
+	c.publishAction(Action{Channel: ch.id, Type: ActionSettle, Version: req.Tx.Version})
+	log.Info("Settled channel")
+}
+
+// settlementReq creates the withdrawal request for the ledger channel from the
+// latest states of the channel tree. If the given event is a progressed event
+// with a newer state, this state is withdrawn instead.
+func (s *settler) settlementReq(r *registry, ch *ch, e channel.AdjudicatorEvent) (
+	channel.AdjudicatorReq, channel.StateMap, error,
+) {
+	ch.subChsAccess.Lock()
+	defer ch.subChsAccess.Unlock()
+	if ch.isClosed {
+		// Channel could have been closed while we were waiting for the timeout.
+		return channel.AdjudicatorReq{}, nil, errors.New("channel not registered with the watcher")
+	}
+
+	tx, signedSubStates := retreiveLatestSubStates(r, ch)
+	if e, ok := e.(*channel.ProgressedEvent); ok && e.State.Version > tx.Version {
+		tx = channel.Transaction{State: e.State}
+	}
+	subStates := channel.MakeStateMap()
+	for _, s := range signedSubStates {
+		if s.State != nil {
+			subStates.Add(s.State)
+		}
+	}
+
+	for i, part := range ch.params.Parts {
+		acc, err := s.wallet.Unlock(part)
+		if err != nil {
+			continue
+		}
+		req := makeAdjudicatorReq(ch.params, tx)
+		req.Acc, req.Idx = acc, channel.Index(i)
+		return req, subStates, nil
+	}
+	return channel.AdjudicatorReq{}, nil, errors.New("no participant account found in wallet")
+}
@@ -18,6 +18,8 @@ import (
 	"context"
 	"sync"
 
+	"github.com/pkg/errors"
+
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/watcher"
 )
@@ -28,8 +30,9 @@ const statesPubSubBufferSize = 10
 
 type (
 	statesPubSub struct {
-		once sync.Once
-		pipe chan channel.Transaction
+		once    sync.Once
+		pipe    chan channel.Transaction
+		persist func(channel.Transaction) error
 	}
 
 	// statesSub is used by the watcher to receive newer off-chain states from
@@ -40,16 +43,20 @@ type (
 	}
 )
 
-func newStatesPubSub() *statesPubSub {
+// newStatesPubSub returns a new states pub-sub. If persist is not nil, it is
+// called on each published transaction before it is passed to the subscriber.
+func newStatesPubSub(persist func(channel.Transaction) error) *statesPubSub {
 	return &statesPubSub{
-		pipe: make(chan channel.Transaction, statesPubSubBufferSize),
+		pipe:    make(chan channel.Transaction, statesPubSubBufferSize),
+		persist: persist,
 	}
 }
 
 // Publish publishes the given transaction (state and signatures on it) to the
 // subscriber.
 //
-// Always returns nil. Error result is for implementing watcher.StatesPub.
+// Returns an error only if the watcher is persistent and persisting the
+// transaction failed. In this case, the transaction is not published.
 //
 // Panics if the pub-sub instance is already closed. It is implemented this
 // way, because
@@ -59,6 +66,11 @@ func newStatesPubSub() *statesPubSub {
 //    guaranteed that, this method will never be called after the pub-sub
 //    instance is closed and that, this method will never panic.
 func (s *statesPubSub) Publish(_ context.Context, tx channel.Transaction) error {
+	if s.persist != nil {
+		if err := s.persist(tx); err != nil {
+			return errors.WithMessage(err, "persisting transaction")
+		}
+	}
 	s.pipe <- tx
 	return nil
 }
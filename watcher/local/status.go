@@ -0,0 +1,189 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"perun.network/go-perun/channel"
+)
+
+type (
+	// Status describes the state of the watcher for a single client.
+	Status struct {
+		Client   ClientID
+		Channels []ChannelStatus // Watched channels in ascending order of their IDs.
+		Usage    Usage
+	}
+
+	// ChannelStatus describes the state of a watched channel, e.g., for
+	// debugging why a dispute was or was not refuted.
+	ChannelStatus struct {
+		ID     channel.ID
+		Parent *channel.ID // Nil for ledger channels.
+
+		// SubChannels are the IDs of the direct sub-channels that are
+		// currently watched, in ascending order.
+		SubChannels []channel.ID
+
+		// LatestVersion is the version of the latest state that the watcher
+		// received from the client.
+		LatestVersion uint64
+
+		// RegisteredVersion is the version that the watcher registered on the
+		// blockchain when refuting a dispute. It is zero, if the watcher did
+		// not register any state for this channel.
+		RegisteredVersion uint64
+
+		// LastEvent is the last adjudicator event received from the
+		// blockchain for this channel. It is nil, if no event was received.
+		LastEvent channel.AdjudicatorEvent
+
+		// RefutationPending is true while the watcher registers the latest
+		// states of the channel tree, this channel belongs to, to refute a
+		// dispute.
+		RefutationPending bool
+	}
+
+	// chStatus holds the introspection data of a channel. It is guarded by
+	// its own mutex, so that the status can be read while the channel tree is
+	// locked, e.g., during a refutation.
+	chStatus struct {
+		mtx               sync.Mutex
+		latestVersion     uint64
+		registeredVersion uint64
+		lastEvent         channel.AdjudicatorEvent
+		refuting          bool // Only used for ledger channels.
+	}
+)
+
+// Status returns the status of the watcher for the client.
+func (w *ClientWatcher) Status() Status {
+	return Status{
+		Client:   w.id,
+		Channels: w.Channels(),
+		Usage:    w.Usage(),
+	}
+}
+
+// Channels returns the status of all channels watched for the client,
+// including sub-channels, in ascending order of their IDs.
+func (w *ClientWatcher) Channels() []ChannelStatus {
+	chs := w.all()
+	statuses := make([]ChannelStatus, 0, len(chs))
+	for _, ch := range chs {
+		statuses = append(statuses, ch.statusInfo())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return bytes.Compare(statuses[i].ID[:], statuses[j].ID[:]) < 0
+	})
+	return statuses
+}
+
+// Channel returns the status of the channel with the given ID, if it is
+// watched for the client.
+func (w *ClientWatcher) Channel(id channel.ID) (ChannelStatus, bool) {
+	ch, ok := w.retrieve(id)
+	if !ok {
+		return ChannelStatus{}, false
+	}
+	return ch.statusInfo(), true
+}
+
+// statusInfo returns the current status of the channel.
+func (ch *ch) statusInfo() ChannelStatus {
+	s := ChannelStatus{
+		ID:                ch.id,
+		RefutationPending: ch.root().isRefuting(),
+	}
+	if ch.parent != nil {
+		parent := ch.parent.id
+		s.Parent = &parent
+	}
+
+	ch.status.mtx.Lock()
+	defer ch.status.mtx.Unlock()
+	s.LatestVersion = ch.status.latestVersion
+	s.RegisteredVersion = ch.status.registeredVersion
+	s.LastEvent = ch.status.lastEvent
+	s.SubChannels = make([]channel.ID, 0, len(ch.subChs))
+	for id := range ch.subChs {
+		s.SubChannels = append(s.SubChannels, id)
+	}
+	sort.Slice(s.SubChannels, func(i, j int) bool {
+		return bytes.Compare(s.SubChannels[i][:], s.SubChannels[j][:]) < 0
+	})
+	return s
+}
+
+// addSubCh adds a direct sub-channel. The caller must hold the lock on the
+// channel tree.
+func (ch *ch) addSubCh(id channel.ID) {
+	ch.status.mtx.Lock()
+	ch.subChs[id] = struct{}{}
+	ch.status.mtx.Unlock()
+}
+
+// removeSubCh removes a direct sub-channel. The caller must hold the lock on
+// the channel tree.
+func (ch *ch) removeSubCh(id channel.ID) {
+	ch.status.mtx.Lock()
+	delete(ch.subChs, id)
+	ch.status.mtx.Unlock()
+}
+
+func (ch *ch) latestVersion() uint64 {
+	ch.status.mtx.Lock()
+	defer ch.status.mtx.Unlock()
+	return ch.status.latestVersion
+}
+
+func (ch *ch) setLatestVersion(v uint64) {
+	ch.status.mtx.Lock()
+	ch.status.latestVersion = v
+	ch.status.mtx.Unlock()
+}
+
+func (ch *ch) registeredVersion() uint64 {
+	ch.status.mtx.Lock()
+	defer ch.status.mtx.Unlock()
+	return ch.status.registeredVersion
+}
+
+func (ch *ch) setRegisteredVersion(v uint64) {
+	ch.status.mtx.Lock()
+	ch.status.registeredVersion = v
+	ch.status.mtx.Unlock()
+}
+
+func (ch *ch) setLastEvent(e channel.AdjudicatorEvent) {
+	ch.status.mtx.Lock()
+	ch.status.lastEvent = e
+	ch.status.mtx.Unlock()
+}
+
+func (ch *ch) isRefuting() bool {
+	ch.status.mtx.Lock()
+	defer ch.status.mtx.Unlock()
+	return ch.status.refuting
+}
+
+func (ch *ch) setRefuting(refuting bool) {
+	ch.status.mtx.Lock()
+	ch.status.refuting = refuting
+	ch.status.mtx.Unlock()
+}
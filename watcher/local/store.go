@@ -0,0 +1,256 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire/perunio"
+	"polycry.pt/poly-go/sortedkv"
+)
+
+const (
+	// rootPrefix is the prefix of all tables of the watcher. The tables of
+	// the default client directly follow this prefix.
+	rootPrefix = "Watch:"
+	// clientPrefix is the table prefix for the tables of a named client. It
+	// is followed by the hex encoded client ID and a colon, so that the
+	// tables of different clients do not overlap.
+	clientPrefix = "Client:"
+	// clientsPrefix is the table prefix for the IDs of the named clients.
+	clientsPrefix = "Clients:"
+
+	// chPrefix is the table prefix for the watched channels.
+	chPrefix = "Ch:"
+	// archivedPrefix is the table prefix for the archived sub-channel states.
+	// Keys are the concatenation of the root (ledger) channel ID and the
+	// sub-channel ID.
+	archivedPrefix = "Archived:"
+	// usageKey is the key of the usage record of a client, which includes
+	// its channel quota.
+	usageKey = "Usage"
+)
+
+type (
+	// store persists the data required by the watcher to refute disputes
+	// after a restart.
+	store struct {
+		db     sortedkv.Database
+		prefix string // prefix of all tables of the client.
+	}
+
+	// chRecord is the persisted data of a watched channel or of an archived
+	// sub-channel state. The parent is always nil for archived states.
+	chRecord struct {
+		parent *channel.ID
+		params *channel.Params
+		tx     channel.Transaction
+	}
+
+	// usageRecord is the persisted usage record of a client together with
+	// the channel quota set by ClientWatcher.SetChannelQuota, if any.
+	usageRecord struct {
+		usage    Usage
+		quotaSet bool
+		quota    uint64
+	}
+)
+
+// newStore returns the store of the default client in the given database.
+func newStore(db sortedkv.Database) *store {
+	return &store{db: db, prefix: rootPrefix}
+}
+
+// forClient returns the store of the named client in the same database.
+func (s *store) forClient(id ClientID) *store {
+	return &store{db: s.db, prefix: rootPrefix + clientPrefix + hex.EncodeToString([]byte(id)) + ":"}
+}
+
+// putClient persists the ID of a named client.
+func (s *store) putClient(id ClientID) error {
+	return errors.WithMessage(s.clientsTable().Put(string(id), ""), "putting client")
+}
+
+// clients returns the IDs of all named clients stored in the database.
+func (s *store) clients() ([]ClientID, error) {
+	var ids []ClientID
+	it := s.clientsTable().NewIterator()
+	for it.Next() {
+		ids = append(ids, ClientID(it.Key()))
+	}
+	return ids, errors.WithMessage(it.Close(), "iterating clients")
+}
+
+// putUsage persists the usage record of the client.
+func (s *store) putUsage(r usageRecord) error {
+	var buf bytes.Buffer
+	if err := perunio.Encode(&buf, r.usage.Refutations, r.usage.Registrations, r.usage.Settlements,
+		r.quotaSet, r.quota); err != nil {
+		return errors.WithMessage(err, "encoding usage")
+	}
+	return errors.WithMessage(s.db.PutBytes(s.prefix+usageKey, buf.Bytes()), "putting usage")
+}
+
+// usage returns the usage record of the client. It is empty if none was
+// persisted yet.
+func (s *store) usage() (r usageRecord, err error) {
+	if ok, err := s.db.Has(s.prefix + usageKey); err != nil {
+		return r, errors.WithMessage(err, "checking usage")
+	} else if !ok {
+		return r, nil
+	}
+	data, err := s.db.GetBytes(s.prefix + usageKey)
+	if err != nil {
+		return r, errors.WithMessage(err, "getting usage")
+	}
+	err = perunio.Decode(bytes.NewReader(data), &r.usage.Refutations, &r.usage.Registrations, &r.usage.Settlements,
+		&r.quotaSet, &r.quota)
+	return r, errors.WithMessage(err, "decoding usage")
+}
+
+// putChannel persists the channel data along with the latest transaction.
+func (s *store) putChannel(r chRecord) error {
+	return s.put(s.chTable(), r.params.ID(), r)
+}
+
+// deleteChannel removes the channel data from the store.
+func (s *store) deleteChannel(id channel.ID) error {
+	return errors.WithMessage(s.chTable().Delete(string(id[:])), "deleting channel")
+}
+
+// channels returns all channels stored in the database.
+func (s *store) channels() ([]chRecord, error) {
+	return s.records(s.chTable().NewIterator())
+}
+
+// putArchived persists the last signed state of a de-registered sub-channel
+// in the given channel tree.
+func (s *store) putArchived(root channel.ID, state channel.SignedState) error {
+	r := chRecord{
+		params: state.Params,
+		tx:     channel.Transaction{State: state.State, Sigs: state.Sigs},
+	}
+	return s.put(s.archivedTable(root), state.State.ID, r)
+}
+
+// deleteArchived removes all archived sub-channel states of the given channel
+// tree.
+func (s *store) deleteArchived(root channel.ID) error {
+	table := s.archivedTable(root)
+	it := table.NewIterator()
+	batch := table.NewBatch()
+	for it.Next() {
+		if err := batch.Delete(it.Key()); err != nil {
+			it.Close() //nolint:errcheck
+			return errors.WithMessage(err, "deleting archived state")
+		}
+	}
+	if err := it.Close(); err != nil {
+		return errors.WithMessage(err, "iterating archived states")
+	}
+	return errors.WithMessage(batch.Apply(), "applying batch")
+}
+
+// archived returns the archived sub-channel states of the given channel tree.
+func (s *store) archived(root channel.ID) (map[channel.ID]channel.SignedState, error) {
+	rs, err := s.records(s.archivedTable(root).NewIterator())
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[channel.ID]channel.SignedState, len(rs))
+	for _, r := range rs {
+		states[r.tx.ID] = makeSignedState(r.params, r.tx)
+	}
+	return states, nil
+}
+
+func (s *store) put(table sortedkv.Database, id channel.ID, r chRecord) error {
+	var buf bytes.Buffer
+	if err := r.Encode(&buf); err != nil {
+		return errors.WithMessage(err, "encoding record")
+	}
+	return errors.WithMessage(table.PutBytes(string(id[:]), buf.Bytes()), "putting record")
+}
+
+func (s *store) records(it sortedkv.Iterator) ([]chRecord, error) {
+	var rs []chRecord
+	for it.Next() {
+		var r chRecord
+		if err := r.Decode(bytes.NewReader(it.ValueBytes())); err != nil {
+			it.Close() //nolint:errcheck
+			return nil, errors.WithMessagef(err, "decoding record %x", it.Key())
+		}
+		rs = append(rs, r)
+	}
+	return rs, errors.WithMessage(it.Close(), "iterating records")
+}
+
+func (s *store) chTable() sortedkv.Database {
+	return sortedkv.NewTable(s.db, s.prefix+chPrefix)
+}
+
+func (s *store) archivedTable(root channel.ID) sortedkv.Database {
+	return sortedkv.NewTable(s.db, s.prefix+archivedPrefix+string(root[:]))
+}
+
+func (s *store) clientsTable() sortedkv.Database {
+	return sortedkv.NewTable(s.db, rootPrefix+clientsPrefix)
+}
+
+func (r chRecord) Encode(w io.Writer) error {
+	hasParent := r.parent != nil
+	if err := perunio.Encode(w, hasParent); err != nil {
+		return err
+	}
+	if hasParent {
+		if err := perunio.Encode(w, *r.parent); err != nil {
+			return err
+		}
+	}
+	return perunio.Encode(w, r.params, sigsPadded(r.tx))
+}
+
+func (r *chRecord) Decode(rd io.Reader) error {
+	var hasParent bool
+	if err := perunio.Decode(rd, &hasParent); err != nil {
+		return err
+	}
+	if hasParent {
+		r.parent = new(channel.ID)
+		if err := perunio.Decode(rd, r.parent); err != nil {
+			return err
+		}
+	}
+	r.params = new(channel.Params)
+	return perunio.Decode(rd, r.params, &r.tx)
+}
+
+// sigsPadded returns the transaction with one signature slot per participant,
+// as required by the transaction encoding.
+func sigsPadded(tx channel.Transaction) channel.Transaction {
+	if tx.State == nil || len(tx.Sigs) == tx.NumParts() {
+		return tx
+	}
+	sigs := make([]wallet.Sig, tx.NumParts())
+	copy(sigs, tx.Sigs)
+	tx.Sigs = sigs
+	return tx
+}
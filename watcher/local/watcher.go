@@ -25,6 +25,7 @@ import (
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/log"
 	"perun.network/go-perun/watcher"
+	"polycry.pt/poly-go/sortedkv"
 )
 
 var _ watcher.Watcher = &Watcher{}
@@ -43,9 +44,27 @@ const (
 
 type (
 	// Watcher implements a local watcher.
+	//
+	// It serves multiple clients, see Client. The methods of the watcher
+	// itself act on behalf of the default client.
 	Watcher struct {
 		rs channel.RegisterSubscriber
-		*registry
+
+		// settler is used for settling disputed channels. It is nil, if
+		// automatic settlement is not enabled.
+		settler *settler
+
+		// quota is the initial channel quota of each client.
+		quota int
+
+		// actions publishes the actions of the watcher to the subscribers.
+		actions *actionFeed
+
+		// ClientWatcher is the watcher of the default client.
+		*ClientWatcher
+
+		clientsMtx sync.Mutex
+		clients    map[ClientID]*ClientWatcher // Named clients.
 	}
 
 	txRetriever struct {
@@ -59,10 +78,13 @@ type (
 		isClosed bool
 		parent   *ch
 
-		// For keeping track of the sub-channels of this ledger channel
+		// For keeping track of the direct sub-channels of this channel
 		// registered with the watcher.
 		// Sub-channels are added when they are registered with the watcher and
 		// removed when they are de-registered from the watcher.
+		//
+		// It is modified while holding the lock on the channel tree and the
+		// status mutex, so that it can be read holding either of them.
 		subChs map[channel.ID]struct{}
 
 		// For keeping track of the last received signed states for a
@@ -71,13 +93,11 @@ type (
 		// required while disputing any other channel in the channel tree and
 		// the particular sub-channel has already been de-registered from the
 		// watcher.
+		//
+		// Only the map of the root (ledger) channel is used. It holds the
+		// archived states of all sub-channels in the channel tree.
 		archivedSubChStates map[channel.ID]channel.SignedState
 
-		// For keeping track of the version registered on the blockchain for
-		// this channel. This is used to prevent registering the same state
-		// more than once.
-		registeredVersion uint64
-
 		// For retrieving the latest state (from the handler for receiving
 		// off-chain states) when processing events from the blockchain.
 		txRetriever txRetriever
@@ -86,10 +106,30 @@ type (
 		eventsToClientPub  adjudicatorPub
 		statesSub          statesSub
 
-		// subChsAccess mutex is used for thread-safe access of a parent
-		// channel and all of its sub-channels. For example, while adding new
-		// sub-channels to a ledger channel or while registering dispute for
-		// the ledger channel and all its children.
+		// For returning the pub-sub instances to the client, when it
+		// re-attaches to a channel that was restored from the store.
+		statesPub         watcher.StatesPub
+		eventsToClientSub watcher.AdjudicatorSub
+
+		// restored is true for channels that were restored from the store and
+		// to which no client has re-attached yet.
+		restored bool
+
+		// settlement keeps track of the pending automatic settlement. Only
+		// used for ledger channels.
+		settlement settlement
+
+		// status keeps track of the introspection data of the channel,
+		// including the version registered on the blockchain for this
+		// channel. The registered version is used to prevent registering the
+		// same state more than once.
+		status chStatus
+
+		// subChsAccess mutex is used for thread-safe access of a channel
+		// tree. For example, while adding new sub-channels to any channel in
+		// the tree or while registering dispute for the ledger channel and
+		// all its descendants. Only the mutex of the root (ledger) channel is
+		// used.
 		subChsAccess sync.Mutex
 
 		// wg is used to synchronize the starting and stopping of handler go
@@ -122,19 +162,144 @@ func (ch *ch) Go(fn func()) {
 
 func (ch *ch) isSubChannel() bool { return ch.parent != nil }
 
+// root returns the ledger channel at the root of the channel tree.
+func (ch *ch) root() *ch {
+	for ch.parent != nil {
+		ch = ch.parent
+	}
+	return ch
+}
+
 // NewWatcher initializes a local watcher.
 //
 // It implements the pub-sub interfaces using go channels.
-func NewWatcher(rs channel.RegisterSubscriber) (*Watcher, error) {
-	w := &Watcher{
-		rs:       rs,
-		registry: newRegistry(),
+func NewWatcher(rs channel.RegisterSubscriber, opts ...Option) (*Watcher, error) {
+	return newWatcher(rs, nil, opts), nil
+}
+
+// NewPersistentWatcher initializes a local watcher that persists the watched
+// channels, their latest states and the archived sub-channel states in the
+// given database.
+//
+// All clients and channels found in the database are restored and the watcher
+// resumes watching for adjudicator events on them right away. The client
+// re-attaches to a restored channel by starting to watch for it again, upon
+// which the watcher returns the existing pub-sub instances for the channel.
+func NewPersistentWatcher(
+	ctx context.Context,
+	rs channel.RegisterSubscriber,
+	db sortedkv.Database,
+	opts ...Option,
+) (w *Watcher, err error) {
+	w = newWatcher(rs, newStore(db), opts)
+	clients, err := w.store.clients()
+	if err != nil {
+		return nil, errors.WithMessage(err, "restoring clients")
+	}
+	restored := []*ClientWatcher{w.ClientWatcher}
+	for _, id := range clients {
+		c := w.newClientWatcher(id, w.store.forClient(id))
+		w.clients[id] = c
+		restored = append(restored, c)
+	}
+
+	var done []*ClientWatcher
+	defer func() {
+		if err != nil {
+			for _, c := range done {
+				c.closeAll()
+			}
+		}
+	}()
+	for _, c := range restored {
+		if err := c.restoreUsage(); err != nil {
+			return nil, errors.WithMessagef(err, "restoring usage of client %q", c.id)
+		}
+		if err := c.restore(ctx); err != nil {
+			return nil, errors.WithMessagef(err, "restoring watched channels of client %q", c.id)
+		}
+		done = append(done, c)
 	}
 	return w, nil
 }
 
+func newWatcher(rs channel.RegisterSubscriber, s *store, opts []Option) *Watcher {
+	w := &Watcher{
+		rs:      rs,
+		actions: newActionFeed(),
+		clients: make(map[ClientID]*ClientWatcher),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.ClientWatcher = w.newClientWatcher("", s)
+	return w
+}
+
+// restore restores all channels from the store and starts the handlers for
+// each of them.
+func (w *ClientWatcher) restore(ctx context.Context) (err error) {
+	records, err := w.store.channels()
+	if err != nil {
+		return err
+	}
+	var restored []*ch
+	defer func() {
+		if err != nil {
+			for _, ch := range restored {
+				closePubSubs(ch)
+				w.remove(ch.id)
+			}
+		}
+	}()
+	// Parents are restored before their sub-channels, so that the
+	// sub-channels can be attached to their parents.
+	for len(records) > 0 {
+		r, parent, ok := w.nextRestorable(records)
+		if !ok {
+			return errors.Errorf("parent %x of sub-channel %x not found", *records[0].parent, records[0].tx.ID)
+		}
+		records = records[1:]
+		ch, err := w.registry.addIfSucceeds(r.tx.ID, false, func() (*ch, error) {
+			return w.newWatchedCh(ctx, parent, r.params, r.tx)
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "restoring channel %x", r.tx.ID)
+		}
+		restored = append(restored, ch)
+		ch.restored = true
+
+		if parent != nil {
+			parent.addSubCh(ch.id)
+		} else if ch.archivedSubChStates, err = w.store.archived(ch.id); err != nil {
+			return errors.WithMessagef(err, "restoring archived states of channel %x", ch.id)
+		}
+		w.startHandlers(ch, r.tx)
+	}
+	return nil
+}
+
+// nextRestorable moves the first record, whose parent is already restored,
+// to the front of the records. It returns the record and the parent.
+func (w *ClientWatcher) nextRestorable(records []chRecord) (chRecord, *ch, bool) {
+	for i, r := range records {
+		if r.parent == nil {
+			records[0], records[i] = records[i], records[0]
+			return r, nil, true
+		}
+		if parent, ok := w.registry.retrieve(*r.parent); ok {
+			records[0], records[i] = records[i], records[0]
+			return r, parent, true
+		}
+	}
+	return chRecord{}, nil, false
+}
+
 // StartWatchingLedgerChannel starts watching for a ledger channel.
-func (w *Watcher) StartWatchingLedgerChannel(
+//
+// Returns an ErrQuotaExceeded error if the client already watches as many
+// channels as its quota allows.
+func (w *ClientWatcher) StartWatchingLedgerChannel(
 	ctx context.Context,
 	signedState channel.SignedState,
 ) (watcher.StatesPub, watcher.AdjudicatorSub, error) {
@@ -143,9 +308,13 @@ func (w *Watcher) StartWatchingLedgerChannel(
 
 // StartWatchingSubChannel starts watching for a sub-channel or virtual channel.
 //
-// Parent must be a ledger channel. Because, currently only one level of
-// sub-channels is supported.
-func (w *Watcher) StartWatchingSubChannel(
+// Parent can be a ledger channel or a sub-channel, so that channel trees of
+// arbitrary depth can be watched. The parent must be registered with the
+// watcher.
+//
+// Returns an ErrQuotaExceeded error if the client already watches as many
+// channels as its quota allows.
+func (w *ClientWatcher) StartWatchingSubChannel(
 	ctx context.Context,
 	parent channel.ID,
 	signedState channel.SignedState,
@@ -154,50 +323,119 @@ func (w *Watcher) StartWatchingSubChannel(
 	if !ok {
 		return nil, nil, errors.New("parent channel not registered with the watcher")
 	}
-	if parentCh.isSubChannel() {
-		return nil, nil, errors.New("parent must be a ledger channel")
+	root := parentCh.root()
+	root.subChsAccess.Lock()
+	defer root.subChsAccess.Unlock()
+	if parentCh.isClosed {
+		// Parent could have been closed while we were waiting for the mutex.
+		return nil, nil, errors.New("parent channel not registered with the watcher")
 	}
-	parentCh.subChsAccess.Lock()
-	defer parentCh.subChsAccess.Unlock()
 	statesPub, eventsSub, err := w.startWatching(ctx, parentCh, signedState)
 	if err != nil {
 		return nil, nil, err
 	}
-	parentCh.subChs[signedState.State.ID] = struct{}{}
+	parentCh.addSubCh(signedState.State.ID)
 	return statesPub, eventsSub, nil
 }
 
-func (w *Watcher) startWatching(
+func (w *ClientWatcher) startWatching(
 	ctx context.Context,
 	parent *ch,
 	signedState channel.SignedState,
 ) (watcher.StatesPub, watcher.AdjudicatorSub, error) {
 	id := signedState.State.ID
+	initialTx := channel.Transaction{
+		State: signedState.State,
+		Sigs:  signedState.Sigs,
+	}
 
-	var statesPubSub *statesPubSub
-	var eventsToClientPubSub *adjudicatorPubSub
-	chInitializer := func() (*ch, error) {
-		eventsFromChainSub, err := w.rs.Subscribe(ctx, id)
+	if ch, ok := w.registry.takeRestored(id); ok {
+		statesPub, eventsSub, err := reattach(ctx, ch, parent, initialTx)
 		if err != nil {
-			return nil, errors.WithMessage(err, "subscribing to adjudicator events from blockchain")
+			return nil, nil, err
 		}
-		statesPubSub = newStatesPubSub()
-		eventsToClientPubSub = newAdjudicatorEventsPubSub()
-		return newCh(id, parent, signedState.Params, eventsFromChainSub, eventsToClientPubSub, statesPubSub), nil
+		w.publishAction(Action{Channel: id, Type: ActionStartWatching, Version: ch.latestVersion()})
+		return statesPub, eventsSub, nil
 	}
 
-	ch, err := w.registry.addIfSucceeds(id, chInitializer)
+	ch, err := w.registry.addIfSucceeds(id, true, func() (*ch, error) {
+		return w.newWatchedCh(ctx, parent, signedState.Params, initialTx)
+	})
 	if err != nil {
 		return nil, nil, err
 	}
-	initialTx := channel.Transaction{
-		State: signedState.State,
-		Sigs:  signedState.Sigs,
+	w.startHandlers(ch, initialTx)
+	w.publishAction(Action{Channel: id, Type: ActionStartWatching, Version: initialTx.Version})
+
+	return ch.statesPub, ch.eventsToClientSub, nil
+}
+
+// newWatchedCh subscribes to the adjudicator events for the channel and
+// initializes the pub-sub instances. If the watcher is persistent, the
+// channel is persisted along with the given transaction.
+func (w *ClientWatcher) newWatchedCh(
+	ctx context.Context,
+	parent *ch,
+	params *channel.Params,
+	tx channel.Transaction,
+) (*ch, error) {
+	id := tx.State.ID
+	eventsFromChainSub, err := w.watcher.rs.Subscribe(ctx, id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "subscribing to adjudicator events from blockchain")
+	}
+
+	var persist func(channel.Transaction) error
+	if w.store != nil {
+		var parentID *channel.ID
+		if parent != nil {
+			parentID = &parent.id
+		}
+		persist = func(tx channel.Transaction) error {
+			return w.store.putChannel(chRecord{parent: parentID, params: params, tx: tx})
+		}
+		if err := persist(tx); err != nil {
+			if err := eventsFromChainSub.Close(); err != nil {
+				log.WithField("id", id).Error(errors.WithMessage(err, "closing events from chain sub").Error())
+			}
+			return nil, errors.WithMessage(err, "persisting channel")
+		}
 	}
+
+	statesPubSub := newStatesPubSub(persist)
+	eventsToClientPubSub := newAdjudicatorEventsPubSub()
+	ch := newCh(id, parent, params, eventsFromChainSub, eventsToClientPubSub, statesPubSub)
+	ch.status.latestVersion = tx.Version
+	ch.statesPub = statesPubSub
+	ch.eventsToClientSub = eventsToClientPubSub
+	return ch, nil
+}
+
+// startHandlers starts the handlers for off-chain states from the client and
+// for adjudicator events from the blockchain.
+func (w *ClientWatcher) startHandlers(ch *ch, initialTx channel.Transaction) {
 	ch.Go(func() { ch.handleStatesFromClient(initialTx) })
-	ch.Go(func() { ch.handleEventsFromChain(w.rs, w.registry) }) //nolint:contextcheck
+	ch.Go(func() { ch.handleEventsFromChain(w.watcher.rs, w, w.watcher.settler) }) //nolint:contextcheck
+}
 
-	return statesPubSub, eventsToClientPubSub, nil
+// reattach returns the pub-sub instances of a restored channel to the client.
+// If the given transaction is newer than the restored one, it is published to
+// the watcher.
+func reattach(
+	ctx context.Context,
+	ch *ch,
+	parent *ch,
+	tx channel.Transaction,
+) (watcher.StatesPub, watcher.AdjudicatorSub, error) {
+	if ch.parent != parent {
+		return nil, nil, errors.New("restored channel has a different parent")
+	}
+	if latestTx := ch.txRetriever.retrieve(); tx.Version > latestTx.Version {
+		if err := ch.statesPub.Publish(ctx, tx); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ch.statesPub, ch.eventsToClientSub, nil
 }
 
 func newCh(
@@ -216,7 +454,6 @@ func newCh(
 		subChs:              make(map[channel.ID]struct{}),
 		archivedSubChStates: make(map[channel.ID]channel.SignedState),
 
-		registeredVersion: 0,
 		txRetriever: txRetriever{
 			request:  make(chan struct{}),
 			response: make(chan channel.Transaction),
@@ -254,12 +491,14 @@ func (ch *ch) handleStatesFromClient(initialTx channel.Transaction) {
 				return
 			}
 			currentTx = _tx
+			ch.setLatestVersion(currentTx.Version)
 			log.WithField("ID", currentTx.ID).Debugf("Received state from client", currentTx.Version, currentTx.ID)
 
 		case <-ch.txRetriever.request:
 			pendingTx, found := readPendingTxs(ch.statesSub, statesFromClientWaitTime)
 			if found {
 				currentTx = pendingTx
+				ch.setLatestVersion(currentTx.Version)
 			}
 			ch.txRetriever.response <- currentTx
 		}
@@ -290,16 +529,17 @@ func readPendingTxs(statesSub statesSub, timeout time.Duration) (channel.Transac
 
 // handleEventsFromChain receives adjudicator events from the blockchain and
 // relays it to the client. If received state is not the latest, it disputes by
-// registering the latest state.
+// registering the latest state. If automatic settlement is enabled, the
+// channel is settled once the timeout of a registered or progressed state
+// elapses.
 //
 // It should be started as a go-routine and returns when the subscription for
 // adjudicator events from blockchain is closed.
-func (ch *ch) handleEventsFromChain(registerer channel.Registerer, chRegistry *registry) {
-	parent := ch
-	if ch.isSubChannel() {
-		parent = ch.parent
-	}
+func (ch *ch) handleEventsFromChain(registerer channel.Registerer, client *ClientWatcher, s *settler) {
+	root := ch.root()
 	for e := ch.eventsFromChainSub.Next(); e != nil; e = ch.eventsFromChainSub.Next() {
+		ch.setLastEvent(e)
+		client.publishAction(Action{Channel: ch.id, Type: ActionEvent, Version: e.Version(), Event: e})
 		switch e.(type) {
 		case *channel.RegisteredEvent:
 			// This lock ensures, when there are one or more sub-channels and
@@ -307,12 +547,12 @@ func (ch *ch) handleEventsFromChain(registerer channel.Registerer, chRegistry *r
 			// processed one after the other.
 			//
 			// Even if older states have been registered for more than one
-			// channel in the same family, the channel tree will be registered
+			// channel in the same tree, the channel tree will be registered
 			// only once.
-			parent.subChsAccess.Lock()
+			root.subChsAccess.Lock()
 
 			func() {
-				defer parent.subChsAccess.Unlock()
+				defer root.subChsAccess.Unlock()
 
 				log := log.WithFields(log.Fields{"ID": e.ID(), "Version": e.Version()})
 				log.Debug("Received registered event from chain")
@@ -322,24 +562,29 @@ func (ch *ch) handleEventsFromChain(registerer channel.Registerer, chRegistry *r
 				latestTx := ch.txRetriever.retrieve()
 				log.Debugf("Latest version is (%d)", latestTx.Version)
 
-				if e.Version() < latestTx.Version {
-					if e.Version() < ch.registeredVersion {
-						log.Debugf("Latest version (%d) already registered ", ch.registeredVersion)
-						return
-					}
-
-					log.Debugf("Registering latest version (%d)", latestTx.Version)
-					err := registerDispute(chRegistry, registerer, parent) //nolint:contextcheck
-					if err != nil {
-						log.Error("Error registering dispute")
-						return
-					}
-					log.Debug("Registered successfully")
+				if e.Version() >= latestTx.Version {
+					client.publishAction(Action{Channel: ch.id, Type: ActionRefutationNotRequired, Version: latestTx.Version})
+					return
+				}
+				if registered := ch.registeredVersion(); e.Version() < registered {
+					log.Debugf("Latest version (%d) already registered ", registered)
+					client.publishAction(Action{Channel: ch.id, Type: ActionAlreadyRefuted, Version: latestTx.Version})
+					return
+				}
+
+				log.Debugf("Registering latest version (%d)", latestTx.Version)
+				err := registerDispute(client, registerer, root) //nolint:contextcheck
+				if err != nil {
+					log.Error("Error registering dispute")
+					return
 				}
+				log.Debug("Registered successfully")
 			}()
+			ch.scheduleSettlement(s, client, e)
 		case *channel.ProgressedEvent:
 			log.Debugf("Received progressed event from chain: %v", e)
 			ch.eventsToClientPub.publish(e)
+			ch.scheduleSettlement(s, client, e)
 		case *channel.ConcludedEvent:
 			log.Debugf("Received concluded event from chain: %v", e)
 			ch.eventsToClientPub.publish(e)
@@ -354,42 +599,74 @@ func (ch *ch) handleEventsFromChain(registerer channel.Registerer, chRegistry *r
 	}
 }
 
-// registerDispute collects the latest transaction for the parent channel and
-// each of its children. It then registers a dispute for the channel tree.
+// registerDispute collects the latest transaction for the root channel and
+// each of its descendants. It then registers a dispute for the channel tree
+// and records it in the client's usage. The refutation is published as an
+// action.
 //
-// This function assumes the callers has locked the parent channel.
-func registerDispute(r *registry, registerer channel.Registerer, parentCh *ch) error {
-	parentTx, subStates := retreiveLatestSubStates(r, parentCh)
+// This function assumes the callers has locked the root channel.
+func registerDispute(c *ClientWatcher, registerer channel.Registerer, rootCh *ch) error {
+	rootCh.setRefuting(true)
+	rootTx, subStates := retreiveLatestSubStates(c.registry, rootCh)
 
-	err := registerer.Register(context.TODO(), makeAdjudicatorReq(parentCh.params, parentTx), subStates)
+	err := registerer.Register(context.TODO(), makeAdjudicatorReq(rootCh.params, rootTx), subStates)
+	rootCh.setRefuting(false)
 	if err != nil {
+		c.publishAction(Action{Channel: rootCh.id, Type: ActionRefute, Version: rootTx.Version, Err: err})
 		return err
 	}
 
-	parentCh.registeredVersion = parentTx.Version
+	rootCh.setRegisteredVersion(rootTx.Version)
+	registered := uint64(1)
 	for i := range subStates {
-		subCh, ok := r.retrieve(parentTx.Allocation.Locked[i].ID)
+		if subStates[i].State == nil {
+			continue
+		}
+		registered++
+		subCh, ok := c.retrieve(subStates[i].State.ID)
 		if ok {
-			subCh.registeredVersion = subStates[i].State.Version
+			subCh.setRegisteredVersion(subStates[i].State.Version)
 		}
 	}
+	c.recordUsage(func(u *Usage) {
+		u.Refutations++
+		u.Registrations += registered
+	})
+	c.publishAction(Action{Channel: rootCh.id, Type: ActionRefute, Version: rootTx.Version})
 	return nil
 }
 
-func retreiveLatestSubStates(r *registry, parent *ch) (channel.Transaction, []channel.SignedState) {
-	parentTx := parent.txRetriever.retrieve()
-	subStates := make([]channel.SignedState, len(parentTx.Allocation.Locked))
-	for i := range parentTx.Allocation.Locked {
+// retreiveLatestSubStates retrieves the latest transaction of the root
+// channel and the latest states of all its descendants, in depth-first
+// pre-order, as required by channel.Registerer.
+func retreiveLatestSubStates(r *registry, root *ch) (channel.Transaction, []channel.SignedState) {
+	rootTx := root.txRetriever.retrieve()
+	subStates := appendLatestSubStates(r, root, rootTx.Allocation.Locked, []channel.SignedState{})
+	return rootTx, subStates
+}
+
+func appendLatestSubStates(
+	r *registry,
+	root *ch,
+	locked []channel.SubAlloc,
+	subStates []channel.SignedState,
+) []channel.SignedState {
+	for _, subAlloc := range locked {
 		// Can be done concurrently.
-		subCh, ok := r.retrieve(parentTx.Allocation.Locked[i].ID)
+		var subState channel.SignedState
+		subCh, ok := r.retrieve(subAlloc.ID)
 		if ok {
 			subChTx := subCh.txRetriever.retrieve()
-			subStates[i] = makeSignedState(subCh.params, subChTx)
+			subState = makeSignedState(subCh.params, subChTx)
 		} else {
-			subStates[i] = parent.archivedSubChStates[parentTx.Allocation.Locked[i].ID]
+			subState = root.archivedSubChStates[subAlloc.ID]
+		}
+		subStates = append(subStates, subState)
+		if subState.State != nil {
+			subStates = appendLatestSubStates(r, root, subState.State.Locked, subStates)
 		}
 	}
-	return parentTx, subStates
+	return subStates
 }
 
 func makeSignedState(params *channel.Params, tx channel.Transaction) channel.SignedState {
@@ -412,54 +689,99 @@ func makeAdjudicatorReq(params *channel.Params, tx channel.Transaction) channel.
 // instances and removes the channel from the registry.
 //
 // The client should invoke stop watching for all the sub-channels before
-// invoking for the parent ledger channel.
+// invoking for their parent channel.
 //
 // In case of stop watching for sub-channels, watcher ensures that, when it
-// receives a registered event for its parent channel or any other sub-channels
-// of the parent channel, it is able to successfully refute with the latest
-// states for the ledger channel and all its sub-channels (even if the watcher
-// has stopped watching for some of the sub-channel).
+// receives a registered event for any channel in the channel tree, it is able
+// to successfully refute with the latest states for the ledger channel and all
+// its descendants (even if the watcher has stopped watching for some of the
+// sub-channels).
 //
 // Context is not used, it is for implementing watcher.Watcher interface.
-func (w *Watcher) StopWatching(_ context.Context, id channel.ID) error {
+func (w *ClientWatcher) StopWatching(_ context.Context, id channel.ID) error {
 	ch, ok := w.retrieve(id)
 	if !ok {
 		return errors.New("channel not registered with the watcher")
 	}
 
-	parent := ch
-	if ch.isSubChannel() {
-		parent = ch.parent
+	if err := w.deregister(ch); err != nil {
+		return err
 	}
-	parent.subChsAccess.Lock()
-	defer parent.subChsAccess.Unlock()
+
+	// The handlers are stopped without holding the lock on the channel tree,
+	// because the adjudicator event handler acquires it.
+	closePubSubs(ch)
+	w.publishAction(Action{Channel: id, Type: ActionStopWatching, Version: ch.latestVersion()})
+	return nil
+}
+
+// deregister removes the channel from the channel tree and the registry.
+func (w *ClientWatcher) deregister(ch *ch) error {
+	root := ch.root()
+	root.subChsAccess.Lock()
+	defer root.subChsAccess.Unlock()
 	if ch.isClosed {
 		// Channel could have been closed while were waiting for the mutex locked.
 		return errors.New("channel not registered with the watcher")
 	}
+	if len(ch.subChs) > 0 {
+		return errors.WithMessagef(ErrSubChannelsPresent, "cannot de-register: %d %v", len(ch.subChs), ch.id)
+	}
+	id := ch.id
 
 	if ch.isSubChannel() {
 		latestParentTx := ch.parent.txRetriever.retrieve()
 		if _, ok := latestParentTx.SubAlloc(id); ok {
-			parent.archivedSubChStates[id] = makeSignedState(ch.params, ch.txRetriever.retrieve())
+			archivedState := makeSignedState(ch.params, ch.txRetriever.retrieve())
+			if w.store != nil {
+				if err := w.store.putArchived(root.id, archivedState); err != nil {
+					return errors.WithMessage(err, "archiving sub-channel state")
+				}
+			}
+			root.archivedSubChStates[id] = archivedState
+		}
+		ch.parent.removeSubCh(id)
+	}
+
+	if w.store != nil {
+		if err := w.unpersist(ch); err != nil {
+			return err
 		}
-		delete(parent.subChs, id)
-	} else if len(ch.subChs) > 0 {
-		return errors.WithMessagef(ErrSubChannelsPresent, "cannot de-register: %d %v", len(ch.subChs), ch.id)
 	}
 
-	closePubSubs(ch)
 	w.remove(ch.id)
 	ch.isClosed = true
 	return nil
 }
 
+// unpersist removes the channel and, for ledger channels, the archived states
+// of its sub-channels from the store.
+func (w *ClientWatcher) unpersist(ch *ch) error {
+	if err := w.store.deleteChannel(ch.id); err != nil {
+		return err
+	}
+	if ch.isSubChannel() {
+		return nil
+	}
+	return errors.WithMessage(w.store.deleteArchived(ch.id), "deleting archived states")
+}
+
+// closeAll stops watching all channels of the client without removing them
+// from the store.
+func (w *ClientWatcher) closeAll() {
+	for _, ch := range w.all() {
+		closePubSubs(ch)
+		w.remove(ch.id)
+	}
+}
+
 func closePubSubs(ch *ch) {
 	if err := ch.eventsFromChainSub.Close(); err != nil {
 		err := errors.WithMessage(err, "closing events from chain sub")
 		log.WithField("id", ch.id).Error(err.Error())
 	}
 	ch.statesSub.close()
+	ch.stopSettlement()
 	ch.wg.Wait()
 
 	ch.eventsToClientPub.close()
@@ -17,6 +17,7 @@ package local_test
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"sync"
 	"testing"
@@ -31,9 +32,12 @@ import (
 	_ "perun.network/go-perun/backend/ethereum/channel/test" // For initilizing channeltest
 	"perun.network/go-perun/channel"
 	channeltest "perun.network/go-perun/channel/test"
+	wallettest "perun.network/go-perun/wallet/test"
 	"perun.network/go-perun/watcher"
 	"perun.network/go-perun/watcher/internal/mock"
 	"perun.network/go-perun/watcher/local"
+	"polycry.pt/poly-go/sortedkv"
+	"polycry.pt/poly-go/sortedkv/memorydb"
 	"polycry.pt/poly-go/test"
 )
 
@@ -103,17 +107,18 @@ func Test_StartWatching(t *testing.T) {
 			t.Log(err)
 		})
 
-		// Start watching for a sub-channel for the second time.
+		// Start watching for a sub-channel of a sub-channel.
 		// Parent is a sub-channel that is registered with the watcher.
-		t.Run("error/parent_is_sub_channel", func(t *testing.T) {
+		t.Run("happy/parent_is_sub_channel", func(t *testing.T) {
 			// Setup: Generate the params and the initial state for another sub-channel.
 			parent := childState.ID
 			childParams2, childState2 := channeltest.NewRandomParamsAndState(rng, channeltest.WithVersion(0))
 			childSignedState2 := makeSignedStateWDummySigs(childParams2, childState2)
 
-			_, _, err = w.StartWatchingSubChannel(context.Background(), parent, childSignedState2)
-			require.Error(t, err)
-			t.Log(err)
+			statesPub, eventsSub, err := w.StartWatchingSubChannel(context.Background(), parent, childSignedState2)
+			require.NoError(t, err)
+			require.NotNil(t, statesPub)
+			require.NotNil(t, eventsSub)
 		})
 	})
 }
@@ -472,6 +477,75 @@ func Test_Watcher_Working(t *testing.T) {
 			testIfEventsAreRelayed(t, makeConcludedEvents)
 		})
 	})
+
+	t.Run("ledger_channel_with_nested_sub_channels", func(t *testing.T) {
+		// Send a registered event on the adjudicator subscription of the ledger channel,
+		// with a state older than the latest state (published to the watcher).
+		// Watcher should refute by registering the latest states of the whole channel tree.
+		//
+		// If stopWatchingGrandChild is true, the watcher stops watching for
+		// the grand child before the event is triggered, and should refute
+		// with its archived state.
+		testRefutation := func(t *testing.T, stopWatchingGrandChild bool) {
+			t.Helper()
+			// Setup
+			parentParams, parentTxs := randomTxsForSingleCh(rng, 3)
+			childParams, childTxs := randomTxsForSingleCh(rng, 3)
+			grandChildParams, grandChildTxs := randomTxsForSingleCh(rng, 2)
+			// Add sub-channels to allocations. These transactions represent funding of the sub-channels.
+			parentTxs[2].Allocation.Locked = []channel.SubAlloc{{ID: childTxs[0].ID}}
+			childTxs[2].Allocation.Locked = []channel.SubAlloc{{ID: grandChildTxs[0].ID}}
+
+			adjSubParent := &mock.AdjudicatorSubscription{}
+			triggerParent := setExpectationNextCall(adjSubParent, makeRegisteredEvents(parentTxs[1], parentTxs[2])...)
+			adjSubChild := &mock.AdjudicatorSubscription{}
+			setExpectationNextCall(adjSubChild)
+			adjSubGrandChild := &mock.AdjudicatorSubscription{}
+			triggerGrandChild := setExpectationNextCall(adjSubGrandChild)
+			setExpectationCloseCallErrCall(adjSubGrandChild, triggerGrandChild, nil)
+			rs := &mock.RegisterSubscriber{}
+			setExpectationSubscribeCall(rs, adjSubParent, nil)
+			setExpectationSubscribeCall(rs, adjSubChild, nil)
+			setExpectationSubscribeCall(rs, adjSubGrandChild, nil)
+			setExpectationRegisterCalls(t, rs,
+				&channelTree{parentTxs[2], []channel.Transaction{childTxs[2], grandChildTxs[1]}})
+
+			w := newWatcher(t, rs)
+
+			// Publish the states of all channels in the tree to the watcher.
+			parentSignedState := makeSignedStateWDummySigs(parentParams, parentTxs[0].State)
+			statesPubParent, eventsForClientParent := startWatchingForLedgerChannel(t, w, parentSignedState)
+			require.NoError(t, statesPubParent.Publish(context.Background(), parentTxs[1]))
+			require.NoError(t, statesPubParent.Publish(context.Background(), parentTxs[2]))
+
+			childSignedState := makeSignedStateWDummySigs(childParams, childTxs[0].State)
+			statesPubChild, _ := startWatchingForSubChannel(t, w, childSignedState, parentTxs[0].State.ID)
+			require.NoError(t, statesPubChild.Publish(context.Background(), childTxs[1]))
+			require.NoError(t, statesPubChild.Publish(context.Background(), childTxs[2]))
+
+			grandChildSignedState := makeSignedStateWDummySigs(grandChildParams, grandChildTxs[0].State)
+			statesPubGrandChild, _ := startWatchingForSubChannel(t, w, grandChildSignedState, childTxs[0].State.ID)
+			require.NoError(t, statesPubGrandChild.Publish(context.Background(), grandChildTxs[1]))
+
+			// The child cannot be de-registered while the grand child is registered.
+			require.True(t, local.IsErrSubChannelsPresent(w.StopWatching(context.Background(), childTxs[0].State.ID)))
+			if stopWatchingGrandChild {
+				require.NoError(t, w.StopWatching(context.Background(), grandChildTxs[0].State.ID))
+			}
+
+			// Trigger adjudicator events with an older state and assert if Register was called once.
+			triggerAdjEventAndExpectNotification(t, triggerParent, eventsForClientParent)
+			time.Sleep(50 * time.Millisecond) // Wait for the watcher to refute.
+			rs.AssertNumberOfCalls(t, "Register", 1)
+
+			// Trigger adjudicator events with the registered state and assert.
+			triggerAdjEventAndExpectNotification(t, triggerParent, eventsForClientParent)
+			rs.AssertExpectations(t)
+		}
+
+		t.Run("happy/older_state_registered", func(t *testing.T) { testRefutation(t, false) })
+		t.Run("happy/older_state_registered_grand_child_archived", func(t *testing.T) { testRefutation(t, true) })
+	})
 }
 
 func Test_Watcher_StopWatching(t *testing.T) {
@@ -710,6 +784,497 @@ func Test_Watcher_StopWatching(t *testing.T) {
 	})
 }
 
+func Test_Watcher_Persistence(t *testing.T) {
+	rng := test.Prng(t)
+
+	// Start watching for a ledger channel, publish a newer state and restart
+	// the watcher. The restored watcher should refute with the latest state,
+	// even before the client re-attaches to the channel.
+	t.Run("happy/ledger_channel_restored", func(t *testing.T) {
+		db := memorydb.NewDatabase()
+		params, txs := randomTxsForSingleCh(rng, 3)
+
+		adjSub := &mock.AdjudicatorSubscription{}
+		setExpectationNextCall(adjSub)
+		rs := &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSub, nil)
+		w := newPersistentWatcher(t, rs, db)
+		statesPub, _ := startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(params, txs[0].State))
+		require.NoError(t, statesPub.Publish(context.Background(), txs[2]))
+
+		// Restart the watcher.
+		adjSub = &mock.AdjudicatorSubscription{}
+		trigger := setExpectationNextCall(adjSub, makeRegisteredEvents(txs[1], txs[2])...)
+		setExpectationCloseCallErrCall(adjSub, trigger, nil)
+		rs = &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSub, nil)
+		setExpectationRegisterCalls(t, rs, &channelTree{txs[2], []channel.Transaction{}})
+		w = newPersistentWatcher(t, rs, db)
+
+		trigger.trigger()
+		time.Sleep(50 * time.Millisecond) // Wait for the watcher to refute.
+		rs.AssertNumberOfCalls(t, "Register", 1)
+
+		// Re-attach to the restored channel and receive the buffered event.
+		_, eventsForClient := startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(params, txs[0].State))
+		require.EqualValues(t, makeRegisteredEvents(txs[1])[0], <-eventsForClient.EventStream())
+		triggerAdjEventAndExpectNotification(t, trigger, eventsForClient)
+
+		// Stop watching removes the channel from the store.
+		require.NoError(t, w.StopWatching(context.Background(), txs[0].State.ID))
+		rs.AssertExpectations(t)
+		w = newPersistentWatcher(t, &mock.RegisterSubscriber{}, db)
+		require.Error(t, w.StopWatching(context.Background(), txs[0].State.ID))
+	})
+
+	// Start watching for a ledger channel and a sub-channel, stop watching
+	// for the sub-channel and restart the watcher. The restored watcher should
+	// refute with the archived sub-channel state.
+	t.Run("happy/archived_sub_channel_state_restored", func(t *testing.T) {
+		db := memorydb.NewDatabase()
+		parentParams, parentTxs := randomTxsForSingleCh(rng, 3)
+		childParams, childTxs := randomTxsForSingleCh(rng, 2)
+		// The sub-allocation must be valid, because the states are persisted.
+		subAlloc := *channel.NewSubAlloc(childTxs[0].ID, []channel.Bal{big.NewInt(0)}, nil)
+		parentTxs[1].Allocation.Locked = []channel.SubAlloc{subAlloc} // sub-channel funding.
+		parentTxs[2].Allocation.Locked = []channel.SubAlloc{subAlloc}
+
+		adjSubParent := &mock.AdjudicatorSubscription{}
+		setExpectationNextCall(adjSubParent)
+		adjSubChild := &mock.AdjudicatorSubscription{}
+		triggerChild := setExpectationNextCall(adjSubChild)
+		setExpectationCloseCallErrCall(adjSubChild, triggerChild, nil)
+		rs := &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSubParent, nil)
+		setExpectationSubscribeCall(rs, adjSubChild, nil)
+		w := newPersistentWatcher(t, rs, db)
+
+		parentStatesPub, _ := startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(parentParams, parentTxs[0].State))
+		require.NoError(t, parentStatesPub.Publish(context.Background(), parentTxs[1]))
+		require.NoError(t, parentStatesPub.Publish(context.Background(), parentTxs[2]))
+		childStatesPub, _ := startWatchingForSubChannel(t, w, makeSignedStateWDummySigs(childParams, childTxs[0].State), parentTxs[0].State.ID)
+		require.NoError(t, childStatesPub.Publish(context.Background(), childTxs[1]))
+		require.NoError(t, w.StopWatching(context.Background(), childTxs[0].State.ID))
+
+		// Restart the watcher.
+		adjSubParent = &mock.AdjudicatorSubscription{}
+		triggerParent := setExpectationNextCall(adjSubParent, makeRegisteredEvents(parentTxs[1])...)
+		rs = &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSubParent, nil)
+		setExpectationRegisterCalls(t, rs, &channelTree{parentTxs[2], []channel.Transaction{childTxs[1]}})
+		w = newPersistentWatcher(t, rs, db)
+		_, eventsForClient := startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(parentParams, parentTxs[0].State))
+
+		triggerAdjEventAndExpectNotification(t, triggerParent, eventsForClient)
+		time.Sleep(50 * time.Millisecond) // Wait for the watcher to refute.
+		rs.AssertExpectations(t)
+	})
+
+	// Re-attaching to a restored channel with a newer state should publish
+	// the state to the watcher.
+	t.Run("happy/reattach_with_newer_state", func(t *testing.T) {
+		db := memorydb.NewDatabase()
+		params, txs := randomTxsForSingleCh(rng, 3)
+
+		adjSub := &mock.AdjudicatorSubscription{}
+		setExpectationNextCall(adjSub)
+		rs := &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSub, nil)
+		w := newPersistentWatcher(t, rs, db)
+		startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(params, txs[0].State))
+
+		// Restart the watcher.
+		adjSub = &mock.AdjudicatorSubscription{}
+		trigger := setExpectationNextCall(adjSub, makeRegisteredEvents(txs[1])...)
+		rs = &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSub, nil)
+		setExpectationRegisterCalls(t, rs, &channelTree{txs[2], []channel.Transaction{}})
+		w = newPersistentWatcher(t, rs, db)
+		_, eventsForClient := startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(params, txs[2].State))
+
+		triggerAdjEventAndExpectNotification(t, trigger, eventsForClient)
+		time.Sleep(50 * time.Millisecond) // Wait for the watcher to refute.
+		rs.AssertExpectations(t)
+	})
+}
+
+func Test_Watcher_AutoSettlement(t *testing.T) {
+	rng := test.Prng(t)
+	acc := wallettest.NewRandomAccount(rng)
+	withAcc := channeltest.WithParts(wallettest.NewRandomAddress(rng), acc.Address())
+
+	// setup starts watching for a ledger channel with auto settlement enabled.
+	// The returned channel receives the requests of all calls to Withdraw.
+	setup := func(t *testing.T, params *channel.Params, txs []channel.Transaction, adjSub *mock.AdjudicatorSubscription) (
+		*local.Watcher, watcher.AdjudicatorSub, chan channel.AdjudicatorReq,
+	) {
+		t.Helper()
+		rs := &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSub, nil)
+		withdrawn := make(chan channel.AdjudicatorReq, 1)
+		wd := &mock.Withdrawer{}
+		wd.On("Withdraw", testifyMock.Anything, testifyMock.Anything, testifyMock.Anything).Run(
+			func(args testifyMock.Arguments) { withdrawn <- args.Get(1).(channel.AdjudicatorReq) },
+		).Return(nil)
+
+		w, err := local.NewWatcher(rs, local.WithAutoSettlement(wd, wallettest.RandomWallet()))
+		require.NoError(t, err)
+		statesPub, eventsForClient := startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(params, txs[0].State))
+		for _, tx := range txs[1:] {
+			require.NoError(t, statesPub.Publish(context.Background(), tx))
+		}
+		return w, eventsForClient, withdrawn
+	}
+
+	// After the timeout of the registered state elapsed, the latest state is
+	// withdrawn for the participant whose account is in the wallet.
+	t.Run("happy/registered", func(t *testing.T) {
+		params, txs := randomTxsForSingleCh(rng, 2, withAcc)
+		adjSub := &mock.AdjudicatorSubscription{}
+		trigger := setExpectationNextCall(adjSub, makeRegisteredEvents(txs[1])...)
+		_, eventsForClient, withdrawn := setup(t, params, txs, adjSub)
+
+		triggerAdjEventAndExpectNotification(t, trigger, eventsForClient)
+		req := <-withdrawn
+		assert.True(t, assertEqualAdjudicatorReq(t, req, txs[1].State))
+		assert.Equal(t, channel.Index(1), req.Idx)
+		assert.True(t, req.Acc.Address().Equal(acc.Address()))
+	})
+
+	// After the timeout of a progressed state elapsed, the progressed state is
+	// withdrawn, even if it was not published to the watcher.
+	t.Run("happy/progressed", func(t *testing.T) {
+		params, txs := randomTxsForSingleCh(rng, 3, withAcc)
+		adjSub := &mock.AdjudicatorSubscription{}
+		trigger := setExpectationNextCall(adjSub, makeProgressedEvents(txs[2])...)
+		_, eventsForClient, withdrawn := setup(t, params, txs[:2], adjSub)
+
+		triggerAdjEventAndExpectNotification(t, trigger, eventsForClient)
+		assert.True(t, assertEqualAdjudicatorReq(t, <-withdrawn, txs[2].State))
+	})
+
+	// Stopping to watch before the timeout elapsed cancels the settlement.
+	t.Run("happy/stopped_before_timeout", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		params, txs := randomTxsForSingleCh(rng, 2, withAcc)
+		event := makeRegisteredEvents(txs[1])[0].(*channel.RegisteredEvent)
+		event.TimeoutV = &channel.TimeTimeout{Time: time.Now().Add(time.Hour)}
+		adjSub := &mock.AdjudicatorSubscription{}
+		trigger := setExpectationNextCall(adjSub, event)
+		setExpectationCloseCallErrCall(adjSub, trigger, nil)
+		w, eventsForClient, withdrawn := setup(t, params, txs, adjSub)
+
+		triggerAdjEventAndExpectNotification(t, trigger, eventsForClient)
+		require.NoError(t, w.StopWatching(context.Background(), txs[0].State.ID))
+		assert.Empty(t, withdrawn)
+	})
+}
+
+func Test_Watcher_Clients(t *testing.T) {
+	rng := test.Prng(t)
+
+	// newClosableSub returns an adjudicator subscription without events, that
+	// can be closed.
+	newClosableSub := func() *mock.AdjudicatorSubscription {
+		adjSub := &mock.AdjudicatorSubscription{}
+		trigger := setExpectationNextCall(adjSub)
+		setExpectationCloseCallErrCall(adjSub, trigger, nil)
+		return adjSub
+	}
+
+	// Different clients can watch the same channel independently.
+	t.Run("happy/namespaces", func(t *testing.T) {
+		params, txs := randomTxsForSingleCh(rng, 1)
+		rs := &mock.RegisterSubscriber{}
+		for i := 0; i < 3; i++ {
+			setExpectationSubscribeCall(rs, newClosableSub(), nil)
+		}
+		w := newWatcher(t, rs)
+		alice, err := w.Client("alice")
+		require.NoError(t, err)
+		bob, err := w.Client("bob")
+		require.NoError(t, err)
+		sameAlice, err := w.Client("alice")
+		require.NoError(t, err)
+		assert.Same(t, alice, sameAlice)
+		assert.Equal(t, []local.ClientID{"alice", "bob"}, w.Clients())
+
+		for _, c := range []watcher.Watcher{w, alice, bob} {
+			startWatchingForLedgerChannel(t, c, makeSignedStateWDummySigs(params, txs[0].State))
+		}
+		require.NoError(t, alice.StopWatching(context.Background(), txs[0].ID))
+		require.Error(t, alice.StopWatching(context.Background(), txs[0].ID))
+		assert.Equal(t, 1, bob.NumChannels())
+		assert.Equal(t, 1, w.NumChannels())
+
+		// Sub-channels can only be watched for channels of the same client.
+		childParams, childTxs := randomTxsForSingleCh(rng, 1)
+		_, _, err = alice.StartWatchingSubChannel(context.Background(), txs[0].ID,
+			makeSignedStateWDummySigs(childParams, childTxs[0].State))
+		require.Error(t, err)
+
+		require.NoError(t, bob.StopWatching(context.Background(), txs[0].ID))
+		require.NoError(t, w.StopWatching(context.Background(), txs[0].ID))
+		rs.AssertExpectations(t)
+	})
+
+	t.Run("happy/quota", func(t *testing.T) {
+		rs := &mock.RegisterSubscriber{}
+		for i := 0; i < 4; i++ {
+			setExpectationSubscribeCall(rs, newClosableSub(), nil)
+		}
+		w, err := local.NewWatcher(rs, local.WithChannelQuota(1))
+		require.NoError(t, err)
+		alice, err := w.Client("alice")
+		require.NoError(t, err)
+
+		params1, txs1 := randomTxsForSingleCh(rng, 1)
+		params2, txs2 := randomTxsForSingleCh(rng, 1)
+		startWatchingForLedgerChannel(t, alice, makeSignedStateWDummySigs(params1, txs1[0].State))
+		_, _, err = alice.StartWatchingLedgerChannel(context.Background(), makeSignedStateWDummySigs(params2, txs2[0].State))
+		require.True(t, local.IsErrQuotaExceeded(err), err)
+
+		// The quotas of other clients are not affected.
+		startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(params2, txs2[0].State))
+
+		// Stopping to watch a channel frees the quota.
+		require.NoError(t, alice.StopWatching(context.Background(), txs1[0].ID))
+		startWatchingForLedgerChannel(t, alice, makeSignedStateWDummySigs(params2, txs2[0].State))
+
+		require.Error(t, alice.SetChannelQuota(-1))
+		require.NoError(t, alice.SetChannelQuota(2))
+		startWatchingForLedgerChannel(t, alice, makeSignedStateWDummySigs(params1, txs1[0].State))
+		assert.Equal(t, 2, alice.NumChannels())
+	})
+
+	// Refutations are recorded in the usage of the client and the usage is
+	// restored along with the client and its quota.
+	t.Run("happy/usage_persisted", func(t *testing.T) {
+		db := memorydb.NewDatabase()
+		parentParams, parentTxs := randomTxsForSingleCh(rng, 3)
+		childParams, childTxs := randomTxsForSingleCh(rng, 1)
+		subAlloc := *channel.NewSubAlloc(childTxs[0].ID, []channel.Bal{big.NewInt(0)}, nil)
+		parentTxs[2].Allocation.Locked = []channel.SubAlloc{subAlloc}
+
+		adjSubParent := &mock.AdjudicatorSubscription{}
+		triggerParent := setExpectationNextCall(adjSubParent, makeRegisteredEvents(parentTxs[1])...)
+		adjSubChild := &mock.AdjudicatorSubscription{}
+		setExpectationNextCall(adjSubChild)
+		rs := &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSubParent, nil)
+		setExpectationSubscribeCall(rs, adjSubChild, nil)
+		setExpectationRegisterCalls(t, rs, &channelTree{parentTxs[2], []channel.Transaction{childTxs[0]}})
+		w := newPersistentWatcher(t, rs, db)
+		alice, err := w.Client("alice")
+		require.NoError(t, err)
+
+		require.NoError(t, alice.SetChannelQuota(2))
+		statesPub, eventsForClient := startWatchingForLedgerChannel(t, alice,
+			makeSignedStateWDummySigs(parentParams, parentTxs[0].State))
+		require.NoError(t, statesPub.Publish(context.Background(), parentTxs[2]))
+		startWatchingForSubChannel(t, alice, makeSignedStateWDummySigs(childParams, childTxs[0].State), parentTxs[0].ID)
+
+		triggerAdjEventAndExpectNotification(t, triggerParent, eventsForClient)
+		wantUsage := local.Usage{Refutations: 1, Registrations: 2}
+		require.Eventually(t, func() bool { return alice.Usage() == wantUsage }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, local.Usage{}, w.Usage())
+		rs.AssertExpectations(t)
+
+		// Restart the watcher.
+		rs = &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, &ethChannel.RegisteredSub{}, nil)
+		setExpectationSubscribeCall(rs, &ethChannel.RegisteredSub{}, nil)
+		w = newPersistentWatcher(t, rs, db)
+		assert.Equal(t, []local.ClientID{"alice"}, w.Clients())
+		alice, err = w.Client("alice")
+		require.NoError(t, err)
+		assert.Equal(t, wantUsage, alice.Usage())
+		assert.Equal(t, 2, alice.NumChannels())
+		assert.Zero(t, w.NumChannels())
+		params, txs := randomTxsForSingleCh(rng, 1)
+		_, _, err = alice.StartWatchingLedgerChannel(context.Background(), makeSignedStateWDummySigs(params, txs[0].State))
+		require.True(t, local.IsErrQuotaExceeded(err), err)
+	})
+}
+
+func Test_Watcher_Status(t *testing.T) {
+	rng := test.Prng(t)
+
+	// randomTree returns the transactions of a ledger channel with a funded
+	// sub-channel.
+	randomTree := func() (parentParams, childParams *channel.Params, parentTxs, childTxs []channel.Transaction) {
+		parentParams, parentTxs = randomTxsForSingleCh(rng, 3)
+		childParams, childTxs = randomTxsForSingleCh(rng, 3)
+		parentTxs[2].Allocation.Locked = []channel.SubAlloc{{ID: childTxs[0].ID}}
+		return parentParams, childParams, parentTxs, childTxs
+	}
+
+	// startWatchingTree starts watching for the channel tree and publishes
+	// the latest states of both channels.
+	startWatchingTree := func(
+		t *testing.T,
+		w *local.Watcher,
+		parentParams, childParams *channel.Params,
+		parentTxs, childTxs []channel.Transaction,
+	) (eventsParent, eventsChild watcher.AdjudicatorSub) {
+		t.Helper()
+		parentPub, eventsParent := startWatchingForLedgerChannel(t, w, makeSignedStateWDummySigs(parentParams, parentTxs[0].State))
+		require.NoError(t, parentPub.Publish(context.Background(), parentTxs[2]))
+		childPub, eventsChild := startWatchingForSubChannel(t, w,
+			makeSignedStateWDummySigs(childParams, childTxs[0].State), parentTxs[0].ID)
+		require.NoError(t, childPub.Publish(context.Background(), childTxs[2]))
+		require.Eventually(t, func() bool {
+			s, _ := w.Channel(childTxs[0].ID)
+			return s.LatestVersion == childTxs[2].Version
+		}, time.Second, 10*time.Millisecond)
+		return eventsParent, eventsChild
+	}
+
+	// The status reflects the channel tree, the refutation and the received
+	// events. Each decision of the watcher is published as an action.
+	t.Run("happy/refutation", func(t *testing.T) {
+		parentParams, childParams, parentTxs, childTxs := randomTree()
+		parentID, childID := parentTxs[0].ID, childTxs[0].ID
+		adjSubParent := &mock.AdjudicatorSubscription{}
+		triggerParent := setExpectationNextCall(adjSubParent, makeRegisteredEvents(parentTxs[1], parentTxs[2])...)
+		adjSubChild := &mock.AdjudicatorSubscription{}
+		triggerChild := setExpectationNextCall(adjSubChild, makeRegisteredEvents(childTxs[1])...)
+		rs := &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSubParent, nil)
+		setExpectationSubscribeCall(rs, adjSubChild, nil)
+		setExpectationRegisterCalls(t, rs, &channelTree{parentTxs[2], []channel.Transaction{childTxs[2]}})
+		w := newWatcher(t, rs)
+		sub := w.SubscribeActions()
+		defer sub.Close()
+		eventsParent, eventsChild := startWatchingTree(t, w, parentParams, childParams, parentTxs, childTxs)
+
+		triggerAdjEventAndExpectNotification(t, triggerParent, eventsParent)
+		a := expectAction(t, sub, local.ActionEvent)
+		assert.Equal(t, parentID, a.Channel)
+		assert.Equal(t, parentTxs[1].Version, a.Version)
+		a = expectAction(t, sub, local.ActionRefute)
+		assert.Equal(t, parentID, a.Channel)
+		assert.Equal(t, parentTxs[2].Version, a.Version)
+		assert.NoError(t, a.Err)
+
+		// The child's registered state is older than the latest one, but the
+		// latest one was already registered.
+		triggerAdjEventAndExpectNotification(t, triggerChild, eventsChild)
+		a = expectAction(t, sub, local.ActionAlreadyRefuted)
+		assert.Equal(t, childID, a.Channel)
+
+		triggerAdjEventAndExpectNotification(t, triggerParent, eventsParent)
+		a = expectAction(t, sub, local.ActionRefutationNotRequired)
+		assert.Equal(t, parentID, a.Channel)
+
+		status := w.Status()
+		assert.Equal(t, local.ClientID(""), status.Client)
+		assert.Equal(t, local.Usage{Refutations: 1, Registrations: 2}, status.Usage)
+		require.Len(t, status.Channels, 2)
+		parent, ok := w.Channel(parentID)
+		require.True(t, ok)
+		assert.Nil(t, parent.Parent)
+		assert.Equal(t, []channel.ID{childID}, parent.SubChannels)
+		assert.Equal(t, parentTxs[2].Version, parent.LatestVersion)
+		assert.Equal(t, parentTxs[2].Version, parent.RegisteredVersion)
+		assert.Equal(t, parentTxs[2].Version, parent.LastEvent.Version())
+		assert.False(t, parent.RefutationPending)
+		child, ok := w.Channel(childID)
+		require.True(t, ok)
+		require.NotNil(t, child.Parent)
+		assert.Equal(t, parentID, *child.Parent)
+		assert.Empty(t, child.SubChannels)
+		assert.Equal(t, childTxs[2].Version, child.RegisteredVersion)
+		assert.Equal(t, childTxs[1].Version, child.LastEvent.Version())
+		rs.AssertExpectations(t)
+	})
+
+	// While the refutation is in progress, it is marked as pending for all
+	// channels in the tree.
+	t.Run("happy/refutation_pending", func(t *testing.T) {
+		parentParams, childParams, parentTxs, childTxs := randomTree()
+		adjSubParent := &mock.AdjudicatorSubscription{}
+		triggerParent := setExpectationNextCall(adjSubParent, makeRegisteredEvents(parentTxs[1])...)
+		adjSubChild := &mock.AdjudicatorSubscription{}
+		setExpectationNextCall(adjSubChild)
+		rs := &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSubParent, nil)
+		setExpectationSubscribeCall(rs, adjSubChild, nil)
+		release := make(chan struct{})
+		rs.On("Register", testifyMock.Anything, testifyMock.Anything, testifyMock.Anything).Run(
+			func(testifyMock.Arguments) { <-release },
+		).Return(assert.AnError)
+		w := newWatcher(t, rs)
+		sub := w.SubscribeActions()
+		defer sub.Close()
+		eventsParent, _ := startWatchingTree(t, w, parentParams, childParams, parentTxs, childTxs)
+
+		triggerAdjEventAndExpectNotification(t, triggerParent, eventsParent)
+		for _, id := range []channel.ID{parentTxs[0].ID, childTxs[0].ID} {
+			id := id
+			require.Eventually(t, func() bool {
+				s, _ := w.Channel(id)
+				return s.RefutationPending
+			}, time.Second, 10*time.Millisecond)
+		}
+
+		close(release)
+		a := expectAction(t, sub, local.ActionRefute)
+		assert.ErrorIs(t, a.Err, assert.AnError)
+		parent, _ := w.Channel(parentTxs[0].ID)
+		assert.False(t, parent.RefutationPending)
+		assert.Zero(t, parent.RegisteredVersion)
+	})
+
+	t.Run("happy/start_stop_watching", func(t *testing.T) {
+		params, txs := randomTxsForSingleCh(rng, 1)
+		adjSub := &mock.AdjudicatorSubscription{}
+		trigger := setExpectationNextCall(adjSub)
+		setExpectationCloseCallErrCall(adjSub, trigger, nil)
+		rs := &mock.RegisterSubscriber{}
+		setExpectationSubscribeCall(rs, adjSub, nil)
+		w := newWatcher(t, rs)
+		alice, err := w.Client("alice")
+		require.NoError(t, err)
+		sub := w.SubscribeActions()
+
+		startWatchingForLedgerChannel(t, alice, makeSignedStateWDummySigs(params, txs[0].State))
+		a := expectAction(t, sub, local.ActionStartWatching)
+		assert.Equal(t, local.ClientID("alice"), a.Client)
+		assert.Equal(t, txs[0].ID, a.Channel)
+		assert.Len(t, alice.Channels(), 1)
+		assert.Empty(t, w.Channels())
+
+		require.NoError(t, alice.StopWatching(context.Background(), txs[0].ID))
+		expectAction(t, sub, local.ActionStopWatching)
+		_, ok := alice.Channel(txs[0].ID)
+		assert.False(t, ok)
+
+		sub.Close()
+		_, ok = <-sub.ActionStream()
+		assert.False(t, ok)
+		assert.Zero(t, sub.Missed())
+	})
+}
+
+// expectAction returns the next action of the given type published on the
+// subscription. Actions of other types are skipped.
+func expectAction(t *testing.T, sub *local.ActionSub, actionType local.ActionType) local.Action {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case a := <-sub.ActionStream():
+			if a.Type == actionType {
+				return a
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for action %v", actionType)
+			return local.Action{}
+		}
+	}
+}
+
 func newWatcher(t *testing.T, rs channel.RegisterSubscriber) *local.Watcher {
 	t.Helper()
 
@@ -719,14 +1284,27 @@ func newWatcher(t *testing.T, rs channel.RegisterSubscriber) *local.Watcher {
 	return w
 }
 
+func newPersistentWatcher(t *testing.T, rs channel.RegisterSubscriber, db sortedkv.Database) *local.Watcher {
+	t.Helper()
+
+	w, err := local.NewPersistentWatcher(context.Background(), rs, db)
+	require.NoError(t, err)
+	require.NotNil(t, w)
+	return w
+}
+
 func makeSignedStateWDummySigs(params *channel.Params, state *channel.State) channel.SignedState {
 	return channel.SignedState{Params: params, State: state}
 }
 
-// randomTxsForSingleCh returns "n" transactions for a random channel.
-func randomTxsForSingleCh(rng *rand.Rand, n int) (*channel.Params, []channel.Transaction) {
-	params, initialState := channeltest.NewRandomParamsAndState(rng, channeltest.WithVersion(0),
-		channeltest.WithNumParts(2), channeltest.WithNumAssets(1), channeltest.WithIsFinal(false), channeltest.WithNumLocked(0))
+// randomTxsForSingleCh returns "n" transactions for a random channel. The
+// given options override the default options.
+func randomTxsForSingleCh(rng *rand.Rand, n int, opts ...channeltest.RandomOpt) (*channel.Params, []channel.Transaction) {
+	opts = append([]channeltest.RandomOpt{
+		channeltest.WithVersion(0), channeltest.WithNumParts(2), channeltest.WithNumAssets(1),
+		channeltest.WithIsFinal(false), channeltest.WithNumLocked(0),
+	}, opts...)
+	params, initialState := channeltest.NewRandomParamsAndState(rng, opts...)
 
 	txs := make([]channel.Transaction, n)
 	for i := range txs {
@@ -934,7 +1512,7 @@ func makeConcludedEvents(txs ...channel.Transaction) []channel.AdjudicatorEvent
 
 func startWatchingForLedgerChannel(
 	t *testing.T,
-	w *local.Watcher,
+	w watcher.Watcher,
 	signedState channel.SignedState,
 ) (watcher.StatesPub, watcher.AdjudicatorSub) {
 	t.Helper()
@@ -949,7 +1527,7 @@ func startWatchingForLedgerChannel(
 
 func startWatchingForSubChannel(
 	t *testing.T,
-	w *local.Watcher,
+	w watcher.Watcher,
 	signedState channel.SignedState,
 	parentID channel.ID,
 ) (watcher.StatesPub, watcher.AdjudicatorSub) {
@@ -0,0 +1,174 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	stdsync "sync"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/watcher"
+)
+
+var (
+	_ watcher.AdjudicatorSub = (*adjudicatorSub)(nil)
+	_ channel.Timeout        = (*timeout)(nil)
+)
+
+const adjSubBufferSize = 10
+
+type (
+	// adjudicatorSub relays the adjudicator events received from the
+	// watchtower to the client.
+	adjudicatorSub struct {
+		events chan channel.AdjudicatorEvent
+		done   chan struct{}
+		once   stdsync.Once
+		sendMu stdsync.Mutex // prevents closing events while sending
+
+		mu       stdsync.Mutex
+		err      error
+		timeouts map[uint64]*timeout // by event sequence number
+	}
+
+	// timeout is the timeout of an event relayed by the watchtower. It
+	// elapses when the watchtower signals so.
+	timeout struct {
+		elapsed chan struct{}
+		once    stdsync.Once
+	}
+)
+
+func newAdjudicatorSub() *adjudicatorSub {
+	return &adjudicatorSub{
+		events:   make(chan channel.AdjudicatorEvent, adjSubBufferSize),
+		done:     make(chan struct{}),
+		timeouts: make(map[uint64]*timeout),
+	}
+}
+
+// EventStream returns a channel for consuming the relayed adjudicator events.
+// It always returns the same channel and does not support multiplexing.
+//
+// The channel will be closed when the client stops watching or when the
+// Watcher is closed, and Err should tell the possible error.
+func (a *adjudicatorSub) EventStream() <-chan channel.AdjudicatorEvent {
+	return a.events
+}
+
+// Err returns the error that caused the subscription to close, if any.
+func (a *adjudicatorSub) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// publish publishes the event of the given message on the event stream. It
+// blocks until the event was consumed or the subscription was closed.
+func (a *adjudicatorSub) publish(m *msgWatchEvent) {
+	var t channel.Timeout = &channel.ElapsedTimeout{}
+	if !m.Elapsed {
+		t = a.timeout(m.Seq)
+	}
+	switch e := m.Event.(type) {
+	case *channel.RegisteredEvent:
+		e.TimeoutV = t
+	case *channel.ProgressedEvent:
+		e.TimeoutV = t
+	case *channel.ConcludedEvent:
+		e.TimeoutV = t
+	}
+
+	a.sendMu.Lock()
+	defer a.sendMu.Unlock()
+	select {
+	case <-a.done:
+		return
+	default:
+	}
+	select {
+	case a.events <- m.Event:
+	case <-a.done:
+	}
+}
+
+// timeout returns the timeout of the event with the given sequence number.
+func (a *adjudicatorSub) timeout(seq uint64) *timeout {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.timeouts[seq]
+	if !ok {
+		t = &timeout{elapsed: make(chan struct{})}
+		a.timeouts[seq] = t
+	} else {
+		// The timeout elapsed before the event was received.
+		delete(a.timeouts, seq)
+	}
+	return t
+}
+
+// timeoutElapsed marks the timeout of the event with the given sequence
+// number as elapsed.
+func (a *adjudicatorSub) timeoutElapsed(seq uint64) {
+	a.mu.Lock()
+	t, ok := a.timeouts[seq]
+	if !ok {
+		t = &timeout{elapsed: make(chan struct{})}
+		a.timeouts[seq] = t
+	} else {
+		delete(a.timeouts, seq)
+	}
+	a.mu.Unlock()
+	t.once.Do(func() { close(t.elapsed) })
+}
+
+// close closes the subscription with the given error.
+func (a *adjudicatorSub) close(err error) {
+	a.once.Do(func() {
+		a.mu.Lock()
+		a.err = err
+		a.mu.Unlock()
+		close(a.done)
+		a.sendMu.Lock()
+		close(a.events)
+		a.sendMu.Unlock()
+	})
+}
+
+// IsElapsed returns whether the watchtower signaled that the timeout elapsed.
+func (t *timeout) IsElapsed(context.Context) bool {
+	select {
+	case <-t.elapsed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits until the watchtower signals that the timeout elapsed or the
+// context is cancelled.
+func (t *timeout) Wait(ctx context.Context) error {
+	select {
+	case <-t.elapsed:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "ctx done")
+	}
+}
+
+// String says that this is a timeout of a remote watchtower.
+func (t *timeout) String() string { return "<Remote watchtower timeout>" }
@@ -0,0 +1,22 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote implements a watchtower that watches channels on behalf of
+// remote clients, and a watcher.Watcher that delegates to such a watchtower.
+//
+// The client-side Watcher forwards all requests over a wire.Bus to the Server,
+// which watches the channels using another watcher.Watcher, typically a local
+// watcher. The Server only receives signed states and never holds any keys of
+// the channel participants. Adjudicator events are relayed back to the client.
+package remote // import "perun.network/go-perun/watcher/remote"
@@ -0,0 +1,269 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+func init() {
+	wire.RegisterDecoder(wire.WatchStart,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgWatchStart
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.WatchStop,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgWatchStop
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.WatchPublish,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgWatchPublish
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.WatchResponse,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgWatchResponse
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.WatchEvent,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgWatchEvent
+			return &m, m.Decode(r)
+		})
+	wire.RegisterDecoder(wire.WatchTimeoutElapsed,
+		func(r io.Reader) (wire.Msg, error) {
+			var m msgWatchTimeoutElapsed
+			return &m, m.Decode(r)
+		})
+}
+
+type (
+	// msgWatchStart requests the watchtower to start watching a channel.
+	msgWatchStart struct {
+		ReqID uint64
+		// Parent is the ID of the parent channel, or nil for ledger channels.
+		Parent *channel.ID
+		// Params and Tx form the initial signed state.
+		Params *channel.Params
+		Tx     channel.Transaction
+	}
+
+	// msgWatchStop requests the watchtower to stop watching a channel.
+	msgWatchStop struct {
+		ReqID     uint64
+		ChannelID channel.ID
+	}
+
+	// msgWatchPublish publishes a newer off-chain transaction of a channel to
+	// the watchtower.
+	msgWatchPublish struct {
+		ReqID uint64
+		Tx    channel.Transaction
+	}
+
+	// msgWatchResponse is the watchtower's response to a request. An empty
+	// error signals success.
+	msgWatchResponse struct {
+		ReqID uint64
+		Error string
+	}
+
+	// msgWatchEvent relays an adjudicator event to the client. Seq numbers the
+	// events of a channel. If the event's timeout has not elapsed yet, the
+	// watchtower sends a msgWatchTimeoutElapsed with the same Seq once it
+	// elapsed. The event's timeout is not encoded.
+	msgWatchEvent struct {
+		Seq     uint64
+		Elapsed bool
+		Event   channel.AdjudicatorEvent
+	}
+
+	// msgWatchTimeoutElapsed signals that the timeout of the event with the
+	// given sequence number has elapsed.
+	msgWatchTimeoutElapsed struct {
+		ChannelID channel.ID
+		Seq       uint64
+	}
+)
+
+// Adjudicator event kinds, as encoded in msgWatchEvent.
+const (
+	registeredEvent uint8 = iota
+	progressedEvent
+	concludedEvent
+)
+
+// Type returns this message's type: WatchStart.
+func (*msgWatchStart) Type() wire.Type { return wire.WatchStart }
+
+func (m msgWatchStart) Encode(w io.Writer) error {
+	return perunio.Encode(w, m.ReqID, optChannelID{&m.Parent}, m.Params, sigsPadded(m.Tx))
+}
+
+func (m *msgWatchStart) Decode(r io.Reader) error {
+	m.Params = new(channel.Params)
+	if err := perunio.Decode(r, &m.ReqID, optChannelID{&m.Parent}, m.Params, &m.Tx); err != nil {
+		return err
+	}
+	if m.Tx.State == nil {
+		return errors.New("empty initial state")
+	}
+	return nil
+}
+
+// Type returns this message's type: WatchStop.
+func (*msgWatchStop) Type() wire.Type { return wire.WatchStop }
+
+func (m msgWatchStop) Encode(w io.Writer) error {
+	return perunio.Encode(w, m.ReqID, m.ChannelID)
+}
+
+func (m *msgWatchStop) Decode(r io.Reader) error {
+	return perunio.Decode(r, &m.ReqID, &m.ChannelID)
+}
+
+// Type returns this message's type: WatchPublish.
+func (*msgWatchPublish) Type() wire.Type { return wire.WatchPublish }
+
+func (m msgWatchPublish) Encode(w io.Writer) error {
+	if m.Tx.State == nil {
+		return errors.New("publishing empty transaction")
+	}
+	return perunio.Encode(w, m.ReqID, sigsPadded(m.Tx))
+}
+
+func (m *msgWatchPublish) Decode(r io.Reader) error {
+	if err := perunio.Decode(r, &m.ReqID, &m.Tx); err != nil {
+		return err
+	}
+	if m.Tx.State == nil {
+		return errors.New("empty transaction published")
+	}
+	return nil
+}
+
+// Type returns this message's type: WatchResponse.
+func (*msgWatchResponse) Type() wire.Type { return wire.WatchResponse }
+
+func (m msgWatchResponse) Encode(w io.Writer) error {
+	return perunio.Encode(w, m.ReqID, m.Error)
+}
+
+func (m *msgWatchResponse) Decode(r io.Reader) error {
+	return perunio.Decode(r, &m.ReqID, &m.Error)
+}
+
+// Type returns this message's type: WatchEvent.
+func (*msgWatchEvent) Type() wire.Type { return wire.WatchEvent }
+
+func (m msgWatchEvent) Encode(w io.Writer) error {
+	if err := perunio.Encode(w, m.Seq, m.Elapsed, m.Event.ID(), m.Event.Version()); err != nil {
+		return err
+	}
+	switch e := m.Event.(type) {
+	case *channel.RegisteredEvent:
+		return perunio.Encode(w, registeredEvent, sigsPadded(channel.Transaction{State: e.State, Sigs: e.Sigs}))
+	case *channel.ProgressedEvent:
+		return perunio.Encode(w, progressedEvent, e.State, e.Idx)
+	case *channel.ConcludedEvent:
+		return perunio.Encode(w, concludedEvent)
+	default:
+		return errors.Errorf("unknown adjudicator event type %T", e)
+	}
+}
+
+func (m *msgWatchEvent) Decode(r io.Reader) error {
+	var (
+		base channel.AdjudicatorEventBase
+		kind uint8
+	)
+	if err := perunio.Decode(r, &m.Seq, &m.Elapsed, &base.IDV, &base.VersionV, &kind); err != nil {
+		return err
+	}
+	switch kind {
+	case registeredEvent:
+		var tx channel.Transaction
+		if err := perunio.Decode(r, &tx); err != nil {
+			return err
+		}
+		m.Event = &channel.RegisteredEvent{AdjudicatorEventBase: base, State: tx.State, Sigs: tx.Sigs}
+	case progressedEvent:
+		e := &channel.ProgressedEvent{AdjudicatorEventBase: base, State: new(channel.State)}
+		if err := perunio.Decode(r, e.State, &e.Idx); err != nil {
+			return err
+		}
+		m.Event = e
+	case concludedEvent:
+		m.Event = &channel.ConcludedEvent{AdjudicatorEventBase: base}
+	default:
+		return errors.Errorf("unknown adjudicator event kind %d", kind)
+	}
+	return nil
+}
+
+// Type returns this message's type: WatchTimeoutElapsed.
+func (*msgWatchTimeoutElapsed) Type() wire.Type { return wire.WatchTimeoutElapsed }
+
+func (m msgWatchTimeoutElapsed) Encode(w io.Writer) error {
+	return perunio.Encode(w, m.ChannelID, m.Seq)
+}
+
+func (m *msgWatchTimeoutElapsed) Decode(r io.Reader) error {
+	return perunio.Decode(r, &m.ChannelID, &m.Seq)
+}
+
+// sigsPadded returns the transaction with one signature slot per participant,
+// as required by the transaction encoding.
+func sigsPadded(tx channel.Transaction) channel.Transaction {
+	if tx.State == nil || len(tx.Sigs) == tx.NumParts() {
+		return tx
+	}
+	sigs := make([]wallet.Sig, tx.NumParts())
+	copy(sigs, tx.Sigs)
+	tx.Sigs = sigs
+	return tx
+}
+
+// optChannelID encodes an optional channel ID.
+type optChannelID struct{ ID **channel.ID }
+
+func (id optChannelID) Encode(w io.Writer) error {
+	if *id.ID != nil {
+		return perunio.Encode(w, true, **id.ID)
+	}
+	return perunio.Encode(w, false)
+}
+
+func (id optChannelID) Decode(r io.Reader) error {
+	var exists bool
+	if err := perunio.Decode(r, &exists); err != nil {
+		return err
+	}
+	if !exists {
+		*id.ID = nil
+		return nil
+	}
+	*id.ID = new(channel.ID)
+	return perunio.Decode(r, *id.ID)
+}
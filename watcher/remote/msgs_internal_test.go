@@ -0,0 +1,50 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"testing"
+
+	_ "perun.network/go-perun/backend/sim"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/test"
+	"perun.network/go-perun/wire"
+	wiretest "perun.network/go-perun/wire/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestMsgSerialization(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	tx := *test.NewRandomTransaction(rng, []bool{true, false})
+	id := tx.ID
+	parent := test.NewRandomChannelID(rng)
+
+	msgs := []wire.Msg{
+		&msgWatchStart{ReqID: 1, Params: test.NewRandomParams(rng), Tx: tx},
+		&msgWatchStart{ReqID: 2, Parent: &parent, Params: test.NewRandomParams(rng), Tx: tx},
+		&msgWatchStop{ReqID: 3, ChannelID: id},
+		&msgWatchPublish{ReqID: 4, Tx: tx},
+		&msgWatchResponse{ReqID: 5},
+		&msgWatchResponse{ReqID: 6, Error: "error"},
+		&msgWatchEvent{Seq: 1, Elapsed: true, Event: channel.NewRegisteredEvent(id, nil, tx.Version, tx.State, tx.Sigs)},
+		&msgWatchEvent{Seq: 2, Event: channel.NewRegisteredEvent(id, nil, tx.Version, nil, nil)},
+		&msgWatchEvent{Seq: 3, Event: channel.NewProgressedEvent(id, nil, tx.State, 1)},
+		&msgWatchEvent{Seq: 4, Event: channel.NewConcludedEvent(id, nil, tx.Version)},
+		&msgWatchTimeoutElapsed{ChannelID: id, Seq: 5},
+	}
+	for _, m := range msgs {
+		wiretest.MsgSerializerTest(t, m)
+	}
+}
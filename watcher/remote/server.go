@@ -0,0 +1,390 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	stdsync "sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/watcher"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/sync"
+)
+
+// sendTimeout is the timeout for sending a single message to a client.
+const sendTimeout = 10 * time.Second
+
+type (
+	// Server is a watchtower that watches channels on behalf of remote
+	// clients. It receives the requests of remote Watchers on its wire address
+	// and executes them on the underlying watcher. Adjudicator events are
+	// relayed back to the clients that registered the channel. If a client is
+	// not reachable, the events are dropped, but the underlying watcher still
+	// refutes registrations of outdated states.
+	//
+	// Several participants of a channel may watch it with the same Server. The
+	// channel is then only registered once with the underlying watcher, which
+	// receives the newest state that any of the clients submitted. Only states
+	// that are signed by all participants are accepted.
+	Server struct {
+		sync.Closer
+
+		watcher watcher.Watcher
+		bus     wire.Bus
+		addr    wire.Address
+		recv    *wire.Receiver
+		ctx     context.Context
+
+		mu      stdsync.Mutex
+		chs     map[clientCh]*serverCh    // channels by client and channel ID
+		watched map[channel.ID]*watchedCh // channels of the underlying watcher
+	}
+
+	// clientCh identifies a channel that is watched on behalf of a client.
+	clientCh struct {
+		client wallet.AddrKey
+		id     channel.ID
+	}
+
+	// serverCh is a channel watched on behalf of a client.
+	serverCh struct {
+		client  wire.Address
+		parent  *channel.ID
+		watched *watchedCh
+	}
+
+	// watchedCh is a channel that is registered with the underlying watcher.
+	// Its clients and version are protected by the Server's mutex.
+	watchedCh struct {
+		params    *channel.Params
+		parent    *channel.ID
+		pub       watcher.StatesPub
+		clients   map[wallet.AddrKey]wire.Address
+		version   uint64             // version of the newest published state
+		cancel    context.CancelFunc // cancels waiting for event timeouts
+		forwarded chan struct{}      // closed when all events were forwarded
+	}
+)
+
+// NewServer creates a new watchtower that watches channels using the given
+// watcher and receives requests over the bus on the given address. Serve must
+// be called to start handling requests.
+func NewServer(w watcher.Watcher, bus wire.Bus, addr wire.Address) (*Server, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		watcher: w,
+		bus:     bus,
+		addr:    addr,
+		recv:    wire.NewReceiver(),
+		ctx:     ctx,
+		chs:     make(map[clientCh]*serverCh),
+		watched: make(map[channel.ID]*watchedCh),
+	}
+	if err := bus.SubscribeClient(s.recv, addr); err != nil {
+		cancel()
+		return nil, errors.WithMessage(err, "subscribing to bus")
+	}
+	s.OnCloseAlways(func() {
+		cancel()
+		if err := s.recv.Close(); err != nil {
+			log.Warnf("Closing watchtower receiver: %v", err)
+		}
+	})
+	return s, nil
+}
+
+// Serve handles the requests of remote watchers until the Server is closed.
+// Requests are handled one after the other.
+func (s *Server) Serve() error {
+	for {
+		env, err := s.recv.Next(s.ctx)
+		if err != nil {
+			if s.IsClosed() {
+				return nil
+			}
+			return errors.WithMessage(err, "receiving request")
+		}
+		s.handle(env)
+	}
+}
+
+func (s *Server) handle(env *wire.Envelope) {
+	var (
+		reqID uint64
+		err   error
+	)
+	switch m := env.Msg.(type) {
+	case *msgWatchStart:
+		reqID, err = m.ReqID, s.startWatching(env.Sender, m)
+	case *msgWatchStop:
+		reqID, err = m.ReqID, s.stopWatching(env.Sender, m.ChannelID)
+	case *msgWatchPublish:
+		reqID, err = m.ReqID, s.publish(env.Sender, m.Tx)
+	default:
+		log.WithField("peer", env.Sender).Warnf("Watchtower received unexpected message %v", env.Msg.Type())
+		return
+	}
+
+	res := &msgWatchResponse{ReqID: reqID}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	s.send(env.Sender, res)
+}
+
+func (s *Server) startWatching(client wire.Address, m *msgWatchStart) error {
+	id := m.Tx.ID
+	if m.Params.ID() != id {
+		return errors.New("params do not match state")
+	}
+	if err := verifySigs(m.Params, m.Tx); err != nil {
+		return err
+	}
+	if _, err := s.channel(client, id); err == nil {
+		return errors.New("channel already watched")
+	}
+	if m.Parent != nil {
+		if _, err := s.channel(client, *m.Parent); err != nil {
+			return errors.WithMessage(err, "parent channel")
+		}
+	}
+
+	s.mu.Lock()
+	wch, ok := s.watched[id]
+	s.mu.Unlock()
+	if ok {
+		// Another participant of the channel already watches it.
+		if !equalParent(wch.parent, m.Parent) {
+			return errors.New("channel already watched with a different parent")
+		}
+		if err := s.publishNewer(wch, m.Tx); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if wch, err = s.watch(m); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	wch.clients[wallet.Key(client)] = client
+	s.chs[clientCh{wallet.Key(client), id}] = &serverCh{client: client, parent: m.Parent, watched: wch}
+	s.mu.Unlock()
+	return nil
+}
+
+// watch registers a channel with the underlying watcher and starts relaying
+// its events to its clients.
+func (s *Server) watch(m *msgWatchStart) (*watchedCh, error) {
+	ss := channel.SignedState{Params: m.Params, State: m.Tx.State, Sigs: m.Tx.Sigs}
+	var (
+		pub watcher.StatesPub
+		sub watcher.AdjudicatorSub
+		err error
+	)
+	if m.Parent == nil {
+		pub, sub, err = s.watcher.StartWatchingLedgerChannel(s.ctx, ss)
+	} else {
+		pub, sub, err = s.watcher.StartWatchingSubChannel(s.ctx, *m.Parent, ss)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	wch := &watchedCh{
+		params:    m.Params,
+		parent:    m.Parent,
+		pub:       pub,
+		clients:   make(map[wallet.AddrKey]wire.Address),
+		version:   m.Tx.Version,
+		cancel:    cancel,
+		forwarded: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.watched[m.Tx.ID] = wch
+	s.mu.Unlock()
+	go s.forwardEvents(ctx, m.Tx.ID, wch, sub)
+	return wch, nil
+}
+
+func (s *Server) stopWatching(client wire.Address, id channel.ID) error {
+	ch, err := s.channel(client, id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	subChs, last := 0, len(ch.watched.clients) == 1
+	for key, sch := range s.chs {
+		if key.client == wallet.Key(client) && sch.parent != nil && *sch.parent == id {
+			subChs++
+		}
+	}
+	s.mu.Unlock()
+	if subChs > 0 {
+		return errors.Errorf("cannot stop watching: %d sub-channels present", subChs)
+	}
+
+	if last {
+		if err := s.watcher.StopWatching(s.ctx, id); err != nil {
+			return err
+		}
+		// All events are relayed before the client receives the response.
+		<-ch.watched.forwarded
+		ch.watched.cancel()
+	}
+
+	s.mu.Lock()
+	delete(ch.watched.clients, wallet.Key(client))
+	delete(s.chs, clientCh{wallet.Key(client), id})
+	if last {
+		delete(s.watched, id)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Server) publish(client wire.Address, tx channel.Transaction) error {
+	ch, err := s.channel(client, tx.ID)
+	if err != nil {
+		return err
+	}
+	if err := verifySigs(ch.watched.params, tx); err != nil {
+		return err
+	}
+	return s.publishNewer(ch.watched, tx)
+}
+
+// publishNewer publishes the transaction to the underlying watcher if it is
+// newer than all states that were published before. Older states are ignored,
+// because another client of the channel already submitted a newer one.
+func (s *Server) publishNewer(wch *watchedCh, tx channel.Transaction) error {
+	s.mu.Lock()
+	newer := tx.Version > wch.version
+	s.mu.Unlock()
+	if !newer {
+		return nil
+	}
+	if err := wch.pub.Publish(s.ctx, tx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	wch.version = tx.Version
+	s.mu.Unlock()
+	return nil
+}
+
+// channel returns the channel with the given ID if it is watched on behalf of
+// the given client.
+func (s *Server) channel(client wire.Address, id channel.ID) (*serverCh, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.chs[clientCh{wallet.Key(client), id}]
+	if !ok {
+		return nil, errors.New("channel not watched")
+	}
+	return ch, nil
+}
+
+// clients returns the clients that currently watch the channel.
+func (s *Server) clients(wch *watchedCh) []wire.Address {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients := make([]wire.Address, 0, len(wch.clients))
+	for _, c := range wch.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// forwardEvents relays the adjudicator events of a channel to its clients,
+// until the subscription is closed.
+func (s *Server) forwardEvents(ctx context.Context, id channel.ID, wch *watchedCh, sub watcher.AdjudicatorSub) {
+	defer close(wch.forwarded)
+	log := log.WithField("ID", id)
+
+	var seq uint64
+	for e := range sub.EventStream() {
+		seq++
+		timeout := e.Timeout()
+		_, elapsed := timeout.(*channel.ElapsedTimeout)
+		elapsed = elapsed || timeout == nil
+		for _, client := range s.clients(wch) {
+			s.send(client, &msgWatchEvent{Seq: seq, Elapsed: elapsed, Event: e})
+			if !elapsed {
+				go s.forwardTimeout(ctx, client, id, seq, timeout)
+			}
+		}
+	}
+	if err := sub.Err(); err != nil {
+		log.Errorf("Adjudicator subscription closed with error: %v", err)
+	}
+}
+
+// forwardTimeout notifies the client once the timeout of an event elapsed.
+func (s *Server) forwardTimeout(ctx context.Context, client wire.Address, id channel.ID, seq uint64, timeout channel.Timeout) {
+	if err := timeout.Wait(ctx); err != nil {
+		return
+	}
+	s.send(client, &msgWatchTimeoutElapsed{ChannelID: id, Seq: seq})
+}
+
+// verifySigs checks that the transaction contains valid signatures of all
+// participants of the channel with the given parameters.
+func verifySigs(params *channel.Params, tx channel.Transaction) error {
+	if tx.ID != params.ID() {
+		return errors.New("state does not belong to the channel")
+	}
+	if len(tx.Sigs) != len(params.Parts) {
+		return errors.Errorf("expected %d signatures, got %d", len(params.Parts), len(tx.Sigs))
+	}
+	for i, sig := range tx.Sigs {
+		if sig == nil {
+			return errors.Errorf("missing signature of participant %d", i)
+		}
+		if ok, err := channel.Verify(params.Parts[i], tx.State, sig); err != nil {
+			return errors.WithMessagef(err, "verifying signature of participant %d", i)
+		} else if !ok {
+			return errors.Errorf("invalid signature of participant %d", i)
+		}
+	}
+	return nil
+}
+
+// equalParent returns whether both parent channel IDs are nil or equal.
+func equalParent(a, b *channel.ID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// send sends a message to a client. Errors are only logged, because the
+// client might be offline.
+func (s *Server) send(client wire.Address, msg wire.Msg) {
+	ctx, cancel := context.WithTimeout(s.ctx, sendTimeout)
+	defer cancel()
+	if err := s.bus.Publish(ctx, &wire.Envelope{Sender: s.addr, Recipient: client, Msg: msg}); err != nil {
+		log.WithField("peer", client).Warnf("Watchtower could not send %v: %v", msg.Type(), err)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	stdsync "sync"
+
+	"github.com/pkg/errors"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/watcher"
+	"perun.network/go-perun/wire"
+	"polycry.pt/poly-go/sync"
+)
+
+var _ watcher.Watcher = (*Watcher)(nil)
+
+type (
+	// Watcher implements a watcher.Watcher that delegates watching to a
+	// remote watchtower Server.
+	Watcher struct {
+		sync.Closer
+
+		bus    wire.Bus
+		addr   wire.Address
+		server wire.Address
+		recv   *wire.Receiver
+
+		mu      stdsync.Mutex
+		lastReq uint64
+		pending map[uint64]chan *msgWatchResponse
+		subs    map[channel.ID]*adjudicatorSub
+	}
+
+	// statesPub publishes states of a channel to the watchtower.
+	statesPub struct {
+		w  *Watcher
+		id channel.ID
+	}
+)
+
+// NewWatcher creates a Watcher that delegates watching to the watchtower
+// with the given server address. It receives the watchtower's messages over
+// the bus on the given address, which must not be used by any other
+// subscriber of the bus, e.g., the client.
+func NewWatcher(bus wire.Bus, addr, server wire.Address) (*Watcher, error) {
+	w := &Watcher{
+		bus:     bus,
+		addr:    addr,
+		server:  server,
+		recv:    wire.NewReceiver(),
+		pending: make(map[uint64]chan *msgWatchResponse),
+		subs:    make(map[channel.ID]*adjudicatorSub),
+	}
+	if err := bus.SubscribeClient(w.recv, addr); err != nil {
+		return nil, errors.WithMessage(err, "subscribing to bus")
+	}
+	w.OnCloseAlways(func() {
+		if err := w.recv.Close(); err != nil {
+			log.Warnf("Closing remote watcher receiver: %v", err)
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for id, sub := range w.subs {
+			sub.close(errors.New("watcher closed"))
+			delete(w.subs, id)
+		}
+	})
+	go w.handleMsgs()
+	return w, nil
+}
+
+// StartWatchingLedgerChannel starts watching for a ledger channel.
+func (w *Watcher) StartWatchingLedgerChannel(
+	ctx context.Context,
+	signedState channel.SignedState,
+) (watcher.StatesPub, watcher.AdjudicatorSub, error) {
+	return w.startWatching(ctx, nil, signedState)
+}
+
+// StartWatchingSubChannel starts watching for a sub-channel or virtual
+// channel. The parent channel must be watched by the same watchtower.
+func (w *Watcher) StartWatchingSubChannel(
+	ctx context.Context,
+	parent channel.ID,
+	signedState channel.SignedState,
+) (watcher.StatesPub, watcher.AdjudicatorSub, error) {
+	return w.startWatching(ctx, &parent, signedState)
+}
+
+func (w *Watcher) startWatching(
+	ctx context.Context,
+	parent *channel.ID,
+	signedState channel.SignedState,
+) (watcher.StatesPub, watcher.AdjudicatorSub, error) {
+	id := signedState.State.ID
+	sub := newAdjudicatorSub()
+	w.mu.Lock()
+	if _, ok := w.subs[id]; ok {
+		w.mu.Unlock()
+		return nil, nil, errors.New("channel already watched")
+	}
+	// The subscription is added before the request is sent, because the
+	// watchtower might relay events right after responding.
+	w.subs[id] = sub
+	w.mu.Unlock()
+
+	tx := channel.Transaction{State: signedState.State, Sigs: signedState.Sigs}
+	if err := w.request(ctx, func(reqID uint64) wire.Msg {
+		return &msgWatchStart{ReqID: reqID, Parent: parent, Params: signedState.Params, Tx: tx}
+	}); err != nil {
+		w.mu.Lock()
+		delete(w.subs, id)
+		w.mu.Unlock()
+		return nil, nil, errors.WithMessage(err, "starting to watch")
+	}
+	return &statesPub{w: w, id: id}, sub, nil
+}
+
+// StopWatching requests the watchtower to stop watching the channel and
+// closes the channel's AdjudicatorSub.
+func (w *Watcher) StopWatching(ctx context.Context, id channel.ID) error {
+	if err := w.request(ctx, func(reqID uint64) wire.Msg {
+		return &msgWatchStop{ReqID: reqID, ChannelID: id}
+	}); err != nil {
+		return errors.WithMessage(err, "stopping to watch")
+	}
+
+	w.mu.Lock()
+	sub, ok := w.subs[id]
+	delete(w.subs, id)
+	w.mu.Unlock()
+	if ok {
+		sub.close(nil)
+	}
+	return nil
+}
+
+// Publish publishes the given transaction to the watchtower. It returns once
+// the watchtower received the transaction.
+func (p *statesPub) Publish(ctx context.Context, tx channel.Transaction) error {
+	if tx.ID != p.id {
+		return errors.New("transaction of other channel")
+	}
+	return errors.WithMessage(p.w.request(ctx, func(reqID uint64) wire.Msg {
+		return &msgWatchPublish{ReqID: reqID, Tx: tx}
+	}), "publishing state")
+}
+
+// request sends the request created by newReq to the watchtower and waits
+// for the response.
+func (w *Watcher) request(ctx context.Context, newReq func(reqID uint64) wire.Msg) error {
+	resRecv := make(chan *msgWatchResponse, 1)
+	w.mu.Lock()
+	w.lastReq++
+	reqID := w.lastReq
+	w.pending[reqID] = resRecv
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.pending, reqID)
+		w.mu.Unlock()
+	}()
+
+	if err := w.bus.Publish(ctx, &wire.Envelope{
+		Sender:    w.addr,
+		Recipient: w.server,
+		Msg:       newReq(reqID),
+	}); err != nil {
+		return errors.WithMessage(err, "sending request")
+	}
+
+	select {
+	case res := <-resRecv:
+		if res.Error != "" {
+			return errors.New("watchtower: " + res.Error)
+		}
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "waiting for response")
+	case <-w.Closed():
+		return errors.New("watcher closed")
+	}
+}
+
+// handleMsgs dispatches the messages received from the watchtower until the
+// Watcher is closed.
+func (w *Watcher) handleMsgs() {
+	for {
+		env, err := w.recv.Next(context.Background())
+		if err != nil {
+			return
+		}
+		if !env.Sender.Equal(w.server) {
+			log.WithField("peer", env.Sender).Warn("Remote watcher received message from unknown sender")
+			continue
+		}
+
+		switch m := env.Msg.(type) {
+		case *msgWatchResponse:
+			w.mu.Lock()
+			resRecv, ok := w.pending[m.ReqID]
+			w.mu.Unlock()
+			if !ok {
+				log.Debugf("Remote watcher received response to unknown request %d", m.ReqID)
+				continue
+			}
+			// Duplicated or late responses are dropped, so that they cannot
+			// block the handling of further messages.
+			select {
+			case resRecv <- m:
+			default:
+				log.Warnf("Remote watcher dropped duplicate response to request %d", m.ReqID)
+			}
+		case *msgWatchEvent:
+			if sub, ok := w.sub(m.Event.ID()); ok {
+				sub.publish(m)
+			}
+		case *msgWatchTimeoutElapsed:
+			if sub, ok := w.sub(m.ChannelID); ok {
+				sub.timeoutElapsed(m.Seq)
+			}
+		default:
+			log.Warnf("Remote watcher received unexpected message %v", env.Msg.Type())
+		}
+	}
+}
+
+func (w *Watcher) sub(id channel.ID) (*adjudicatorSub, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sub, ok := w.subs[id]
+	return sub, ok
+}
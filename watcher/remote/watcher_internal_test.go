@@ -0,0 +1,64 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	wiretest "perun.network/go-perun/wire/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestWatcher_DuplicateResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rng := pkgtest.Prng(t)
+
+	bus := wire.NewLocalBus()
+	serverAddr, clientAddr := wiretest.NewRandomAddress(rng), wiretest.NewRandomAddress(rng)
+	server := wire.NewReceiver()
+	defer server.Close()
+	require.NoError(t, bus.SubscribeClient(server, serverAddr))
+	w, err := NewWatcher(bus, clientAddr, serverAddr)
+	require.NoError(t, err)
+	defer w.Close()
+
+	// The server answers every request several times.
+	go func() {
+		for {
+			env, err := server.Next(ctx)
+			if err != nil {
+				return
+			}
+			res := &msgWatchResponse{ReqID: env.Msg.(*msgWatchStop).ReqID}
+			for i := 0; i < 3; i++ {
+				if err := bus.Publish(ctx, &wire.Envelope{Sender: serverAddr, Recipient: clientAddr, Msg: res}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// The duplicated responses must not block the handling of later ones.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.StopWatching(ctx, channel.ID{}))
+	}
+}
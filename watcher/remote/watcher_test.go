@@ -0,0 +1,305 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "perun.network/go-perun/backend/sim"
+	"perun.network/go-perun/channel"
+	channeltest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/wallet"
+	wallettest "perun.network/go-perun/wallet/test"
+	"perun.network/go-perun/watcher"
+	"perun.network/go-perun/watcher/local"
+	"perun.network/go-perun/watcher/remote"
+	wiretest "perun.network/go-perun/wire/test"
+	"polycry.pt/poly-go/test"
+)
+
+const testTimeout = 5 * time.Second
+
+func TestWatcher(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	// Set up a watchtower that watches using a local watcher.
+	rs := newRegisterSubscriber()
+	lw, err := local.NewWatcher(rs)
+	require.NoError(t, err)
+	bus := wiretest.NewSerializingLocalBus()
+	serverAddr, clientAddr := wiretest.NewRandomAddress(rng), wiretest.NewRandomAddress(rng)
+	server, err := remote.NewServer(lw, bus, serverAddr)
+	require.NoError(t, err)
+	defer server.Close()
+	go func() { assert.NoError(t, server.Serve()) }()
+
+	w, err := remote.NewWatcher(bus, clientAddr, serverAddr)
+	require.NoError(t, err)
+	defer w.Close()
+
+	params, txs, _ := newRandomChannel(t, rng, 3)
+	statesPub, eventsSub, err := w.StartWatchingLedgerChannel(ctx, signedState(params, txs[0]))
+	require.NoError(t, err)
+	_, _, err = w.StartWatchingLedgerChannel(ctx, signedState(params, txs[0]))
+	assert.Error(t, err, "watching twice")
+	require.NoError(t, statesPub.Publish(ctx, txs[1]))
+	require.NoError(t, statesPub.Publish(ctx, txs[2]))
+
+	// Register an outdated state. The event is relayed and the watchtower
+	// refutes with the latest state.
+	timeout := &channel.TimeTimeout{Time: time.Now().Add(100 * time.Millisecond)}
+	rs.sub.events <- channel.NewRegisteredEvent(txs[1].ID, timeout, txs[1].Version, txs[1].State, nil)
+
+	select {
+	case e := <-eventsSub.EventStream():
+		require.IsType(t, &channel.RegisteredEvent{}, e)
+		assert.Equal(t, txs[1].Version, e.Version())
+		assert.NoError(t, e.(*channel.RegisteredEvent).State.Equal(txs[1].State))
+		assert.False(t, e.Timeout().IsElapsed(ctx))
+		assert.NoError(t, e.Timeout().Wait(ctx))
+		assert.True(t, e.Timeout().IsElapsed(ctx))
+	case <-ctx.Done():
+		t.Fatal("event not relayed")
+	}
+	select {
+	case req := <-rs.registered:
+		assert.NoError(t, req.Tx.State.Equal(txs[2].State))
+	case <-ctx.Done():
+		t.Fatal("outdated state not refuted")
+	}
+
+	require.NoError(t, w.StopWatching(ctx, txs[0].ID))
+	_, ok := <-eventsSub.EventStream()
+	assert.False(t, ok, "event stream not closed")
+	assert.NoError(t, eventsSub.Err())
+	assert.Error(t, w.StopWatching(ctx, txs[0].ID), "stopping twice")
+}
+
+func TestServer_ForeignChannel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	lw, err := local.NewWatcher(newRegisterSubscriber())
+	require.NoError(t, err)
+	bus := wiretest.NewSerializingLocalBus()
+	serverAddr := wiretest.NewRandomAddress(rng)
+	server, err := remote.NewServer(lw, bus, serverAddr)
+	require.NoError(t, err)
+	defer server.Close()
+	go func() { assert.NoError(t, server.Serve()) }()
+
+	alice, err := remote.NewWatcher(bus, wiretest.NewRandomAddress(rng), serverAddr)
+	require.NoError(t, err)
+	defer alice.Close()
+	mallory, err := remote.NewWatcher(bus, wiretest.NewRandomAddress(rng), serverAddr)
+	require.NoError(t, err)
+	defer mallory.Close()
+
+	params, txs, _ := newRandomChannel(t, rng, 1)
+	_, _, err = alice.StartWatchingLedgerChannel(ctx, signedState(params, txs[0]))
+	require.NoError(t, err)
+
+	// Mallory must neither stop watching Alice's channel nor open sub-channels
+	// in it.
+	assert.Error(t, mallory.StopWatching(ctx, params.ID()))
+	subParams, subTxs, _ := newRandomChannel(t, rng, 1)
+	_, _, err = mallory.StartWatchingSubChannel(ctx, params.ID(), signedState(subParams, subTxs[0]))
+	assert.Error(t, err)
+
+	require.NoError(t, alice.StopWatching(ctx, params.ID()))
+}
+
+func TestServer_SharedChannel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	rs := newRegisterSubscriber()
+	lw, err := local.NewWatcher(rs)
+	require.NoError(t, err)
+	bus := wiretest.NewSerializingLocalBus()
+	serverAddr := wiretest.NewRandomAddress(rng)
+	server, err := remote.NewServer(lw, bus, serverAddr)
+	require.NoError(t, err)
+	defer server.Close()
+	go func() { assert.NoError(t, server.Serve()) }()
+
+	alice, err := remote.NewWatcher(bus, wiretest.NewRandomAddress(rng), serverAddr)
+	require.NoError(t, err)
+	defer alice.Close()
+	bob, err := remote.NewWatcher(bus, wiretest.NewRandomAddress(rng), serverAddr)
+	require.NoError(t, err)
+	defer bob.Close()
+
+	// Both participants watch the same channel. Alice's outdated state does
+	// not replace the newer state published by Bob.
+	params, txs, _ := newRandomChannel(t, rng, 3)
+	_, aliceSub, err := alice.StartWatchingLedgerChannel(ctx, signedState(params, txs[0]))
+	require.NoError(t, err)
+	bobPub, bobSub, err := bob.StartWatchingLedgerChannel(ctx, signedState(params, txs[0]))
+	require.NoError(t, err)
+	require.NoError(t, bobPub.Publish(ctx, txs[2]))
+
+	// The event is relayed to both and the newest state is registered.
+	rs.sub.events <- channel.NewRegisteredEvent(txs[1].ID, &channel.ElapsedTimeout{}, txs[1].Version, txs[1].State, nil)
+	for _, sub := range []watcher.AdjudicatorSub{aliceSub, bobSub} {
+		select {
+		case e := <-sub.EventStream():
+			assert.Equal(t, txs[1].Version, e.Version())
+		case <-ctx.Done():
+			t.Fatal("event not relayed")
+		}
+	}
+	select {
+	case req := <-rs.registered:
+		assert.Equal(t, txs[2].Version, req.Tx.Version)
+	case <-ctx.Done():
+		t.Fatal("outdated state not refuted")
+	}
+
+	// Bob keeps watching after Alice stopped.
+	require.NoError(t, alice.StopWatching(ctx, params.ID()))
+	_, ok := <-aliceSub.EventStream()
+	assert.False(t, ok, "event stream not closed")
+	rs.sub.events <- channel.NewConcludedEvent(params.ID(), &channel.ElapsedTimeout{}, txs[2].Version)
+	select {
+	case e := <-bobSub.EventStream():
+		assert.IsType(t, &channel.ConcludedEvent{}, e)
+	case <-ctx.Done():
+		t.Fatal("event not relayed")
+	}
+	require.NoError(t, bob.StopWatching(ctx, params.ID()))
+}
+
+func TestServer_InvalidSigs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	rng := test.Prng(t)
+
+	lw, err := local.NewWatcher(newRegisterSubscriber())
+	require.NoError(t, err)
+	bus := wiretest.NewSerializingLocalBus()
+	serverAddr := wiretest.NewRandomAddress(rng)
+	server, err := remote.NewServer(lw, bus, serverAddr)
+	require.NoError(t, err)
+	defer server.Close()
+	go func() { assert.NoError(t, server.Serve()) }()
+
+	w, err := remote.NewWatcher(bus, wiretest.NewRandomAddress(rng), serverAddr)
+	require.NoError(t, err)
+	defer w.Close()
+
+	params, txs, accs := newRandomChannel(t, rng, 2)
+	unsigned := signedState(params, txs[0])
+	unsigned.Sigs = []wallet.Sig{unsigned.Sigs[0], nil}
+	_, _, err = w.StartWatchingLedgerChannel(ctx, unsigned)
+	assert.Error(t, err, "missing signature")
+
+	pub, _, err := w.StartWatchingLedgerChannel(ctx, signedState(params, txs[0]))
+	require.NoError(t, err)
+	forged := txs[1].Clone()
+	forged.Sigs[1], err = channel.Sign(accs[0], forged.State)
+	require.NoError(t, err)
+	assert.Error(t, pub.Publish(ctx, forged), "invalid signature")
+	require.NoError(t, pub.Publish(ctx, txs[1]))
+	require.NoError(t, w.StopWatching(ctx, params.ID()))
+}
+
+// newRandomChannel creates random parameters of a two-party ledger channel and
+// n transactions with increasing versions, starting at 0, that are signed by
+// both participants, whose accounts are also returned.
+func newRandomChannel(t *testing.T, rng *rand.Rand, n int) (*channel.Params, []channel.Transaction, []wallet.Account) {
+	t.Helper()
+	accs := []wallet.Account{wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng)}
+	params, state := channeltest.NewRandomParamsAndState(rng, channeltest.WithVersion(0),
+		channeltest.WithParts(accs[0].Address(), accs[1].Address()), channeltest.WithNumAssets(1),
+		channeltest.WithIsFinal(false), channeltest.WithNumLocked(0))
+	txs := make([]channel.Transaction, n)
+	for i := range txs {
+		txs[i] = channel.Transaction{State: state.Clone(), Sigs: make([]wallet.Sig, len(accs))}
+		txs[i].Version = uint64(i)
+		for j, acc := range accs {
+			sig, err := channel.Sign(acc, txs[i].State)
+			require.NoError(t, err)
+			txs[i].Sigs[j] = sig
+		}
+	}
+	return params, txs, accs
+}
+
+// signedState returns the signed state of the transaction.
+func signedState(params *channel.Params, tx channel.Transaction) channel.SignedState {
+	return channel.SignedState{Params: params, State: tx.State, Sigs: tx.Sigs}
+}
+
+type (
+	// registerSubscriber is a channel.RegisterSubscriber that records
+	// registrations and returns the same subscription for every channel.
+	registerSubscriber struct {
+		sub        *adjudicatorSub
+		registered chan channel.AdjudicatorReq
+	}
+
+	// adjudicatorSub is an adjudicator subscription whose events are sent on
+	// a go channel.
+	adjudicatorSub struct {
+		events chan channel.AdjudicatorEvent
+		closed chan struct{}
+	}
+)
+
+func newRegisterSubscriber() *registerSubscriber {
+	return &registerSubscriber{
+		sub: &adjudicatorSub{
+			events: make(chan channel.AdjudicatorEvent),
+			closed: make(chan struct{}),
+		},
+		registered: make(chan channel.AdjudicatorReq, 1),
+	}
+}
+
+func (rs *registerSubscriber) Register(_ context.Context, req channel.AdjudicatorReq, _ []channel.SignedState) error {
+	rs.registered <- req
+	return nil
+}
+
+func (rs *registerSubscriber) Subscribe(context.Context, channel.ID) (channel.AdjudicatorSubscription, error) {
+	return rs.sub, nil
+}
+
+func (s *adjudicatorSub) Next() channel.AdjudicatorEvent {
+	select {
+	case e := <-s.events:
+		return e
+	case <-s.closed:
+		return nil
+	}
+}
+
+func (s *adjudicatorSub) Err() error { return nil }
+
+func (s *adjudicatorSub) Close() error {
+	close(s.closed)
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"io"
 
 	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire/perunio"
 )
 
 func init() {
@@ -29,16 +30,28 @@ func init() {
 }
 
 // Account is a node's permanent Perun identity, which is used to establish
-// authenticity within the Perun peer-to-peer network. For now, it is just a
-// stub.
+// authenticity within the Perun peer-to-peer network.
 type Account = wallet.Account
 
+// AuthNonceLen is the length of the nonces exchanged in the peer
+// authentication protocol.
+const AuthNonceLen = 32
+
+// AuthNonce is a fresh random challenge used in the peer authentication
+// protocol.
+type AuthNonce = [AuthNonceLen]byte
+
 var _ Msg = (*AuthResponseMsg)(nil)
 
-// AuthResponseMsg is the response message in the peer authentication protocol.
+// AuthResponseMsg is the message in the peer authentication protocol.
 //
-// This will be expanded later to contain signatures.
-type AuthResponseMsg struct{}
+// Each party sends a fresh Nonce and proves its identity by signing the
+// handshake transcript, which contains both nonces. Sig is nil in the first
+// message of the handshake, which only carries the challenge of the dialer.
+type AuthResponseMsg struct {
+	Nonce AuthNonce
+	Sig   wallet.Sig
+}
 
 // Type returns AuthResponse.
 func (m *AuthResponseMsg) Type() Type {
@@ -47,15 +60,30 @@ func (m *AuthResponseMsg) Type() Type {
 
 // Encode encodes this AuthResponseMsg into an io.Writer.
 func (m *AuthResponseMsg) Encode(w io.Writer) error {
-	return nil
+	if err := perunio.Encode(w, m.Nonce, m.Sig != nil); err != nil {
+		return err
+	}
+	if m.Sig == nil {
+		return nil
+	}
+	return perunio.Encode(w, m.Sig)
 }
 
 // Decode decodes an AuthResponseMsg from an io.Reader.
 func (m *AuthResponseMsg) Decode(r io.Reader) (err error) {
-	return nil
+	var hasSig bool
+	if err := perunio.Decode(r, &m.Nonce, &hasSig); err != nil {
+		return err
+	}
+	if !hasSig {
+		m.Sig = nil
+		return nil
+	}
+	return perunio.Decode(r, wallet.SigDec{Sig: &m.Sig})
 }
 
-// NewAuthResponseMsg creates an authentication response message.
-func NewAuthResponseMsg(_ Account) Msg {
-	return &AuthResponseMsg{}
+// NewAuthResponseMsg creates an authentication message with the given nonce
+// and transcript signature. The signature may be nil.
+func NewAuthResponseMsg(nonce AuthNonce, sig wallet.Sig) *AuthResponseMsg {
+	return &AuthResponseMsg{Nonce: nonce, Sig: sig}
 }
@@ -17,6 +17,8 @@ package wire_test
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	_ "perun.network/go-perun/backend/ethereum/wallet/test" // random init
 	wallettest "perun.network/go-perun/wallet/test"
 	"perun.network/go-perun/wire"
@@ -26,5 +28,14 @@ import (
 
 func TestAuthResponseMsg(t *testing.T) {
 	rng := pkgtest.Prng(t)
-	wiretest.MsgSerializerTest(t, wire.NewAuthResponseMsg(wallettest.NewRandomAccount(rng)))
+	var nonce wire.AuthNonce
+	rng.Read(nonce[:])
+	t.Run("without signature", func(t *testing.T) {
+		wiretest.MsgSerializerTest(t, wire.NewAuthResponseMsg(nonce, nil))
+	})
+	t.Run("with signature", func(t *testing.T) {
+		sig, err := wallettest.NewRandomAccount(rng).SignData(nonce[:])
+		require.NoError(t, err)
+		wiretest.MsgSerializerTest(t, wire.NewAuthResponseMsg(nonce, sig))
+	})
 }
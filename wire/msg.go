@@ -136,6 +136,22 @@ const (
 	ChannelUpdateAcc
 	ChannelUpdateRej
 	ChannelSync
+	ChannelProposalAccs
+	ChannelAction
+	WatchStart
+	WatchStop
+	WatchPublish
+	WatchResponse
+	WatchEvent
+	WatchTimeoutElapsed
+	ChannelAnnouncement
+	ChannelDeposit
+	ChannelWithdrawal
+	ChannelWithdrawalAcc
+	ChannelAssetChange
+	ChannelProposalCounter
+	ChannelUpdateCounter
+	ChannelPipelinedUpdate
 	LastType // upper bound on the message types of the Perun wire protocol
 )
 
@@ -157,6 +173,22 @@ var typeNames = map[Type]string{
 	ChannelUpdateAcc:                 "ChannelUpdateAcc",
 	ChannelUpdateRej:                 "ChannelUpdateRej",
 	ChannelSync:                      "ChannelSync",
+	ChannelProposalAccs:              "ChannelProposalAccs",
+	ChannelAction:                    "ChannelAction",
+	WatchStart:                       "WatchStart",
+	WatchStop:                        "WatchStop",
+	WatchPublish:                     "WatchPublish",
+	WatchResponse:                    "WatchResponse",
+	WatchEvent:                       "WatchEvent",
+	WatchTimeoutElapsed:              "WatchTimeoutElapsed",
+	ChannelAnnouncement:              "ChannelAnnouncement",
+	ChannelDeposit:                   "ChannelDeposit",
+	ChannelWithdrawal:                "ChannelWithdrawal",
+	ChannelWithdrawalAcc:             "ChannelWithdrawalAcc",
+	ChannelAssetChange:               "ChannelAssetChange",
+	ChannelProposalCounter:           "ChannelProposalCounter",
+	ChannelUpdateCounter:             "ChannelUpdateCounter",
+	ChannelPipelinedUpdate:           "ChannelPipelinedUpdate",
 }
 
 // String returns the name of a message type if it is valid and name known
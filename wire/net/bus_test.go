@@ -40,3 +40,19 @@ func TestBus(t *testing.T) {
 
 	assert.NoError(t, hub.Close())
 }
+
+func TestBus_Encrypted(t *testing.T) {
+	const numClients = 16
+	const numMsgs = 16
+
+	var hub nettest.ConnHub
+
+	wiretest.GenericBusTest(t, func(acc wire.Account) wire.Bus {
+		bus := net.NewBus(acc, hub.NewEncryptedNetDialer(acc))
+		hub.OnClose(func() { bus.Close() })
+		go bus.Listen(hub.NewEncryptedNetListener(acc))
+		return bus
+	}, numClients, numMsgs)
+
+	assert.NoError(t, hub.Close())
+}
@@ -0,0 +1,483 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+
+	"perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+	pkg "polycry.pt/poly-go/context"
+	"polycry.pt/poly-go/sync/atomic"
+)
+
+const (
+	// encryptionProtocol names the handshake and record protocol of the
+	// EncryptedConn. It is hashed into all derived keys and signatures.
+	encryptionProtocol = "perun/wire/net/Encrypted/X25519-ChaChaPoly-SHA256"
+
+	// maxRecordLen is the maximal length of a record on the wire.
+	maxRecordLen = math.MaxUint16
+	// aeadOverhead is the length of the authentication tag of a record.
+	aeadOverhead = 16
+	// maxRecordPayloadLen is the maximal length of the plaintext in a record.
+	maxRecordPayloadLen = maxRecordLen - aeadOverhead
+	// recordHeaderLen is the length of the record length prefix.
+	recordHeaderLen = 2
+)
+
+var _ Conn = (*EncryptedConn)(nil)
+
+// EncryptedConn is a connection that encrypts and authenticates all envelopes
+// that are sent over an underlying io stream.
+//
+// The keys are negotiated in a handshake, which uses ephemeral X25519 keys and
+// in which both parties prove their identity by signing the handshake
+// transcript with their wire.Account. The identities are only transmitted
+// encrypted. Similar to crypto/tls, the handshake is run on the first call to
+// Send or Recv, unless it is run explicitly with Handshake before.
+type EncryptedConn struct {
+	conn   io.ReadWriteCloser
+	id     wire.Account
+	active bool
+	closed atomic.Bool
+
+	handshakeMtx  sync.Mutex
+	handshakeDone bool
+	handshakeErr  error
+	peer          wire.Address // Expected or authenticated address of the peer.
+
+	send, recv *cipherState
+	recvBuf    []byte // Decrypted but not yet consumed data.
+}
+
+// NewEncryptedConnActive creates an encrypted connection for the party that
+// dialed. The handshake fails with an AuthenticationError if the peer cannot
+// prove that it controls the expected peer address.
+func NewEncryptedConnActive(conn io.ReadWriteCloser, id wire.Account, peer wire.Address) *EncryptedConn {
+	return &EncryptedConn{
+		conn:   conn,
+		id:     id,
+		active: true,
+		peer:   peer,
+	}
+}
+
+// NewEncryptedConnPassive creates an encrypted connection for the party that
+// accepted the connection. The address of the peer is learned during the
+// handshake and can be queried with Peer afterwards.
+func NewEncryptedConnPassive(conn io.ReadWriteCloser, id wire.Account) *EncryptedConn {
+	return &EncryptedConn{
+		conn: conn,
+		id:   id,
+	}
+}
+
+// Handshake runs the handshake if it has not been run yet. It is safe to call
+// Handshake concurrently. If the context is done before the handshake
+// finishes, the connection is closed.
+func (c *EncryptedConn) Handshake(ctx context.Context) error {
+	c.handshakeMtx.Lock()
+	defer c.handshakeMtx.Unlock()
+	if c.handshakeDone {
+		return c.handshakeErr
+	}
+
+	var res *handshakeResult
+	var err error
+	ok := pkg.TerminatesCtx(ctx, func() {
+		if c.active {
+			res, err = encryptionHandshakeActive(c.conn, c.id, c.peer)
+		} else {
+			res, err = encryptionHandshakePassive(c.conn, c.id)
+		}
+	})
+
+	c.handshakeDone = true
+	if !ok {
+		// Do not touch err as it may still be written to.
+		c.handshakeErr = errors.WithMessage(ctx.Err(), "handshake timeout")
+	} else {
+		c.handshakeErr = err
+	}
+	if c.handshakeErr != nil {
+		c.conn.Close()
+		return c.handshakeErr
+	}
+	c.send, c.recv, c.peer = res.send, res.recv, res.peer
+	return nil
+}
+
+// Peer returns the authenticated address of the peer. It returns nil if the
+// handshake did not complete successfully yet.
+func (c *EncryptedConn) Peer() wire.Address {
+	c.handshakeMtx.Lock()
+	defer c.handshakeMtx.Unlock()
+	if !c.handshakeDone || c.handshakeErr != nil {
+		return nil
+	}
+	return c.peer
+}
+
+// Send encrypts and sends an envelope to the peer.
+func (c *EncryptedConn) Send(e *wire.Envelope) error {
+	if err := c.Handshake(context.Background()); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := e.Encode(&buf); err != nil {
+		c.conn.Close()
+		return err
+	}
+	for data := buf.Bytes(); len(data) > 0; {
+		n := len(data)
+		if n > maxRecordPayloadLen {
+			n = maxRecordPayloadLen
+		}
+		if err := c.writeEncrypted(data[:n]); err != nil {
+			c.conn.Close()
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// Recv receives and decrypts an envelope from the peer.
+func (c *EncryptedConn) Recv() (*wire.Envelope, error) {
+	if err := c.Handshake(context.Background()); err != nil {
+		return nil, err
+	}
+
+	var e wire.Envelope
+	if err := e.Decode(recordReader{c}); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Close closes the connection and aborts any ongoing Send, Recv or Handshake
+// calls.
+func (c *EncryptedConn) Close() error {
+	if !c.closed.TrySet() {
+		return errors.New("already closed")
+	}
+	return c.conn.Close()
+}
+
+func (c *EncryptedConn) writeEncrypted(plaintext []byte) error {
+	record, err := c.send.seal(plaintext)
+	if err != nil {
+		return err
+	}
+	return writeRecord(c.conn, record)
+}
+
+// recordReader is an io.Reader that reads and decrypts records from an
+// EncryptedConn.
+type recordReader struct{ c *EncryptedConn }
+
+func (r recordReader) Read(p []byte) (int, error) {
+	for len(r.c.recvBuf) == 0 {
+		record, err := readRecord(r.c.conn)
+		if err != nil {
+			return 0, err
+		}
+		if r.c.recvBuf, err = r.c.recv.open(record); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.c.recvBuf)
+	r.c.recvBuf = r.c.recvBuf[n:]
+	return n, nil
+}
+
+// handshakeResult contains the result of a successful encryption handshake.
+type handshakeResult struct {
+	send, recv *cipherState
+	peer       wire.Address
+}
+
+// encryptionHandshakeActive runs the handshake of the dialing party.
+//
+//	-> e
+//	<- e, ee, Enc(address, signature)
+//	-> Enc(address, signature)
+func encryptionHandshakeActive(conn io.ReadWriter, id wire.Account, peer wire.Address) (*handshakeResult, error) {
+	priv, pub, err := newEphemeralKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRecord(conn, pub); err != nil {
+		return nil, errors.WithMessage(err, "sending ephemeral key")
+	}
+
+	msg, err := readRecord(conn)
+	if err != nil {
+		return nil, errors.WithMessage(err, "receiving handshake response")
+	} else if len(msg) < curve25519.PointSize {
+		return nil, errors.New("handshake response too short")
+	}
+	hs, err := newHandshakeState(priv, msg[:curve25519.PointSize], pub, msg[:curve25519.PointSize])
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := hs.passiveCipher.open(msg[curve25519.PointSize:])
+	if err != nil {
+		return nil, errors.WithMessage(err, "decrypting handshake response")
+	}
+	addr, err := hs.verifyIdentity(payload, rolePassive, id.Address())
+	if err != nil {
+		return nil, err
+	} else if !addr.Equal(peer) {
+		return nil, NewAuthenticationError(addr, id.Address(), id.Address(), "unexpected peer identity in handshake")
+	}
+
+	payload, err = hs.identity(id, roleActive)
+	if err != nil {
+		return nil, err
+	}
+	record, err := hs.activeCipher.seal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRecord(conn, record); err != nil {
+		return nil, errors.WithMessage(err, "sending handshake identity")
+	}
+
+	return &handshakeResult{send: hs.activeTransport, recv: hs.passiveTransport, peer: addr}, nil
+}
+
+// encryptionHandshakePassive runs the handshake of the accepting party.
+func encryptionHandshakePassive(conn io.ReadWriter, id wire.Account) (*handshakeResult, error) {
+	peerPub, err := readRecord(conn)
+	if err != nil {
+		return nil, errors.WithMessage(err, "receiving ephemeral key")
+	} else if len(peerPub) != curve25519.PointSize {
+		return nil, errors.New("invalid ephemeral key length")
+	}
+
+	priv, pub, err := newEphemeralKey()
+	if err != nil {
+		return nil, err
+	}
+	hs, err := newHandshakeState(priv, peerPub, peerPub, pub)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := hs.identity(id, rolePassive)
+	if err != nil {
+		return nil, err
+	}
+	record, err := hs.passiveCipher.seal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRecord(conn, append(pub, record...)); err != nil {
+		return nil, errors.WithMessage(err, "sending handshake response")
+	}
+
+	msg, err := readRecord(conn)
+	if err != nil {
+		return nil, errors.WithMessage(err, "receiving handshake identity")
+	}
+	if payload, err = hs.activeCipher.open(msg); err != nil {
+		return nil, errors.WithMessage(err, "decrypting handshake identity")
+	}
+	addr, err := hs.verifyIdentity(payload, roleActive, id.Address())
+	if err != nil {
+		return nil, err
+	}
+
+	return &handshakeResult{send: hs.passiveTransport, recv: hs.activeTransport, peer: addr}, nil
+}
+
+// handshakeState contains the keys derived from the ephemeral keys of both
+// parties.
+type handshakeState struct {
+	// hash is the hash of the handshake transcript, which is signed by both
+	// parties.
+	hash [sha256.Size]byte
+	// activeCipher and passiveCipher encrypt the identities of the active and
+	// passive party during the handshake.
+	activeCipher, passiveCipher *cipherState
+	// activeTransport and passiveTransport encrypt the data sent by the active
+	// and passive party after the handshake.
+	activeTransport, passiveTransport *cipherState
+}
+
+// newHandshakeState computes the shared secret from the own private and the
+// peer's public ephemeral key and derives all keys of the connection from it.
+func newHandshakeState(priv, peerPub, activePub, passivePub []byte) (*handshakeState, error) {
+	shared, err := curve25519.X25519(priv, peerPub)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing shared secret")
+	}
+
+	hs := handshakeState{
+		hash: sha256.Sum256(bytes.Join([][]byte{[]byte(encryptionProtocol), activePub, passivePub}, nil)),
+	}
+	kdf := hkdf.New(sha256.New, shared, hs.hash[:], []byte(encryptionProtocol))
+	for _, s := range []**cipherState{&hs.activeCipher, &hs.passiveCipher, &hs.activeTransport, &hs.passiveTransport} {
+		key := make([]byte, chacha20poly1305.KeySize)
+		if _, err := io.ReadFull(kdf, key); err != nil {
+			return nil, errors.Wrap(err, "deriving key")
+		}
+		if *s, err = newCipherState(key); err != nil {
+			return nil, err
+		}
+	}
+	return &hs, nil
+}
+
+// signedData returns the data that is signed by the party with the given role
+// and address.
+func (hs *handshakeState) signedData(role byte, addr wire.Address) ([]byte, error) {
+	var buf bytes.Buffer
+	err := perunio.Encode(&buf, encryptionProtocol, role, hs.hash, addr)
+	return buf.Bytes(), errors.WithMessage(err, "encoding handshake transcript")
+}
+
+// identity returns the encoded address of id and its signature on the
+// handshake transcript.
+func (hs *handshakeState) identity(id wire.Account, role byte) ([]byte, error) {
+	data, err := hs.signedData(role, id.Address())
+	if err != nil {
+		return nil, err
+	}
+	sig, err := id.SignData(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "signing handshake transcript")
+	}
+	var buf bytes.Buffer
+	err = perunio.Encode(&buf, id.Address(), sig)
+	return buf.Bytes(), errors.WithMessage(err, "encoding identity")
+}
+
+// verifyIdentity decodes the address of the peer and verifies its signature
+// on the handshake transcript. own is only used for error reporting.
+func (hs *handshakeState) verifyIdentity(payload []byte, role byte, own wire.Address) (wire.Address, error) {
+	addr := wire.NewAddress()
+	var sig wallet.Sig
+	if err := perunio.Decode(bytes.NewReader(payload), addr, wallet.SigDec{Sig: &sig}); err != nil {
+		return nil, errors.WithMessage(err, "decoding identity")
+	}
+	data, err := hs.signedData(role, addr)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := wallet.VerifySignature(data, sig, addr); err != nil {
+		return nil, errors.WithMessage(err, "verifying handshake signature")
+	} else if !ok {
+		return nil, NewAuthenticationError(addr, own, own, "invalid handshake signature")
+	}
+	return addr, nil
+}
+
+// cipherState encrypts or decrypts consecutive records with a counter nonce.
+type cipherState struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+func newCipherState(key []byte) (*cipherState, error) {
+	aead, err := chacha20poly1305.New(key)
+	return &cipherState{aead: aead}, errors.Wrap(err, "creating cipher")
+}
+
+func (s *cipherState) nextNonce() ([]byte, error) {
+	if s.nonce == math.MaxUint64 {
+		return nil, errors.New("nonce exhausted")
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[chacha20poly1305.NonceSize-8:], s.nonce)
+	s.nonce++
+	return nonce, nil
+}
+
+func (s *cipherState) seal(plaintext []byte) ([]byte, error) {
+	nonce, err := s.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func (s *cipherState) open(ciphertext []byte) ([]byte, error) {
+	nonce, err := s.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	return plaintext, errors.Wrap(err, "decrypting record")
+}
+
+// newEphemeralKey samples a fresh X25519 key pair.
+func newEphemeralKey() (priv, pub []byte, err error) {
+	priv = make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, priv); err != nil {
+		return nil, nil, errors.Wrap(err, "sampling ephemeral key")
+	}
+	return priv, publicKey(priv), nil
+}
+
+func publicKey(priv []byte) []byte {
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		panic(err) // Cannot happen for the base point.
+	}
+	return pub
+}
+
+// writeRecord writes a length-prefixed record.
+func writeRecord(w io.Writer, record []byte) error {
+	if len(record) > maxRecordLen {
+		return errors.Errorf("record too long: %d", len(record))
+	}
+	buf := make([]byte, recordHeaderLen+len(record))
+	binary.BigEndian.PutUint16(buf, uint16(len(record)))
+	copy(buf[recordHeaderLen:], record)
+	_, err := w.Write(buf)
+	return errors.Wrap(err, "writing record")
+}
+
+// readRecord reads a length-prefixed record.
+func readRecord(r io.Reader) ([]byte, error) {
+	var header [recordHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, errors.Wrap(err, "reading record header")
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[:]))
+	_, err := io.ReadFull(r, record)
+	return record, errors.Wrap(err, "reading record")
+}
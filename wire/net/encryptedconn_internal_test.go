@@ -0,0 +1,196 @@
+// Copyright 2021 - See NOTICE file for copyright holders.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	wallettest "perun.network/go-perun/wallet/test"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+	wiretest "perun.network/go-perun/wire/test"
+	ctxtest "polycry.pt/poly-go/context/test"
+	"polycry.pt/poly-go/test"
+)
+
+// bigMsg is a message with a payload that spans multiple records.
+type bigMsg struct{ data perunio.ByteSlice }
+
+const (
+	bigMsgType wire.Type = wire.LastType + 1
+	bigMsgLen            = 3 * maxRecordLen
+)
+
+func init() {
+	wire.RegisterExternalDecoder(bigMsgType, func(r io.Reader) (wire.Msg, error) {
+		m := bigMsg{data: make([]byte, bigMsgLen)}
+		return &m, m.data.Decode(r)
+	}, "EncryptedConnTestMsg")
+}
+
+func (m *bigMsg) Type() wire.Type          { return bigMsgType }
+func (m *bigMsg) Encode(w io.Writer) error { return m.data.Encode(w) }
+
+func newEncryptedConnPair(active, passive wire.Account, expected wire.Address) (*EncryptedConn, *EncryptedConn) {
+	c0, c1 := net.Pipe()
+	return NewEncryptedConnActive(c0, active, expected), NewEncryptedConnPassive(c1, passive)
+}
+
+func TestEncryptedConn_Success(t *testing.T) {
+	rng := test.Prng(t)
+	acc0, acc1 := wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng)
+	conn0, conn1 := newEncryptedConnPair(acc0, acc1, acc1.Address())
+	defer conn0.Close()
+	defer conn1.Close()
+	assert.Nil(t, conn1.Peer())
+
+	envs := []*wire.Envelope{
+		wiretest.NewRandomEnvelope(rng, wire.NewPingMsg()),
+		wiretest.NewRandomEnvelope(rng, &bigMsg{data: make([]byte, bigMsgLen)}),
+	}
+
+	ct := test.NewConcurrent(t)
+	go ct.Stage("passive", func(t test.ConcT) {
+		for _, e := range envs {
+			re, err := conn1.Recv()
+			require.NoError(t, err)
+			require.Equal(t, e, re)
+			require.NoError(t, conn1.Send(re))
+		}
+	})
+
+	ctxtest.AssertTerminates(t, timeout, func() {
+		require.NoError(t, conn0.Handshake(context.Background()))
+	})
+	for _, e := range envs {
+		require.NoError(t, conn0.Send(e))
+		re, err := conn0.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, e, re)
+	}
+	ct.Wait("passive")
+
+	assert.True(t, conn0.Peer().Equal(acc1.Address()))
+	assert.True(t, conn1.Peer().Equal(acc0.Address()))
+}
+
+func TestEncryptedConn_WrongPeer(t *testing.T) {
+	rng := test.Prng(t)
+	acc0, acc1 := wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng)
+	conn0, conn1 := newEncryptedConnPair(acc0, acc1, wallettest.NewRandomAddress(rng))
+	defer conn1.Close()
+
+	go conn1.Handshake(context.Background()) //nolint:errcheck
+
+	err := conn0.Handshake(context.Background())
+	assert.True(t, IsAuthenticationError(err), "expected AuthenticationError, got %v", err)
+	assert.Nil(t, conn0.Peer())
+	assert.Error(t, conn0.Send(wiretest.NewRandomEnvelope(rng, wire.NewPingMsg())),
+		"Send must fail after failed handshake")
+}
+
+func TestEncryptedConn_Impersonation(t *testing.T) {
+	rng := test.Prng(t)
+	victim, attacker, honest := wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng)
+	fake := impersonator{Account: attacker, claimed: victim.Address()}
+
+	t.Run("active impersonator", func(t *testing.T) {
+		conn0, conn1 := newEncryptedConnPair(fake, honest, honest.Address())
+		defer conn0.Close()
+		go conn0.Handshake(context.Background()) //nolint:errcheck
+
+		err := conn1.Handshake(context.Background())
+		assert.True(t, IsAuthenticationError(err), "expected AuthenticationError, got %v", err)
+	})
+
+	t.Run("passive impersonator", func(t *testing.T) {
+		conn0, conn1 := newEncryptedConnPair(honest, fake, victim.Address())
+		defer conn1.Close()
+		go conn1.Handshake(context.Background()) //nolint:errcheck
+
+		err := conn0.Handshake(context.Background())
+		assert.True(t, IsAuthenticationError(err), "expected AuthenticationError, got %v", err)
+	})
+}
+
+// tamperer flips a bit in every nth write.
+type tamperer struct {
+	net.Conn
+	n, writes int
+}
+
+func (t *tamperer) Write(p []byte) (int, error) {
+	t.writes++
+	if t.writes == t.n {
+		p = append([]byte(nil), p...)
+		p[len(p)-1] ^= 1
+	}
+	return t.Conn.Write(p)
+}
+
+func TestEncryptedConn_Tampering(t *testing.T) {
+	rng := test.Prng(t)
+	acc0, acc1 := wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng)
+	c0, c1 := net.Pipe()
+	// The fourth write is the first record after the handshake.
+	conn0 := NewEncryptedConnActive(&tamperer{Conn: c0, n: 3}, acc0, acc1.Address())
+	conn1 := NewEncryptedConnPassive(c1, acc1)
+	defer conn0.Close()
+
+	ct := test.NewConcurrent(t)
+	go ct.Stage("passive", func(t test.ConcT) {
+		_, err := conn1.Recv()
+		assert.Error(t, err)
+	})
+	require.NoError(t, conn0.Handshake(context.Background()))
+	// Sending may fail if the passive side already closed the connection.
+	_ = conn0.Send(wiretest.NewRandomEnvelope(rng, wire.NewPingMsg()))
+	ct.Wait("passive")
+}
+
+func TestEncryptedConn_Timeout(t *testing.T) {
+	rng := test.Prng(t)
+	c0, _ := net.Pipe()
+	conn := NewEncryptedConnPassive(c0, wallettest.NewRandomAccount(rng))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctxtest.AssertTerminates(t, 2*timeout, func() {
+		assert.Error(t, conn.Handshake(ctx))
+	})
+	_, err := conn.Recv()
+	assert.Error(t, err, "Recv must fail after failed handshake")
+}
+
+func TestEncryptedConn_Close(t *testing.T) {
+	rng := test.Prng(t)
+	c0, _ := net.Pipe()
+	conn := NewEncryptedConnPassive(c0, wallettest.NewRandomAccount(rng))
+
+	ct := test.NewConcurrent(t)
+	go ct.Stage("recv", func(t test.ConcT) {
+		_, err := conn.Recv()
+		assert.Error(t, err)
+	})
+	assert.NoError(t, conn.Close())
+	ct.Wait("recv")
+	assert.Error(t, conn.Close(), "double close must fail")
+}
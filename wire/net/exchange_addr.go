@@ -15,17 +15,23 @@
 package net
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
 	"fmt"
+	"io"
 
 	"github.com/pkg/errors"
 
+	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
 	pkg "polycry.pt/poly-go/context"
 )
 
 // AuthenticationError describes an error which occures when the ExchangeAddrs
-// protcol fails because it got a different Address than expected.
+// protcol fails because it got a different Address than expected or the peer
+// could not prove that it controls its Address.
 type AuthenticationError struct {
 	Sender, Receiver, Own wire.Address
 }
@@ -50,34 +56,81 @@ func IsAuthenticationError(err error) bool {
 	return ok
 }
 
+// authTranscriptDomain separates the signatures of the authentication protocol
+// from signatures on other data.
+const authTranscriptDomain = "perun/wire/net/ExchangeAddrs"
+
+// Roles in the address exchange protocol. They are part of the signed
+// transcript so that a signature of one role cannot be reused for the other.
+const (
+	roleActive  byte = 0
+	rolePassive byte = 1
+)
+
+// authTranscript is the transcript of the address exchange protocol. It binds
+// the identities of both parties to the fresh nonces of this connection.
+type authTranscript struct {
+	active, passive           wire.Address
+	activeNonce, passiveNonce wire.AuthNonce
+}
+
+// data returns the data that is signed by the party with the given role.
+func (t authTranscript) data(role byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := perunio.Encode(&buf, authTranscriptDomain, role, t.active, t.passive, t.activeNonce, t.passiveNonce)
+	return buf.Bytes(), errors.WithMessage(err, "encoding transcript")
+}
+
+// sign signs the transcript with id in the given role.
+func (t authTranscript) sign(id wire.Account, role byte) (wallet.Sig, error) {
+	data, err := t.data(role)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := id.SignData(data)
+	return sig, errors.WithMessage(err, "signing transcript")
+}
+
+// verify verifies that the transcript was signed by the party with the given
+// role and returns an AuthenticationError otherwise.
+func (t authTranscript) verify(sig wallet.Sig, role byte, own wire.Address) error {
+	signer := t.passive
+	if role == roleActive {
+		signer = t.active
+	}
+	if sig == nil {
+		return NewAuthenticationError(signer, own, own, "missing transcript signature")
+	}
+	data, err := t.data(role)
+	if err != nil {
+		return err
+	}
+	if ok, err := wallet.VerifySignature(data, sig, signer); err != nil {
+		return errors.WithMessage(err, "verifying transcript signature")
+	} else if !ok {
+		return NewAuthenticationError(signer, own, own, "invalid transcript signature")
+	}
+	return nil
+}
+
+// newAuthNonce samples a fresh nonce from crypto/rand.
+func newAuthNonce() (nonce wire.AuthNonce, err error) {
+	_, err = io.ReadFull(rand.Reader, nonce[:])
+	return nonce, errors.Wrap(err, "sampling nonce")
+}
+
 // ExchangeAddrsActive executes the active role of the address exchange
 // protocol. It is executed by the person that dials.
 //
-// In the future, it will be extended to become a proper authentication
-// protocol. The protocol will then exchange Perun addresses and establish
-// authenticity.
+// The protocol is a challenge-response protocol: The active party sends a
+// fresh nonce, the passive party responds with its own nonce and a signature on
+// the transcript containing both nonces and addresses, and the active party
+// finally sends its own signature on the transcript. An AuthenticationError is
+// returned if the peer cannot prove that it controls the expected address.
 func ExchangeAddrsActive(ctx context.Context, id wire.Account, peer wire.Address, conn Conn) error {
 	var err error
 	ok := pkg.TerminatesCtx(ctx, func() {
-		err = conn.Send(&wire.Envelope{
-			Sender:    id.Address(),
-			Recipient: peer,
-			Msg:       wire.NewAuthResponseMsg(id),
-		})
-		if err != nil {
-			err = errors.WithMessage(err, "sending message")
-			return
-		}
-
-		var e *wire.Envelope
-		if e, err = conn.Recv(); err != nil {
-			err = errors.WithMessage(err, "receiving message")
-		} else if _, ok := e.Msg.(*wire.AuthResponseMsg); !ok {
-			err = errors.Errorf("expected AuthResponse wire msg, got %v", e.Msg.Type())
-		} else if !e.Recipient.Equal(id.Address()) &&
-			!e.Sender.Equal(peer) {
-			err = NewAuthenticationError(e.Sender, e.Recipient, id.Address(), "unmatched response sender or recipient")
-		}
+		err = exchangeAddrsActive(id, peer, conn)
 	})
 
 	if !ok {
@@ -88,28 +141,56 @@ func ExchangeAddrsActive(ctx context.Context, id wire.Account, peer wire.Address
 	return err
 }
 
+func exchangeAddrsActive(id wire.Account, peer wire.Address, conn Conn) error {
+	ownNonce, err := newAuthNonce()
+	if err != nil {
+		return err
+	}
+	if err := conn.Send(&wire.Envelope{
+		Sender:    id.Address(),
+		Recipient: peer,
+		Msg:       wire.NewAuthResponseMsg(ownNonce, nil),
+	}); err != nil {
+		return errors.WithMessage(err, "sending message")
+	}
+
+	e, err := conn.Recv()
+	if err != nil {
+		return errors.WithMessage(err, "receiving message")
+	}
+	resp, ok := e.Msg.(*wire.AuthResponseMsg)
+	if !ok {
+		return errors.Errorf("expected AuthResponse wire msg, got %v", e.Msg.Type())
+	} else if !e.Recipient.Equal(id.Address()) || !e.Sender.Equal(peer) {
+		return NewAuthenticationError(e.Sender, e.Recipient, id.Address(), "unmatched response sender or recipient")
+	}
+	transcript := authTranscript{
+		active: id.Address(), passive: peer,
+		activeNonce: ownNonce, passiveNonce: resp.Nonce,
+	}
+	if err := transcript.verify(resp.Sig, rolePassive, id.Address()); err != nil {
+		return err
+	}
+
+	sig, err := transcript.sign(id, roleActive)
+	if err != nil {
+		return err
+	}
+	return errors.WithMessage(conn.Send(&wire.Envelope{
+		Sender:    id.Address(),
+		Recipient: peer,
+		Msg:       wire.NewAuthResponseMsg(ownNonce, sig),
+	}), "sending message")
+}
+
 // ExchangeAddrsPassive executes the passive role of the address exchange
 // protocol. It is executed by the person that listens for incoming connections.
+// It returns the authenticated address of the peer.
 func ExchangeAddrsPassive(ctx context.Context, id wire.Account, conn Conn) (wire.Address, error) {
 	var addr wire.Address
 	var err error
 	ok := pkg.TerminatesCtx(ctx, func() {
-		var e *wire.Envelope
-		if e, err = conn.Recv(); err != nil {
-			err = errors.WithMessage(err, "receiving auth message")
-		} else if _, ok := e.Msg.(*wire.AuthResponseMsg); !ok {
-			err = errors.Errorf("expected AuthResponse wire msg, got %v", e.Msg.Type())
-		} else if !e.Recipient.Equal(id.Address()) {
-			err = NewAuthenticationError(e.Sender, e.Recipient, id.Address(), "unmatched response sender or recipient")
-		}
-		if err != nil {
-			return
-		}
-		addr, err = e.Sender, conn.Send(&wire.Envelope{
-			Sender:    id.Address(),
-			Recipient: e.Sender,
-			Msg:       wire.NewAuthResponseMsg(id),
-		})
+		addr, err = exchangeAddrsPassive(id, conn)
 	})
 
 	if !ok {
@@ -117,6 +198,57 @@ func ExchangeAddrsPassive(ctx context.Context, id wire.Account, conn Conn) (wire
 		return nil, errors.WithMessage(ctx.Err(), "timeout")
 	} else if err != nil {
 		conn.Close()
+		return nil, err
+	}
+	return addr, nil
+}
+
+func exchangeAddrsPassive(id wire.Account, conn Conn) (wire.Address, error) {
+	e, err := conn.Recv()
+	if err != nil {
+		return nil, errors.WithMessage(err, "receiving auth message")
+	}
+	challenge, ok := e.Msg.(*wire.AuthResponseMsg)
+	if !ok {
+		return nil, errors.Errorf("expected AuthResponse wire msg, got %v", e.Msg.Type())
+	} else if !e.Recipient.Equal(id.Address()) {
+		return nil, NewAuthenticationError(e.Sender, e.Recipient, id.Address(), "unmatched response sender or recipient")
+	}
+	peer := e.Sender
+
+	ownNonce, err := newAuthNonce()
+	if err != nil {
+		return nil, err
+	}
+	transcript := authTranscript{
+		active: peer, passive: id.Address(),
+		activeNonce: challenge.Nonce, passiveNonce: ownNonce,
+	}
+	sig, err := transcript.sign(id, rolePassive)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Send(&wire.Envelope{
+		Sender:    id.Address(),
+		Recipient: peer,
+		Msg:       wire.NewAuthResponseMsg(ownNonce, sig),
+	}); err != nil {
+		return nil, errors.WithMessage(err, "sending auth message")
+	}
+
+	if e, err = conn.Recv(); err != nil {
+		return nil, errors.WithMessage(err, "receiving auth message")
+	}
+	resp, ok := e.Msg.(*wire.AuthResponseMsg)
+	if !ok {
+		return nil, errors.Errorf("expected AuthResponse wire msg, got %v", e.Msg.Type())
+	} else if !e.Recipient.Equal(id.Address()) || !e.Sender.Equal(peer) {
+		return nil, NewAuthenticationError(e.Sender, e.Recipient, id.Address(), "unmatched response sender or recipient")
+	} else if resp.Nonce != challenge.Nonce {
+		return nil, NewAuthenticationError(e.Sender, e.Recipient, id.Address(), "unmatched response nonce")
+	}
+	if err := transcript.verify(resp.Sig, roleActive, id.Address()); err != nil {
+		return nil, err
 	}
-	return addr, err
+	return peer, nil
 }
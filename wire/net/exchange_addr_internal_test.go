@@ -20,7 +20,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"perun.network/go-perun/wallet"
 	wallettest "perun.network/go-perun/wallet/test"
 	"perun.network/go-perun/wire"
 	wiretest "perun.network/go-perun/wire/test"
@@ -83,3 +85,74 @@ func TestExchangeAddrs_BogusMsg(t *testing.T) {
 	assert.Error(t, err, "ExchangeAddrs should error when peer sends a non-AuthResponseMsg")
 	assert.Nil(t, addr)
 }
+
+// impersonator is an account that claims the address of another account but
+// signs with its own key.
+type impersonator struct {
+	wire.Account
+	claimed wire.Address
+}
+
+func (a impersonator) Address() wallet.Address { return a.claimed }
+
+func TestExchangeAddrs_Impersonation(t *testing.T) {
+	rng := test.Prng(t)
+	victim, attacker, honest := wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng)
+	fake := impersonator{Account: attacker, claimed: victim.Address()}
+
+	t.Run("active impersonator", func(t *testing.T) {
+		conn0, conn1 := newPipeConnPair()
+		defer conn0.Close()
+		ct := test.NewConcurrent(t)
+		go ct.Stage("active", func(t test.ConcT) {
+			// The impersonator cannot detect the failure, because the passive
+			// side only verifies the last message of the protocol.
+			_ = ExchangeAddrsActive(context.Background(), fake, honest.Address(), conn0)
+		})
+
+		addr, err := ExchangeAddrsPassive(context.Background(), honest, conn1)
+		assert.True(t, IsAuthenticationError(err), "expected AuthenticationError, got %v", err)
+		assert.Nil(t, addr)
+		ct.Wait("active")
+	})
+
+	t.Run("passive impersonator", func(t *testing.T) {
+		conn0, conn1 := newPipeConnPair()
+		defer conn0.Close()
+		ct := test.NewConcurrent(t)
+		go ct.Stage("passive", func(t test.ConcT) {
+			_, err := ExchangeAddrsPassive(context.Background(), fake, conn1)
+			assert.Error(t, err)
+		})
+
+		err := ExchangeAddrsActive(context.Background(), honest, victim.Address(), conn0)
+		assert.True(t, IsAuthenticationError(err), "expected AuthenticationError, got %v", err)
+		conn0.Close()
+		ct.Wait("passive")
+	})
+}
+
+func TestExchangeAddrs_Replay(t *testing.T) {
+	rng := test.Prng(t)
+	account0, account1 := wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng)
+
+	// A valid response of account1 to an old challenge of account0.
+	var oldChallenge, nonce wire.AuthNonce
+	rng.Read(oldChallenge[:])
+	rng.Read(nonce[:])
+	transcript := authTranscript{
+		active: account0.Address(), passive: account1.Address(),
+		activeNonce: oldChallenge, passiveNonce: nonce,
+	}
+	sig, err := transcript.sign(account1, rolePassive)
+	require.NoError(t, err)
+
+	conn := newMockConn()
+	conn.recvQueue <- &wire.Envelope{
+		Sender:    account1.Address(),
+		Recipient: account0.Address(),
+		Msg:       wire.NewAuthResponseMsg(nonce, sig),
+	}
+	err = ExchangeAddrsActive(context.Background(), account0, account1.Address(), conn)
+	assert.True(t, IsAuthenticationError(err), "expected AuthenticationError, got %v", err)
+}
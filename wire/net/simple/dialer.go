@@ -34,6 +34,7 @@ type Dialer struct {
 	peers   map[wallet.AddrKey]string // Known peer addresses.
 	dialer  net.Dialer                // Used to dial connections.
 	network string                    // The socket type.
+	id      wire.Account              // Used for encryption, if set.
 
 	pkgsync.Closer
 }
@@ -52,6 +53,15 @@ func NewNetDialer(network string, defaultTimeout time.Duration) *Dialer {
 	}
 }
 
+// NewEncryptedNetDialer creates a new dialer like NewNetDialer, but all dialed
+// connections are encrypted and authenticated with the node's identity id, see
+// wirenet.EncryptedConn. The peers must listen with an encrypted listener.
+func NewEncryptedNetDialer(network string, defaultTimeout time.Duration, id wire.Account) *Dialer {
+	d := NewNetDialer(network, defaultTimeout)
+	d.id = id
+	return d
+}
+
 // NewTCPDialer is a short-hand version of NewNetDialer for creating TCP dialers.
 func NewTCPDialer(defaultTimeout time.Duration) *Dialer {
 	return NewNetDialer("tcp", defaultTimeout)
@@ -62,6 +72,12 @@ func NewUnixDialer(defaultTimeout time.Duration) *Dialer {
 	return NewNetDialer("unix", defaultTimeout)
 }
 
+// NewEncryptedTCPDialer is a short-hand version of NewEncryptedNetDialer for
+// creating encrypted TCP dialers.
+func NewEncryptedTCPDialer(defaultTimeout time.Duration, id wire.Account) *Dialer {
+	return NewEncryptedNetDialer("tcp", defaultTimeout, id)
+}
+
 func (d *Dialer) host(key wallet.AddrKey) (string, bool) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
@@ -97,7 +113,14 @@ func (d *Dialer) Dial(ctx context.Context, addr wire.Address) (wirenet.Conn, err
 		return nil, errors.Wrap(err, "failed to dial peer")
 	}
 
-	return wirenet.NewIoConn(conn), nil
+	if d.id == nil {
+		return wirenet.NewIoConn(conn), nil
+	}
+	ec := wirenet.NewEncryptedConnActive(conn, d.id, addr)
+	if err := ec.Handshake(wrappedCtx); err != nil {
+		return nil, errors.WithMessage(err, "encryption handshake")
+	}
+	return ec, nil
 }
 
 // Register registers a network address for a peer address.
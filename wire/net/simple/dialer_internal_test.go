@@ -25,6 +25,7 @@ import (
 	simwallet "perun.network/go-perun/backend/sim/wallet"
 	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
+	wirenet "perun.network/go-perun/wire/net"
 	ctxtest "polycry.pt/poly-go/context/test"
 	"polycry.pt/poly-go/test"
 )
@@ -130,3 +131,47 @@ func TestDialer_Dial(t *testing.T) {
 		})
 	})
 }
+
+func TestDialer_DialEncrypted(t *testing.T) {
+	timeout := 100 * time.Millisecond
+	rng := test.Prng(t)
+	lhost := "127.0.0.1:7358"
+	lacc, dacc := simwallet.NewRandomAccount(rng), simwallet.NewRandomAccount(rng)
+
+	l, err := NewEncryptedTCPListener(lhost, lacc)
+	require.NoError(t, err)
+	defer l.Close()
+
+	d := NewEncryptedTCPDialer(timeout, dacc)
+	d.Register(lacc.Address(), lhost)
+	defer d.Close()
+
+	e := &wire.Envelope{
+		Sender:    dacc.Address(),
+		Recipient: lacc.Address(),
+		Msg:       wire.NewPingMsg(),
+	}
+	ct := test.NewConcurrent(t)
+	go ct.Stage("accept", func(rt test.ConcT) {
+		conn, err := l.Accept()
+		assert.NoError(t, err)
+		require.NotNil(rt, conn)
+
+		re, err := conn.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, re, e)
+		assert.True(t, conn.(*wirenet.EncryptedConn).Peer().Equal(dacc.Address()))
+	})
+
+	ct.Stage("dial", func(rt test.ConcT) {
+		ctxtest.AssertTerminates(t, timeout, func() {
+			conn, err := d.Dial(context.Background(), lacc.Address())
+			assert.NoError(t, err)
+			require.NotNil(rt, conn)
+
+			assert.NoError(t, conn.Send(e))
+		})
+	})
+
+	ct.Wait("dial", "accept")
+}
@@ -18,12 +18,14 @@ import (
 	"net"
 
 	"github.com/pkg/errors"
+	"perun.network/go-perun/wire"
 	wirenet "perun.network/go-perun/wire/net"
 )
 
 // Listener is a TCP Listener.
 type Listener struct {
 	net.Listener
+	id wire.Account // Used for encryption, if set.
 }
 
 var _ wirenet.Listener = (*Listener)(nil)
@@ -39,6 +41,20 @@ func NewNetListener(network string, address string) (*Listener, error) {
 	return &Listener{Listener: l}, nil
 }
 
+// NewEncryptedNetListener creates a listener like NewNetListener, but all
+// accepted connections are encrypted and authenticated with the node's
+// identity id, see wirenet.EncryptedConn. The encryption handshake is run on the
+// first use of an accepted connection so that Accept does not block on slow
+// peers.
+func NewEncryptedNetListener(network string, address string, id wire.Account) (*Listener, error) {
+	l, err := NewNetListener(network, address)
+	if err != nil {
+		return nil, err
+	}
+	l.id = id
+	return l, nil
+}
+
 // NewTCPListener is a short-hand version of NewNetListener for TCP listeners.
 func NewTCPListener(address string) (*Listener, error) {
 	return NewNetListener("tcp", address)
@@ -49,6 +65,12 @@ func NewUnixListener(address string) (*Listener, error) {
 	return NewNetListener("unix", address)
 }
 
+// NewEncryptedTCPListener is a short-hand version of NewEncryptedNetListener
+// for encrypted TCP listeners.
+func NewEncryptedTCPListener(address string, id wire.Account) (*Listener, error) {
+	return NewEncryptedNetListener("tcp", address, id)
+}
+
 // Accept implements peer.Dialer.Accept().
 func (l *Listener) Accept() (wirenet.Conn, error) {
 	conn, err := l.Listener.Accept()
@@ -56,5 +78,8 @@ func (l *Listener) Accept() (wirenet.Conn, error) {
 		return nil, errors.Wrap(err, "accept failed")
 	}
 
-	return wirenet.NewIoConn(conn), nil
+	if l.id == nil {
+		return wirenet.NewIoConn(conn), nil
+	}
+	return wirenet.NewEncryptedConnPassive(conn, l.id), nil
 }
@@ -36,6 +36,18 @@ type ConnHub struct {
 // Registers the new listener in the hub. Panics if the address was already
 // entered or the hub is closed.
 func (h *ConnHub) NewNetListener(addr wire.Address) *Listener {
+	return h.newNetListener(addr, nil)
+}
+
+// NewEncryptedNetListener creates a new test listener for the address of id,
+// whose accepted connections are encrypted, see wirenet.EncryptedConn.
+// Registers the new listener in the hub. Panics if the address was already
+// entered or the hub is closed.
+func (h *ConnHub) NewEncryptedNetListener(id wire.Account) *Listener {
+	return h.newNetListener(id.Address(), id)
+}
+
+func (h *ConnHub) newNetListener(addr wire.Address, id wire.Account) *Listener {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
@@ -44,6 +56,7 @@ func (h *ConnHub) NewNetListener(addr wire.Address) *Listener {
 	}
 
 	listener := NewNetListener()
+	listener.id = id
 	if err := h.insert(addr, listener); err != nil {
 		panic("double registration")
 	}
@@ -58,6 +71,17 @@ func (h *ConnHub) NewNetListener(addr wire.Address) *Listener {
 // NewNetDialer creates a new test dialer.
 // Registers the new dialer in the hub. Panics if the hub is closed.
 func (h *ConnHub) NewNetDialer() *Dialer {
+	return h.newNetDialer(nil)
+}
+
+// NewEncryptedNetDialer creates a new test dialer, whose dialed connections are
+// encrypted, see wirenet.EncryptedConn. It can only dial encrypted listeners.
+// Registers the new dialer in the hub. Panics if the hub is closed.
+func (h *ConnHub) NewEncryptedNetDialer(id wire.Account) *Dialer {
+	return h.newNetDialer(id)
+}
+
+func (h *ConnHub) newNetDialer(id wire.Account) *Dialer {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
@@ -65,7 +89,7 @@ func (h *ConnHub) NewNetDialer() *Dialer {
 		panic("ConnHub already closed")
 	}
 
-	dialer := &Dialer{hub: h}
+	dialer := &Dialer{hub: h, id: id}
 	h.dialers.insert(dialer)
 	dialer.OnClose(func() {
 		h.dialers.erase(dialer) //nolint:errcheck
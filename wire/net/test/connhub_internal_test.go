@@ -24,6 +24,7 @@ import (
 	_ "perun.network/go-perun/backend/sim" // backend init
 	wallettest "perun.network/go-perun/wallet/test"
 	"perun.network/go-perun/wire"
+	wirenet "perun.network/go-perun/wire/net"
 	wiretest "perun.network/go-perun/wire/test"
 	ctxtest "polycry.pt/poly-go/context/test"
 	"polycry.pt/poly-go/sync"
@@ -65,6 +66,38 @@ func TestConnHub_Create(t *testing.T) {
 		ct.Wait("accept", "dial")
 	})
 
+	t.Run("create and dial encrypted", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var c ConnHub
+		did, lid := wallettest.NewRandomAccount(rng), wallettest.NewRandomAccount(rng)
+		d, l := c.NewEncryptedNetDialer(did), c.NewEncryptedNetListener(lid)
+
+		ct := pkgtest.NewConcurrent(t)
+		go ctxtest.AssertTerminates(t, timeout, func() {
+			ct.Stage("accept", func(rt pkgtest.ConcT) {
+				conn, err := l.Accept()
+				assert.NoError(err)
+				require.NotNil(rt, conn)
+				assert.NoError(conn.Send(wiretest.NewRandomEnvelope(rng, wire.NewPingMsg())))
+				assert.True(conn.(*wirenet.EncryptedConn).Peer().Equal(did.Address()))
+			})
+		})
+
+		ctxtest.AssertTerminates(t, timeout, func() {
+			ct.Stage("dial", func(rt pkgtest.ConcT) {
+				conn, err := d.Dial(context.Background(), lid.Address())
+				assert.NoError(err)
+				require.NotNil(rt, conn)
+				m, err := conn.Recv()
+				assert.NoError(err)
+				assert.IsType(wire.NewPingMsg(), m.Msg)
+			})
+		})
+
+		ct.Wait("accept", "dial")
+	})
+
 	t.Run("double create", func(t *testing.T) {
 		assert := assert.New(t)
 
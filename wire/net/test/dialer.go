@@ -30,6 +30,7 @@ import (
 type Dialer struct {
 	hub    *ConnHub
 	dialed int32
+	id     wire.Account // Used for encryption, if set.
 
 	sync.Closer
 }
@@ -54,13 +55,21 @@ func (d *Dialer) Dial(ctx context.Context, address wire.Address) (wirenet.Conn,
 	}
 
 	local, remote := net.Pipe()
-	if !l.Put(ctx, wirenet.NewIoConn(remote)) {
+	if !l.Put(ctx, l.wrap(remote)) {
 		local.Close()
 		remote.Close()
 		return nil, errors.New("Put() failed")
 	}
 	atomic.AddInt32(&d.dialed, 1)
-	return wirenet.NewIoConn(local), nil
+
+	if d.id == nil {
+		return wirenet.NewIoConn(local), nil
+	}
+	conn := wirenet.NewEncryptedConnActive(local, d.id, address)
+	if err := conn.Handshake(ctx); err != nil {
+		return nil, errors.WithMessage(err, "encryption handshake")
+	}
+	return conn, nil
 }
 
 // Close closes a connection.
@@ -16,10 +16,12 @@ package test
 
 import (
 	"context"
+	"net"
 	"sync/atomic"
 
 	"github.com/pkg/errors"
 
+	"perun.network/go-perun/wire"
 	wirenet "perun.network/go-perun/wire/net"
 	"polycry.pt/poly-go/sync"
 )
@@ -35,6 +37,8 @@ type Listener struct {
 	queue chan wirenet.Conn // The connection queue (unbuffered).
 
 	accepted int32 // The number of connections that have been accepted.
+
+	id wire.Account // Used for encryption, if set.
 }
 
 // NewNetListener creates a new test listener.
@@ -86,6 +90,15 @@ func (l *Listener) Put(ctx context.Context, conn wirenet.Conn) bool {
 	}
 }
 
+// wrap creates the listener's side of a connection that is dialed via the
+// ConnHub.
+func (l *Listener) wrap(conn net.Conn) wirenet.Conn {
+	if l.id == nil {
+		return wirenet.NewIoConn(conn)
+	}
+	return wirenet.NewEncryptedConnPassive(conn, l.id)
+}
+
 // NumAccepted returns the number of connections that have been accepted by the
 // listener. Note that this number is updated before Accept() returns, but not
 // necessarily before Put() returns.
@@ -30,6 +30,7 @@ type Relay struct {
 	consumers []subscription
 
 	cache             Cache
+	cacheMtx          stdsync.Mutex   // Protects the cache during concurrent Puts.
 	defaultMsgHandler func(*Envelope) // Handles messages with no subscriber.
 }
 
@@ -169,7 +170,10 @@ func (p *Relay) Put(e *Envelope) {
 	}
 
 	if !any {
-		if !p.cache.Put(e) {
+		p.cacheMtx.Lock()
+		cached := p.cache.Put(e)
+		p.cacheMtx.Unlock()
+		if !cached {
 			p.defaultMsgHandler(e)
 		}
 	}